@@ -79,9 +79,8 @@ func (abi ABI) Pack(name string, args ...interface{}) ([]byte, error) {
 }
 
 // toGoSliceType parses the input and casts it to the proper slice defined by the ABI
-// argument in T.
-func toGoSlice(i int, t Argument, output []byte) (interface{}, error) {
-	index := i * 32
+// argument in T, located at the given byte offset within the head of output.
+func toGoSlice(index int, t Argument, output []byte) (interface{}, error) {
 	// The slice must, at very least be large enough for the index+32 which is exactly the size required
 	// for the [offset in output, size of offset].
 	if index+32 > len(output) {
@@ -219,14 +218,13 @@ func allZero(b []byte) bool {
 }
 
 // toGoType parses the input and casts it to the proper type defined by the ABI
-// argument in T.
-func toGoType(i int, t Argument, output []byte) (interface{}, error) {
+// argument in T, located at the given byte offset within the head of output.
+func toGoType(index int, t Argument, output []byte) (interface{}, error) {
 	// we need to treat slices differently
 	if (t.Type.IsSlice || t.Type.IsArray) && t.Type.T != BytesTy && t.Type.T != StringTy && t.Type.T != FixedBytesTy && t.Type.T != FunctionTy {
-		return toGoSlice(i, t, output)
+		return toGoSlice(index, t, output)
 	}
 
-	index := i * 32
 	if index+32 > len(output) {
 		return nil, fmt.Errorf("abi: cannot marshal in to go type: length insufficient %d require %d", len(output), index+32)
 	}
@@ -280,9 +278,16 @@ var (
 	r_byte       = reflect.TypeOf(byte(0))
 )
 
-// Unpack output in v according to the abi specification
+// Unpack output in v according to the abi specification. The name may refer to
+// either a method, in which case output holds its return values, or an event, in
+// which case output holds the non-indexed fields of a log's data.
 func (abi ABI) Unpack(v interface{}, name string, output []byte) error {
-	var method = abi.Methods[name]
+	method, ok := abi.Methods[name]
+	if !ok {
+		if event, ok := abi.Events[name]; ok {
+			return event.unpack(v, output)
+		}
+	}
 
 	if len(output) == 0 {
 		return fmt.Errorf("abi: unmarshalling empty output")
@@ -295,8 +300,9 @@ func (abi ABI) Unpack(v interface{}, name string, output []byte) error {
 	}
 
 	var (
-		value = valueOf.Elem()
-		typ   = value.Type()
+		value   = valueOf.Elem()
+		typ     = value.Type()
+		offsets = headOffsets(method.Outputs)
 	)
 
 	if len(method.Outputs) > 1 {
@@ -305,7 +311,7 @@ func (abi ABI) Unpack(v interface{}, name string, output []byte) error {
 		// names
 		case reflect.Struct:
 			for i := 0; i < len(method.Outputs); i++ {
-				marshalledValue, err := toGoType(i, method.Outputs[i], output)
+				marshalledValue, err := unpackArg(offsets[i], method.Outputs[i], output)
 				if err != nil {
 					return err
 				}
@@ -333,7 +339,7 @@ func (abi ABI) Unpack(v interface{}, name string, output []byte) error {
 				}
 
 				for i := 0; i < len(method.Outputs); i++ {
-					marshalledValue, err := toGoType(i, method.Outputs[i], output)
+					marshalledValue, err := unpackArg(offsets[i], method.Outputs[i], output)
 					if err != nil {
 						return err
 					}
@@ -349,7 +355,7 @@ func (abi ABI) Unpack(v interface{}, name string, output []byte) error {
 			// values to the new interface slice.
 			z := reflect.MakeSlice(typ, 0, len(method.Outputs))
 			for i := 0; i < len(method.Outputs); i++ {
-				marshalledValue, err := toGoType(i, method.Outputs[i], output)
+				marshalledValue, err := unpackArg(offsets[i], method.Outputs[i], output)
 				if err != nil {
 					return err
 				}
@@ -361,7 +367,7 @@ func (abi ABI) Unpack(v interface{}, name string, output []byte) error {
 		}
 
 	} else {
-		marshalledValue, err := toGoType(0, method.Outputs[0], output)
+		marshalledValue, err := unpackArg(0, method.Outputs[0], output)
 		if err != nil {
 			return err
 		}
@@ -29,18 +29,24 @@ type Argument struct {
 	Indexed bool // indexed is only used by events
 }
 
+// argumentMarshaling is the JSON representation of an argument. Tuples list
+// their component arguments recursively.
+type argumentMarshaling struct {
+	Name         string
+	Type         string
+	InternalType string
+	Components   []argumentMarshaling
+	Indexed      bool
+}
+
 func (a *Argument) UnmarshalJSON(data []byte) error {
-	var extarg struct {
-		Name    string
-		Type    string
-		Indexed bool
-	}
+	var extarg argumentMarshaling
 	err := json.Unmarshal(data, &extarg)
 	if err != nil {
 		return fmt.Errorf("argument json err: %v", err)
 	}
 
-	a.Type, err = NewType(extarg.Type)
+	a.Type, err = newType(extarg.Type, extarg.InternalType, extarg.Components)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,191 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backends
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"golang.org/x/net/context"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr    = crypto.PubkeyToAddress(testKey.PublicKey)
+	testBalance = big.NewInt(1000000000000000000)
+)
+
+// newTestBackend creates a simulated backend funding the test account.
+func newTestBackend() *SimulatedBackend {
+	return NewSimulatedBackend(core.GenesisAccount{Address: testAddr, Balance: testBalance})
+}
+
+// sendTransfer signs and sends a value transfer from the test account.
+func sendTransfer(t *testing.T, sim *SimulatedBackend, signer types.Signer, amount int64) *types.Transaction {
+	nonce, err := sim.PendingNonceAt(context.Background(), testAddr)
+	if err != nil {
+		t.Fatalf("failed to retrieve pending nonce: %v", err)
+	}
+	tx := types.NewTransaction(nonce, common.Address{0xaa}, big.NewInt(amount), big.NewInt(21000), big.NewInt(1), nil)
+	if tx, err = types.SignTx(tx, signer, testKey); err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if err := sim.SendTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	return tx
+}
+
+// Tests that transactions can be looked up both while pending and once mined,
+// along with the blocks and headers containing them.
+func TestSimulatedLookups(t *testing.T) {
+	sim := newTestBackend()
+	ctx := context.Background()
+
+	tx := sendTransfer(t, sim, types.HomesteadSigner{}, 1)
+	if _, pending, err := sim.TransactionByHash(ctx, tx.Hash()); err != nil || !pending {
+		t.Fatalf("pending transaction lookup mismatch: pending %v, err %v", pending, err)
+	}
+	sim.Commit()
+
+	if _, pending, err := sim.TransactionByHash(ctx, tx.Hash()); err != nil || pending {
+		t.Fatalf("mined transaction lookup mismatch: pending %v, err %v", pending, err)
+	}
+	if _, _, err := sim.TransactionByHash(ctx, common.Hash{0x01}); err != ethereum.NotFound {
+		t.Fatalf("missing transaction error mismatch: have %v, want %v", err, ethereum.NotFound)
+	}
+	if receipt, _ := sim.TransactionReceipt(ctx, tx.Hash()); receipt == nil || receipt.TxHash != tx.Hash() {
+		t.Fatalf("receipt mismatch: %v", receipt)
+	}
+	block, err := sim.BlockByNumber(ctx, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("failed to retrieve block: %v", err)
+	}
+	if head, _ := sim.BlockByNumber(ctx, nil); head.Hash() != block.Hash() {
+		t.Fatalf("head block mismatch: have %x, want %x", head.Hash(), block.Hash())
+	}
+	if header, err := sim.HeaderByHash(ctx, block.Hash()); err != nil || header.Number.Uint64() != 1 {
+		t.Fatalf("header lookup mismatch: %v, err %v", header, err)
+	}
+	if count, err := sim.TransactionCount(ctx, block.Hash()); err != nil || count != 1 {
+		t.Fatalf("transaction count mismatch: have %d, want 1, err %v", count, err)
+	}
+	if have, err := sim.TransactionInBlock(ctx, block.Hash(), 0); err != nil || have.Hash() != tx.Hash() {
+		t.Fatalf("transaction in block mismatch: err %v", err)
+	}
+	if _, err := sim.BlockByNumber(ctx, big.NewInt(2)); err != errBlockDoesNotExist {
+		t.Fatalf("missing block error mismatch: have %v, want %v", err, errBlockDoesNotExist)
+	}
+	// Historical state should be accessible too
+	if balance, err := sim.BalanceAt(ctx, testAddr, big.NewInt(0)); err != nil || balance.Cmp(testBalance) != 0 {
+		t.Fatalf("genesis balance mismatch: have %v, want %v, err %v", balance, testBalance, err)
+	}
+}
+
+// Tests that the time of the pending block can be shifted.
+func TestSimulatedAdjustTime(t *testing.T) {
+	sim := newTestBackend()
+	ctx := context.Background()
+
+	parent, _ := sim.HeaderByNumber(ctx, nil)
+	if err := sim.AdjustTime(100 * time.Second); err != nil {
+		t.Fatalf("failed to adjust time: %v", err)
+	}
+	sendTransfer(t, sim, types.HomesteadSigner{}, 1)
+	sim.Commit()
+
+	head, _ := sim.HeaderByNumber(ctx, nil)
+	if diff := new(big.Int).Sub(head.Time, parent.Time).Int64(); diff != 110 {
+		t.Fatalf("block time difference mismatch: have %d, want %d", diff, 110)
+	}
+	if err := sim.AdjustTime(-10 * time.Second); err != errBlockTimeOutOfRange {
+		t.Fatalf("out of range adjustment error mismatch: have %v, want %v", err, errBlockTimeOutOfRange)
+	}
+}
+
+// Tests that forking off an old block and growing the side chain results in a
+// reorg, with the new heads announced to subscribers.
+func TestSimulatedFork(t *testing.T) {
+	sim := newTestBackend()
+	ctx := context.Background()
+
+	heads := make(chan *types.Header, 8)
+	sub, err := sim.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		t.Fatalf("failed to subscribe to new heads: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	sim.Commit()
+	fork, _ := sim.HeaderByNumber(ctx, nil)
+	sim.Commit()
+	orphan, _ := sim.HeaderByNumber(ctx, nil)
+
+	if err := sim.Fork(ctx, common.Hash{0x01}); err != errParentDoesNotExist {
+		t.Fatalf("missing parent error mismatch: have %v, want %v", err, errParentDoesNotExist)
+	}
+	if err := sim.Fork(ctx, fork.Hash()); err != nil {
+		t.Fatalf("failed to fork: %v", err)
+	}
+	tx := sendTransfer(t, sim, types.HomesteadSigner{}, 1)
+	if err := sim.Fork(ctx, fork.Hash()); err != errPendingBlockDirty {
+		t.Fatalf("dirty fork error mismatch: have %v, want %v", err, errPendingBlockDirty)
+	}
+	sim.Commit()
+	sim.Commit()
+
+	head, _ := sim.HeaderByNumber(ctx, nil)
+	if head.Number.Uint64() != 3 {
+		t.Fatalf("head number mismatch: have %d, want %d", head.Number, 3)
+	}
+	if header, _ := sim.HeaderByNumber(ctx, orphan.Number); header.Hash() == orphan.Hash() {
+		t.Fatalf("orphaned block still canonical")
+	}
+	if _, pending, err := sim.TransactionByHash(ctx, tx.Hash()); err != nil || pending {
+		t.Fatalf("forked transaction lookup mismatch: pending %v, err %v", pending, err)
+	}
+	for i := 0; ; i++ {
+		select {
+		case header := <-heads:
+			if header.Hash() == head.Hash() {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("new head not announced after %d headers", i)
+		}
+	}
+}
+
+// Tests that the simulated chain follows the rules of the configured chain.
+func TestSimulatedChainConfig(t *testing.T) {
+	config := &params.ChainConfig{ChainId: big.NewInt(1337), HomesteadBlock: new(big.Int), EIP150Block: new(big.Int), EIP155Block: new(big.Int), EIP158Block: new(big.Int)}
+	sim := NewSimulatedBackendWithConfig(config, core.GenesisAccount{Address: testAddr, Balance: testBalance})
+
+	tx := sendTransfer(t, sim, types.NewEIP155Signer(config.ChainId), 1)
+	sim.Commit()
+
+	if receipt, _ := sim.TransactionReceipt(context.Background(), tx.Hash()); receipt == nil {
+		t.Fatalf("replay protected transaction not mined")
+	}
+}
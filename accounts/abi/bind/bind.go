@@ -24,6 +24,7 @@ import (
 	"bytes"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"unicode"
@@ -47,7 +48,10 @@ const (
 // manually maintain hard coded strings that break on runtime.
 func Bind(types []string, abis []string, bytecodes []string, pkg string, lang Lang) (string, error) {
 	// Process each individual contract requested binding
-	contracts := make(map[string]*tmplContract)
+	var (
+		contracts = make(map[string]*tmplContract)
+		structs   = make(map[string]*tmplStruct)
+	)
 
 	for i := 0; i < len(types); i++ {
 		// Parse the actual ABI to generate the binding for
@@ -63,6 +67,10 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 			return r
 		}, abis[i])
 
+		// Bind any tuples used by the contract to Go structs before the methods
+		if err := bindStructs(evmABI, structs, lang); err != nil {
+			return "", err
+		}
 		// Extract the call and transact methods, and sort them alphabetically
 		var (
 			calls     = make(map[string]*tmplMethod)
@@ -94,6 +102,26 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 				transacts[original.Name] = &tmplMethod{Original: original, Normalized: normalized, Structured: structured(original)}
 			}
 		}
+		events := make(map[string]*tmplEvent)
+		for _, original := range evmABI.Events {
+			// Skip anonymous events as they don't support explicit filtering
+			if original.Anonymous {
+				continue
+			}
+			// Normalize the event for capital cases and non-anonymous outputs
+			normalized := original
+			normalized.Name = methodNormalizer[lang](original.Name)
+
+			normalized.Inputs = make([]abi.Argument, len(original.Inputs))
+			copy(normalized.Inputs, original.Inputs)
+			for j, input := range normalized.Inputs {
+				if input.Name == "" {
+					normalized.Inputs[j].Name = fmt.Sprintf("arg%d", j)
+				}
+			}
+			// Append the event to the accumulator list
+			events[original.Name] = &tmplEvent{Original: original, Normalized: normalized}
+		}
 		contracts[types[i]] = &tmplContract{
 			Type:        capitalise(types[i]),
 			InputABI:    strings.Replace(strippedABI, "\"", "\\\"", -1),
@@ -101,20 +129,24 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 			Constructor: evmABI.Constructor,
 			Calls:       calls,
 			Transacts:   transacts,
+			Events:      events,
 		}
 	}
 	// Generate the contract template data content and render it
 	data := &tmplData{
 		Package:   pkg,
 		Contracts: contracts,
+		Structs:   structs,
 	}
 	buffer := new(bytes.Buffer)
 
 	funcs := map[string]interface{}{
-		"bindtype":     bindType[lang],
-		"namedtype":    namedType[lang],
-		"capitalise":   capitalise,
-		"decapitalise": decapitalise,
+		"bindtype":      func(kind abi.Type) string { return bindType[lang](kind, structs) },
+		"bindtopictype": func(kind abi.Type) string { return bindTopicType[lang](kind, structs) },
+		"namedtype":     namedType[lang],
+		"capitalise":    capitalise,
+		"fieldname":     func(name string) string { return abi.FieldName(name, 0) },
+		"decapitalise":  decapitalise,
 	}
 	tmpl := template.Must(template.New("").Funcs(funcs).Parse(tmplSource[lang]))
 	if err := tmpl.Execute(buffer, data); err != nil {
@@ -134,15 +166,26 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 
 // bindType is a set of type binders that convert Solidity types to some supported
 // programming language.
-var bindType = map[Lang]func(kind abi.Type) string{
+var bindType = map[Lang]func(kind abi.Type, structs map[string]*tmplStruct) string{
 	LangGo:   bindTypeGo,
 	LangJava: bindTypeJava,
 }
 
 // bindTypeGo converts a Solidity type to a Go one. Since there is no clear mapping
 // from all Solidity types to Go ones (e.g. uint17), those that cannot be exactly
-// mapped will use an upscaled type (e.g. *big.Int).
-func bindTypeGo(kind abi.Type) string {
+// mapped will use an upscaled type (e.g. *big.Int). Tuples are bound to the Go
+// structs registered for them.
+func bindTypeGo(kind abi.Type, structs map[string]*tmplStruct) string {
+	// Arrays and slices are bound element by element to support nesting
+	if (kind.IsSlice || kind.IsArray) && kind.T != abi.BytesTy && kind.T != abi.FixedBytesTy && kind.T != abi.FunctionTy {
+		if kind.IsSlice {
+			return "[]" + bindTypeGo(*kind.Elem, structs)
+		}
+		return fmt.Sprintf("[%d]", kind.SliceSize) + bindTypeGo(*kind.Elem, structs)
+	}
+	if kind.T == abi.TupleTy {
+		return bindStructTypeGo(kind, structs)
+	}
 	stringKind := kind.String()
 
 	switch {
@@ -183,10 +226,37 @@ func bindTypeGo(kind abi.Type) string {
 	}
 }
 
+// bindTopicType is a set of type binders that convert Solidity types to some
+// supported programming language topic types.
+var bindTopicType = map[Lang]func(kind abi.Type, structs map[string]*tmplStruct) string{
+	LangGo:   bindTopicTypeGo,
+	LangJava: bindTopicTypeJava,
+}
+
+// bindTopicTypeGo converts a Solidity topic type to a Go one. It is almost the
+// same functionality as for simple types, but dynamic types get converted to
+// hashes.
+func bindTopicTypeGo(kind abi.Type, structs map[string]*tmplStruct) string {
+	if hashedTopic(kind) {
+		return "common.Hash"
+	}
+	return bindTypeGo(kind, structs)
+}
+
+// bindTopicTypeJava converts a Solidity topic type to a Java one. It is almost
+// the same functionality as for simple types, but dynamic types get converted
+// to hashes.
+func bindTopicTypeJava(kind abi.Type, structs map[string]*tmplStruct) string {
+	if hashedTopic(kind) {
+		return "Hash"
+	}
+	return bindTypeJava(kind, structs)
+}
+
 // bindTypeJava converts a Solidity type to a Java one. Since there is no clear mapping
 // from all Solidity types to Java ones (e.g. uint17), those that cannot be exactly
-// mapped will use an upscaled type (e.g. BigDecimal).
-func bindTypeJava(kind abi.Type) string {
+// mapped will use an upscaled type (e.g. BigDecimal). Tuples are not supported.
+func bindTypeJava(kind abi.Type, structs map[string]*tmplStruct) string {
 	stringKind := kind.String()
 
 	switch {
@@ -254,6 +324,76 @@ func bindTypeJava(kind abi.Type) string {
 	}
 }
 
+// bindStructs registers the Go structs of all the tuples used by a contract. The
+// arguments are visited in a fixed order to keep the generated names stable.
+func bindStructs(evmABI abi.ABI, structs map[string]*tmplStruct, lang Lang) error {
+	args := evmABI.Constructor.Inputs
+
+	methods := make([]string, 0, len(evmABI.Methods))
+	for name := range evmABI.Methods {
+		methods = append(methods, name)
+	}
+	sort.Strings(methods)
+	for _, name := range methods {
+		args = append(args, evmABI.Methods[name].Inputs...)
+		args = append(args, evmABI.Methods[name].Outputs...)
+	}
+	events := make([]string, 0, len(evmABI.Events))
+	for name := range evmABI.Events {
+		events = append(events, name)
+	}
+	sort.Strings(events)
+	for _, name := range events {
+		args = append(args, evmABI.Events[name].Inputs...)
+	}
+	for _, arg := range args {
+		if !hasTuple(arg.Type) {
+			continue
+		}
+		if lang != LangGo {
+			return fmt.Errorf("tuple argument %q not supported in this binding language", arg.Name)
+		}
+		bindTypeGo(arg.Type, structs)
+	}
+	return nil
+}
+
+// hasTuple returns whether a type is or contains a tuple.
+func hasTuple(kind abi.Type) bool {
+	if kind.T == abi.TupleTy {
+		return true
+	}
+	return kind.Elem != nil && hasTuple(*kind.Elem)
+}
+
+// bindStructTypeGo binds a tuple to a Go struct, registering it on first use,
+// and returns the name of the struct. Tuples are named after their Solidity
+// struct if known, or numbered otherwise.
+func bindStructTypeGo(kind abi.Type, structs map[string]*tmplStruct) string {
+	key := kind.TupleRawName + kind.String() + strings.Join(kind.TupleRawNames, ",")
+	if s, ok := structs[key]; ok {
+		return s.Name
+	}
+	fields := make([]*tmplField, len(kind.TupleElems))
+	for i, elem := range kind.TupleElems {
+		fields[i] = &tmplField{
+			Type:    bindTypeGo(*elem, structs),
+			Name:    abi.FieldName(kind.TupleRawNames[i], i),
+			SolKind: *elem,
+		}
+	}
+	taken := make(map[string]bool)
+	for _, s := range structs {
+		taken[s.Name] = true
+	}
+	name := kind.TupleRawName
+	for i := len(structs); name == "" || taken[name]; i++ {
+		name = fmt.Sprintf("Struct%d", i)
+	}
+	structs[key] = &tmplStruct{Name: name, Fields: fields}
+	return name
+}
+
 // namedType is a set of functions that transform language specific types to
 // named versions that my be used inside method names.
 var namedType = map[Lang]func(string, abi.Type) string{
@@ -53,6 +53,9 @@ var bindTests = []struct {
 			if b, err := NewEmptyTransactor(common.Address{}, nil); b == nil || err != nil {
 				t.Fatalf("transactor binding (%v) nil or error (%v) not nil", b, nil)
 			}
+			if b, err := NewEmptyFilterer(common.Address{}, nil); b == nil || err != nil {
+				t.Fatalf("filterer binding (%v) nil or error (%v) not nil", b, nil)
+			}
 		`,
 	},
 	// Test that all the official sample contracts bind correctly
@@ -408,6 +411,221 @@ var bindTests = []struct {
 			}
 		`,
 	},
+	// Test that events can be filtered from past blocks and watched on new ones
+	{
+		`Eventer`,
+		`
+			contract Eventer {
+				event Transfer(address indexed from, uint indexed id, string memo, uint value);
+
+				function raise() {
+					Transfer(msg.sender, 1, "hi", 42);
+				}
+			}
+		`,
+		`605d80600b6000396000f36040600052602a60205260026040527f68690000000000000000000000000000000000000000000000000000000000006060526001337fe267af17a55d7738dec169a3e38ec1ea614058c94b1c29d2693dd0fab0ee11c760806000a300`,
+		`[{"constant":false,"inputs":[],"name":"raise","outputs":[],"type":"function"},{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"id","type":"uint256"},{"indexed":false,"name":"memo","type":"string"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"}]`,
+		`
+			// Generate a new random account and a funded simulator
+			key, _ := crypto.GenerateKey()
+			auth := bind.NewKeyedTransactor(key)
+			sim := backends.NewSimulatedBackend(core.GenesisAccount{Address: auth.From, Balance: big.NewInt(10000000000)})
+
+			// Deploy an eventer contract
+			_, _, eventer, err := DeployEventer(auth, sim)
+			if err != nil {
+				t.Fatalf("Failed to deploy eventer contract: %v", err)
+			}
+			sim.Commit()
+
+			// Start watching for new events before raising any
+			sink := make(chan *EventerTransfer, 1)
+			sub, err := eventer.WatchTransfer(nil, sink, []common.Address{auth.From}, nil)
+			if err != nil {
+				t.Fatalf("Failed to watch transfer events: %v", err)
+			}
+			defer sub.Unsubscribe()
+
+			// Raise an event and ensure it can be filtered and watched
+			if _, err := eventer.Raise(auth); err != nil {
+				t.Fatalf("Failed to raise transfer event: %v", err)
+			}
+			sim.Commit()
+
+			check := func(event *EventerTransfer) {
+				if event.From != auth.From {
+					t.Errorf("From mismatch: have %x, want %x", event.From, auth.From)
+				}
+				if event.Id.Cmp(big.NewInt(1)) != 0 {
+					t.Errorf("Id mismatch: have %v, want %v", event.Id, 1)
+				}
+				if event.Memo != "hi" {
+					t.Errorf("Memo mismatch: have %q, want %q", event.Memo, "hi")
+				}
+				if event.Value.Cmp(big.NewInt(42)) != 0 {
+					t.Errorf("Value mismatch: have %v, want %v", event.Value, 42)
+				}
+			}
+			it, err := eventer.FilterTransfer(nil, []common.Address{auth.From}, []*big.Int{big.NewInt(1)})
+			if err != nil {
+				t.Fatalf("Failed to filter transfer events: %v", err)
+			}
+			defer it.Close()
+
+			events := 0
+			for it.Next() {
+				check(it.Event)
+				events++
+			}
+			if err := it.Error(); err != nil {
+				t.Fatalf("Failed to iterate transfer events: %v", err)
+			}
+			if events != 1 {
+				t.Fatalf("Filtered event count mismatch: have %d, want %d", events, 1)
+			}
+			// Filters not matching the indexed arguments must not return the event
+			if it, err := eventer.FilterTransfer(nil, []common.Address{common.HexToAddress("0x01")}, nil); err != nil {
+				t.Fatalf("Failed to filter transfer events: %v", err)
+			} else if it.Next() {
+				t.Fatalf("Mismatching filter returned event: %v", it.Event)
+			}
+			select {
+			case event := <-sink:
+				check(event)
+			case err := <-sub.Err():
+				t.Fatalf("Transfer subscription failed: %v", err)
+			case <-time.After(time.Second):
+				t.Fatalf("Transfer event not delivered")
+			}
+		`,
+	},
+	// Test that underscore prefixed event arguments are bound to exported fields
+	{
+		`Underscorer`,
+		`
+			contract Underscorer {
+				event Transfer(address indexed _from, address indexed _to, uint[2] _pair, uint _value);
+
+				function raise() {
+					Transfer(msg.sender, 0x02, [uint(1), 2], 42);
+				}
+			}
+		`,
+		`603980600b6000396000f360016000526002602052602a6040526002337f61562b1811602e4a2889adb9b1f227c4cf39a8253ed791cab390743a213c046160606000a300`,
+		`[{"constant":false,"inputs":[],"name":"raise","outputs":[],"type":"function"},{"anonymous":false,"inputs":[{"indexed":true,"name":"_from","type":"address"},{"indexed":true,"name":"_to","type":"address"},{"indexed":false,"name":"_pair","type":"uint256[2]"},{"indexed":false,"name":"_value","type":"uint256"}],"name":"Transfer","type":"event"}]`,
+		`
+			// Generate a new random account and a funded simulator
+			key, _ := crypto.GenerateKey()
+			auth := bind.NewKeyedTransactor(key)
+			sim := backends.NewSimulatedBackend(core.GenesisAccount{Address: auth.From, Balance: big.NewInt(10000000000)})
+
+			// Deploy an underscorer contract
+			_, _, underscorer, err := DeployUnderscorer(auth, sim)
+			if err != nil {
+				t.Fatalf("Failed to deploy underscorer contract: %v", err)
+			}
+			sim.Commit()
+
+			// Start watching for new events before raising any
+			sink := make(chan *UnderscorerTransfer, 1)
+			sub, err := underscorer.WatchTransfer(nil, sink, []common.Address{auth.From}, nil)
+			if err != nil {
+				t.Fatalf("Failed to watch transfer events: %v", err)
+			}
+			defer sub.Unsubscribe()
+
+			// Raise an event and ensure it can be filtered and watched
+			if _, err := underscorer.Raise(auth); err != nil {
+				t.Fatalf("Failed to raise transfer event: %v", err)
+			}
+			sim.Commit()
+
+			check := func(event *UnderscorerTransfer) {
+				if event.From != auth.From {
+					t.Errorf("From mismatch: have %x, want %x", event.From, auth.From)
+				}
+				if event.To != common.HexToAddress("0x02") {
+					t.Errorf("To mismatch: have %x, want %x", event.To, common.HexToAddress("0x02"))
+				}
+				if event.Pair[0].Cmp(big.NewInt(1)) != 0 || event.Pair[1].Cmp(big.NewInt(2)) != 0 {
+					t.Errorf("Pair mismatch: have %v, want %v", event.Pair, []int{1, 2})
+				}
+				if event.Value.Cmp(big.NewInt(42)) != 0 {
+					t.Errorf("Value mismatch: have %v, want %v", event.Value, 42)
+				}
+			}
+			it, err := underscorer.FilterTransfer(nil, []common.Address{auth.From}, []common.Address{common.HexToAddress("0x02")})
+			if err != nil {
+				t.Fatalf("Failed to filter transfer events: %v", err)
+			}
+			defer it.Close()
+
+			events := 0
+			for it.Next() {
+				check(it.Event)
+				events++
+			}
+			if err := it.Error(); err != nil {
+				t.Fatalf("Failed to iterate transfer events: %v", err)
+			}
+			if events != 1 {
+				t.Fatalf("Filtered event count mismatch: have %d, want %d", events, 1)
+			}
+			select {
+			case event := <-sink:
+				check(event)
+			case err := <-sub.Err():
+				t.Fatalf("Transfer subscription failed: %v", err)
+			case <-time.After(time.Second):
+				t.Fatalf("Transfer event not delivered")
+			}
+		`,
+	},
+	// Test that tuples are bound to Go structs, named ones after their Solidity struct
+	{
+		`StructChecker`, ``, ``,
+		`
+			[
+				{"type":"function","name":"point","constant":true,"inputs":[],"outputs":[{"name":"","type":"tuple","internalType":"struct Geo.Point","components":[{"name":"x","type":"int256"},{"name":"y","type":"int256"}]}]},
+				{"type":"function","name":"submit","constant":false,"inputs":[{"name":"_order","type":"tuple","components":[{"name":"id","type":"uint64"},{"name":"_path","type":"tuple[]","internalType":"struct Geo.Point[]","components":[{"name":"x","type":"int256"},{"name":"y","type":"int256"}]},{"name":"tags","type":"string[]"}]},{"name":"grid","type":"uint8[][]"}],"outputs":[]},
+				{"type":"event","name":"Submitted","inputs":[{"name":"_sender","type":"address","indexed":true},{"name":"_order","type":"tuple","indexed":true,"components":[{"name":"id","type":"uint64"}]},{"name":"_count","type":"uint256","indexed":false}]}
+			]
+		`,
+		`if b, err := NewStructChecker(common.Address{}, nil); b == nil || err != nil {
+			 t.Fatalf("binding (%v) nil or error (%v) not nil", b, nil)
+		 } else if false { // Don't run, just compile and test types
+			 var point GeoPoint
+			 var event StructCheckerSubmitted
+
+			 point, err = b.Point(nil)
+			 _, err = b.Submit(nil, Struct1{Id: 1, Path: []GeoPoint{point}, Tags: []string{""}}, [][]uint8{{1}})
+			 event.Sender, event.Order, event.Count = common.Address{}, common.Hash{}, big.NewInt(0)
+
+			 fmt.Println(err)
+		 }
+		 parsed, err := abi.JSON(strings.NewReader(StructCheckerABI))
+		 if err != nil {
+			 t.Fatalf("failed to parse binding ABI: %v", err)
+		 }
+		 order := Struct1{
+			 Id:   42,
+			 Path: []GeoPoint{{X: big.NewInt(1), Y: big.NewInt(-2)}, {X: big.NewInt(3), Y: big.NewInt(4)}},
+			 Tags: []string{"north", "east"},
+		 }
+		 if _, err := parsed.Pack("submit", order, [][]uint8{{1, 2}, {3}}); err != nil {
+			 t.Fatalf("failed to pack struct input: %v", err)
+		 }
+		 var point GeoPoint
+		 output := common.Hex2Bytes("0000000000000000000000000000000000000000000000000000000000000005" +
+			 "fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffa")
+		 if err := parsed.Unpack(&point, "point", output); err != nil {
+			 t.Fatalf("failed to unpack struct output: %v", err)
+		 }
+		 if point.X.Int64() != 5 || point.Y.Int64() != -6 {
+			 t.Fatalf("struct output mismatch: have (%v, %v), want (5, -6)", point.X, point.Y)
+		 }
+		`,
+	},
 }
 
 // Tests that packages generated by the binder can be successfully compiled and
@@ -0,0 +1,171 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// makeTopics converts a filter query argument list into a filter topic set.
+func makeTopics(query ...[]interface{}) ([][]common.Hash, error) {
+	topics := make([][]common.Hash, len(query))
+	for i, filter := range query {
+		for _, rule := range filter {
+			var topic common.Hash
+
+			// Try to generate the topic based on simple types
+			switch rule := rule.(type) {
+			case common.Hash:
+				copy(topic[:], rule[:])
+			case common.Address:
+				copy(topic[common.HashLength-common.AddressLength:], rule[:])
+			case *big.Int:
+				topic = common.BigToHash(math.U256(new(big.Int).Set(rule)))
+			case bool:
+				if rule {
+					topic[common.HashLength-1] = 1
+				}
+			case int8:
+				topic = common.BigToHash(math.U256(big.NewInt(int64(rule))))
+			case int16:
+				topic = common.BigToHash(math.U256(big.NewInt(int64(rule))))
+			case int32:
+				topic = common.BigToHash(math.U256(big.NewInt(int64(rule))))
+			case int64:
+				topic = common.BigToHash(math.U256(big.NewInt(rule)))
+			case uint8:
+				topic = common.BigToHash(new(big.Int).SetUint64(uint64(rule)))
+			case uint16:
+				topic = common.BigToHash(new(big.Int).SetUint64(uint64(rule)))
+			case uint32:
+				topic = common.BigToHash(new(big.Int).SetUint64(uint64(rule)))
+			case uint64:
+				topic = common.BigToHash(new(big.Int).SetUint64(rule))
+			case string:
+				topic = crypto.Keccak256Hash([]byte(rule))
+			case []byte:
+				topic = crypto.Keccak256Hash(rule)
+
+			default:
+				// Attempt to generate the topic from fixed size byte arrays
+				val := reflect.ValueOf(rule)
+				if val.Kind() != reflect.Array || val.Type().Elem().Kind() != reflect.Uint8 || val.Len() > common.HashLength {
+					return nil, fmt.Errorf("unsupported indexed type: %T", rule)
+				}
+				reflect.Copy(reflect.ValueOf(topic[:val.Len()]), val)
+			}
+			topics[i] = append(topics[i], topic)
+		}
+	}
+	return topics, nil
+}
+
+// hashedTopic reports whether an indexed argument of the given type is stored
+// in the log topics as the Keccak256 hash of its value instead of the value.
+func hashedTopic(kind abi.Type) bool {
+	switch {
+	case kind.T == abi.StringTy || kind.T == abi.BytesTy || kind.T == abi.TupleTy:
+		return true
+	case kind.T == abi.FixedBytesTy || kind.T == abi.FunctionTy:
+		return false
+	default:
+		return kind.IsSlice || kind.IsArray
+	}
+}
+
+// parseTopics converts the indexed topic fields of an event log into the fields
+// of the struct pointed to by out. Arguments stored as hashes in the topics are
+// set into common.Hash fields.
+func parseTopics(out interface{}, event abi.Event, topics []common.Hash) error {
+	value := reflect.ValueOf(out)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot parse topics into %T (struct pointer required)", out)
+	}
+	value = value.Elem()
+
+	for i, arg := range event.Inputs {
+		if !arg.Indexed {
+			continue
+		}
+		if len(topics) == 0 {
+			return errors.New("topic/field count mismatch")
+		}
+		topic := topics[0]
+		topics = topics[1:]
+
+		name := abi.FieldName(arg.Name, i)
+		field := value.FieldByName(name)
+		if !field.IsValid() || !field.CanSet() {
+			return fmt.Errorf("field %s missing in %T", name, out)
+		}
+		if hashedTopic(arg.Type) {
+			if field.Type() != reflect.TypeOf(common.Hash{}) {
+				return fmt.Errorf("field %s of %T must be a common.Hash", name, out)
+			}
+			field.Set(reflect.ValueOf(topic))
+			continue
+		}
+		switch arg.Type.T {
+		case abi.BoolTy:
+			field.SetBool(topic[common.HashLength-1] == 1)
+
+		case abi.IntTy, abi.UintTy:
+			num := new(big.Int).SetBytes(topic[:])
+			if arg.Type.T == abi.IntTy {
+				num = math.S256(num)
+			}
+			switch field.Kind() {
+			case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				field.SetInt(num.Int64())
+			case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				field.SetUint(num.Uint64())
+			default:
+				if field.Type() != reflect.TypeOf(num) {
+					return fmt.Errorf("field %s of %T has unsupported type %v", name, out, field.Type())
+				}
+				field.Set(reflect.ValueOf(num))
+			}
+
+		case abi.AddressTy:
+			field.Set(reflect.ValueOf(common.BytesToAddress(topic[common.HashLength-common.AddressLength:])))
+
+		case abi.HashTy:
+			field.Set(reflect.ValueOf(topic))
+
+		case abi.FixedBytesTy, abi.FunctionTy:
+			if field.Kind() != reflect.Array || field.Type().Elem().Kind() != reflect.Uint8 || field.Len() > common.HashLength {
+				return fmt.Errorf("field %s of %T has unsupported type %v", name, out, field.Type())
+			}
+			reflect.Copy(field, reflect.ValueOf(topic[:field.Len()]))
+
+		default:
+			return fmt.Errorf("unsupported indexed type: %v", arg.Type)
+		}
+	}
+	if len(topics) != 0 {
+		return errors.New("topic/field count mismatch")
+	}
+	return nil
+}
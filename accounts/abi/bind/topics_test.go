@@ -0,0 +1,96 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that typed filter rules are converted into the expected topics.
+func TestMakeTopics(t *testing.T) {
+	addr := common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+
+	topics, err := makeTopics(
+		[]interface{}{addr},
+		[]interface{}{big.NewInt(1), int8(-1)},
+		nil,
+		[]interface{}{"hi", [4]byte{1, 2, 3, 4}, true},
+	)
+	if err != nil {
+		t.Fatalf("failed to make topics: %v", err)
+	}
+	want := [][]common.Hash{
+		{common.BytesToHash(addr[:])},
+		{common.BigToHash(big.NewInt(1)), common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")},
+		nil,
+		{crypto.Keccak256Hash([]byte("hi")), common.HexToHash("0x0102030400000000000000000000000000000000000000000000000000000000"), common.BigToHash(big.NewInt(1))},
+	}
+	if !reflect.DeepEqual(topics, want) {
+		t.Errorf("topics mismatch:\nhave %x\nwant %x", topics, want)
+	}
+	if _, err := makeTopics([]interface{}{struct{}{}}); err == nil {
+		t.Errorf("unsupported rule type accepted")
+	}
+}
+
+// Tests that indexed event arguments are parsed back from the log topics.
+func TestParseTopics(t *testing.T) {
+	const definition = `[{ "type" : "event", "name" : "transfer", "inputs": [
+		{ "name" : "from", "type": "address", "indexed": true },
+		{ "name" : "value", "type": "int8", "indexed": true },
+		{ "name" : "memo", "type": "string", "indexed": true },
+		{ "name" : "data", "type": "bytes" }
+	] }]`
+
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+	topics, err := makeTopics([]interface{}{addr}, []interface{}{int8(-2)}, []interface{}{"hi"})
+	if err != nil {
+		t.Fatalf("failed to make topics: %v", err)
+	}
+	var event struct {
+		From  common.Address
+		Value int8
+		Memo  common.Hash
+		Data  []byte
+	}
+	if err := parseTopics(&event, parsed.Events["transfer"], []common.Hash{topics[0][0], topics[1][0], topics[2][0]}); err != nil {
+		t.Fatalf("failed to parse topics: %v", err)
+	}
+	if event.From != addr {
+		t.Errorf("address mismatch: have %x, want %x", event.From, addr)
+	}
+	if event.Value != -2 {
+		t.Errorf("value mismatch: have %d, want %d", event.Value, -2)
+	}
+	if event.Memo != crypto.Keccak256Hash([]byte("hi")) {
+		t.Errorf("memo hash mismatch: have %x, want %x", event.Memo, crypto.Keccak256Hash([]byte("hi")))
+	}
+	if err := parseTopics(&event, parsed.Events["transfer"], topics[0]); err == nil {
+		t.Errorf("missing topics accepted")
+	}
+}
@@ -18,6 +18,7 @@ package abi
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -33,6 +34,18 @@ type Event struct {
 	Inputs    []Argument
 }
 
+// String returns a readable representation of the event.
+func (e Event) String() string {
+	inputs := make([]string, len(e.Inputs))
+	for i, input := range e.Inputs {
+		inputs[i] = fmt.Sprintf("%v %v", input.Type, input.Name)
+		if input.Indexed {
+			inputs[i] = fmt.Sprintf("%v indexed %v", input.Type, input.Name)
+		}
+	}
+	return fmt.Sprintf("event %v(%v)", e.Name, strings.Join(inputs, ", "))
+}
+
 // Id returns the canonical representation of the event's signature used by the
 // abi definition to identify event names and types.
 func (e Event) Id() common.Hash {
@@ -44,3 +57,35 @@ func (e Event) Id() common.Hash {
 	}
 	return common.BytesToHash(crypto.Keccak256([]byte(fmt.Sprintf("%v(%v)", e.Name, strings.Join(types, ",")))))
 }
+
+// unpack decodes the non-indexed inputs of the event from a log's data section
+// into the struct pointed to by v. Fields are matched by the capitalised input
+// names, anonymous inputs by ArgN, N being their position in the event.
+func (e Event) unpack(v interface{}, output []byte) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("abi: cannot unpack event %s into %T (struct pointer required)", e.Name, v)
+	}
+	value = value.Elem()
+
+	index := 0
+	for i, input := range e.Inputs {
+		if input.Indexed {
+			continue
+		}
+		marshalledValue, err := unpackArg(index, input, output)
+		if err != nil {
+			return err
+		}
+		index += input.Type.headSize()
+
+		field := value.FieldByName(FieldName(input.Name, i))
+		if !field.IsValid() {
+			return fmt.Errorf("abi: field %s of event %s missing in %T", FieldName(input.Name, i), e.Name, v)
+		}
+		if err := set(field, reflect.ValueOf(marshalledValue), input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
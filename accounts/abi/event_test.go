@@ -17,6 +17,7 @@
 package abi
 
 import (
+	"math/big"
 	"strings"
 	"testing"
 
@@ -54,3 +55,80 @@ func TestEventId(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the non-indexed fields of an event are unpacked from the log data
+// into the matching struct fields, leaving indexed ones untouched.
+func TestEventUnpack(t *testing.T) {
+	const definition = `[{ "type" : "event", "name" : "transfer", "inputs": [
+		{ "name" : "from", "type": "address", "indexed": true },
+		{ "name" : "memo", "type": "string" },
+		{ "name" : "", "type": "uint256" }
+	] }]`
+
+	abi, err := JSON(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := common.Hex2Bytes("" +
+		"0000000000000000000000000000000000000000000000000000000000000040" +
+		"000000000000000000000000000000000000000000000000000000000000002a" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"6869000000000000000000000000000000000000000000000000000000000000")
+
+	var event struct {
+		From common.Address
+		Memo string
+		Arg2 *big.Int
+	}
+	if err := abi.Unpack(&event, "transfer", data); err != nil {
+		t.Fatalf("failed to unpack event: %v", err)
+	}
+	if event.From != (common.Address{}) {
+		t.Errorf("indexed field unpacked: %x", event.From)
+	}
+	if event.Memo != "hi" {
+		t.Errorf("memo mismatch: have %q, want %q", event.Memo, "hi")
+	}
+	if event.Arg2 == nil || event.Arg2.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("unnamed field mismatch: have %v, want %v", event.Arg2, 42)
+	}
+	// Unpacking into anything but a struct pointer must fail
+	var out []interface{}
+	if err := abi.Unpack(&out, "transfer", data); err == nil {
+		t.Errorf("unpacking into slice succeeded")
+	}
+}
+
+// Tests that underscore prefixed event arguments are unpacked into exported
+// fields, and that static arrays in the log data are skipped over in full.
+func TestEventUnpackUnderscored(t *testing.T) {
+	const definition = `[{ "type" : "event", "name" : "Transfer", "inputs": [
+		{ "name" : "_from", "type": "address", "indexed": true },
+		{ "name" : "_pair", "type": "uint256[2]" },
+		{ "name" : "_value", "type": "uint256" }
+	] }]`
+
+	abi, err := JSON(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := common.Hex2Bytes("" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"000000000000000000000000000000000000000000000000000000000000002a")
+
+	var event struct {
+		From  common.Address
+		Pair  [2]*big.Int
+		Value *big.Int
+	}
+	if err := abi.Unpack(&event, "Transfer", data); err != nil {
+		t.Fatalf("failed to unpack event: %v", err)
+	}
+	if event.Pair[0] == nil || event.Pair[0].Cmp(big.NewInt(1)) != 0 || event.Pair[1] == nil || event.Pair[1].Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("pair mismatch: have %v, want [1 2]", event.Pair)
+	}
+	if event.Value == nil || event.Value.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("value mismatch: have %v, want %v", event.Value, 42)
+	}
+}
@@ -48,19 +48,32 @@ func (m Method) pack(method Method, args ...interface{}) ([]byte, error) {
 	// output. This is used for strings and bytes types input.
 	var variableInput []byte
 
+	// static arrays and tuples are inlined, so the head may exceed a word per input
+	headSize := 0
+	for _, input := range method.Inputs {
+		headSize += input.Type.headSize()
+	}
 	var ret []byte
 	for i, a := range args {
 		input := method.Inputs[i]
-		// pack the input
-		packed, err := input.Type.pack(reflect.ValueOf(a))
+		// pack the input, recursing into tuples and nested arrays
+		var (
+			packed []byte
+			err    error
+		)
+		if input.Type.isComplex() {
+			packed, err = input.Type.packValue(reflect.ValueOf(a))
+		} else {
+			packed, err = input.Type.pack(reflect.ValueOf(a))
+		}
 		if err != nil {
 			return nil, fmt.Errorf("`%s` %v", method.Name, err)
 		}
 
-		// check for a slice type (string, bytes, slice)
-		if input.Type.requiresLengthPrefix() {
+		// check for a slice type (string, bytes, slice) or a dynamic tuple
+		if input.Type.requiresLengthPrefix() || (input.Type.isComplex() && input.Type.isDynamic()) {
 			// calculate the offset
-			offset := len(method.Inputs)*32 + len(variableInput)
+			offset := headSize + len(variableInput)
 			// set the offset
 			ret = append(ret, packNum(reflect.ValueOf(offset))...)
 			// Append the packed output to the variable input. The variable input
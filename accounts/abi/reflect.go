@@ -86,8 +86,44 @@ func set(dst, src reflect.Value, output Argument) error {
 		dst.Set(src)
 	case dstType.Kind() == reflect.Ptr:
 		return set(dst.Elem(), src, output)
+	case dstType.Kind() == reflect.Struct && srcType.Kind() == reflect.Struct && output.Type.T == TupleTy:
+		return setStruct(dst, src, output)
+	case dstType.Kind() == reflect.Slice && srcType.Kind() == reflect.Slice && output.Type.isList():
+		slice := reflect.MakeSlice(dstType, src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			if err := set(slice.Index(i), src.Index(i), Argument{Type: *output.Type.Elem}); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+	case dstType.Kind() == reflect.Array && srcType.Kind() == reflect.Array && output.Type.isList():
+		if dst.Len() != src.Len() {
+			return fmt.Errorf("abi: cannot unmarshal src (len=%d) in to dst (len=%d)", src.Len(), dst.Len())
+		}
+		for i := 0; i < src.Len(); i++ {
+			if err := set(dst.Index(i), src.Index(i), Argument{Type: *output.Type.Elem}); err != nil {
+				return err
+			}
+		}
 	default:
 		return fmt.Errorf("abi: cannot unmarshal %v in to %v", src.Type(), dst.Type())
 	}
 	return nil
 }
+
+// setStruct assigns the fields of an unpacked tuple in src to the fields of the
+// same name in dst, allowing tuples to be unpacked into user defined structs.
+func setStruct(dst, src reflect.Value, output Argument) error {
+	for i, elem := range output.Type.TupleElems {
+		name := FieldName(output.Type.TupleRawNames[i], i)
+
+		field := dst.FieldByName(name)
+		if !field.IsValid() || !field.CanSet() {
+			return fmt.Errorf("abi: field %s missing in %v", name, dst.Type())
+		}
+		if err := set(field, src.Field(i), Argument{Type: *elem}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
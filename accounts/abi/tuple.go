@@ -0,0 +1,284 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package abi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// FieldName returns the name of the Go struct field an argument is mapped to
+// when unpacking into structs: the capitalised argument name stripped of any
+// leading underscores, or ArgN for an unnamed argument at position N.
+func FieldName(name string, index int) string {
+	name = strings.TrimLeft(name, "_")
+	if name == "" {
+		return fmt.Sprintf("Arg%d", index)
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// isList returns whether the type is an array or slice of elements, as opposed
+// to the byte sequence types which reuse the array and slice flags.
+func (t Type) isList() bool {
+	return (t.IsSlice || t.IsArray) && t.T != BytesTy && t.T != FixedBytesTy && t.T != FunctionTy
+}
+
+// isComplex returns whether the type is a tuple or an array of tuples, arrays
+// or other dynamic types. These types are encoded recursively, whereas all the
+// others keep using the flat encoders.
+func (t Type) isComplex() bool {
+	return t.T == TupleTy || (t.isList() && (t.Elem.isList() || t.Elem.isDynamic()))
+}
+
+// isDynamic returns whether the encoding of the type has a variable size, in
+// which case it is placed into the tail of its enclosing tuple and referenced
+// by an offset.
+func (t Type) isDynamic() bool {
+	switch {
+	case t.isList():
+		return t.IsSlice || t.Elem.isDynamic()
+	case t.T == TupleTy:
+		for _, elem := range t.TupleElems {
+			if elem.isDynamic() {
+				return true
+			}
+		}
+		return false
+	default:
+		return t.T == StringTy || t.T == BytesTy
+	}
+}
+
+// headSize returns the number of bytes the type occupies in the head of its
+// enclosing tuple: static arrays and tuples are inlined, everything else takes
+// up a single word.
+func (t Type) headSize() int {
+	switch {
+	case t.isDynamic():
+		return 32
+	case t.isList():
+		return t.SliceSize * t.Elem.headSize()
+	case t.T == TupleTy:
+		size := 0
+		for _, elem := range t.TupleElems {
+			size += elem.headSize()
+		}
+		return size
+	default:
+		return 32
+	}
+}
+
+// headOffsets returns the position of each argument within the head of their
+// encoding.
+func headOffsets(args []Argument) []int {
+	offsets := make([]int, len(args))
+	for i := 1; i < len(args); i++ {
+		offsets[i] = offsets[i-1] + args[i-1].Type.headSize()
+	}
+	return offsets
+}
+
+// goType returns the Go type values of the type are unpacked into.
+func (t Type) goType() reflect.Type {
+	switch {
+	case t.isList() && t.IsSlice:
+		return reflect.SliceOf(t.Elem.goType())
+	case t.isList():
+		return reflect.ArrayOf(t.SliceSize, t.Elem.goType())
+	}
+	switch t.T {
+	case IntTy, UintTy:
+		return reflect.TypeOf(readInteger(t.Kind, make([]byte, 32)))
+	case BoolTy:
+		return reflect.TypeOf(false)
+	case StringTy:
+		return reflect.TypeOf("")
+	case AddressTy:
+		return reflect.TypeOf(common.Address{})
+	case HashTy:
+		return reflect.TypeOf(common.Hash{})
+	case BytesTy:
+		return reflect.TypeOf([]byte(nil))
+	case FixedBytesTy, FunctionTy:
+		return reflect.ArrayOf(t.SliceSize, reflect.TypeOf(byte(0)))
+	case TupleTy:
+		return t.Type
+	}
+	return reflect.TypeOf((*interface{})(nil)).Elem()
+}
+
+// packValue packs the given value according to the abi specification in t,
+// recursing into tuples and arrays.
+func (t Type) packValue(v reflect.Value) ([]byte, error) {
+	v = indirect(v)
+
+	switch {
+	case t.isList():
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, typeErr(t.String(), v.Type())
+		}
+		if t.IsArray && v.Len() != t.SliceSize {
+			return nil, fmt.Errorf("abi: cannot use array of length %d as type %v", v.Len(), t)
+		}
+		types, values := make([]*Type, v.Len()), make([]reflect.Value, v.Len())
+		for i := range values {
+			types[i], values[i] = t.Elem, v.Index(i)
+		}
+		packed, err := packSequence(types, values)
+		if err != nil {
+			return nil, err
+		}
+		if t.IsSlice {
+			return append(packNum(reflect.ValueOf(v.Len())), packed...), nil
+		}
+		return packed, nil
+
+	case t.T == TupleTy:
+		if v.Kind() != reflect.Struct {
+			return nil, typeErr(t.String(), v.Type())
+		}
+		values := make([]reflect.Value, len(t.TupleElems))
+		for i, name := range t.TupleRawNames {
+			field := v.FieldByName(FieldName(name, i))
+			if !field.IsValid() {
+				return nil, fmt.Errorf("abi: field %s missing in %v", FieldName(name, i), v.Type())
+			}
+			values[i] = field
+		}
+		return packSequence(t.TupleElems, values)
+
+	default:
+		return t.pack(v)
+	}
+}
+
+// packSequence packs a list of values as consecutive tuple elements, placing
+// the static ones into the head and the dynamic ones into the tail.
+func packSequence(types []*Type, values []reflect.Value) ([]byte, error) {
+	size := 0
+	for _, t := range types {
+		size += t.headSize()
+	}
+	var head, tail []byte
+	for i, t := range types {
+		packed, err := t.packValue(values[i])
+		if err != nil {
+			return nil, err
+		}
+		if t.isDynamic() {
+			head = append(head, packNum(reflect.ValueOf(size+len(tail)))...)
+			tail = append(tail, packed...)
+		} else {
+			head = append(head, packed...)
+		}
+	}
+	return append(head, tail...), nil
+}
+
+// unpackArg unpacks the argument located at the given byte offset within the
+// head of output.
+func unpackArg(index int, arg Argument, output []byte) (interface{}, error) {
+	if !arg.Type.isComplex() {
+		return toGoType(index, arg, output)
+	}
+	value, err := decodeValue(arg.Type, output, index)
+	if err != nil {
+		return nil, err
+	}
+	return value.Interface(), nil
+}
+
+// readOffset reads the offset of a dynamic value stored at the given position,
+// ensuring that it points into the output.
+func readOffset(output []byte, index int) (int, error) {
+	if index+32 > len(output) {
+		return 0, fmt.Errorf("abi: cannot marshal in to go type: length insufficient %d require %d", len(output), index+32)
+	}
+	offset := binary.BigEndian.Uint64(output[index+24 : index+32])
+	if offset > uint64(len(output)) {
+		return 0, fmt.Errorf("abi: cannot marshal in to go type: offset %d would go over slice boundary (len=%d)", offset, len(output))
+	}
+	return int(offset), nil
+}
+
+// decodeValue unpacks a value of type t located at the given byte offset within
+// the head of output, recursing into tuples and arrays.
+func decodeValue(t Type, output []byte, index int) (reflect.Value, error) {
+	// Dynamic lists and tuples are stored in the tail, referenced from the head
+	if (t.isList() || t.T == TupleTy) && t.isDynamic() {
+		offset, err := readOffset(output, index)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		output, index = output[offset:], 0
+	}
+	switch {
+	case t.isList():
+		size := t.SliceSize
+		if t.IsSlice {
+			if len(output) < 32 {
+				return reflect.Value{}, fmt.Errorf("abi: cannot marshal in to go slice: insufficient size output %d require %d", len(output), 32)
+			}
+			length := binary.BigEndian.Uint64(output[24:32])
+			if size := t.Elem.headSize(); size > 0 && length > uint64(len(output)-32)/uint64(size) {
+				return reflect.Value{}, fmt.Errorf("abi: cannot marshal in to go slice: length %d would go over slice boundary (len=%d)", length, len(output))
+			}
+			size, output = int(length), output[32:]
+		}
+		value := reflect.New(t.goType()).Elem()
+		if t.IsSlice {
+			value = reflect.MakeSlice(t.goType(), size, size)
+		}
+		for i := 0; i < size; i++ {
+			elem, err := decodeValue(*t.Elem, output, index+i*t.Elem.headSize())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value.Index(i).Set(elem)
+		}
+		return value, nil
+
+	case t.T == TupleTy:
+		value := reflect.New(t.Type).Elem()
+		for i, elem := range t.TupleElems {
+			field, err := decodeValue(*elem, output, index)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value.Field(i).Set(field)
+			index += elem.headSize()
+		}
+		return value, nil
+
+	default:
+		marshalled, err := toGoType(index, Argument{Type: t}, output)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value := reflect.New(t.goType()).Elem()
+		if err := set(value, reflect.ValueOf(marshalled), Argument{Type: t}); err != nil {
+			return reflect.Value{}, err
+		}
+		return value, nil
+	}
+}
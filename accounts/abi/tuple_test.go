@@ -0,0 +1,203 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package abi
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const tupleABI = `[
+	{ "type": "function", "name": "g", "constant": true,
+	  "inputs": [ { "name": "a", "type": "uint256[][]" }, { "name": "b", "type": "string[]" } ],
+	  "outputs": [ { "name": "a", "type": "uint256[][]" }, { "name": "b", "type": "string[]" } ] },
+	{ "type": "function", "name": "point", "constant": true,
+	  "inputs": [ { "name": "p", "type": "tuple", "internalType": "struct Geo.Point", "components": [
+	    { "name": "x", "type": "uint256" }, { "name": "owner", "type": "address" } ] } ],
+	  "outputs": [ { "name": "p", "type": "tuple", "components": [
+	    { "name": "x", "type": "uint256" }, { "name": "owner", "type": "address" } ] } ] },
+	{ "type": "function", "name": "order", "constant": true,
+	  "inputs": [ { "name": "o", "type": "tuple", "components": [
+	    { "name": "id", "type": "uint64" },
+	    { "name": "_items", "type": "tuple[]", "components": [
+	      { "name": "name", "type": "string" }, { "name": "amounts", "type": "uint8[2]" } ] },
+	    { "name": "tags", "type": "bytes32[][]" } ] },
+	    { "name": "note", "type": "string" } ],
+	  "outputs": [ { "name": "o", "type": "tuple", "components": [
+	    { "name": "id", "type": "uint64" },
+	    { "name": "_items", "type": "tuple[]", "components": [
+	      { "name": "name", "type": "string" }, { "name": "amounts", "type": "uint8[2]" } ] },
+	    { "name": "tags", "type": "bytes32[][]" } ] },
+	    { "name": "note", "type": "string" } ] }
+]`
+
+// Tests that tuple types are parsed with their components and signatures.
+func TestTupleTypeParsing(t *testing.T) {
+	abi, err := JSON(strings.NewReader(tupleABI))
+	if err != nil {
+		t.Fatalf("failed to parse abi: %v", err)
+	}
+	tests := []struct {
+		method string
+		sig    string
+	}{
+		{"g", "g(uint256[][],string[])"},
+		{"point", "point((uint256,address))"},
+		{"order", "order((uint64,(string,uint8[2])[],bytes32[][]),string)"},
+	}
+	for _, tt := range tests {
+		if sig := abi.Methods[tt.method].Sig(); sig != tt.sig {
+			t.Errorf("%s: signature mismatch: have %s, want %s", tt.method, sig, tt.sig)
+		}
+	}
+	point := abi.Methods["point"].Inputs[0].Type
+	if point.T != TupleTy || point.TupleRawName != "GeoPoint" {
+		t.Errorf("tuple type mismatch: have %v/%s, want %v/%s", point.T, point.TupleRawName, TupleTy, "GeoPoint")
+	}
+	if !reflect.DeepEqual(point.TupleRawNames, []string{"x", "owner"}) {
+		t.Errorf("tuple component names mismatch: have %v", point.TupleRawNames)
+	}
+	if _, err := JSON(strings.NewReader(`[{ "type": "function", "name": "f", "inputs": [ { "name": "t", "type": "tuple" } ] }]`)); err == nil {
+		t.Errorf("tuple without components accepted")
+	}
+}
+
+// Tests nested dynamic arrays against the encoding example of the ABI spec.
+func TestNestedArrayPacking(t *testing.T) {
+	abi, err := JSON(strings.NewReader(tupleABI))
+	if err != nil {
+		t.Fatalf("failed to parse abi: %v", err)
+	}
+	nums := [][]*big.Int{{big.NewInt(1), big.NewInt(2)}, {big.NewInt(3)}}
+	strs := []string{"one", "two", "three"}
+
+	packed, err := abi.Pack("g", nums, strs)
+	if err != nil {
+		t.Fatalf("failed to pack: %v", err)
+	}
+	want := common.Hex2Bytes("2289b18c" +
+		"0000000000000000000000000000000000000000000000000000000000000040" +
+		"0000000000000000000000000000000000000000000000000000000000000140" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000040" +
+		"00000000000000000000000000000000000000000000000000000000000000a0" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"00000000000000000000000000000000000000000000000000000000000000a0" +
+		"00000000000000000000000000000000000000000000000000000000000000e0" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"6f6e650000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000003" +
+		"74776f0000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000005" +
+		"7468726565000000000000000000000000000000000000000000000000000000")
+	if !bytes.Equal(packed, want) {
+		t.Fatalf("packed output mismatch:\nhave %x\nwant %x", packed, want)
+	}
+	var out struct {
+		A [][]*big.Int
+		B []string
+	}
+	if err := abi.Unpack(&out, "g", packed[4:]); err != nil {
+		t.Fatalf("failed to unpack: %v", err)
+	}
+	if !reflect.DeepEqual(out.A, nums) || !reflect.DeepEqual(out.B, strs) {
+		t.Errorf("unpacked output mismatch: have %v %v, want %v %v", out.A, out.B, nums, strs)
+	}
+}
+
+// Tests that tuples are packed from and unpacked into Go structs.
+func TestTuplePacking(t *testing.T) {
+	abi, err := JSON(strings.NewReader(tupleABI))
+	if err != nil {
+		t.Fatalf("failed to parse abi: %v", err)
+	}
+	// Static tuples are inlined into the head
+	type point struct {
+		X     *big.Int
+		Owner common.Address
+	}
+	in := point{X: big.NewInt(7), Owner: common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")}
+
+	packed, err := abi.Pack("point", in)
+	if err != nil {
+		t.Fatalf("failed to pack point: %v", err)
+	}
+	want := common.Hex2Bytes("" +
+		"0000000000000000000000000000000000000000000000000000000000000007" +
+		"0000000000000000000000000102030405060708090a0b0c0d0e0f1011121314")
+	if !bytes.Equal(packed[4:], want) {
+		t.Fatalf("packed point mismatch:\nhave %x\nwant %x", packed[4:], want)
+	}
+	var out point
+	if err := abi.Unpack(&out, "point", packed[4:]); err != nil {
+		t.Fatalf("failed to unpack point: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("unpacked point mismatch: have %+v, want %+v", out, in)
+	}
+	// Dynamic tuples with nested tuple arrays round trip through named structs
+	type item struct {
+		Name    string
+		Amounts [2]uint8
+	}
+	type order struct {
+		Id    uint64
+		Items []item
+		Tags  [][][32]byte
+	}
+	ord := order{
+		Id:    3,
+		Items: []item{{"apple", [2]uint8{1, 2}}, {"pear", [2]uint8{3, 4}}},
+		Tags:  [][][32]byte{{{1}, {2}}, {}},
+	}
+	if packed, err = abi.Pack("order", ord, "rush"); err != nil {
+		t.Fatalf("failed to pack order: %v", err)
+	}
+	var res struct {
+		O    order
+		Note string
+	}
+	if err := abi.Unpack(&res, "order", packed[4:]); err != nil {
+		t.Fatalf("failed to unpack order: %v", err)
+	}
+	if !reflect.DeepEqual(res.O, ord) || res.Note != "rush" {
+		t.Errorf("unpacked order mismatch: have %+v %q, want %+v %q", res.O, res.Note, ord, "rush")
+	}
+	// Unpacking without a target struct yields the generated tuple type
+	var generic []interface{}
+	if err := abi.Unpack(&generic, "order", packed[4:]); err != nil {
+		t.Fatalf("failed to unpack order generically: %v", err)
+	}
+	if id := reflect.ValueOf(generic[0]).FieldByName("Id").Interface(); id != uint64(3) {
+		t.Errorf("generic order id mismatch: have %v, want %v", id, 3)
+	}
+	// Structs missing tuple fields are rejected
+	if _, err := abi.Pack("point", struct{ X *big.Int }{big.NewInt(1)}); err == nil {
+		t.Errorf("packed struct with missing tuple field")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -35,6 +36,7 @@ const (
 	HashTy
 	FixedpointTy
 	FunctionTy
+	TupleTy
 )
 
 // Type is the reflection of the supported argument type
@@ -49,6 +51,10 @@ type Type struct {
 	Size int
 	T    byte // Our own type checking
 
+	TupleElems    []*Type  // Component types of a tuple
+	TupleRawNames []string // Original (unnormalised) names of the tuple components
+	TupleRawName  string   // Solidity struct name of the tuple, if known
+
 	stringKind string // holds the unparsed string for deriving signatures
 }
 
@@ -70,8 +76,39 @@ var (
 	typeRegex = regexp.MustCompile("([a-zA-Z]+)(([0-9]+)(x([0-9]+))?)?")
 )
 
-// NewType creates a new reflection type of abi type given in t.
+// NewType creates a new reflection type of abi type given in t. Tuple types
+// need their components and can only be created while parsing a JSON ABI.
 func NewType(t string) (typ Type, err error) {
+	return newType(t, "", nil)
+}
+
+// newType creates a new reflection type of abi type given in t, using the
+// components to construct tuple types and the internal type for naming them.
+func newType(t string, internalType string, components []argumentMarshaling) (typ Type, err error) {
+	if strings.Count(t, "[") != strings.Count(t, "]") {
+		return Type{}, fmt.Errorf("abi: type parse error: %s", t)
+	}
+	// Nested arrays are parsed from their outermost dimension inwards
+	if strings.Count(t, "[") > 1 {
+		if !strings.HasSuffix(t, "]") {
+			return Type{}, fmt.Errorf("abi: type parse error: %s", t)
+		}
+		i := strings.LastIndex(t, "[")
+		if size := t[i+1 : len(t)-1]; size == "" {
+			typ.IsSlice, typ.SliceSize = true, -1
+		} else if typ.SliceSize, err = strconv.Atoi(size); err != nil {
+			return Type{}, fmt.Errorf("abi: type parse error: %s", t)
+		} else {
+			typ.IsArray = true
+		}
+		elem, err := newType(t[:i], internalType, components)
+		if err != nil {
+			return Type{}, err
+		}
+		typ.Elem = &elem
+		typ.stringKind = elem.stringKind + t[i:]
+		return typ, nil
+	}
 	res := fullTypeRegex.FindAllStringSubmatch(t, -1)[0]
 	// check if type is slice and parse type.
 	switch {
@@ -85,7 +122,7 @@ func NewType(t string) (typ Type, err error) {
 		return Type{}, fmt.Errorf("abi: type parse error: %s", t)
 	}
 	if typ.IsArray || typ.IsSlice {
-		sliceType, err := NewType(res[1])
+		sliceType, err := newType(res[1], internalType, components)
 		if err != nil {
 			return Type{}, err
 		}
@@ -165,6 +202,52 @@ func NewType(t string) (typ Type, err error) {
 		typ.IsArray = true
 		typ.T = FunctionTy
 		typ.SliceSize = 24
+	case "tuple":
+		if len(components) == 0 {
+			return Type{}, fmt.Errorf("abi: tuple type without components: %s", t)
+		}
+		var (
+			fields = make([]reflect.StructField, len(components))
+			elems  = make([]*Type, len(components))
+			names  = make([]string, len(components))
+			kinds  = make([]string, len(components))
+			used   = make(map[string]bool)
+		)
+		for i, c := range components {
+			elem, err := newType(c.Type, c.InternalType, c.Components)
+			if err != nil {
+				return Type{}, err
+			}
+			name := FieldName(c.Name, i)
+			if used[name] {
+				return Type{}, fmt.Errorf("abi: duplicate tuple field %s", name)
+			}
+			used[name] = true
+
+			fields[i] = reflect.StructField{Name: name, Type: elem.goType()}
+			if c.Name != "" {
+				fields[i].Tag = reflect.StructTag(fmt.Sprintf("json:%q", c.Name))
+			}
+			elems[i], names[i], kinds[i] = &elem, c.Name, elem.stringKind
+		}
+		typ.Kind = reflect.Struct
+		typ.Type = reflect.StructOf(fields)
+		typ.T = TupleTy
+		typ.TupleElems = elems
+		typ.TupleRawNames = names
+
+		// Struct names are qualified by their contract (Foo.Bar), which is
+		// flattened into a single Go identifier (FooBar)
+		if strings.HasPrefix(internalType, "struct ") {
+			name := strings.TrimPrefix(internalType, "struct ")
+			if i := strings.Index(name, "["); i >= 0 {
+				name = name[:i]
+			}
+			typ.TupleRawName = strings.Replace(name, ".", "", -1)
+		}
+		if !(typ.IsArray || typ.IsSlice) {
+			typ.stringKind = "(" + strings.Join(kinds, ",") + ")"
+		}
 	default:
 		return Type{}, fmt.Errorf("unsupported arg type: %s", t)
 	}
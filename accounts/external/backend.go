@@ -0,0 +1,262 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package external implements an account backend forwarding all signing requests
+// to an external signer process, keeping the keys out of the node.
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	// errPasswordsUnsupported is returned for operations trying to pass a password
+	// to the external signer, which handles authentication by itself.
+	errPasswordsUnsupported = errors.New("password operations not supported on external signers")
+
+	// errMissingTransaction is returned if the signer approved a transaction
+	// signing request, but replied without the signed transaction.
+	errMissingTransaction = errors.New("signer returned no transaction")
+)
+
+const (
+	// accountListTimeout is the maximum time to wait for the signer to reply to
+	// an account listing, which may need to be approved manually.
+	accountListTimeout = time.Minute
+
+	// accountCacheTTL is the time a successful account listing is reused before
+	// asking the signer again, picking up newly revealed or revoked accounts.
+	accountCacheTTL = 5 * time.Minute
+
+	// accountRetryBackoff is the time to wait after a denied or failed account
+	// listing before asking the signer again, to avoid flooding it with prompts.
+	accountRetryBackoff = 30 * time.Second
+)
+
+// sendTxArgs is the transaction to sign, as expected by account_signTransaction.
+type sendTxArgs struct {
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      *hexutil.Big    `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Value    *hexutil.Big    `json:"value"`
+	Data     hexutil.Bytes   `json:"data"`
+	Nonce    hexutil.Uint64  `json:"nonce"`
+}
+
+// signTransactionResult is the reply of account_signTransaction.
+type signTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+// ExternalBackend is an accounts.Backend exposing a single external signer.
+type ExternalBackend struct {
+	signers []accounts.Wallet
+}
+
+// NewExternalBackend creates a backend connected to the signer at the given
+// endpoint (IPC path or HTTP URL).
+func NewExternalBackend(endpoint string) (*ExternalBackend, error) {
+	signer, err := NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &ExternalBackend{signers: []accounts.Wallet{signer}}, nil
+}
+
+// Wallets implements accounts.Backend, returning the external signer.
+func (eb *ExternalBackend) Wallets() []accounts.Wallet {
+	return eb.signers
+}
+
+// Subscribe implements accounts.Backend. The external signer never comes and
+// goes, so no events are ever fired.
+func (eb *ExternalBackend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// ExternalSigner is an accounts.Wallet forwarding requests to an external signer
+// over its account_* RPC API.
+//
+// Only transaction signing is forwarded. Signing data (eth_sign, personal_sign)
+// is not supported, as the node only hands pre-hashed data to wallets, whereas
+// the signer insists on seeing the data it signs.
+type ExternalSigner struct {
+	client   *rpc.Client
+	endpoint string
+
+	cacheMu     sync.Mutex
+	cache       []accounts.Account // Accounts revealed by the last account listing
+	cacheExpiry time.Time          // Time after which the signer is asked again
+}
+
+// NewExternalSigner connects to the signer at the given endpoint.
+func NewExternalSigner(endpoint string) (*ExternalSigner, error) {
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return newExternalSigner(client, endpoint), nil
+}
+
+// newExternalSigner creates a signer wallet over an established RPC connection.
+func newExternalSigner(client *rpc.Client, endpoint string) *ExternalSigner {
+	return &ExternalSigner{client: client, endpoint: endpoint}
+}
+
+// URL implements accounts.Wallet, returning the endpoint of the signer.
+func (api *ExternalSigner) URL() accounts.URL {
+	return accounts.URL{Scheme: "extapi", Path: api.endpoint}
+}
+
+// Status implements accounts.Wallet.
+func (api *ExternalSigner) Status() string {
+	return "ok [external signer]"
+}
+
+// Open implements accounts.Wallet. The signer manages its own connections.
+func (api *ExternalSigner) Open(passphrase string) error {
+	return accounts.ErrNotSupported
+}
+
+// Close implements accounts.Wallet. The signer manages its own connections.
+func (api *ExternalSigner) Close() error {
+	return accounts.ErrNotSupported
+}
+
+// Accounts implements accounts.Wallet, returning the accounts the signer agreed
+// to reveal. Since every listing needs to be approved, successful listings are
+// reused for accountCacheTTL, whereas denied or failed ones are only retried
+// after accountRetryBackoff.
+func (api *ExternalSigner) Accounts() []accounts.Account {
+	// Hold the lock during listing to avoid concurrent approval prompts
+	api.cacheMu.Lock()
+	defer api.cacheMu.Unlock()
+
+	if time.Now().Before(api.cacheExpiry) {
+		return api.cache
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), accountListTimeout)
+	defer cancel()
+
+	var addresses []common.Address
+	if err := api.client.CallContext(ctx, &addresses, "account_list"); err != nil {
+		log.Error("Failed to list external accounts", "err", err)
+		api.cache, api.cacheExpiry = nil, time.Now().Add(accountRetryBackoff)
+		return nil
+	}
+	accs := make([]accounts.Account, 0, len(addresses))
+	for _, addr := range addresses {
+		accs = append(accs, accounts.Account{Address: addr, URL: api.URL()})
+	}
+	api.cache, api.cacheExpiry = accs, time.Now().Add(accountCacheTTL)
+	return accs
+}
+
+// Contains implements accounts.Wallet, returning whether a particular account is
+// or is not revealed by the signer.
+func (api *ExternalSigner) Contains(account accounts.Account) bool {
+	for _, acc := range api.Accounts() {
+		if acc.Address == account.Address && (account.URL == (accounts.URL{}) || account.URL == api.URL()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Derive implements accounts.Wallet, but is not supported on external signers.
+func (api *ExternalSigner) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+
+// SelfDerive implements accounts.Wallet, but is a noop on external signers, which
+// manage their accounts by themselves.
+func (api *ExternalSigner) SelfDerive(base accounts.DerivationPath, chain ethereum.ChainStateReader) {
+}
+
+// SignHash implements accounts.Wallet, but is not supported: the signer only
+// signs data it can show to the user (account_sign), not opaque hashes, and the
+// original data can't be recovered from its hash. Clients needing data to be
+// signed should call account_sign on the signer directly.
+func (api *ExternalSigner) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	return nil, accounts.ErrNotSupported
+}
+
+// SignTx implements accounts.Wallet, requesting the signer to sign the transaction.
+func (api *ExternalSigner) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	args := &sendTxArgs{
+		From:     account.Address,
+		To:       tx.To(),
+		Gas:      (*hexutil.Big)(tx.Gas()),
+		GasPrice: (*hexutil.Big)(tx.GasPrice()),
+		Value:    (*hexutil.Big)(tx.Value()),
+		Data:     tx.Data(),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+	}
+	var res signTransactionResult
+	if err := api.client.Call(&res, "account_signTransaction", args); err != nil {
+		return nil, err
+	}
+	if res.Tx == nil {
+		return nil, errMissingTransaction
+	}
+	// Make sure the signer signed for the chain we're on, with the right account
+	var signer types.Signer = types.HomesteadSigner{}
+	if chainID != nil {
+		if res.Tx.ChainId().Cmp(chainID) != 0 {
+			return nil, fmt.Errorf("chain id mismatch: have %v, want %v", res.Tx.ChainId(), chainID)
+		}
+		signer = types.NewEIP155Signer(chainID)
+	}
+	sender, err := types.Sender(signer, res.Tx)
+	if err != nil {
+		return nil, err
+	}
+	if sender != account.Address {
+		return nil, fmt.Errorf("signer mismatch: expected %s, got %s", account.Address.Hex(), sender.Hex())
+	}
+	return res.Tx, nil
+}
+
+// SignHashWithPassphrase implements accounts.Wallet, but is not supported on
+// external signers.
+func (api *ExternalSigner) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return nil, errPasswordsUnsupported
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, but is not supported on
+// external signers.
+func (api *ExternalSigner) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return nil, errPasswordsUnsupported
+}
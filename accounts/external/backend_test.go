@@ -0,0 +1,210 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package external
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// approvingUI is a signer UI accepting every request, unlocking the keys with
+// a fixed password.
+type approvingUI struct{}
+
+func (approvingUI) ApproveTx(request *core.SignTxRequest) (core.SignTxResponse, error) {
+	return core.SignTxResponse{Transaction: request.Transaction, Approved: true, Password: "password"}, nil
+}
+
+func (approvingUI) ApproveSignData(request *core.SignDataRequest) (core.SignDataResponse, error) {
+	return core.SignDataResponse{Approved: true, Password: "password"}, nil
+}
+
+func (approvingUI) ApproveListing(request *core.ListRequest) (core.ListResponse, error) {
+	return core.ListResponse{Accounts: request.Accounts}, nil
+}
+
+func (approvingUI) ShowError(message string)                     {}
+func (approvingUI) ShowInfo(message string)                      {}
+func (approvingUI) OnApprovedTx(tx ethapi.SignTransactionResult) {}
+func (approvingUI) OnSignerStartup(info core.StartupInfo)        {}
+
+// newTestSigner starts an in-process signer daemon over a fresh keystore with a
+// single account, returning a wallet connected to it.
+func newTestSigner(t *testing.T) (*ExternalSigner, accounts.Account, func()) {
+	dir, err := ioutil.TempDir("", "external-signer-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary keystore: %v", err)
+	}
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.NewAccount("password")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", core.NewSignerAPI(1337, accounts.NewManager(ks), approvingUI{})); err != nil {
+		t.Fatalf("failed to register signer API: %v", err)
+	}
+	signer := newExternalSigner(rpc.DialInProc(server), "inproc")
+	return signer, account, func() { server.Stop(); os.RemoveAll(dir) }
+}
+
+// testTx creates a plain value transfer to sign.
+func testTx() *types.Transaction {
+	return types.NewTransaction(7, common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314"), big.NewInt(1000), big.NewInt(21000), big.NewInt(1), nil)
+}
+
+// Tests that accounts are listed and transactions signed through the signer's
+// account_* RPC API.
+func TestExternalSigner(t *testing.T) {
+	signer, account, teardown := newTestSigner(t)
+	defer teardown()
+
+	accs := signer.Accounts()
+	if len(accs) != 1 || accs[0].Address != account.Address || accs[0].URL != signer.URL() {
+		t.Fatalf("account list mismatch: have %v, want [%x]", accs, account.Address)
+	}
+	if !signer.Contains(accounts.Account{Address: account.Address}) {
+		t.Errorf("listed account not contained")
+	}
+	tx := testTx()
+	signed, err := signer.SignTx(accs[0], tx, big.NewInt(1337))
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if signed.Hash() == tx.Hash() || signed.Nonce() != tx.Nonce() || signed.Value().Cmp(tx.Value()) != 0 {
+		t.Errorf("signed transaction mismatch: have %v", signed)
+	}
+	if sender, err := types.Sender(types.NewEIP155Signer(big.NewInt(1337)), signed); err != nil || sender != account.Address {
+		t.Errorf("sender mismatch: have %x, want %x, err %v", sender, account.Address, err)
+	}
+	// Transactions signed for another chain must be rejected
+	if _, err := signer.SignTx(accs[0], tx, big.NewInt(1)); err == nil || !strings.Contains(err.Error(), "chain id mismatch") {
+		t.Errorf("chain mismatch error mismatch: have %v", err)
+	}
+	// Data signing is not forwarded to the signer
+	if _, err := signer.SignHash(accs[0], crypto.Keccak256(nil)); err != accounts.ErrNotSupported {
+		t.Errorf("hash signing error mismatch: have %v, want %v", err, accounts.ErrNotSupported)
+	}
+}
+
+// FakeSigner is an account_* API replying with a preset account list and signed
+// transaction.
+type FakeSigner struct {
+	addrs   []common.Address
+	listErr error
+	lists   int
+	tx      *types.Transaction
+}
+
+func (s *FakeSigner) List() ([]common.Address, error) {
+	s.lists++
+	return s.addrs, s.listErr
+}
+
+func (s *FakeSigner) SignTransaction(args map[string]interface{}) (*ethapi.SignTransactionResult, error) {
+	return &ethapi.SignTransactionResult{Tx: s.tx}, nil
+}
+
+// Tests that invalid signer replies are rejected instead of being accepted (or
+// crashing the node).
+func TestExternalSignerInvalidReplies(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	account := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+
+	fake := new(FakeSigner)
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", fake); err != nil {
+		t.Fatalf("failed to register fake signer API: %v", err)
+	}
+	defer server.Stop()
+	signer := newExternalSigner(rpc.DialInProc(server), "inproc")
+
+	// Approved request without a transaction in the reply
+	if _, err := signer.SignTx(account, testTx(), big.NewInt(1337)); err != errMissingTransaction {
+		t.Errorf("missing transaction error mismatch: have %v, want %v", err, errMissingTransaction)
+	}
+	// Transaction signed by a different account
+	fake.tx, _ = types.SignTx(testTx(), types.NewEIP155Signer(big.NewInt(1337)), other)
+	if _, err := signer.SignTx(account, testTx(), big.NewInt(1337)); err == nil || !strings.Contains(err.Error(), "signer mismatch") {
+		t.Errorf("sender mismatch error mismatch: have %v", err)
+	}
+	// Transaction correctly signed
+	fake.tx, _ = types.SignTx(testTx(), types.NewEIP155Signer(big.NewInt(1337)), key)
+	if _, err := signer.SignTx(account, testTx(), big.NewInt(1337)); err != nil {
+		t.Errorf("failed to accept valid signature: %v", err)
+	}
+}
+
+// Tests that account listings are cached for a while, denied ones included, and
+// that the signer is asked again once the cache expires.
+func TestExternalSignerAccountCache(t *testing.T) {
+	fake := &FakeSigner{listErr: errors.New("listing denied")}
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", fake); err != nil {
+		t.Fatalf("failed to register fake signer API: %v", err)
+	}
+	defer server.Stop()
+	signer := newExternalSigner(rpc.DialInProc(server), "inproc")
+
+	// Denied listings must not be retried until the backoff expires
+	for i := 0; i < 2; i++ {
+		if accs := signer.Accounts(); len(accs) != 0 {
+			t.Fatalf("denied listing %d: have %v, want none", i, accs)
+		}
+	}
+	if fake.lists != 1 {
+		t.Fatalf("listings after denial mismatch: have %d, want 1", fake.lists)
+	}
+	// Once expired, the signer must be asked again and its reply cached
+	addr := common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+	fake.addrs, fake.listErr = []common.Address{addr}, nil
+	signer.cacheExpiry = time.Time{}
+
+	for i := 0; i < 2; i++ {
+		if accs := signer.Accounts(); len(accs) != 1 || accs[0].Address != addr {
+			t.Fatalf("approved listing %d: have %v, want [%x]", i, accs, addr)
+		}
+	}
+	if fake.lists != 2 {
+		t.Fatalf("listings after approval mismatch: have %d, want 2", fake.lists)
+	}
+	// Once the successful listing expires, changes must be picked up
+	fake.addrs = nil
+	signer.cacheExpiry = time.Time{}
+
+	if accs := signer.Accounts(); len(accs) != 0 {
+		t.Fatalf("refreshed listing: have %v, want none", accs)
+	}
+	if fake.lists != 3 {
+		t.Fatalf("listings after refresh mismatch: have %d, want 3", fake.lists)
+	}
+}
@@ -65,6 +65,24 @@ func (u URL) MarshalJSON() ([]byte, error) {
 	return json.Marshal(u.String())
 }
 
+// UnmarshalJSON parses url.
+func (u *URL) UnmarshalJSON(input []byte) error {
+	var textURL string
+	if err := json.Unmarshal(input, &textURL); err != nil {
+		return err
+	}
+	if textURL == "" {
+		*u = URL{}
+		return nil
+	}
+	url, err := parseURL(textURL)
+	if err != nil {
+		return err
+	}
+	*u = url
+	return nil
+}
+
 // Cmp compares x and y and returns:
 //
 //   -1 if x <  y
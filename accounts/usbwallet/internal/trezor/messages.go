@@ -0,0 +1,539 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trezor
+
+// Initialize resets the device and requests its features.
+type Initialize struct{}
+
+// Type implements Message.
+func (m *Initialize) Type() MessageType { return TypeInitialize }
+
+// Marshal implements Message.
+func (m *Initialize) Marshal() []byte { return nil }
+
+// Unmarshal implements Message.
+func (m *Initialize) Unmarshal(data []byte) error {
+	*m = Initialize{}
+	return decode(data, func(int, int, uint64, []byte) error { return nil })
+}
+
+// Ping tests the device connection, optionally forcing the PIN and passphrase
+// protections to be checked.
+type Ping struct {
+	Message              *string // Message to send back in the Success reply
+	ButtonProtection     *bool   // Whether to ask for a button confirmation
+	PinProtection        *bool   // Whether to ask for the PIN
+	PassphraseProtection *bool   // Whether to ask for the passphrase
+}
+
+// Type implements Message.
+func (m *Ping) Type() MessageType { return TypePing }
+
+// Marshal implements Message.
+func (m *Ping) Marshal() []byte {
+	e := new(encoder)
+	e.string(1, m.Message)
+	e.bool(2, m.ButtonProtection)
+	e.bool(3, m.PinProtection)
+	e.bool(4, m.PassphraseProtection)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *Ping) Unmarshal(data []byte) error {
+	*m = Ping{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) error {
+		switch field {
+		case 1:
+			m.Message = newString(payload)
+		case 2:
+			m.ButtonProtection = newBool(num)
+		case 3:
+			m.PinProtection = newBool(num)
+		case 4:
+			m.PassphraseProtection = newBool(num)
+		}
+		return nil
+	})
+}
+
+// Success is the reply to a request that completed without a dedicated result.
+type Success struct {
+	Message *string // Human readable description of the success
+}
+
+// Type implements Message.
+func (m *Success) Type() MessageType { return TypeSuccess }
+
+// Marshal implements Message.
+func (m *Success) Marshal() []byte {
+	e := new(encoder)
+	e.string(1, m.Message)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *Success) Unmarshal(data []byte) error {
+	*m = Success{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) error {
+		if field == 1 {
+			m.Message = newString(payload)
+		}
+		return nil
+	})
+}
+
+// Failure is the reply to a request that could not be completed.
+type Failure struct {
+	Code    *uint32 // Computer readable failure code
+	Message *string // Human readable description of the failure
+}
+
+// Type implements Message.
+func (m *Failure) Type() MessageType { return TypeFailure }
+
+// Marshal implements Message.
+func (m *Failure) Marshal() []byte {
+	e := new(encoder)
+	e.uint32(1, m.Code)
+	e.string(2, m.Message)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *Failure) Unmarshal(data []byte) error {
+	*m = Failure{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) error {
+		switch field {
+		case 1:
+			m.Code = newUint32(num)
+		case 2:
+			m.Message = newString(payload)
+		}
+		return nil
+	})
+}
+
+// GetMessage returns the failure description, or an empty string if unset.
+func (m *Failure) GetMessage() string {
+	if m.Message != nil {
+		return *m.Message
+	}
+	return ""
+}
+
+// Features is the reply to Initialize, describing the device and its firmware.
+type Features struct {
+	Vendor               *string // Name of the manufacturer, e.g. "bitcointrezor.com"
+	MajorVersion         *uint32 // Major version of the firmware
+	MinorVersion         *uint32 // Minor version of the firmware
+	PatchVersion         *uint32 // Patch version of the firmware
+	DeviceID             *string // Device's unique identifier
+	PinProtection        *bool   // Whether the device is protected by a PIN
+	PassphraseProtection *bool   // Whether the node is protected by a passphrase
+	Label                *string // Device description label
+	Initialized          *bool   // Whether the device contains a seed
+}
+
+// Type implements Message.
+func (m *Features) Type() MessageType { return TypeFeatures }
+
+// Marshal implements Message.
+func (m *Features) Marshal() []byte {
+	e := new(encoder)
+	e.string(1, m.Vendor)
+	e.uint32(2, m.MajorVersion)
+	e.uint32(3, m.MinorVersion)
+	e.uint32(4, m.PatchVersion)
+	e.string(6, m.DeviceID)
+	e.bool(7, m.PinProtection)
+	e.bool(8, m.PassphraseProtection)
+	e.string(10, m.Label)
+	e.bool(12, m.Initialized)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *Features) Unmarshal(data []byte) error {
+	*m = Features{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) error {
+		switch field {
+		case 1:
+			m.Vendor = newString(payload)
+		case 2:
+			m.MajorVersion = newUint32(num)
+		case 3:
+			m.MinorVersion = newUint32(num)
+		case 4:
+			m.PatchVersion = newUint32(num)
+		case 6:
+			m.DeviceID = newString(payload)
+		case 7:
+			m.PinProtection = newBool(num)
+		case 8:
+			m.PassphraseProtection = newBool(num)
+		case 10:
+			m.Label = newString(payload)
+		case 12:
+			m.Initialized = newBool(num)
+		}
+		return nil
+	})
+}
+
+// GetVersion returns the major, minor and patch versions of the firmware.
+func (m *Features) GetVersion() [3]uint32 {
+	var version [3]uint32
+	for i, v := range []*uint32{m.MajorVersion, m.MinorVersion, m.PatchVersion} {
+		if v != nil {
+			version[i] = *v
+		}
+	}
+	return version
+}
+
+// GetLabel returns the device label, or an empty string if unset.
+func (m *Features) GetLabel() string {
+	if m.Label != nil {
+		return *m.Label
+	}
+	return ""
+}
+
+// PinMatrixRequest asks for the PIN, entered via a scrambled matrix shown on
+// the device.
+type PinMatrixRequest struct {
+	Kind *uint32 // Reason for the PIN request (current, new or repeated)
+}
+
+// Type implements Message.
+func (m *PinMatrixRequest) Type() MessageType { return TypePinMatrixRequest }
+
+// Marshal implements Message.
+func (m *PinMatrixRequest) Marshal() []byte {
+	e := new(encoder)
+	e.uint32(1, m.Kind)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *PinMatrixRequest) Unmarshal(data []byte) error {
+	*m = PinMatrixRequest{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) error {
+		if field == 1 {
+			m.Kind = newUint32(num)
+		}
+		return nil
+	})
+}
+
+// PinMatrixAck replies to PinMatrixRequest with the matrix positions of the PIN.
+type PinMatrixAck struct {
+	Pin *string // PIN encoded as positions on the scrambled matrix
+}
+
+// Type implements Message.
+func (m *PinMatrixAck) Type() MessageType { return TypePinMatrixAck }
+
+// Marshal implements Message.
+func (m *PinMatrixAck) Marshal() []byte {
+	e := new(encoder)
+	e.string(1, m.Pin)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *PinMatrixAck) Unmarshal(data []byte) error {
+	*m = PinMatrixAck{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) error {
+		if field == 1 {
+			m.Pin = newString(payload)
+		}
+		return nil
+	})
+}
+
+// ButtonRequest notifies that the device awaits a physical button confirmation.
+type ButtonRequest struct {
+	Code *uint32 // Reason for the button request
+	Data *string // Optional data associated with the request
+}
+
+// Type implements Message.
+func (m *ButtonRequest) Type() MessageType { return TypeButtonRequest }
+
+// Marshal implements Message.
+func (m *ButtonRequest) Marshal() []byte {
+	e := new(encoder)
+	e.uint32(1, m.Code)
+	e.string(2, m.Data)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *ButtonRequest) Unmarshal(data []byte) error {
+	*m = ButtonRequest{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) error {
+		switch field {
+		case 1:
+			m.Code = newUint32(num)
+		case 2:
+			m.Data = newString(payload)
+		}
+		return nil
+	})
+}
+
+// ButtonAck replies to ButtonRequest, allowing the device to wait for the user.
+type ButtonAck struct{}
+
+// Type implements Message.
+func (m *ButtonAck) Type() MessageType { return TypeButtonAck }
+
+// Marshal implements Message.
+func (m *ButtonAck) Marshal() []byte { return nil }
+
+// Unmarshal implements Message.
+func (m *ButtonAck) Unmarshal(data []byte) error {
+	*m = ButtonAck{}
+	return decode(data, func(int, int, uint64, []byte) error { return nil })
+}
+
+// PassphraseRequest asks for the passphrase protecting the wallet's seed.
+type PassphraseRequest struct{}
+
+// Type implements Message.
+func (m *PassphraseRequest) Type() MessageType { return TypePassphraseRequest }
+
+// Marshal implements Message.
+func (m *PassphraseRequest) Marshal() []byte { return nil }
+
+// Unmarshal implements Message.
+func (m *PassphraseRequest) Unmarshal(data []byte) error {
+	*m = PassphraseRequest{}
+	return decode(data, func(int, int, uint64, []byte) error { return nil })
+}
+
+// PassphraseAck replies to PassphraseRequest with the user's passphrase.
+type PassphraseAck struct {
+	Passphrase *string // Passphrase protecting the wallet's seed
+}
+
+// Type implements Message.
+func (m *PassphraseAck) Type() MessageType { return TypePassphraseAck }
+
+// Marshal implements Message.
+func (m *PassphraseAck) Marshal() []byte {
+	e := new(encoder)
+	e.string(1, m.Passphrase)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *PassphraseAck) Unmarshal(data []byte) error {
+	*m = PassphraseAck{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) error {
+		if field == 1 {
+			m.Passphrase = newString(payload)
+		}
+		return nil
+	})
+}
+
+// EthereumGetAddress requests the Ethereum address at a BIP32 derivation path.
+type EthereumGetAddress struct {
+	AddressN    []uint32 // BIP32 derivation path of the requested address
+	ShowDisplay *bool    // Whether to show the address on the device's display
+}
+
+// Type implements Message.
+func (m *EthereumGetAddress) Type() MessageType { return TypeEthereumGetAddress }
+
+// Marshal implements Message.
+func (m *EthereumGetAddress) Marshal() []byte {
+	e := new(encoder)
+	e.uint32s(1, m.AddressN)
+	e.bool(2, m.ShowDisplay)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *EthereumGetAddress) Unmarshal(data []byte) error {
+	*m = EthereumGetAddress{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) (err error) {
+		switch field {
+		case 1:
+			m.AddressN, err = appendUint32s(m.AddressN, wire, num, payload)
+		case 2:
+			m.ShowDisplay = newBool(num)
+		}
+		return err
+	})
+}
+
+// EthereumAddress is the reply to EthereumGetAddress.
+type EthereumAddress struct {
+	Address []byte // Raw 20 byte Ethereum address
+}
+
+// Type implements Message.
+func (m *EthereumAddress) Type() MessageType { return TypeEthereumAddress }
+
+// Marshal implements Message.
+func (m *EthereumAddress) Marshal() []byte {
+	e := new(encoder)
+	e.bytes(1, m.Address)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *EthereumAddress) Unmarshal(data []byte) error {
+	*m = EthereumAddress{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) error {
+		if field == 1 {
+			m.Address = copyBytes(payload)
+		}
+		return nil
+	})
+}
+
+// EthereumSignTx requests the signing of an Ethereum transaction. Numeric values
+// are big endian encoded without leading zeroes. If the data does not fit into
+// the initial chunk, the device will request the remainder via EthereumTxRequest.
+type EthereumSignTx struct {
+	AddressN         []uint32 // BIP32 derivation path of the signing key
+	Nonce            []byte   // Nonce of the transaction
+	GasPrice         []byte   // Gas price of the transaction
+	GasLimit         []byte   // Gas limit of the transaction
+	To               []byte   // Recipient of the transaction (nil for contract creation)
+	Value            []byte   // Amount of wei to transfer
+	DataInitialChunk []byte   // Leading part of the data, at most 1024 bytes
+	DataLength       *uint32  // Total length of the data
+	ChainID          *uint32  // Chain identifier for EIP-155 replay protection
+}
+
+// Type implements Message.
+func (m *EthereumSignTx) Type() MessageType { return TypeEthereumSignTx }
+
+// Marshal implements Message.
+func (m *EthereumSignTx) Marshal() []byte {
+	e := new(encoder)
+	e.uint32s(1, m.AddressN)
+	e.bytes(2, m.Nonce)
+	e.bytes(3, m.GasPrice)
+	e.bytes(4, m.GasLimit)
+	e.bytes(5, m.To)
+	e.bytes(6, m.Value)
+	e.bytes(7, m.DataInitialChunk)
+	e.uint32(8, m.DataLength)
+	e.uint32(9, m.ChainID)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *EthereumSignTx) Unmarshal(data []byte) error {
+	*m = EthereumSignTx{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) (err error) {
+		switch field {
+		case 1:
+			m.AddressN, err = appendUint32s(m.AddressN, wire, num, payload)
+		case 2:
+			m.Nonce = copyBytes(payload)
+		case 3:
+			m.GasPrice = copyBytes(payload)
+		case 4:
+			m.GasLimit = copyBytes(payload)
+		case 5:
+			m.To = copyBytes(payload)
+		case 6:
+			m.Value = copyBytes(payload)
+		case 7:
+			m.DataInitialChunk = copyBytes(payload)
+		case 8:
+			m.DataLength = newUint32(num)
+		case 9:
+			m.ChainID = newUint32(num)
+		}
+		return err
+	})
+}
+
+// EthereumTxRequest is the reply to EthereumSignTx and EthereumTxAck, either
+// requesting the next data chunk or returning the final signature.
+type EthereumTxRequest struct {
+	DataLength *uint32 // Number of data bytes requested next (unset when done)
+	SignatureV *uint32 // Recovery identifier of the signature (27/28 or EIP-155 adjusted)
+	SignatureR []byte  // R component of the signature
+	SignatureS []byte  // S component of the signature
+}
+
+// Type implements Message.
+func (m *EthereumTxRequest) Type() MessageType { return TypeEthereumTxRequest }
+
+// Marshal implements Message.
+func (m *EthereumTxRequest) Marshal() []byte {
+	e := new(encoder)
+	e.uint32(1, m.DataLength)
+	e.uint32(2, m.SignatureV)
+	e.bytes(3, m.SignatureR)
+	e.bytes(4, m.SignatureS)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *EthereumTxRequest) Unmarshal(data []byte) error {
+	*m = EthereumTxRequest{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) error {
+		switch field {
+		case 1:
+			m.DataLength = newUint32(num)
+		case 2:
+			m.SignatureV = newUint32(num)
+		case 3:
+			m.SignatureR = copyBytes(payload)
+		case 4:
+			m.SignatureS = copyBytes(payload)
+		}
+		return nil
+	})
+}
+
+// EthereumTxAck replies to EthereumTxRequest with the next chunk of data.
+type EthereumTxAck struct {
+	DataChunk []byte // Requested chunk of the transaction data
+}
+
+// Type implements Message.
+func (m *EthereumTxAck) Type() MessageType { return TypeEthereumTxAck }
+
+// Marshal implements Message.
+func (m *EthereumTxAck) Marshal() []byte {
+	e := new(encoder)
+	e.bytes(1, m.DataChunk)
+	return e.buf
+}
+
+// Unmarshal implements Message.
+func (m *EthereumTxAck) Unmarshal(data []byte) error {
+	*m = EthereumTxAck{}
+	return decode(data, func(field int, wire int, num uint64, payload []byte) error {
+		if field == 1 {
+			m.DataChunk = copyBytes(payload)
+		}
+		return nil
+	})
+}
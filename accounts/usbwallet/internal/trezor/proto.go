@@ -0,0 +1,195 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trezor
+
+import "errors"
+
+// Protobuf wire types used by the Trezor messages.
+const (
+	wireVarint = 0 // int32, uint32, bool, enum
+	wireBytes  = 2 // string, bytes, packed repeated fields
+)
+
+var (
+	errTruncated   = errors.New("protobuf: truncated message")
+	errOverflow    = errors.New("protobuf: varint overflow")
+	errUnsupported = errors.New("protobuf: unsupported wire type")
+)
+
+// encoder accumulates the protobuf encoding of a message. Fields are only
+// emitted if set, matching the proto2 optional semantics of the Trezor specs.
+type encoder struct {
+	buf []byte
+}
+
+// varint appends a base 128 varint to the encoded message.
+func (e *encoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.buf = append(e.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	e.buf = append(e.buf, byte(v))
+}
+
+// key appends a field key composed of the field number and wire type.
+func (e *encoder) key(field int, wire int) {
+	e.varint(uint64(field<<3 | wire))
+}
+
+// uint32 appends an optional unsigned integer field.
+func (e *encoder) uint32(field int, v *uint32) {
+	if v != nil {
+		e.key(field, wireVarint)
+		e.varint(uint64(*v))
+	}
+}
+
+// uint32s appends a repeated unsigned integer field in unpacked form.
+func (e *encoder) uint32s(field int, vs []uint32) {
+	for _, v := range vs {
+		e.key(field, wireVarint)
+		e.varint(uint64(v))
+	}
+}
+
+// bool appends an optional boolean field.
+func (e *encoder) bool(field int, v *bool) {
+	if v != nil {
+		e.key(field, wireVarint)
+		if *v {
+			e.varint(1)
+		} else {
+			e.varint(0)
+		}
+	}
+}
+
+// bytes appends an optional length delimited field.
+func (e *encoder) bytes(field int, v []byte) {
+	if v != nil {
+		e.key(field, wireBytes)
+		e.varint(uint64(len(v)))
+		e.buf = append(e.buf, v...)
+	}
+}
+
+// string appends an optional string field.
+func (e *encoder) string(field int, v *string) {
+	if v != nil {
+		e.bytes(field, []byte(*v))
+	}
+}
+
+// readVarint decodes a base 128 varint from the start of data, returning it
+// along with the number of bytes consumed.
+func readVarint(data []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(data); i++ {
+		if i == 10 {
+			return 0, 0, errOverflow
+		}
+		v |= uint64(data[i]&0x7f) << (7 * uint(i))
+		if data[i] < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errTruncated
+}
+
+// decode iterates over the fields of a protobuf encoded message, invoking fn
+// with the field number and wire type, along with the integer value for varint
+// fields or the payload for length delimited ones.
+func decode(data []byte, fn func(field int, wire int, num uint64, payload []byte) error) error {
+	for len(data) > 0 {
+		key, n, err := readVarint(data)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+
+		var (
+			field = int(key >> 3)
+			wire  = int(key & 7)
+			num   uint64
+			load  []byte
+		)
+		switch wire {
+		case wireVarint:
+			if num, n, err = readVarint(data); err != nil {
+				return err
+			}
+			data = data[n:]
+
+		case wireBytes:
+			size, n, err := readVarint(data)
+			if err != nil {
+				return err
+			}
+			data = data[n:]
+			if uint64(len(data)) < size {
+				return errTruncated
+			}
+			load, data = data[:size], data[size:]
+
+		default:
+			return errUnsupported
+		}
+		if err := fn(field, wire, num, load); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendUint32s decodes a repeated unsigned integer field element, accepting
+// both the unpacked and the packed encodings.
+func appendUint32s(vs []uint32, wire int, num uint64, payload []byte) ([]uint32, error) {
+	if wire == wireVarint {
+		return append(vs, uint32(num)), nil
+	}
+	for len(payload) > 0 {
+		v, n, err := readVarint(payload)
+		if err != nil {
+			return nil, err
+		}
+		vs, payload = append(vs, uint32(v)), payload[n:]
+	}
+	return vs, nil
+}
+
+// newUint32 returns a pointer to a copy of v, used to set optional fields.
+func newUint32(v uint64) *uint32 {
+	n := uint32(v)
+	return &n
+}
+
+// newBool returns a pointer to a copy of v, used to set optional fields.
+func newBool(v uint64) *bool {
+	b := v != 0
+	return &b
+}
+
+// newString returns a pointer to a copy of v, used to set optional fields.
+func newString(v []byte) *string {
+	s := string(v)
+	return &s
+}
+
+// copyBytes returns a copy of v that does not alias the decoded message.
+func copyBytes(v []byte) []byte {
+	return append([]byte{}, v...)
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package trezor contains the wire protocol messages used to communicate with
+// Trezor hardware wallets.
+//
+// The messages are a hand picked subset of the ones defined by the official
+// protocol buffer specs at https://github.com/trezor/trezor-common/tree/master/protob,
+// with a minimal protobuf encoder and decoder to avoid pulling in a full code
+// generation toolchain for a dozen of messages.
+package trezor
+
+import "fmt"
+
+// MessageType is the identifier of a Trezor message on the wire.
+type MessageType uint16
+
+// The Trezor message types supported by this package.
+const (
+	TypeInitialize         MessageType = 0
+	TypePing               MessageType = 1
+	TypeSuccess            MessageType = 2
+	TypeFailure            MessageType = 3
+	TypeFeatures           MessageType = 17
+	TypePinMatrixRequest   MessageType = 18
+	TypePinMatrixAck       MessageType = 19
+	TypeButtonRequest      MessageType = 26
+	TypeButtonAck          MessageType = 27
+	TypePassphraseRequest  MessageType = 41
+	TypePassphraseAck      MessageType = 42
+	TypeEthereumGetAddress MessageType = 56
+	TypeEthereumAddress    MessageType = 57
+	TypeEthereumSignTx     MessageType = 58
+	TypeEthereumTxRequest  MessageType = 59
+	TypeEthereumTxAck      MessageType = 60
+)
+
+// typeNames maps the supported message types to their protocol names.
+var typeNames = map[MessageType]string{
+	TypeInitialize:         "Initialize",
+	TypePing:               "Ping",
+	TypeSuccess:            "Success",
+	TypeFailure:            "Failure",
+	TypeFeatures:           "Features",
+	TypePinMatrixRequest:   "PinMatrixRequest",
+	TypePinMatrixAck:       "PinMatrixAck",
+	TypeButtonRequest:      "ButtonRequest",
+	TypeButtonAck:          "ButtonAck",
+	TypePassphraseRequest:  "PassphraseRequest",
+	TypePassphraseAck:      "PassphraseAck",
+	TypeEthereumGetAddress: "EthereumGetAddress",
+	TypeEthereumAddress:    "EthereumAddress",
+	TypeEthereumSignTx:     "EthereumSignTx",
+	TypeEthereumTxRequest:  "EthereumTxRequest",
+	TypeEthereumTxAck:      "EthereumTxAck",
+}
+
+// String implements fmt.Stringer, returning the protocol name of the message type.
+func (t MessageType) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("MessageType(%d)", uint16(t))
+}
+
+// Message is a Trezor protocol message that can be serialized into and parsed
+// from the protobuf wire format.
+type Message interface {
+	// Type returns the wire identifier of the message.
+	Type() MessageType
+
+	// Marshal encodes the message into its protobuf wire format.
+	Marshal() []byte
+
+	// Unmarshal decodes the protobuf wire format into the message.
+	Unmarshal(data []byte) error
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trezor
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// Tests that messages are encoded according to the protobuf wire format.
+func TestMarshal(t *testing.T) {
+	yes := true
+	tests := []struct {
+		msg  Message
+		want []byte
+	}{
+		{&Initialize{}, nil},
+		{&Ping{PinProtection: &yes}, []byte{0x18, 0x01}},
+		{&EthereumGetAddress{AddressN: []uint32{0x8000002c, 1}}, []byte{0x08, 0xac, 0x80, 0x80, 0x80, 0x08, 0x08, 0x01}},
+		{&EthereumTxAck{DataChunk: []byte{0xca, 0xfe}}, []byte{0x0a, 0x02, 0xca, 0xfe}},
+	}
+	for i, tt := range tests {
+		if have := tt.msg.Marshal(); !bytes.Equal(have, tt.want) {
+			t.Errorf("test %d: encoding mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that messages survive an encoding round trip.
+func TestRoundTrip(t *testing.T) {
+	length, chainID, v := uint32(3000), uint32(1337), uint32(2709)
+	tests := []struct {
+		msg   Message
+		blank Message
+	}{
+		{
+			&EthereumSignTx{
+				AddressN:         []uint32{0x8000002c, 0x8000003c, 0x80000000, 0},
+				Nonce:            []byte{0x01},
+				GasPrice:         []byte{0x04, 0xa8, 0x17, 0xc8, 0x00},
+				GasLimit:         []byte{0x52, 0x08},
+				To:               bytes.Repeat([]byte{0x11}, 20),
+				Value:            []byte{},
+				DataInitialChunk: bytes.Repeat([]byte{0xff}, 1024),
+				DataLength:       &length,
+				ChainID:          &chainID,
+			},
+			new(EthereumSignTx),
+		},
+		{
+			&EthereumTxRequest{SignatureV: &v, SignatureR: bytes.Repeat([]byte{0x22}, 32), SignatureS: bytes.Repeat([]byte{0x33}, 32)},
+			new(EthereumTxRequest),
+		},
+		{&EthereumTxRequest{DataLength: &length}, new(EthereumTxRequest)},
+	}
+	for i, tt := range tests {
+		if err := tt.blank.Unmarshal(tt.msg.Marshal()); err != nil {
+			t.Fatalf("test %d: failed to decode: %v", i, err)
+		}
+		if !reflect.DeepEqual(tt.blank, tt.msg) {
+			t.Errorf("test %d: round trip mismatch: have %+v, want %+v", i, tt.blank, tt.msg)
+		}
+	}
+}
+
+// Tests that packed repeated fields and unknown fields are accepted, and that
+// malformed input is rejected.
+func TestUnmarshal(t *testing.T) {
+	msg := new(EthereumGetAddress)
+	if err := msg.Unmarshal([]byte{0x0a, 0x02, 0x2c, 0x01, 0x78, 0x05, 0x10, 0x01}); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if !reflect.DeepEqual(msg.AddressN, []uint32{0x2c, 1}) || msg.ShowDisplay == nil || !*msg.ShowDisplay {
+		t.Errorf("decoded message mismatch: %+v", msg)
+	}
+	for i, data := range [][]byte{{0x0a, 0x05, 0x01}, {0x08}, {0x0d, 0x00, 0x00, 0x00, 0x00}} {
+		if err := msg.Unmarshal(data); err == nil {
+			t.Errorf("test %d: malformed input accepted", i)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// This file contains the implementation for interacting with the Trezor hardware
+// wallets. The wire protocol spec can be found on the SatoshiLabs website:
+// https://doc.satoshilabs.com/trezor-tech/api-protobuf.html
+
+package usbwallet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet/internal/trezor"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ErrTrezorPINNeeded is returned if opening the trezor requires a PIN code. In
+// this case, the calling application should display a pinpad and send back the
+// encoded passphrase.
+var ErrTrezorPINNeeded = errors.New("trezor: pin needed")
+
+// ErrTrezorPassphraseNeeded is returned if opening the trezor requires the
+// passphrase protecting its seed. In this case, the calling application should
+// request the passphrase from the user and send it back via Open.
+var ErrTrezorPassphraseNeeded = errors.New("trezor: passphrase needed")
+
+// errTrezorReplyInvalidHeader is the error message returned by a Trezor data exchange
+// if the device replies with a mismatching header.
+var errTrezorReplyInvalidHeader = errors.New("trezor: invalid reply header")
+
+// Maximum number of transaction data bytes sent along the signing request, with
+// the remainder being streamed on demand.
+const trezorDataChunkSize = 1024
+
+// trezorDriver implements the communication with a Trezor hardware wallet.
+type trezorDriver struct {
+	device         io.ReadWriter // USB device connection to communicate through
+	version        [3]uint32     // Current version of the Trezor firmware
+	label          string        // Current textual label of the Trezor device
+	pinwait        bool          // Flags whether the device is waiting for PIN entry
+	passphrasewait bool          // Flags whether the device is waiting for passphrase entry
+	log            log.Logger    // Logger to allow outputting events to the user
+}
+
+// newTrezorDriver creates a new instance of a Trezor USB protocol driver.
+func newTrezorDriver(logger log.Logger) driver {
+	return &trezorDriver{
+		log: logger,
+	}
+}
+
+// Status implements driver, returning the firmware version and label of the
+// Trezor, and whether it's still waiting for the user to unlock it.
+func (w *trezorDriver) Status() string {
+	status := fmt.Sprintf("Trezor v%d.%d.%d '%s' online", w.version[0], w.version[1], w.version[2], w.label)
+	switch {
+	case w.pinwait:
+		return status + " (waiting for PIN)"
+	case w.passphrasewait:
+		return status + " (waiting for passphrase)"
+	}
+	return status
+}
+
+// Offline implements driver, returning whether the Trezor is still waiting for
+// the user to unlock it.
+func (w *trezorDriver) Offline() bool {
+	return w.device == nil || w.pinwait || w.passphrasewait
+}
+
+// Open implements driver, attempting to initialize the connection to the Trezor
+// hardware wallet. Initializing the Trezor is a multi phase operation:
+//  * The first phase is to initialize the connection and read the wallet's
+//    features. This phase is invoked if the device is not waiting for any user
+//    input. The device will display the pinpad if it's PIN protected and will
+//    return an appropriate error to notify the user that a second phase is needed.
+//  * The second phase is to unlock access to the Trezor, which is done by the
+//    user actually providing a passphrase mapping a keyboard keypad to the pin
+//    number of the user (shuffled according to the pinpad displayed).
+//  * If the seed is protected by a passphrase, a final phase is needed to send
+//    the passphrase itself over to the device.
+func (w *trezorDriver) Open(device io.ReadWriter, passphrase string) error {
+	w.device = device
+
+	switch {
+	case w.pinwait:
+		// Second phase, an empty PIN can't unlock anything, keep waiting for it
+		if passphrase == "" {
+			return ErrTrezorPINNeeded
+		}
+		w.pinwait = false
+
+		res, err := w.trezorExchange(&trezor.PinMatrixAck{Pin: &passphrase}, new(trezor.Success), new(trezor.PassphraseRequest))
+		if err != nil {
+			return err
+		}
+		if res == 1 {
+			w.passphrasewait = true
+			return ErrTrezorPassphraseNeeded
+		}
+		return nil
+
+	case w.passphrasewait:
+		// Final phase, send over the passphrase protecting the seed
+		w.passphrasewait = false
+
+		_, err := w.trezorExchange(&trezor.PassphraseAck{Passphrase: &passphrase}, new(trezor.Success))
+		return err
+	}
+	// First phase, initialize the connection and read the supported features
+	features := new(trezor.Features)
+	if _, err := w.trezorExchange(&trezor.Initialize{}, features); err != nil {
+		return err
+	}
+	w.version, w.label = features.GetVersion(), features.GetLabel()
+
+	// Do a manual ping, forcing the device to ask for its PIN and passphrase
+	askPin, askPassphrase := true, true
+	res, err := w.trezorExchange(&trezor.Ping{PinProtection: &askPin, PassphraseProtection: &askPassphrase}, new(trezor.PinMatrixRequest), new(trezor.PassphraseRequest), new(trezor.Success))
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 0:
+		w.pinwait = true
+		return ErrTrezorPINNeeded
+	case 1:
+		w.passphrasewait = true
+		return ErrTrezorPassphraseNeeded
+	}
+	return nil
+}
+
+// Close implements driver, cleaning up any metadata maintained within the
+// Trezor driver.
+func (w *trezorDriver) Close() error {
+	w.device, w.version, w.label = nil, [3]uint32{}, ""
+	w.pinwait, w.passphrasewait = false, false
+	return nil
+}
+
+// Heartbeat implements driver, performing a sanity check against the Trezor to
+// see if it's still online.
+func (w *trezorDriver) Heartbeat() error {
+	_, err := w.trezorExchange(&trezor.Ping{}, new(trezor.Success))
+	return err
+}
+
+// Derive implements driver, sending a derivation request to the Trezor and
+// returning the Ethereum address located on that derivation path.
+func (w *trezorDriver) Derive(path accounts.DerivationPath) (common.Address, error) {
+	return w.trezorDerive(path)
+}
+
+// SignTx implements driver, sending the transaction to the Trezor and waiting
+// for the user to confirm or deny the transaction.
+func (w *trezorDriver) SignTx(path accounts.DerivationPath, tx *types.Transaction, chainID *big.Int) (common.Address, *types.Transaction, error) {
+	if w.Offline() {
+		return common.Address{}, nil, accounts.ErrWalletClosed
+	}
+	return w.trezorSign(path, tx, chainID)
+}
+
+// trezorDerive sends a derivation request to the Trezor device and returns the
+// Ethereum address located on that path.
+func (w *trezorDriver) trezorDerive(derivationPath []uint32) (common.Address, error) {
+	address := new(trezor.EthereumAddress)
+	if _, err := w.trezorExchange(&trezor.EthereumGetAddress{AddressN: derivationPath}, address); err != nil {
+		return common.Address{}, err
+	}
+	if len(address.Address) != common.AddressLength {
+		return common.Address{}, errors.New("reply lacks address entry")
+	}
+	return common.BytesToAddress(address.Address), nil
+}
+
+// trezorSign sends the transaction to the Trezor wallet, and waits for the user
+// to confirm or deny the transaction.
+//
+// The transaction data is streamed to the device in chunks: the first one along
+// the signing request, the rest on demand as requested by the device via the
+// data length field of its replies. Once all data is consumed, the device sends
+// back the signature, with V being 27/28 for Homestead signatures or adjusted
+// by the chain ID for EIP-155 ones.
+func (w *trezorDriver) trezorSign(derivationPath []uint32, tx *types.Transaction, chainID *big.Int) (common.Address, *types.Transaction, error) {
+	// Create the transaction initiation message
+	data := tx.Data()
+	length := uint32(len(data))
+
+	request := &trezor.EthereumSignTx{
+		AddressN:   derivationPath,
+		Nonce:      new(big.Int).SetUint64(tx.Nonce()).Bytes(),
+		GasPrice:   tx.GasPrice().Bytes(),
+		GasLimit:   tx.Gas().Bytes(),
+		Value:      tx.Value().Bytes(),
+		DataLength: &length,
+	}
+	if to := tx.To(); to != nil {
+		request.To = (*to)[:] // Non contract deploy, set recipient explicitly
+	}
+	if length > trezorDataChunkSize { // Send the data chunked if that was requested
+		request.DataInitialChunk, data = data[:trezorDataChunkSize], data[trezorDataChunkSize:]
+	} else {
+		request.DataInitialChunk, data = data, nil
+	}
+	if chainID != nil { // EIP-155 transaction, set chain ID explicitly (only 32 bit is supported)
+		id := uint32(chainID.Int64())
+		request.ChainID = &id
+	}
+	// Send the initiation message and stream content until a signature is returned
+	response := new(trezor.EthereumTxRequest)
+	if _, err := w.trezorExchange(request, response); err != nil {
+		return common.Address{}, nil, err
+	}
+	for response.DataLength != nil && int(*response.DataLength) <= len(data) {
+		chunk := data[:*response.DataLength]
+		data = data[*response.DataLength:]
+
+		if _, err := w.trezorExchange(&trezor.EthereumTxAck{DataChunk: chunk}, response); err != nil {
+			return common.Address{}, nil, err
+		}
+	}
+	// Extract the Ethereum signature and do a sanity validation
+	if len(response.SignatureR) == 0 || len(response.SignatureR) > 32 || len(response.SignatureS) == 0 || len(response.SignatureS) > 32 || response.SignatureV == nil {
+		return common.Address{}, nil, errors.New("reply lacks signature")
+	}
+	signature := append(common.LeftPadBytes(response.SignatureR, 32), common.LeftPadBytes(response.SignatureS, 32)...)
+	signature = append(signature, byte(*response.SignatureV))
+
+	// Create the correct signer and signature transform based on the chain ID
+	var signer types.Signer
+	if chainID == nil {
+		signer = new(types.HomesteadSigner)
+		signature[64] = signature[64] - 27
+	} else {
+		signer = types.NewEIP155Signer(chainID)
+		signature[64] = signature[64] - byte(chainID.Uint64()*2+35)
+	}
+	// Inject the final signature into the transaction and sanity check the sender
+	signed, err := tx.WithSignature(signer, signature)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	sender, err := types.Sender(signer, signed)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return sender, signed, nil
+}
+
+// trezorExchange performs a data exchange with the Trezor wallet, sending it a
+// message and retrieving the response. If multiple responses are possible, the
+// method will also return the index of the destination object used.
+//
+// Messages are framed into 64 byte HID reports, each starting with the '?'
+// report marker. The first report additionally carries the message header:
+//
+//  Description                    | Length
+//  -------------------------------+----------
+//  Magic '##'                     | 2 bytes
+//  Message type (big endian)      | 2 bytes
+//  Payload length (big endian)    | 4 bytes
+//  Protobuf encoded payload       | arbitrary
+//
+// Button confirmation requests are acknowledged transparently, waiting for the
+// user to act on the device, whereas failures are converted into errors.
+func (w *trezorDriver) trezorExchange(req trezor.Message, results ...trezor.Message) (int, error) {
+	// Construct the original message payload to chunk up
+	data := req.Marshal()
+
+	payload := make([]byte, 8+len(data))
+	copy(payload, []byte{0x23, 0x23})
+	binary.BigEndian.PutUint16(payload[2:], uint16(req.Type()))
+	binary.BigEndian.PutUint32(payload[4:], uint32(len(data)))
+	copy(payload[8:], data)
+
+	// Stream all the chunks to the device
+	chunk := make([]byte, 64)
+	chunk[0] = 0x3f // Report ID magic number
+
+	for len(payload) > 0 {
+		// Construct the new message to stream, padding with zeroes if needed
+		if len(payload) > 63 {
+			copy(chunk[1:], payload[:63])
+			payload = payload[63:]
+		} else {
+			copy(chunk[1:], payload)
+			copy(chunk[1+len(payload):], make([]byte, 63-len(payload)))
+			payload = nil
+		}
+		// Send over to the device
+		w.log.Trace("Data chunk sent to the Trezor", "chunk", hexutil.Bytes(chunk))
+		if _, err := w.device.Write(chunk); err != nil {
+			return 0, err
+		}
+	}
+	// Stream the reply back from the wallet in 64 byte chunks
+	var (
+		kind  trezor.MessageType
+		reply []byte
+	)
+	for {
+		// Read the next chunk from the Trezor wallet
+		if _, err := io.ReadFull(w.device, chunk); err != nil {
+			return 0, err
+		}
+		w.log.Trace("Data chunk received from the Trezor", "chunk", hexutil.Bytes(chunk))
+
+		// Make sure the transport header matches
+		if chunk[0] != 0x3f || (reply == nil && (chunk[1] != 0x23 || chunk[2] != 0x23)) {
+			return 0, errTrezorReplyInvalidHeader
+		}
+		// If it's the first chunk, retrieve the reply message type and total message length
+		var payload []byte
+
+		if reply == nil {
+			kind = trezor.MessageType(binary.BigEndian.Uint16(chunk[3:5]))
+			reply = make([]byte, 0, int(binary.BigEndian.Uint32(chunk[5:9])))
+			payload = chunk[9:]
+		} else {
+			payload = chunk[1:]
+		}
+		// Append to the reply and stop when filled up
+		if left := cap(reply) - len(reply); left > len(payload) {
+			reply = append(reply, payload...)
+		} else {
+			reply = append(reply, payload[:left]...)
+			break
+		}
+	}
+	// Try to parse the reply into the requested reply message
+	switch kind {
+	case trezor.TypeFailure:
+		// Trezor returned a failure, extract and return the message
+		failure := new(trezor.Failure)
+		if err := failure.Unmarshal(reply); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("trezor: " + failure.GetMessage())
+
+	case trezor.TypeButtonRequest:
+		// Trezor is waiting for user confirmation, ack and wait for the next message
+		return w.trezorExchange(&trezor.ButtonAck{}, results...)
+	}
+	for i, res := range results {
+		if res.Type() == kind {
+			return i, res.Unmarshal(reply)
+		}
+	}
+	expected := make([]string, len(results))
+	for i, res := range results {
+		expected[i] = res.Type().String()
+	}
+	return 0, fmt.Errorf("trezor: expected reply types %s, got %s", expected, kind)
+}
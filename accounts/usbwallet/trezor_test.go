@@ -0,0 +1,389 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package usbwallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet/internal/trezor"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/karalabe/hid"
+)
+
+// mockTransport is a usbTransport serving a fixed set of devices.
+type mockTransport struct {
+	infos   []hid.DeviceInfo
+	devices map[string]usbDevice
+}
+
+func (t *mockTransport) Enumerate(vendorID uint16, productID uint16) []hid.DeviceInfo {
+	return t.infos
+}
+
+func (t *mockTransport) Open(info hid.DeviceInfo) (usbDevice, error) {
+	if device, ok := t.devices[info.Path]; ok {
+		return device, nil
+	}
+	return nil, errors.New("device not found")
+}
+
+// mockTrezor emulates the wire protocol of a Trezor device, deriving its keys
+// from the passphrase and the derivation path.
+type mockTrezor struct {
+	pin        string // PIN protecting the device, empty if none
+	passphrase bool   // Whether the seed is protected by a passphrase
+
+	unlocked bool   // Whether the PIN and passphrase were both accepted
+	secret   string // Passphrase received from the host
+	pinwait  bool   // Whether a PIN matrix was requested
+	passwait bool   // Whether a passphrase was requested
+
+	signing *trezor.EthereumSignTx // Pending signing request
+	data    []byte                 // Transaction data streamed so far
+
+	request []byte             // Request being assembled from HID reports
+	kind    trezor.MessageType // Type of the request being assembled
+	length  int                // Total length of the request being assembled
+	replies [][]byte           // HID reports queued for reading
+	closed  bool               // Whether the host closed the device
+
+	lock sync.Mutex
+}
+
+func (d *mockTrezor) key(path accounts.DerivationPath) *ecdsa.PrivateKey {
+	return crypto.ToECDSA(crypto.Keccak256([]byte(d.secret + path.String())))
+}
+
+func (d *mockTrezor) Write(chunk []byte) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(chunk) != 64 || chunk[0] != 0x3f {
+		return 0, errors.New("invalid report")
+	}
+	if d.request == nil {
+		if chunk[1] != 0x23 || chunk[2] != 0x23 {
+			return 0, errors.New("invalid header")
+		}
+		d.kind = trezor.MessageType(binary.BigEndian.Uint16(chunk[3:5]))
+		d.length = int(binary.BigEndian.Uint32(chunk[5:9]))
+		d.request = append(make([]byte, 0, d.length), chunk[9:]...)
+	} else {
+		d.request = append(d.request, chunk[1:]...)
+	}
+	if len(d.request) >= d.length {
+		reply := d.handle(d.kind, d.request[:d.length])
+		d.request = nil
+
+		payload := make([]byte, 8, 8+64)
+		copy(payload, []byte{0x23, 0x23})
+		binary.BigEndian.PutUint16(payload[2:], uint16(reply.Type()))
+		data := reply.Marshal()
+		binary.BigEndian.PutUint32(payload[4:], uint32(len(data)))
+		payload = append(payload, data...)
+
+		for len(payload) > 0 {
+			report := make([]byte, 64)
+			report[0] = 0x3f
+			n := copy(report[1:], payload)
+			payload = payload[n:]
+			d.replies = append(d.replies, report)
+		}
+	}
+	return len(chunk), nil
+}
+
+func (d *mockTrezor) Read(p []byte) (int, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if len(d.replies) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, d.replies[0])
+	d.replies = d.replies[1:]
+	return n, nil
+}
+
+func (d *mockTrezor) Close() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.closed = true
+}
+
+func failure(message string) trezor.Message {
+	return &trezor.Failure{Message: &message}
+}
+
+// handle processes a single request, returning the reply to send back.
+func (d *mockTrezor) handle(kind trezor.MessageType, data []byte) trezor.Message {
+	switch kind {
+	case trezor.TypeInitialize:
+		d.pinwait, d.passwait, d.signing = false, false, nil
+
+		major, minor, patch, label := uint32(1), uint32(5), uint32(2), "mock"
+		return &trezor.Features{MajorVersion: &major, MinorVersion: &minor, PatchVersion: &patch, Label: &label}
+
+	case trezor.TypePing:
+		if d.pin != "" && !d.unlocked {
+			d.pinwait = true
+			return new(trezor.PinMatrixRequest)
+		}
+		return d.requestPassphrase()
+
+	case trezor.TypePinMatrixAck:
+		req := new(trezor.PinMatrixAck)
+		if err := req.Unmarshal(data); err != nil || !d.pinwait {
+			return failure("unexpected message")
+		}
+		d.pinwait = false
+		if req.Pin == nil || *req.Pin != d.pin {
+			return failure("PIN invalid")
+		}
+		return d.requestPassphrase()
+
+	case trezor.TypePassphraseAck:
+		req := new(trezor.PassphraseAck)
+		if err := req.Unmarshal(data); err != nil || !d.passwait {
+			return failure("unexpected message")
+		}
+		d.passwait, d.unlocked, d.secret = false, true, *req.Passphrase
+		return new(trezor.Success)
+
+	case trezor.TypeEthereumGetAddress:
+		req := new(trezor.EthereumGetAddress)
+		if err := req.Unmarshal(data); err != nil || !d.unlocked {
+			return failure("device locked")
+		}
+		return &trezor.EthereumAddress{Address: crypto.PubkeyToAddress(d.key(req.AddressN).PublicKey).Bytes()}
+
+	case trezor.TypeEthereumSignTx:
+		req := new(trezor.EthereumSignTx)
+		if err := req.Unmarshal(data); err != nil || !d.unlocked {
+			return failure("device locked")
+		}
+		d.signing, d.data = req, req.DataInitialChunk
+
+		// Request a user confirmation before streaming the data
+		return new(trezor.ButtonRequest)
+
+	case trezor.TypeButtonAck:
+		if d.signing == nil {
+			return failure("unexpected message")
+		}
+		return d.continueSigning()
+
+	case trezor.TypeEthereumTxAck:
+		req := new(trezor.EthereumTxAck)
+		if err := req.Unmarshal(data); err != nil || d.signing == nil {
+			return failure("unexpected message")
+		}
+		d.data = append(d.data, req.DataChunk...)
+		return d.continueSigning()
+	}
+	return failure("unknown message")
+}
+
+// requestPassphrase asks for the passphrase if the seed is protected by one and
+// the device was not unlocked yet.
+func (d *mockTrezor) requestPassphrase() trezor.Message {
+	if d.passphrase && !d.unlocked {
+		d.passwait = true
+		return new(trezor.PassphraseRequest)
+	}
+	d.unlocked = true
+	return new(trezor.Success)
+}
+
+// continueSigning either requests the next data chunk of the pending transaction
+// or signs it if all the data was received.
+func (d *mockTrezor) continueSigning() trezor.Message {
+	req := d.signing
+	if left := int(*req.DataLength) - len(d.data); left > 0 {
+		if left > 100 {
+			left = 100
+		}
+		length := uint32(left)
+		return &trezor.EthereumTxRequest{DataLength: &length}
+	}
+	d.signing = nil
+
+	var (
+		nonce    = new(big.Int).SetBytes(req.Nonce).Uint64()
+		value    = new(big.Int).SetBytes(req.Value)
+		gasLimit = new(big.Int).SetBytes(req.GasLimit)
+		gasPrice = new(big.Int).SetBytes(req.GasPrice)
+		tx       *types.Transaction
+		signer   types.Signer = types.HomesteadSigner{}
+	)
+	if req.To == nil {
+		tx = types.NewContractCreation(nonce, value, gasLimit, gasPrice, d.data)
+	} else {
+		tx = types.NewTransaction(nonce, common.BytesToAddress(req.To), value, gasLimit, gasPrice, d.data)
+	}
+	if req.ChainID != nil {
+		signer = types.NewEIP155Signer(new(big.Int).SetUint64(uint64(*req.ChainID)))
+	}
+	signed, err := types.SignTx(tx, signer, d.key(req.AddressN))
+	if err != nil {
+		return failure(err.Error())
+	}
+	v, r, s := signed.RawSignatureValues()
+	sigv := uint32(v.Uint64())
+	return &trezor.EthereumTxRequest{SignatureV: &sigv, SignatureR: r.Bytes(), SignatureS: s.Bytes()}
+}
+
+// newMockTrezorHub creates a Trezor hub tracking a single mocked device.
+func newMockTrezorHub(device *mockTrezor) *Hub {
+	transport := &mockTransport{
+		infos: []hid.DeviceInfo{
+			{Path: "trezor-wallet", VendorID: 0x534c, ProductID: 0x0001, UsagePage: 0xff00, Interface: 0},
+			{Path: "trezor-u2f", VendorID: 0x534c, ProductID: 0x0001, UsagePage: 0xf1d0, Interface: 1},
+			{Path: "ledger-wallet", VendorID: 0x2c97, ProductID: 0x0001, UsagePage: 0xffa0, Interface: 0},
+		},
+		devices: map[string]usbDevice{"trezor-wallet": device},
+	}
+	return newHub(TrezorScheme, trezorDeviceIDs, 0xff00, 0, transport, newTrezorDriver)
+}
+
+// Tests that the hub only tracks the wallet interface of matching devices.
+func TestTrezorHub(t *testing.T) {
+	hub := newMockTrezorHub(new(mockTrezor))
+
+	wallets := hub.Wallets()
+	if len(wallets) != 1 {
+		t.Fatalf("wallet count mismatch: have %d, want 1", len(wallets))
+	}
+	if url := wallets[0].URL(); url != (accounts.URL{Scheme: TrezorScheme, Path: "trezor-wallet"}) {
+		t.Errorf("wallet URL mismatch: have %v", url)
+	}
+	if status := wallets[0].Status(); status != "Closed" {
+		t.Errorf("wallet status mismatch: have %q, want %q", status, "Closed")
+	}
+}
+
+// Tests the multi phase opening of a Trezor protected by a PIN and passphrase.
+func TestTrezorOpen(t *testing.T) {
+	device := &mockTrezor{pin: "1234", passphrase: true}
+	wallet := newMockTrezorHub(device).Wallets()[0]
+
+	if err := wallet.Open(""); err != ErrTrezorPINNeeded {
+		t.Fatalf("first phase error mismatch: have %v, want %v", err, ErrTrezorPINNeeded)
+	}
+	if status := wallet.Status(); !strings.Contains(status, "waiting for PIN") {
+		t.Errorf("status mismatch: have %q", status)
+	}
+	if _, err := wallet.Derive(accounts.DefaultBaseDerivationPath, false); err != accounts.ErrWalletClosed {
+		t.Errorf("locked derivation error mismatch: have %v, want %v", err, accounts.ErrWalletClosed)
+	}
+	if err := wallet.Open("9999"); err == nil || !strings.Contains(err.Error(), "PIN invalid") {
+		t.Fatalf("invalid PIN error mismatch: have %v", err)
+	}
+	if err := wallet.Open(""); err != ErrTrezorPINNeeded {
+		t.Fatalf("reopen error mismatch: have %v, want %v", err, ErrTrezorPINNeeded)
+	}
+	if err := wallet.Open("1234"); err != ErrTrezorPassphraseNeeded {
+		t.Fatalf("second phase error mismatch: have %v, want %v", err, ErrTrezorPassphraseNeeded)
+	}
+	if err := wallet.Open("secret"); err != nil {
+		t.Fatalf("final phase failed: %v", err)
+	}
+	defer wallet.Close()
+
+	if status := wallet.Status(); status != "Trezor v1.5.2 'mock' online" {
+		t.Errorf("status mismatch: have %q", status)
+	}
+	if err := wallet.Open(""); err != accounts.ErrWalletAlreadyOpen {
+		t.Errorf("duplicate open error mismatch: have %v, want %v", err, accounts.ErrWalletAlreadyOpen)
+	}
+	// Ensure derivation happens with the passphrase protected seed
+	account, err := wallet.Derive(accounts.DefaultBaseDerivationPath, true)
+	if err != nil {
+		t.Fatalf("failed to derive account: %v", err)
+	}
+	if want := crypto.PubkeyToAddress(device.key(accounts.DefaultBaseDerivationPath).PublicKey); account.Address != want {
+		t.Errorf("derived address mismatch: have %x, want %x", account.Address, want)
+	}
+	if want := "trezor://trezor-wallet/m/44'/60'/0'/0"; account.URL.String() != want {
+		t.Errorf("derived URL mismatch: have %s, want %s", account.URL, want)
+	}
+	if !wallet.Contains(account) {
+		t.Errorf("pinned account not contained")
+	}
+}
+
+// Tests signing transactions with a Trezor, streaming the data in chunks.
+func TestTrezorSignTx(t *testing.T) {
+	device := new(mockTrezor)
+	wallet := newMockTrezorHub(device).Wallets()[0]
+
+	if err := wallet.Open(""); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	account, err := wallet.Derive(accounts.DefaultBaseDerivationPath, true)
+	if err != nil {
+		t.Fatalf("failed to derive account: %v", err)
+	}
+	data := bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, 700) // Longer than the initial chunk
+	tx := types.NewTransaction(1, common.HexToAddress("0x01"), big.NewInt(2), big.NewInt(21000), big.NewInt(3), data)
+
+	for _, chainID := range []*big.Int{big.NewInt(1337), nil} {
+		signed, err := wallet.SignTx(account, tx, chainID)
+		if err != nil {
+			t.Fatalf("chain %v: failed to sign transaction: %v", chainID, err)
+		}
+		var signer types.Signer = types.HomesteadSigner{}
+		if chainID != nil {
+			signer = types.NewEIP155Signer(chainID)
+		}
+		sender, err := types.Sender(signer, signed)
+		if err != nil {
+			t.Fatalf("chain %v: failed to recover sender: %v", chainID, err)
+		}
+		if sender != account.Address {
+			t.Errorf("chain %v: sender mismatch: have %x, want %x", chainID, sender, account.Address)
+		}
+		if !bytes.Equal(signed.Data(), data) {
+			t.Errorf("chain %v: data mismatch", chainID)
+		}
+	}
+	if _, err := wallet.SignTx(accounts.Account{Address: common.HexToAddress("0x02")}, tx, nil); err != accounts.ErrUnknownAccount {
+		t.Errorf("unknown account error mismatch: have %v, want %v", err, accounts.ErrUnknownAccount)
+	}
+	// Closing the wallet should release the device
+	if err := wallet.Close(); err != nil {
+		t.Fatalf("failed to close wallet: %v", err)
+	}
+	if !device.closed {
+		t.Errorf("device not closed")
+	}
+	if _, err := wallet.SignTx(account, tx, nil); err != accounts.ErrWalletClosed {
+		t.Errorf("closed wallet error mismatch: have %v, want %v", err, accounts.ErrWalletClosed)
+	}
+}
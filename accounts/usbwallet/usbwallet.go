@@ -17,9 +17,48 @@
 // Package usbwallet implements support for USB hardware wallets.
 package usbwallet
 
+import (
+	"io"
+
+	"github.com/karalabe/hid"
+)
+
 // deviceID is a combined vendor/product identifier to uniquely identify a USB
 // hardware device.
 type deviceID struct {
 	Vendor  uint16 // The Vendor identifer
 	Product uint16 // The Product identifier
 }
+
+// usbDevice is an open connection to a USB hardware wallet, over which the
+// vendor specific wire protocol is spoken.
+type usbDevice interface {
+	io.ReadWriter
+
+	// Close releases the underlying USB handle.
+	Close()
+}
+
+// usbTransport abstracts away the enumeration and opening of USB devices, allowing
+// the wallets to be exercised against mocked hardware too.
+type usbTransport interface {
+	// Enumerate returns the infos of all attached USB devices matching the given
+	// vendor and product IDs, zero acting as a wildcard.
+	Enumerate(vendorID uint16, productID uint16) []hid.DeviceInfo
+
+	// Open connects to the USB device described by info.
+	Open(info hid.DeviceInfo) (usbDevice, error)
+}
+
+// hidTransport is the usbTransport backed by the system's HID API.
+type hidTransport struct{}
+
+// Enumerate implements usbTransport, listing the devices via the HID API.
+func (hidTransport) Enumerate(vendorID uint16, productID uint16) []hid.DeviceInfo {
+	return hid.Enumerate(vendorID, productID)
+}
+
+// Open implements usbTransport, opening the device via the HID API.
+func (hidTransport) Open(info hid.DeviceInfo) (usbDevice, error) {
+	return info.Open()
+}
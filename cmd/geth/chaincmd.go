@@ -28,7 +28,6 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/console"
 	"github.com/ethereum/go-ethereum/core"
-	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
@@ -83,6 +82,10 @@ if already existing.
 TODO: Please write this
 `,
 	}
+	dumpCommandIterativeFlag = cli.BoolFlag{
+		Name:  "iterative",
+		Usage: "Stream the state as JSON lines instead of a single JSON object",
+	}
 	dumpCommand = cli.Command{
 		Action:    dump,
 		Name:      "dump",
@@ -92,7 +95,14 @@ TODO: Please write this
 		Description: `
 The arguments are interpreted as block numbers or hashes.
 Use "ethereum dump 0" to dump the genesis block.
+
+With --iterative, the state is streamed as one JSON line with the state root,
+followed by one line per account, without ever loading the whole state into
+memory.
 `,
+		Flags: []cli.Flag{
+			dumpCommandIterativeFlag,
+		},
 	}
 )
 
@@ -149,6 +159,8 @@ func importChain(ctx *cli.Context) error {
 	if err := utils.ImportChain(chain, ctx.Args().First()); err != nil {
 		utils.Fatalf("Import error: %v", err)
 	}
+	// Flush any state still cached in memory to disk
+	chain.Stop()
 	fmt.Printf("Import done in %v.\n\n", time.Since(start))
 
 	// Output pre-compaction stats mostly to see the import trashing
@@ -259,11 +271,17 @@ func dump(ctx *cli.Context) error {
 			fmt.Println("{}")
 			utils.Fatalf("block not found")
 		} else {
-			state, err := state.New(block.Root(), chainDb)
+			state, err := chain.StateAt(block.Root())
 			if err != nil {
 				utils.Fatalf("could not create new state: %v", err)
 			}
-			fmt.Printf("%s\n", state.Dump())
+			if ctx.Bool(dumpCommandIterativeFlag.Name) {
+				if err := state.IterativeDump(os.Stdout); err != nil {
+					utils.Fatalf("could not dump state: %v", err)
+				}
+			} else {
+				fmt.Printf("%s\n", state.Dump())
+			}
 		}
 	}
 	chainDb.Close()
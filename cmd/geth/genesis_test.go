@@ -82,6 +82,28 @@ var customGenesisTests = []struct {
 		query:  "eth.getBlock(0).nonce",
 		result: "0x0000000000000042",
 	},
+	// Genesis file with a proof-of-authority chain configuration
+	{
+		genesis: `{
+			"alloc"      : {},
+			"coinbase"   : "0x0000000000000000000000000000000000000000",
+			"difficulty" : "0x1",
+			"extraData"  : "0x00000000000000000000000000000000000000000000000000000000000000007df9a875a174b3bc565e6424a0050ebc1b2d1d820000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+			"gasLimit"   : "0x2fefd8",
+			"nonce"      : "0x0000000000000000",
+			"mixhash"    : "0x0000000000000000000000000000000000000000000000000000000000000000",
+			"parentHash" : "0x0000000000000000000000000000000000000000000000000000000000000000",
+			"timestamp"  : "0x00",
+			"config"     : {
+				"clique" : {
+					"period" : 15,
+					"epoch"  : 30000
+				}
+			}
+		}`,
+		query:  "clique.getSigners(0)",
+		result: "0x7df9a875a174b3bc565e6424a0050ebc1b2d1d82",
+	},
 }
 
 // Tests that initializing Geth with a custom genesis block and chain definitions
@@ -27,6 +27,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/console"
@@ -87,14 +88,25 @@ func init() {
 		utils.IdentityFlag,
 		utils.UnlockedAccountFlag,
 		utils.PasswordFileFlag,
+		utils.ExternalSignerFlag,
 		utils.BootnodesFlag,
 		utils.DataDirFlag,
 		utils.KeyStoreDirFlag,
 		utils.FastSyncFlag,
+		utils.GCModeFlag,
+		utils.SnapshotFlag,
 		utils.LightModeFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
 		utils.LightKDFFlag,
+		utils.TxPoolJournalFlag,
+		utils.TxPoolRejournalFlag,
+		utils.TxPoolPriceBumpFlag,
+		utils.TxPoolAccountSlotsFlag,
+		utils.TxPoolGlobalSlotsFlag,
+		utils.TxPoolAccountQueueFlag,
+		utils.TxPoolGlobalQueueFlag,
+		utils.TxPoolLifetimeFlag,
 		utils.CacheFlag,
 		utils.TrieCacheGenFlag,
 		utils.JSpathFlag,
@@ -122,6 +134,11 @@ func init() {
 		utils.WSPortFlag,
 		utils.WSApiFlag,
 		utils.WSAllowedOriginsFlag,
+		utils.GraphQLEnabledFlag,
+		utils.GraphQLListenAddrFlag,
+		utils.GraphQLPortFlag,
+		utils.GraphQLCORSDomainFlag,
+		utils.GraphQLVirtualHostsFlag,
 		utils.IPCDisabledFlag,
 		utils.IPCApiFlag,
 		utils.IPCPathFlag,
@@ -136,6 +153,7 @@ func init() {
 		utils.VMEnableDebugFlag,
 		utils.NetworkIdFlag,
 		utils.RPCCORSDomainFlag,
+		utils.RPCVirtualHostsFlag,
 		utils.EthStatsURLFlag,
 		utils.MetricsEnabledFlag,
 		utils.FakePoWFlag,
@@ -222,6 +240,10 @@ func makeFullNode(ctx *cli.Context) *node.Node {
 	if url := ctx.GlobalString(utils.EthStatsURLFlag.Name); url != "" {
 		utils.RegisterEthStatsService(stack, url)
 	}
+	// Add the GraphQL endpoint if requested
+	if ctx.GlobalBool(utils.GraphQLEnabledFlag.Name) {
+		utils.RegisterGraphQLService(ctx, stack)
+	}
 	// Add the release oracle service so it boots along with node.
 	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
 		config := release.Config{
@@ -268,21 +290,28 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 		}
 		stateReader := ethclient.NewClient(rpcClient)
 
-		// Open and self derive any wallets already attached
+		// Open and self derive any wallets already attached. Self-derivation is also
+		// set up for wallets needing further user input (e.g. Trezor), as those are
+		// opened later via personal.openWallet.
 		for _, wallet := range stack.AccountManager().Wallets() {
-			if err := wallet.Open(""); err != nil {
+			err := wallet.Open("")
+			if err != nil {
 				log.Warn(fmt.Sprintf("Failed to open wallet %s: %v", wallet.URL(), err))
-			} else {
+			}
+			if selfDerivable(err) {
 				wallet.SelfDerive(accounts.DefaultBaseDerivationPath, stateReader)
 			}
 		}
 		// Listen for wallet event till termination
 		for event := range events {
 			if event.Arrive {
-				if err := event.Wallet.Open(""); err != nil {
+				err := event.Wallet.Open("")
+				if err != nil {
 					log.Info(fmt.Sprintf("New wallet appeared: %s, failed to open: %s", event.Wallet.URL(), err))
 				} else {
 					log.Info(fmt.Sprintf("New wallet appeared: %s, %s", event.Wallet.URL(), event.Wallet.Status()))
+				}
+				if selfDerivable(err) {
 					event.Wallet.SelfDerive(accounts.DefaultBaseDerivationPath, stateReader)
 				}
 			} else {
@@ -302,3 +331,10 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 		}
 	}
 }
+
+// selfDerivable reports whether self-derivation should be set up on a wallet
+// after trying to open it: either it was opened, or it only awaits further user
+// input to be unlocked.
+func selfDerivable(err error) bool {
+	return err == nil || err == usbwallet.ErrTrezorPINNeeded || err == usbwallet.ErrTrezorPassphraseNeeded
+}
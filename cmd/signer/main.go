@@ -0,0 +1,258 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// signer is a utility that can be used to sign transactions and arbitrary data,
+// keeping the keys out of the node. Every request is decided on by a rule file
+// or the user, through the terminal or an external UI speaking over stdio.
+//
+// A node started with --signer forwards its transaction signing requests here.
+// Signing arbitrary data (account_sign) needs to be requested from the signer
+// directly, the node only ever holds the hash of such data.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core"
+	"github.com/ethereum/go-ethereum/signer/rules"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	gitCommit string // Git SHA1 commit hash of the release (set via linker flags)
+	app       = utils.NewApp(gitCommit, "Manage Ethereum account operations")
+)
+
+var (
+	keystoreFlag = cli.StringFlag{
+		Name:  "keystore",
+		Value: filepath.Join(node.DefaultDataDir(), "keystore"),
+		Usage: "Directory for the keystore",
+	}
+	noUSBFlag = cli.BoolFlag{
+		Name:  "nousb",
+		Usage: "Disables monitoring for and managing USB hardware wallets",
+	}
+	chainIDFlag = cli.Int64Flag{
+		Name:  "chainid",
+		Value: 1,
+		Usage: "Chain id to use for signing (1=mainnet, 3=ropsten, 4=rinkeby)",
+	}
+	rpcPortFlag = cli.IntFlag{
+		Name:  "rpcport",
+		Value: 8550,
+		Usage: "HTTP-RPC server listening port",
+	}
+	ipcPathFlag = cli.StringFlag{
+		Name:  "ipcpath",
+		Value: filepath.Join(node.DefaultDataDir(), "signer.ipc"),
+		Usage: "Filename for the IPC socket",
+	}
+	rulesFlag = cli.StringFlag{
+		Name:  "rules",
+		Usage: "Javascript file to evaluate the requests with before asking the user",
+	}
+	stdioUIFlag = cli.BoolFlag{
+		Name: "stdio-ui",
+		Usage: "Use STDIN/STDOUT as a channel for an external UI. " +
+			"This means that an STDIN/STDOUT is used for RPC-communication with a e.g. a graphical user " +
+			"interface, and can be used when the signer is started by an external process.",
+	}
+	verbosityFlag = cli.IntFlag{
+		Name:  "verbosity",
+		Value: 3,
+		Usage: "Logging verbosity: 0=silent, 1=error, 2=warn, 3=info, 4=debug, 5=detail",
+	}
+)
+
+func init() {
+	app.Action = signer
+	app.Flags = []cli.Flag{
+		keystoreFlag,
+		utils.LightKDFFlag,
+		noUSBFlag,
+		utils.UnlockedAccountFlag,
+		utils.PasswordFileFlag,
+		chainIDFlag,
+		utils.RPCEnabledFlag,
+		utils.RPCListenAddrFlag,
+		rpcPortFlag,
+		utils.RPCCORSDomainFlag,
+		utils.RPCVirtualHostsFlag,
+		utils.IPCDisabledFlag,
+		ipcPathFlag,
+		rulesFlag,
+		stdioUIFlag,
+		verbosityFlag,
+	}
+}
+
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func signer(ctx *cli.Context) error {
+	// Log to stderr, stdout may be the channel to the UI
+	log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(ctx.Int(verbosityFlag.Name)), log.StreamHandler(os.Stderr, log.TerminalFormat(true))))
+
+	// Assemble the chain of UIs deciding on the requests
+	var ui core.UIClientAPI
+	if ctx.Bool(stdioUIFlag.Name) {
+		log.Info("Using stdin/stdout as UI channel")
+		ui = core.NewStdIOUI()
+	} else {
+		ui = core.NewCommandlineUI()
+	}
+	if path := ctx.String(rulesFlag.Name); path != "" {
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read rules: %v", err)
+		}
+		evaluator := rules.NewRuleEvaluator(ui)
+		if err := evaluator.Init(string(source)); err != nil {
+			return fmt.Errorf("failed to load rules: %v", err)
+		}
+		log.Info("Loaded rules", "file", path)
+		ui = evaluator
+	}
+	// Open the key stores and unlock any requested accounts
+	am, ks := makeAccountManager(ctx)
+	if err := unlockAccounts(ctx, ks); err != nil {
+		return err
+	}
+	api := core.NewSignerAPI(ctx.Int64(chainIDFlag.Name), am, ui)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", api); err != nil {
+		return err
+	}
+	info := make(map[string]string)
+	if !ctx.Bool(utils.IPCDisabledFlag.Name) {
+		endpoint := ctx.String(ipcPathFlag.Name)
+		listener, err := rpc.CreateIPCListener(endpoint)
+		if err != nil {
+			return fmt.Errorf("failed to open IPC endpoint: %v", err)
+		}
+		defer listener.Close()
+		go server.ServeListener(listener)
+
+		log.Info("IPC endpoint opened", "url", endpoint)
+		info["ipc"] = endpoint
+	}
+	if ctx.Bool(utils.RPCEnabledFlag.Name) {
+		endpoint := fmt.Sprintf("%s:%d", ctx.String(utils.RPCListenAddrFlag.Name), ctx.Int(rpcPortFlag.Name))
+		listener, err := net.Listen("tcp", endpoint)
+		if err != nil {
+			return fmt.Errorf("failed to open HTTP endpoint: %v", err)
+		}
+		defer listener.Close()
+		go rpc.NewHTTPServer(ctx.String(utils.RPCCORSDomainFlag.Name), splitAndTrim(ctx.String(utils.RPCVirtualHostsFlag.Name)), server).Serve(listener)
+
+		log.Info("HTTP endpoint opened", "url", "http://"+endpoint)
+		info["http"] = "http://" + endpoint
+	}
+	ui.OnSignerStartup(core.StartupInfo{Info: info})
+
+	// Serve requests until interrupted
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt)
+	defer signal.Stop(sigc)
+	<-sigc
+
+	log.Info("Exiting...", "signal", "interrupt")
+	server.Stop()
+	return nil
+}
+
+// makeAccountManager creates the account manager over the keystore and, unless
+// disabled, the USB hardware wallets.
+func makeAccountManager(ctx *cli.Context) (*accounts.Manager, *keystore.KeyStore) {
+	scryptN, scryptP := keystore.StandardScryptN, keystore.StandardScryptP
+	if ctx.Bool(utils.LightKDFFlag.Name) {
+		scryptN, scryptP = keystore.LightScryptN, keystore.LightScryptP
+	}
+	ks := keystore.NewKeyStore(ctx.String(keystoreFlag.Name), scryptN, scryptP)
+
+	backends := []accounts.Backend{ks}
+	if !ctx.Bool(noUSBFlag.Name) {
+		if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
+			log.Warn("Failed to start Ledger hub, disabling", "err", err)
+		} else {
+			backends = append(backends, ledgerhub)
+		}
+		if trezorhub, err := usbwallet.NewTrezorHub(); err != nil {
+			log.Warn("Failed to start Trezor hub, disabling", "err", err)
+		} else {
+			backends = append(backends, trezorhub)
+		}
+	}
+	return accounts.NewManager(backends...), ks
+}
+
+// unlockAccounts unlocks the keystore accounts requested on the command line,
+// allowing requests approved by the rules to be signed without a password.
+func unlockAccounts(ctx *cli.Context, ks *keystore.KeyStore) error {
+	unlocks := splitAndTrim(ctx.String(utils.UnlockedAccountFlag.Name))
+	if len(unlocks) == 0 {
+		return nil
+	}
+	passwords := utils.MakePasswordList(ctx)
+	if len(passwords) == 0 {
+		return fmt.Errorf("password file needed to unlock accounts")
+	}
+	for i, addr := range unlocks {
+		if !common.IsHexAddress(addr) {
+			return fmt.Errorf("invalid account to unlock: %s", addr)
+		}
+		password := passwords[len(passwords)-1]
+		if i < len(passwords) {
+			password = passwords[i]
+		}
+		if err := ks.Unlock(accounts.Account{Address: common.HexToAddress(addr)}, password); err != nil {
+			return fmt.Errorf("failed to unlock account %s: %v", addr, err)
+		}
+		log.Info("Unlocked account", "address", addr)
+	}
+	return nil
+}
+
+// splitAndTrim splits a comma separated list, dropping empty entries.
+func splitAndTrim(input string) []string {
+	var result []string
+	for _, item := range strings.Split(input, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bitutil
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Tests that data bitset encoding and decoding works and is bijective.
+func TestEncodingCycle(t *testing.T) {
+	tests := []string{
+		// Corner cases of various lengths and sparsities
+		"0x000000000000000000",
+		"0xef0400",
+		"0xdf7070533534333636313639343638373532313536346c1bc33339343837313070706336343035336336346c65fefb3930393233383838ac2f65fefb",
+		"0x7b64000000",
+		"0x000034000000000000",
+		"0x0000000000000000000000000000000000000000000000000000000000000000",
+		"0x4912385c0e7b64000000",
+		"0x000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+		"0x00",
+		"0x000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	}
+	for i, tt := range tests {
+		data := hexutil.MustDecode(tt)
+
+		proc, err := bitsetDecodeBytes(bitsetEncodeBytes(data), len(data))
+		if err != nil {
+			t.Errorf("test %d: failed to decompress compressed data: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(data, proc) {
+			t.Errorf("test %d: compress/decompress mismatch: have %x, want %x", i, proc, data)
+		}
+	}
+}
+
+// Tests that data bitset decoding and rencoding works and is bijective.
+func TestDecodingCycle(t *testing.T) {
+	tests := []struct {
+		size  int
+		input string
+		fail  error
+	}{
+		{size: 0, input: "0x"},
+
+		{size: 3, input: "0x", fail: nil},
+		{size: 9, input: "0x408001"},
+		{size: 9, input: "0x4080", fail: errMissingData},
+		{size: 9, input: "0x40800101", fail: errUnreferencedData},
+		{size: 9, input: "0x400001", fail: errZeroContent},
+		{size: 1, input: "0xc0", fail: nil},
+		{size: 2, input: "0xe0010101", fail: errExceededTarget},
+	}
+	for i, tt := range tests {
+		data := hexutil.MustDecode(tt.input)
+
+		orig, err := bitsetDecodeBytes(data, tt.size)
+		if err != tt.fail {
+			t.Errorf("test %d: failure mismatch: have %v, want %v", i, err, tt.fail)
+		}
+		if err != nil {
+			continue
+		}
+		if comp := bitsetEncodeBytes(orig); !bytes.Equal(comp, data) {
+			t.Errorf("test %d: decompress/compress mismatch: have %x, want %x", i, comp, data)
+		}
+	}
+}
+
+// Tests that the compression and decompression of sparse data round trips for
+// inputs of various sizes and densities.
+func TestCompression(t *testing.T) {
+	for size := 0; size < 1024; size += 17 {
+		for _, density := range []float64{0, 0.01, 0.1, 0.5, 1} {
+			data := make([]byte, size)
+			for i := range data {
+				if rand.Float64() < density {
+					data[i] = byte(1 + rand.Intn(255))
+				}
+			}
+			comp := CompressBytes(data)
+			if len(comp) > len(data) {
+				t.Errorf("size %d, density %v: compressed data larger than input: %d > %d", size, density, len(comp), len(data))
+			}
+			dec, err := DecompressBytes(comp, size)
+			if err != nil {
+				t.Errorf("size %d, density %v: failed to decompress: %v", size, density, err)
+				continue
+			}
+			if !bytes.Equal(data, dec) {
+				t.Errorf("size %d, density %v: compress/decompress mismatch: have %x, want %x", size, density, dec, data)
+			}
+		}
+	}
+	// Make sure the raw fallback is used when no space can be saved
+	if comp := CompressBytes([]byte{0x01, 0x00}); !bytes.Equal(comp, []byte{0x01, 0x00}) {
+		t.Errorf("uncompressible data mismatch: have %x, want %x", comp, []byte{0x01, 0x00})
+	}
+	if _, err := DecompressBytes([]byte{0x01, 0x02, 0x03}, 2); err != errExceededTarget {
+		t.Errorf("oversized input error mismatch: have %v, want %v", err, errExceededTarget)
+	}
+}
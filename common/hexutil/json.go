@@ -64,15 +64,32 @@ func (b Bytes) String() string {
 	return Encode(b)
 }
 
+// ImplementsGraphQLType returns true if Bytes implements the specified GraphQL type.
+func (b Bytes) ImplementsGraphQLType(name string) bool { return name == "Bytes" }
+
+// UnmarshalGraphQL unmarshals the provided GraphQL query data.
+func (b *Bytes) UnmarshalGraphQL(input interface{}) error {
+	str, ok := input.(string)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for Bytes", input)
+	}
+	data, err := Decode(str)
+	if err != nil {
+		return err
+	}
+	*b = data
+	return nil
+}
+
 // UnmarshalJSON decodes input as a JSON string with 0x prefix. The length of out
 // determines the required input length. This function is commonly used to implement the
 // UnmarshalJSON method for fixed-size types:
 //
-//     type Foo [8]byte
+//	type Foo [8]byte
 //
-//     func (f *Foo) UnmarshalJSON(input []byte) error {
-//         return hexutil.UnmarshalJSON("Foo", input, f[:])
-//     }
+//	func (f *Foo) UnmarshalJSON(input []byte) error {
+//	    return hexutil.UnmarshalJSON("Foo", input, f[:])
+//	}
 func UnmarshalJSON(typname string, input, out []byte) error {
 	raw, err := checkJSON(input)
 	if err != nil {
@@ -113,6 +130,17 @@ func (b *Big) MarshalJSON() ([]byte, error) {
 	return []byte(enc), nil
 }
 
+// MarshalText implements encoding.TextMarshaler. It allows encoding Big values
+// that are not addressable (e.g. stored in an interface), which the pointer based
+// MarshalJSON doesn't cover. The GraphQL server marshals non-null scalars so.
+func (b Big) MarshalText() ([]byte, error) {
+	bigint := (*big.Int)(&b)
+	if bigint.Sign() == -1 {
+		return nil, errNegativeBigInt
+	}
+	return []byte(EncodeBig(bigint)), nil
+}
+
 // UnmarshalJSON implements json.Unmarshaler.
 func (b *Big) UnmarshalJSON(input []byte) error {
 	raw, err := checkNumberJSON(input)
@@ -152,6 +180,27 @@ func (b *Big) String() string {
 	return EncodeBig(b.ToInt())
 }
 
+// ImplementsGraphQLType returns true if Big implements the provided GraphQL type.
+func (b Big) ImplementsGraphQLType(name string) bool { return name == "BigInt" }
+
+// UnmarshalGraphQL unmarshals the provided GraphQL query data, accepting both
+// hex strings and integer literals.
+func (b *Big) UnmarshalGraphQL(input interface{}) error {
+	switch input := input.(type) {
+	case string:
+		dec, err := DecodeBig(input)
+		if err != nil {
+			return err
+		}
+		*b = (Big)(*dec)
+	case int32:
+		*b = (Big)(*big.NewInt(int64(input)))
+	default:
+		return fmt.Errorf("unexpected type %T for BigInt", input)
+	}
+	return nil
+}
+
 // Uint64 marshals/unmarshals as a JSON string with 0x prefix.
 // The zero value marshals as "0x0".
 type Uint64 uint64
@@ -192,6 +241,30 @@ func (b Uint64) String() string {
 	return EncodeUint64(uint64(b))
 }
 
+// ImplementsGraphQLType returns true if Uint64 implements the provided GraphQL type.
+func (b Uint64) ImplementsGraphQLType(name string) bool { return name == "Long" }
+
+// UnmarshalGraphQL unmarshals the provided GraphQL query data, accepting both
+// hex strings and non-negative integer literals.
+func (b *Uint64) UnmarshalGraphQL(input interface{}) error {
+	switch input := input.(type) {
+	case string:
+		dec, err := DecodeUint64(input)
+		if err != nil {
+			return err
+		}
+		*b = Uint64(dec)
+	case int32:
+		if input < 0 {
+			return ErrUint64Range
+		}
+		*b = Uint64(input)
+	default:
+		return fmt.Errorf("unexpected type %T for Long", input)
+	}
+	return nil
+}
+
 // Uint marshals/unmarshals as a JSON string with 0x prefix.
 // The zero value marshals as "0x0".
 type Uint uint
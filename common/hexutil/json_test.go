@@ -19,6 +19,7 @@ package hexutil
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"math/big"
 	"testing"
 )
@@ -193,6 +194,28 @@ func TestMarshalBig(t *testing.T) {
 	}
 }
 
+func TestMarshalBigValue(t *testing.T) {
+	// Nil pointers encode as null
+	if out, err := (*Big)(nil).MarshalJSON(); err != nil || string(out) != "null" {
+		t.Errorf("nil MarshalJSON mismatch: got %q, %v", out, err)
+	}
+	// Non-addressable values encode as text (e.g. GraphQL scalars)
+	for _, test := range encodeBigTests {
+		in := test.input.(*big.Int)
+		out, err := json.Marshal(interface{}(Big(*in)))
+		if err != nil {
+			t.Errorf("%d: %v", in, err)
+			continue
+		}
+		if want := `"` + test.want + `"`; string(out) != want {
+			t.Errorf("%d: value marshal output mismatch: got %q, want %q", in, out, want)
+		}
+	}
+	if _, err := json.Marshal(interface{}(Big(*big.NewInt(-1)))); err == nil {
+		t.Errorf("negative value marshalled without error")
+	}
+}
+
 var unmarshalUint64Tests = []unmarshalTest{
 	// invalid encoding
 	{input: "", wantErr: errNonString},
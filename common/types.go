@@ -81,6 +81,18 @@ func (h Hash) MarshalJSON() ([]byte, error) {
 	return hexutil.Bytes(h[:]).MarshalJSON()
 }
 
+// ImplementsGraphQLType returns true if Hash implements the specified GraphQL type.
+func (h Hash) ImplementsGraphQLType(name string) bool { return name == "Bytes32" }
+
+// UnmarshalGraphQL unmarshals the provided GraphQL query data.
+func (h *Hash) UnmarshalGraphQL(input interface{}) error {
+	str, ok := input.(string)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for Bytes32", input)
+	}
+	return hexutil.UnmarshalJSON("Hash", []byte(`"`+str+`"`), h[:])
+}
+
 // Sets the hash to the value of b. If b is larger than len(h) it will panic
 func (h *Hash) SetBytes(b []byte) {
 	if len(b) > len(h) {
@@ -181,6 +193,31 @@ func (a *Address) UnmarshalJSON(input []byte) error {
 	return hexutil.UnmarshalJSON("Address", input, a[:])
 }
 
+// MarshalText returns the hex representation of a, allowing addresses to be
+// used as JSON object keys.
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.Hex()), nil
+}
+
+// UnmarshalText parses an address in hex syntax.
+func (a *Address) UnmarshalText(input []byte) error {
+	quoted := make([]byte, 0, len(input)+2)
+	quoted = append(append(append(quoted, '"'), input...), '"')
+	return hexutil.UnmarshalJSON("Address", quoted, a[:])
+}
+
+// ImplementsGraphQLType returns true if Address implements the specified GraphQL type.
+func (a Address) ImplementsGraphQLType(name string) bool { return name == "Address" }
+
+// UnmarshalGraphQL unmarshals the provided GraphQL query data.
+func (a *Address) UnmarshalGraphQL(input interface{}) error {
+	str, ok := input.(string)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for Address", input)
+	}
+	return a.UnmarshalText([]byte(str))
+}
+
 // PP Pretty Prints a byte slice in the following format:
 // 	hex(value[:4])...(hex[len(value)-4:])
 func PP(value []byte) string {
@@ -0,0 +1,107 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ethash implements the ethash proof-of-work consensus engine.
+package ethash
+
+import (
+	"time"
+
+	ethashc "github.com/ethereum/ethash"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/pow"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// epochLength is the number of blocks in a single ethash epoch, beyond the
+// 2048th of which the underlying hasher is unable to verify seals.
+const epochLength = 30000
+
+// Ethash is a consensus engine based on proof-of-work implementing the ethash
+// algorithm. The heavy lifting of hashing is delegated to the cgo bindings of
+// the reference ethash implementation.
+type Ethash struct {
+	hasher pow.PoW // Hashimoto implementation doing the actual seal searching and checking
+
+	// The fields below are hooks for testing
+	fakeMode  bool          // Flag whether to disable PoW checking
+	fakeFull  bool          // Flag whether to disable all consensus rules
+	fakeFail  uint64        // Block number which fails PoW check even in fake mode
+	fakeDelay time.Duration // Time delay to sleep for before returning from verify
+}
+
+// New creates a full sized ethash PoW scheme.
+func New() *Ethash {
+	return &Ethash{hasher: ethashc.New()}
+}
+
+// NewShared creates a full sized ethash PoW scheme, where the verification cache
+// is shared across all instances created with NewShared.
+func NewShared() *Ethash {
+	return &Ethash{hasher: ethashc.NewShared()}
+}
+
+// NewTester creates a small sized ethash PoW scheme useful only for testing
+// purposes. The DAG files are stored in a temporary directory.
+func NewTester() (*Ethash, error) {
+	hasher, err := ethashc.NewForTesting()
+	if err != nil {
+		return nil, err
+	}
+	return &Ethash{hasher: hasher}, nil
+}
+
+// NewFaker creates a ethash consensus engine with a fake PoW scheme that accepts
+// all blocks' seal as valid, though they still have to conform to the Ethereum
+// consensus rules.
+func NewFaker() *Ethash {
+	return &Ethash{fakeMode: true}
+}
+
+// NewFakeFailer creates a ethash consensus engine with a fake PoW scheme that
+// accepts all blocks as valid apart from the single one specified, though they
+// still have to conform to the Ethereum consensus rules.
+func NewFakeFailer(fail uint64) *Ethash {
+	return &Ethash{fakeMode: true, fakeFail: fail}
+}
+
+// NewFakeDelayer creates a ethash consensus engine with a fake PoW scheme that
+// accepts all blocks as valid, but delays verifications by some time, though
+// they still have to conform to the Ethereum consensus rules.
+func NewFakeDelayer(delay time.Duration) *Ethash {
+	return &Ethash{fakeMode: true, fakeDelay: delay}
+}
+
+// NewFullFaker creates a ethash consensus engine with a full fake scheme that
+// accepts all blocks as valid, without checking any consensus rules whatsoever.
+func NewFullFaker() *Ethash {
+	return &Ethash{fakeMode: true, fakeFull: true}
+}
+
+// Hashrate implements PoW, returning the measured rate of the search invocations
+// per second of the local miner threads.
+func (ethash *Ethash) Hashrate() float64 {
+	if ethash.hasher == nil {
+		return 0
+	}
+	return float64(ethash.hasher.GetHashrate())
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC APIs. Currently
+// that is empty.
+func (ethash *Ethash) APIs(chain consensus.ChainReader) []rpc.API {
+	return nil
+}
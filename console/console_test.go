@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/internal/jsre"
 	"github.com/ethereum/go-ethereum/node"
@@ -100,6 +101,7 @@ func newTester(t *testing.T, confOverride func(*eth.Config)) *tester {
 		ChainConfig: &params.ChainConfig{HomesteadBlock: new(big.Int), ChainId: new(big.Int)},
 		Etherbase:   common.HexToAddress(testAddress),
 		PowTest:     true,
+		TxPool:      core.DefaultTxPoolConfig,
 	}
 	if confOverride != nil {
 		confOverride(ethConf)
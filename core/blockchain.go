@@ -30,7 +30,9 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -39,10 +41,10 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
-	"github.com/ethereum/go-ethereum/pow"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 	"github.com/hashicorp/golang-lru"
+	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 )
 
 var (
@@ -56,12 +58,33 @@ const (
 	blockCacheLimit     = 256
 	maxFutureBlocks     = 256
 	maxTimeFutureBlocks = 30
+
+	// snapshotLayers is the maximum number of diff layers kept in memory on top
+	// of the persistent state snapshot. It's capped at half the number of tries
+	// kept in memory, as the snapshot generator reads the disk layer's trie.
+	snapshotLayers = 64
 	// must be bumped when consensus algorithm is changed, this forces the upgradedb
 	// command to be run (forces the blocks to be imported again using the new algorithm)
 	BlockChainVersion = 3
 	badBlockLimit     = 10
 )
 
+// CacheConfig contains the configuration values for the trie caching and state
+// pruning that's resident in a blockchain.
+type CacheConfig struct {
+	Disabled       bool   // Whether to disable trie write caching and pruning (archive node)
+	TriesInMemory  uint64 // Number of recent block states to keep in memory before garbage collecting
+	TrieCheckpoint uint64 // Number of blocks between two state tries flushed to disk
+	Snapshot       bool   // Whether to maintain a flat state snapshot for fast state reads
+}
+
+// DefaultCacheConfig contains the default state pruning settings, used if no
+// explicit configuration is provided.
+var DefaultCacheConfig = &CacheConfig{
+	TriesInMemory:  128,
+	TrieCheckpoint: 1024,
+}
+
 // BlockChain represents the canonical chain given a database with a genesis
 // block. The Blockchain manages chain imports, reverts, chain reorganisations.
 //
@@ -77,7 +100,8 @@ const (
 // included in the canonical one where as GetBlockByNumber always represents the
 // canonical chain.
 type BlockChain struct {
-	config *params.ChainConfig // chain & network configuration
+	config      *params.ChainConfig // chain & network configuration
+	cacheConfig *CacheConfig        // Trie caching and pruning configuration
 
 	hc           *HeaderChain
 	chainDb      ethdb.Database
@@ -92,11 +116,14 @@ type BlockChain struct {
 	currentBlock     *types.Block // Current head of the block chain
 	currentFastBlock *types.Block // Current head of the fast-sync chain (may be above the block chain!)
 
-	stateCache   *state.StateDB // State database to reuse between imports (contains state cache)
-	bodyCache    *lru.Cache     // Cache for the most recent block bodies
-	bodyRLPCache *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
-	blockCache   *lru.Cache     // Cache for the most recent entire blocks
-	futureBlocks *lru.Cache     // future blocks are blocks added for later processing
+	triedb       *trie.NodeDatabase // In-memory trie node cache in front of the chain database
+	triegc       *prque.Prque       // Priority queue mapping block numbers to tries to gc
+	snaps        *snapshot.Tree     // Flat state snapshot for fast state reads (nil if disabled)
+	stateCache   *state.StateDB     // State database to reuse between imports (contains state cache)
+	bodyCache    *lru.Cache         // Cache for the most recent block bodies
+	bodyRLPCache *lru.Cache         // Cache for the most recent block bodies in RLP encoded format
+	blockCache   *lru.Cache         // Cache for the most recent entire blocks
+	futureBlocks *lru.Cache         // future blocks are blocks added for later processing
 
 	quit    chan struct{} // blockchain quit channel
 	running int32         // running must be called atomically
@@ -104,7 +131,7 @@ type BlockChain struct {
 	procInterrupt int32          // interrupt signaler for block processing
 	wg            sync.WaitGroup // chain processing wait group for shutting down
 
-	pow       pow.PoW
+	engine    consensus.Engine
 	processor Processor // block processor interface
 	validator Validator // block and state validator interface
 	vmConfig  vm.Config
@@ -113,9 +140,12 @@ type BlockChain struct {
 }
 
 // NewBlockChain returns a fully initialised block chain using information
-// available in the database. It initialiser the default Ethereum Validator and
-// Processor.
-func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, pow pow.PoW, mux *event.TypeMux, vmConfig vm.Config) (*BlockChain, error) {
+// available in the database. It initialises the default Ethereum Validator and
+// Processor. If no cache configuration is given, DefaultCacheConfig is used.
+func NewBlockChain(chainDb ethdb.Database, cacheConfig *CacheConfig, config *params.ChainConfig, engine consensus.Engine, mux *event.TypeMux, vmConfig vm.Config) (*BlockChain, error) {
+	if cacheConfig == nil {
+		cacheConfig = DefaultCacheConfig
+	}
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
@@ -124,23 +154,25 @@ func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, pow pow.P
 
 	bc := &BlockChain{
 		config:       config,
+		cacheConfig:  cacheConfig,
 		chainDb:      chainDb,
+		triedb:       state.NewNodeDatabase(chainDb),
+		triegc:       prque.New(),
 		eventMux:     mux,
 		quit:         make(chan struct{}),
 		bodyCache:    bodyCache,
 		bodyRLPCache: bodyRLPCache,
 		blockCache:   blockCache,
 		futureBlocks: futureBlocks,
-		pow:          pow,
+		engine:       engine,
 		vmConfig:     vmConfig,
 		badBlocks:    badBlocks,
 	}
-	bc.SetValidator(NewBlockValidator(config, bc, pow))
-	bc.SetProcessor(NewStateProcessor(config, bc))
+	bc.SetValidator(NewBlockValidator(config, bc, engine))
+	bc.SetProcessor(NewStateProcessor(config, bc, engine))
 
-	gv := func() HeaderValidator { return bc.Validator() }
 	var err error
-	bc.hc, err = NewHeaderChain(chainDb, config, gv, bc.getProcInterrupt)
+	bc.hc, err = NewHeaderChain(chainDb, config, engine, bc.getProcInterrupt)
 	if err != nil {
 		return nil, err
 	}
@@ -207,8 +239,27 @@ func (self *BlockChain) loadLastState() error {
 			self.currentFastBlock = block
 		}
 	}
+	// Make sure the state associated with the head block is available
+	if _, err := state.New(self.currentBlock.Root(), self.triedb); err != nil {
+		log.Warn("Head state missing, repairing chain", "number", self.currentBlock.Number(), "hash", self.currentBlock.Hash())
+		if err := self.repair(&self.currentBlock); err != nil {
+			return err
+		}
+	}
+	// Open the flat state snapshot of the head state, or rebuild it if unusable
+	if self.cacheConfig.Snapshot {
+		if self.snaps == nil {
+			snaps, err := snapshot.New(self.chainDb, self.triedb, self.currentBlock.Root())
+			if err != nil {
+				log.Warn("State snapshot unavailable", "err", err)
+			}
+			self.snaps = snaps
+		} else if self.snaps.Snapshot(self.currentBlock.Root()) == nil {
+			self.snaps.Rebuild(self.currentBlock.Root())
+		}
+	}
 	// Initialize a statedb cache to ensure singleton account bloom filter generation
-	statedb, err := state.New(self.currentBlock.Root(), self.chainDb)
+	statedb, err := state.NewWithSnapshots(self.currentBlock.Root(), self.triedb, self.snaps)
 	if err != nil {
 		return err
 	}
@@ -226,6 +277,29 @@ func (self *BlockChain) loadLastState() error {
 	return nil
 }
 
+// repair tries to repair the current blockchain by rolling back the current block
+// until one with associated state is found. This is needed to fix incomplete db
+// writes caused either by crashes/power outages, or simply non-committed tries
+// of a pruning node.
+//
+// This method only rolls back the current block. The current header and current
+// fast block are left intact.
+func (self *BlockChain) repair(head **types.Block) error {
+	for {
+		// Abort if we've rewound to a head block that does have associated state
+		if _, err := state.New((*head).Root(), self.triedb); err == nil {
+			log.Info("Rewound blockchain to past state", "number", (*head).Number(), "hash", (*head).Hash())
+			return nil
+		}
+		// Otherwise rewind one block and recheck state availability there
+		parent := self.GetBlock((*head).ParentHash(), (*head).NumberU64()-1)
+		if parent == nil {
+			return fmt.Errorf("missing block %d [%x…]", (*head).NumberU64()-1, (*head).ParentHash().Bytes()[:4])
+		}
+		*head = parent
+	}
+}
+
 // SetHead rewinds the local chain to a new head. In the case of headers, everything
 // above the new head will be deleted and the new one set. In the case of blocks
 // though, the head may be further rewound if block bodies are missing (non-archive
@@ -278,7 +352,7 @@ func (self *BlockChain) FastSyncCommitHead(hash common.Hash) error {
 	if block == nil {
 		return fmt.Errorf("non existent block [%x…]", hash[:4])
 	}
-	if _, err := trie.NewSecure(block.Root(), self.chainDb, 0); err != nil {
+	if _, err := trie.NewSecure(block.Root(), self.triedb, 0); err != nil {
 		return err
 	}
 	// If all checks out, manually set the head block
@@ -361,8 +435,8 @@ func (self *BlockChain) Processor() Processor {
 	return self.processor
 }
 
-// AuxValidator returns the auxiliary validator (Proof of work atm)
-func (self *BlockChain) AuxValidator() pow.PoW { return self.pow }
+// Engine retrieves the blockchain's consensus engine.
+func (self *BlockChain) Engine() consensus.Engine { return self.engine }
 
 // State returns a new mutable state based on the current HEAD block.
 func (self *BlockChain) State() (*state.StateDB, error) {
@@ -374,6 +448,12 @@ func (self *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return self.stateCache.New(root)
 }
 
+// StateDatabase retrieves the trie node database holding the recent states of the
+// chain in memory, falling back to the chain database for everything else.
+func (self *BlockChain) StateDatabase() *trie.NodeDatabase {
+	return self.triedb
+}
+
 // Reset purges the entire blockchain, restoring it to its genesis state.
 func (bc *BlockChain) Reset() {
 	bc.ResetWithGenesisBlock(bc.genesisBlock)
@@ -515,7 +595,7 @@ func (bc *BlockChain) HasBlockAndState(hash common.Hash) bool {
 		return false
 	}
 	// Ensure the associated state is also present
-	_, err := state.New(block.Root(), bc.chainDb)
+	_, err := state.New(block.Root(), bc.triedb)
 	return err == nil
 }
 
@@ -587,6 +667,37 @@ func (bc *BlockChain) Stop() {
 	atomic.StoreInt32(&bc.procInterrupt, 1)
 
 	bc.wg.Wait()
+
+	// Flatten the state snapshot into its disk layer, as diff layers are not
+	// persisted, and stop any background generation
+	if bc.snaps != nil {
+		if err := bc.snaps.Cap(bc.CurrentBlock().Root(), 0); err != nil {
+			log.Error("Failed to flatten state snapshot", "err", err)
+		}
+		bc.snaps.Close()
+	}
+	// Ensure the state of a few recent blocks survives the restart. If pruning is
+	// enabled, these are the head (nothing to reprocess), the block before it (in
+	// case of a small reorg) and the oldest retained one (for deep reorgs).
+	if !bc.cacheConfig.Disabled {
+		for _, offset := range []uint64{0, 1, bc.cacheConfig.TriesInMemory - 1} {
+			if number := bc.CurrentBlock().NumberU64(); number > offset {
+				recent := bc.GetBlockByNumber(number - offset)
+
+				log.Info("Writing cached state to disk", "block", recent.Number(), "hash", recent.Hash(), "root", recent.Root())
+				if err := bc.triedb.Commit(recent.Root()); err != nil {
+					log.Error("Failed to commit recent state trie", "err", err)
+				}
+			}
+		}
+		for !bc.triegc.Empty() {
+			root, _ := bc.triegc.Pop()
+			bc.triedb.Dereference(root.(common.Hash))
+		}
+		if size := bc.triedb.Size(); size != 0 {
+			log.Error("Dangling trie nodes after full cleanup", "size", size)
+		}
+	}
 	log.Info("Blockchain manager stopped")
 }
 
@@ -741,12 +852,6 @@ func (self *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain
 				log.Crit("Failed to write block receipts", "err", err)
 				return
 			}
-			if err := WriteMipmapBloom(self.chainDb, block.NumberU64(), receipts); err != nil {
-				errs[index] = fmt.Errorf("failed to write log blooms: %v", err)
-				atomic.AddInt32(&failed, 1)
-				log.Crit("Failed to write log blooms", "err", err)
-				return
-			}
 			if err := WriteTransactions(self.chainDb, block); err != nil {
 				errs[index] = fmt.Errorf("failed to write individual transactions: %v", err)
 				atomic.AddInt32(&failed, 1)
@@ -828,6 +933,10 @@ func (self *BlockChain) WriteBlock(block *types.Block) (status WriteStatus, err
 	if err := WriteBlock(self.chainDb, block); err != nil {
 		log.Crit("Failed to write block contents", "err", err)
 	}
+	// Persist or track the block's state depending on the pruning mode
+	if err := self.writeState(block); err != nil {
+		return NonStatTy, err
+	}
 
 	// If the total difficulty is higher than our known, add it to the canonical chain
 	// Second clause in the if statement reduces the vulnerability to selfish mining.
@@ -841,6 +950,12 @@ func (self *BlockChain) WriteBlock(block *types.Block) (status WriteStatus, err
 		}
 		self.insert(block) // Insert the block as the new head of the chain
 		status = CanonStatTy
+
+		// Keep the state snapshot in step with the head, rebuilding it if the
+		// new head's parent wasn't tracked (e.g. reorg deeper than the diffs)
+		if self.snaps != nil {
+			self.updateSnapshot(block.Root())
+		}
 	} else {
 		status = SideStatTy
 	}
@@ -850,6 +965,60 @@ func (self *BlockChain) WriteBlock(block *types.Block) (status WriteStatus, err
 	return
 }
 
+// updateSnapshot caps the diff layers of the state snapshot after the head block
+// changed to one with the given state root, or rebuilds the snapshot if there's
+// no layer for it.
+func (self *BlockChain) updateSnapshot(root common.Hash) {
+	if self.snaps.Snapshot(root) == nil {
+		self.snaps.Rebuild(root)
+		return
+	}
+	layers := snapshotLayers
+	if !self.cacheConfig.Disabled && self.cacheConfig.TriesInMemory/2 < uint64(layers) {
+		layers = int(self.cacheConfig.TriesInMemory / 2)
+	}
+	if err := self.snaps.Cap(root, layers); err != nil {
+		log.Warn("Failed to cap state snapshot", "root", root, "err", err)
+	}
+}
+
+// writeState handles the state trie of a freshly written block. Archive nodes
+// flush it straight to disk, whereas pruning nodes keep it in memory and garbage
+// collect the tries of blocks falling out of the retention window, only flushing
+// the ones on checkpoint blocks. This method assumes that the chain mutex is held.
+func (self *BlockChain) writeState(block *types.Block) error {
+	if self.cacheConfig.Disabled {
+		return self.triedb.Commit(block.Root())
+	}
+	// Pin the new state in memory and queue it up for garbage collection
+	self.triedb.Reference(block.Root())
+	self.triegc.Push(block.Root(), -float32(block.NumberU64()))
+
+	current := block.NumberU64()
+	if current < self.cacheConfig.TriesInMemory {
+		return nil
+	}
+	// Flush the state of the block leaving the window if it's a checkpoint
+	chosen := current - self.cacheConfig.TriesInMemory
+	if self.cacheConfig.TrieCheckpoint > 0 && chosen%self.cacheConfig.TrieCheckpoint == 0 {
+		if header := self.GetHeaderByNumber(chosen); header != nil {
+			if err := self.triedb.Commit(header.Root); err != nil {
+				return err
+			}
+		}
+	}
+	// Garbage collect anything at or below the block leaving the window
+	for !self.triegc.Empty() {
+		root, number := self.triegc.Pop()
+		if uint64(-number) > chosen {
+			self.triegc.Push(root, number)
+			break
+		}
+		self.triedb.Dereference(root.(common.Hash))
+	}
+	return nil
+}
+
 // InsertChain will attempt to insert the given chain in to the canonical chain or, otherwise, create a fork. If an error is returned
 // it will return the index number of the failing block as well an error describing what went wrong (for possible errors see core/errors.go).
 func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
@@ -878,59 +1047,58 @@ func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 		stats         = insertStats{startTime: mclock.Now()}
 		events        = make([]interface{}, 0, len(chain))
 		coalescedLogs []*types.Log
-		nonceChecked  = make([]bool, len(chain))
 	)
+	// Start the parallel header verifier
+	headers := make([]*types.Header, len(chain))
+	seals := make([]bool, len(chain))
 
-	// Start the parallel nonce verifier.
-	nonceAbort, nonceResults := verifyNoncesFromBlocks(self.pow, chain)
-	defer close(nonceAbort)
+	for i, block := range chain {
+		headers[i] = block.Header()
+		seals[i] = true
+	}
+	abort, results := self.engine.VerifyHeaders(self, headers, seals)
+	defer close(abort)
 
+	// Iterate over the blocks and insert when the verifier permits
 	for i, block := range chain {
+		// If the chain is terminating, stop processing blocks
 		if atomic.LoadInt32(&self.procInterrupt) == 1 {
 			log.Debug("Premature abort during blocks processing")
 			break
 		}
-		bstart := time.Now()
-		// Wait for block i's nonce to be verified before processing
-		// its state transition.
-		for !nonceChecked[i] {
-			r := <-nonceResults
-			nonceChecked[r.index] = true
-			if !r.valid {
-				invalid := chain[r.index]
-				return r.index, &BlockNonceErr{Hash: invalid.Hash(), Number: invalid.Number(), Nonce: invalid.Nonce()}
-			}
-		}
-
+		// If the header is a banned one, straight out abort
 		if BadHashes[block.Hash()] {
 			err := BadHashError(block.Hash())
 			self.reportBlock(block, nil, err)
 			return i, err
 		}
-		// Stage 1 validation of the block using the chain's validator
-		// interface.
-		err := self.Validator().ValidateBlock(block)
+		// Wait for the block's verification to complete
+		bstart := time.Now()
+
+		err := <-results
+		if err == nil {
+			err = self.Validator().ValidateBody(block)
+		}
 		if err != nil {
 			if IsKnownBlockErr(err) {
 				stats.ignored++
 				continue
 			}
 
-			if err == BlockFutureErr {
+			if err == consensus.ErrFutureBlock {
 				// Allow up to MaxFuture second in the future blocks. If this limit
 				// is exceeded the chain is discarded and processed at a later time
 				// if given.
 				max := big.NewInt(time.Now().Unix() + maxTimeFutureBlocks)
-				if block.Time().Cmp(max) == 1 {
-					return i, fmt.Errorf("%v: BlockFutureErr, %v > %v", BlockFutureErr, block.Time(), max)
+				if block.Time().Cmp(max) > 0 {
+					return i, fmt.Errorf("future block: %v > %v", block.Time(), max)
 				}
-
 				self.futureBlocks.Add(block.Hash(), block)
 				stats.queued++
 				continue
 			}
 
-			if IsParentErr(err) && self.futureBlocks.Contains(block.ParentHash()) {
+			if err == consensus.ErrUnknownAncestor && self.futureBlocks.Contains(block.ParentHash()) {
 				self.futureBlocks.Add(block.Hash(), block)
 				stats.queued++
 				continue
@@ -998,14 +1166,11 @@ func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 			if err := WriteReceipts(self.chainDb, receipts); err != nil {
 				return i, err
 			}
-			// Write map map bloom filters
-			if err := WriteMipmapBloom(self.chainDb, block.NumberU64(), receipts); err != nil {
-				return i, err
-			}
 			// Write hash preimages
 			if err := WritePreimages(self.chainDb, block.NumberU64(), self.stateCache.Preimages()); err != nil {
 				return i, err
 			}
+
 		case SideStatTy:
 			log.Debug("Inserted forked block", "number", block.Number(), "hash", block.Hash(), "diff", block.Difficulty(), "elapsed",
 				common.PrettyDuration(time.Since(bstart)), "txs", len(block.Transactions()), "gas", block.GasUsed(), "uncles", len(block.Uncles()))
@@ -1166,10 +1331,6 @@ func (self *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		if err := WriteReceipts(self.chainDb, receipts); err != nil {
 			return err
 		}
-		// Write map map bloom filters
-		if err := WriteMipmapBloom(self.chainDb, block.NumberU64(), receipts); err != nil {
-			return err
-		}
 		addedTxs = append(addedTxs, block.Transactions()...)
 	}
 
@@ -1279,10 +1440,10 @@ Error: %v
 // chain, possibly creating a reorg. If an error is returned, it will return the
 // index number of the failing header as well an error describing what went wrong.
 //
-// The verify parameter can be used to fine tune whether nonce verification
+// The verify parameter can be used to fine tune whether seal verification
 // should be done or not. The reason behind the optional check is because some
-// of the header retrieval mechanisms already need to verify nonces, as well as
-// because nonces can be verified sparsely, not needing to check each.
+// of the header retrieval mechanisms already need to verify seals, as well as
+// because seals can be verified sparsely, not needing to check each.
 func (self *BlockChain) InsertHeaderChain(chain []*types.Header, checkFreq int) (int, error) {
 	// Make sure only one thread manipulates the chain at once
 	self.chainmu.Lock()
@@ -0,0 +1,30 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+/*
+Package bloombits implements bloom filtering on batches of data.
+
+The header log blooms are rotated 90 degrees into per-bit vectors, each covering
+a fixed size section of consecutive blocks. Querying a section for a set of log
+addresses and topics thus only requires fetching (and AND/OR-ing together) the
+few bit vectors that correspond to the bits set by the filter criteria, instead
+of loading every single header in the section.
+
+Generator is used to rotate the header blooms of a section into bit vectors, and
+Matcher is used to run filter queries over the indexed sections by requesting
+the needed bit vectors from an arbitrary backend (local database, network).
+*/
+package bloombits
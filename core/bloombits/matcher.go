@@ -0,0 +1,391 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bloombits
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/net/context"
+)
+
+// maxSectionMatchers is the maximum number of sections a single session will
+// be matching concurrently, bounding the number of outstanding bit vectors.
+const maxSectionMatchers = 8
+
+// errInvalidBitset is returned if a retrieval delivered a bit vector that does
+// not correspond to the size of a section.
+var errInvalidBitset = errors.New("invalid bit vector delivered")
+
+// bloomIndexes represents the bit indexes inside the bloom filter that belong
+// to some key.
+type bloomIndexes [3]uint
+
+// calcBloomIndexes returns the bloom filter bit indexes belonging to the given key.
+func calcBloomIndexes(b []byte) bloomIndexes {
+	b = crypto.Keccak256(b)
+
+	var idxs bloomIndexes
+	for i := 0; i < len(idxs); i++ {
+		idxs[i] = (uint(b[2*i])<<8)&2047 + uint(b[2*i+1])
+	}
+	return idxs
+}
+
+// Retrieval represents a request for a batch of bit vectors of a single bloom
+// bit, or the response for such a request. The retriever fills the Bitsets
+// field with the uncompressed vectors in the same order as Sections, or sets
+// Error if the retrieval failed.
+type Retrieval struct {
+	Bit      uint
+	Sections []uint64
+	Bitsets  [][]byte
+
+	Context context.Context
+	Error   error
+}
+
+// Matcher is a pipelined system of schedulers and logic matchers which perform
+// binary AND/OR operations on the bit-streams, creating a stream of potential
+// blocks to inspect for data content.
+type Matcher struct {
+	sectionSize uint64           // Size of the data batches to filter on
+	filters     [][]bloomIndexes // Filter the system is matching for
+}
+
+// NewMatcher creates a new pipeline for retrieving bloom bit streams and doing
+// address and topic filtering on them. Setting a filter component to `nil` is
+// allowed and will result in that filter rule being skipped (OR 0x11...1).
+func NewMatcher(sectionSize uint64, filters [][][]byte) *Matcher {
+	m := &Matcher{sectionSize: sectionSize}
+
+	for _, filter := range filters {
+		// Gather the bit indexes of the filter rule, special casing the nil filter
+		if len(filter) == 0 {
+			continue
+		}
+		bloomBits := make([]bloomIndexes, len(filter))
+		for i, clause := range filter {
+			if clause == nil {
+				bloomBits = nil
+				break
+			}
+			bloomBits[i] = calcBloomIndexes(clause)
+		}
+		// Accumulate the filter rules if no nil rule was within
+		if bloomBits != nil {
+			m.filters = append(m.filters, bloomBits)
+		}
+	}
+	return m
+}
+
+// Start starts the matching process and returns a session that delivers the
+// numbers of the potentially matching blocks between begin and end (inclusive)
+// on the results channel. The channel is closed when matching terminates, after
+// which Error reports whether it was successful.
+//
+// The bit vectors needed during matching are not retrieved by the matcher itself,
+// rather the caller is expected to run one or more session multiplexers feeding
+// retrieval requests to its data backend.
+func (m *Matcher) Start(ctx context.Context, begin, end uint64, results chan uint64) *MatcherSession {
+	session := &MatcherSession{
+		matcher: m,
+		pending: make(map[uint][]*fetch),
+		wake:    make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+	}
+	session.ctx, session.cancel = context.WithCancel(ctx)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.fail(ctx.Err())
+		case <-session.quit:
+		}
+	}()
+	go session.run(begin, end, results)
+
+	return session
+}
+
+// fetch is a single pending bit vector retrieval of a section matcher.
+type fetch struct {
+	section uint64      // Section to retrieve the bit vector of
+	result  chan []byte // Channel to deliver the vector on (nil if failed)
+}
+
+// MatcherSession is returned by a started matcher to be used as a terminator
+// for the actively running matching operation and to feed it the bit vectors
+// it needs.
+type MatcherSession struct {
+	matcher *Matcher
+
+	ctx    context.Context    // Context passed along with the retrievals
+	cancel context.CancelFunc // Cancels the retrieval context on termination
+
+	lock    sync.Mutex
+	pending map[uint][]*fetch // Outstanding bit vector fetches, grouped by bloom bit
+	wake    chan struct{}     // Notification channel for the multiplexers
+
+	errLock sync.Mutex
+	err     error // Failure that terminated the session, if any
+
+	quit   chan struct{} // Termination channel of the session
+	closer sync.Once     // Sync object to ensure we only ever close once
+}
+
+// Close stops the matching process and cancels the context of any retrievals
+// still in flight. It is safe to call multiple times.
+func (s *MatcherSession) Close() {
+	s.closer.Do(func() {
+		close(s.quit)
+		s.cancel()
+	})
+}
+
+// Error returns any failure encountered during the matching session.
+func (s *MatcherSession) Error() error {
+	s.errLock.Lock()
+	defer s.errLock.Unlock()
+
+	return s.err
+}
+
+// fail records the first error encountered during matching and terminates the
+// session.
+func (s *MatcherSession) fail(err error) {
+	s.errLock.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.errLock.Unlock()
+
+	s.Close()
+}
+
+// run schedules the section matchers between begin and end, and streams their
+// matches in block order into the results channel.
+func (s *MatcherSession) run(begin, end uint64, results chan uint64) {
+	defer close(results)
+
+	// Start the section matchers, limiting the number of concurrently running ones
+	order := make(chan chan []uint64, maxSectionMatchers)
+	go func() {
+		defer close(order)
+
+		for section := begin / s.matcher.sectionSize; section <= end/s.matcher.sectionSize; section++ {
+			done := make(chan []uint64, 1)
+			select {
+			case order <- done:
+			case <-s.quit:
+				return
+			}
+			go func(section uint64) {
+				done <- s.matchSection(section, begin, end)
+			}(section)
+		}
+	}()
+	// Forward the matches in the order the sections were scheduled
+	for done := range order {
+		select {
+		case matches := <-done:
+			for _, number := range matches {
+				select {
+				case results <- number:
+				case <-s.quit:
+					return
+				}
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// matchSection retrieves all the bit vectors needed by the filters for a single
+// section, combines them and returns the numbers of the matching blocks in the
+// begin-end range. Nil is returned if the session was terminated meanwhile.
+func (s *MatcherSession) matchSection(section, begin, end uint64) []uint64 {
+	// Request all the distinct bit vectors needed by the filter rules
+	fetches := make(map[uint]chan []byte)
+	for _, bloomBits := range s.matcher.filters {
+		for _, idxs := range bloomBits {
+			for _, bit := range idxs {
+				if _, ok := fetches[bit]; !ok {
+					fetches[bit] = s.fetch(bit, section)
+				}
+			}
+		}
+	}
+	vectors := make(map[uint][]byte)
+	for bit, result := range fetches {
+		select {
+		case vector := <-result:
+			if vector == nil {
+				return nil
+			}
+			vectors[bit] = vector
+		case <-s.quit:
+			return nil
+		}
+	}
+	// AND the bits within a clause, OR the clauses within a rule and AND the rules
+	size := s.matcher.sectionSize / 8
+
+	match := make([]byte, size)
+	for i := range match {
+		match[i] = 0xff
+	}
+	for _, bloomBits := range s.matcher.filters {
+		rule := make([]byte, size)
+		for _, idxs := range bloomBits {
+			for i := range rule {
+				rule[i] |= vectors[idxs[0]][i] & vectors[idxs[1]][i] & vectors[idxs[2]][i]
+			}
+		}
+		for i := range match {
+			match[i] &= rule[i]
+		}
+	}
+	// Gather the block numbers within range that passed all the filters
+	var (
+		first   = section * s.matcher.sectionSize
+		matches []uint64
+	)
+	for i := uint64(0); i < s.matcher.sectionSize; i++ {
+		if match[i/8]&(1<<byte(7-i%8)) == 0 {
+			continue
+		}
+		if number := first + i; number >= begin && number <= end {
+			matches = append(matches, number)
+		}
+	}
+	return matches
+}
+
+// fetch schedules the retrieval of a single bit vector, returning the channel
+// on which it will be delivered.
+func (s *MatcherSession) fetch(bit uint, section uint64) chan []byte {
+	result := make(chan []byte, 1)
+
+	s.lock.Lock()
+	s.pending[bit] = append(s.pending[bit], &fetch{section: section, result: result})
+	s.lock.Unlock()
+
+	s.notify()
+	return result
+}
+
+// notify wakes up a multiplexer if there's none yet signalled.
+func (s *MatcherSession) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// allocate assigns a batch of pending fetches of a single bloom bit to the
+// caller, also reporting whether there are further fetches pending.
+func (s *MatcherSession) allocate(batch int) (uint, []*fetch, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for bit, fetches := range s.pending {
+		if len(fetches) > batch {
+			s.pending[bit], fetches = fetches[batch:], fetches[:batch]
+		} else {
+			delete(s.pending, bit)
+		}
+		return bit, fetches, len(s.pending) > 0
+	}
+	return 0, nil, false
+}
+
+// Multiplex polls the matcher session for retrieval tasks and multiplexes them
+// into the requested retrieval queue to be serviced together with other sessions.
+//
+// Each retrieval is carried out by sending a fresh request channel on mux, then
+// a *Retrieval task on the request channel, finally waiting for the same task
+// to be sent back with the results filled in.
+//
+// This method will block for the lifetime of the session. Even after termination
+// of the session, any request in-flight need to be responded to! Empty responses
+// are fine though in that case.
+func (s *MatcherSession) Multiplex(batch int, wait time.Duration, mux chan chan *Retrieval) {
+	for {
+		// Wait until there are pending fetches to service
+		select {
+		case <-s.quit:
+			return
+		case <-s.wake:
+		}
+		// Allow some time for the section matchers to queue up more fetches
+		if wait > 0 {
+			select {
+			case <-s.quit:
+				return
+			case <-time.After(wait):
+			}
+		}
+		for {
+			bit, fetches, more := s.allocate(batch)
+			if fetches == nil {
+				break
+			}
+			if more {
+				s.notify()
+			}
+			// Acquire a retriever and hand over the task
+			request := make(chan *Retrieval)
+			select {
+			case <-s.quit:
+				return
+			case mux <- request:
+			}
+			task := &Retrieval{
+				Bit:      bit,
+				Sections: make([]uint64, len(fetches)),
+				Context:  s.ctx,
+			}
+			for i, fetch := range fetches {
+				task.Sections[i] = fetch.section
+			}
+			request <- task
+			result := <-request
+
+			// Deliver the retrieved bit vectors to the section matchers
+			if result.Error != nil {
+				s.fail(result.Error)
+				return
+			}
+			if len(result.Bitsets) != len(fetches) {
+				s.fail(errInvalidBitset)
+				return
+			}
+			for i, fetch := range fetches {
+				if uint64(len(result.Bitsets[i])) != s.matcher.sectionSize/8 {
+					s.fail(errInvalidBitset)
+					return
+				}
+				fetch.result <- result.Bitsets[i]
+			}
+		}
+	}
+}
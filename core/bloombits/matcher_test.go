@@ -0,0 +1,217 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bloombits
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/net/context"
+)
+
+const testSectionSize = 4096
+
+// Tests that wildcard filter rules (nil) can be specified and are handled well.
+func TestMatcherWildcards(t *testing.T) {
+	matcher := NewMatcher(testSectionSize, [][][]byte{
+		{common1, nil},     // Wildcard address
+		{},                 // Wildcard topic
+		{common2, common3}, // Proper topic
+		{nil, nil},         // Wildcard topic
+	})
+	if len(matcher.filters) != 1 {
+		t.Fatalf("filter system size mismatch: have %d, want %d", len(matcher.filters), 1)
+	}
+	if len(matcher.filters[0]) != 2 {
+		t.Fatalf("filter system rule size mismatch: have %d, want %d", len(matcher.filters[0]), 2)
+	}
+	if matcher.filters[0][0] != calcBloomIndexes(common2) || matcher.filters[0][1] != calcBloomIndexes(common3) {
+		t.Fatalf("filter system rule mismatch: have %v, want %v", matcher.filters[0], []bloomIndexes{calcBloomIndexes(common2), calcBloomIndexes(common3)})
+	}
+}
+
+var (
+	common1 = []byte{0x01}
+	common2 = []byte{0x02}
+	common3 = []byte{0x03}
+)
+
+// Tests the matcher pipeline on single and multiple continuous sections for
+// various filter combinations.
+func TestMatcherContinuous(t *testing.T) {
+	testMatcher(t, [][][]byte{{common1}}, 0, 100000)
+	testMatcher(t, [][][]byte{{common1, common2}}, 0, 100000)
+	testMatcher(t, [][][]byte{{common1}, {common2, common3}}, 0, 100000)
+	testMatcher(t, [][][]byte{}, 0, 10000)
+}
+
+// Tests the matcher pipeline on ranges not aligned to section boundaries.
+func TestMatcherUnaligned(t *testing.T) {
+	testMatcher(t, [][][]byte{{common1, common2}}, 1234, 1235)
+	testMatcher(t, [][][]byte{{common1, common2}}, 4000, 4200)
+	testMatcher(t, [][][]byte{{common1}, {common2, common3}}, 3333, 33333)
+}
+
+// Tests that a failed retrieval terminates the session and the error is surfaced.
+func TestMatcherFailure(t *testing.T) {
+	failure := errors.New("retrieval failed")
+
+	matcher := NewMatcher(testSectionSize, [][][]byte{{common1}})
+	results := make(chan uint64)
+	session := matcher.Start(context.Background(), 0, 100000, results)
+	defer session.Close()
+
+	requests := make(chan chan *Retrieval)
+	go session.Multiplex(16, 0, requests)
+	go func() {
+		for {
+			select {
+			case request := <-requests:
+				task := <-request
+				task.Error = failure
+				request <- task
+			case <-time.After(time.Second):
+				return
+			}
+		}
+	}()
+	for range results {
+	}
+	if err := session.Error(); err != failure {
+		t.Fatalf("session error mismatch: have %v, want %v", err, failure)
+	}
+}
+
+// testMatcher runs the matcher over the given range with a number of concurrent
+// multiplexers and retrievers, and checks that the delivered block numbers are
+// the same as brute force filtering the generated bit vectors would return.
+func testMatcher(t *testing.T, filter [][][]byte, begin, end uint64) {
+	matcher := NewMatcher(testSectionSize, filter)
+
+	results := make(chan uint64, 16)
+	session := matcher.Start(context.Background(), begin, end, results)
+	defer session.Close()
+
+	requests := make(chan chan *Retrieval)
+	for i := 0; i < 4; i++ {
+		go session.Multiplex(16, time.Millisecond, requests)
+	}
+	quit := make(chan struct{})
+	defer close(quit)
+
+	for i := 0; i < 8; i++ {
+		go func() {
+			for {
+				select {
+				case request := <-requests:
+					task := <-request
+					task.Bitsets = make([][]byte, len(task.Sections))
+					for i, section := range task.Sections {
+						task.Bitsets[i] = generateBitset(task.Bit, section)
+					}
+					request <- task
+				case <-quit:
+					return
+				}
+			}
+		}()
+	}
+	// Gather the expected results by brute force and compare
+	var want []uint64
+	for number := begin; number <= end; number++ {
+		if expectMatch(matcher, number) {
+			want = append(want, number)
+		}
+	}
+	var have []uint64
+	for number := range results {
+		have = append(have, number)
+	}
+	if err := session.Error(); err != nil {
+		t.Fatalf("filter %v, range %d-%d: session failed: %v", filter, begin, end, err)
+	}
+	if len(have) != len(want) {
+		t.Fatalf("filter %v, range %d-%d: match count mismatch: have %d, want %d", filter, begin, end, len(have), len(want))
+	}
+	for i := range have {
+		if have[i] != want[i] {
+			t.Fatalf("filter %v, range %d-%d: match %d mismatch: have %d, want %d", filter, begin, end, i, have[i], want[i])
+		}
+	}
+}
+
+// expectMatch checks whether a block would pass all the matcher's filter rules
+// based on the generated bit vectors.
+func expectMatch(matcher *Matcher, number uint64) bool {
+	section, index := number/testSectionSize, number%testSectionSize
+
+	isSet := func(bit uint) bool {
+		return cachedBitset(bit, section)[index/8]&(1<<byte(7-index%8)) != 0
+	}
+	for _, rule := range matcher.filters {
+		passed := false
+		for _, idxs := range rule {
+			if isSet(idxs[0]) && isSet(idxs[1]) && isSet(idxs[2]) {
+				passed = true
+				break
+			}
+		}
+		if !passed {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	bitsetCache     = make(map[[2]uint64][]byte)
+	bitsetCacheLock sync.Mutex
+)
+
+// cachedBitset returns the generated bit vector of a bloom bit and section,
+// caching it to avoid regenerating it for every block during brute forcing.
+func cachedBitset(bit uint, section uint64) []byte {
+	bitsetCacheLock.Lock()
+	defer bitsetCacheLock.Unlock()
+
+	key := [2]uint64{uint64(bit), section}
+	if bitset, ok := bitsetCache[key]; ok {
+		return bitset
+	}
+	bitset := generateBitset(bit, section)
+	bitsetCache[key] = bitset
+	return bitset
+}
+
+// generateBitset deterministically generates a pseudo random bit vector for the
+// given bloom bit and section.
+func generateBitset(bit uint, section uint64) []byte {
+	seed := make([]byte, 16)
+	binary.BigEndian.PutUint64(seed, uint64(bit))
+	binary.BigEndian.PutUint64(seed[8:], section)
+
+	bitset := make([]byte, testSectionSize/8)
+	for i := 0; i < len(bitset); i += 32 {
+		seed = crypto.Keccak256(seed)
+		copy(bitset[i:], seed)
+	}
+	return bitset
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// testChainIndexBackend implements ChainIndexerBackend, verifying that the
+// headers of a section are fed to it in order and completely.
+type testChainIndexBackend struct {
+	t           *testing.T
+	sectionSize uint64
+	section     uint64
+	processed   uint64
+}
+
+func (b *testChainIndexBackend) Reset(section uint64) error {
+	b.section, b.processed = section, 0
+	return nil
+}
+
+func (b *testChainIndexBackend) Process(header *types.Header) {
+	if want := b.section*b.sectionSize + b.processed; header.Number.Uint64() != want {
+		b.t.Errorf("section %d: header number mismatch: have %d, want %d", b.section, header.Number, want)
+	}
+	b.processed++
+}
+
+func (b *testChainIndexBackend) Commit() error {
+	if b.processed != b.sectionSize {
+		return fmt.Errorf("section %d: processed %d headers, want %d", b.section, b.processed, b.sectionSize)
+	}
+	return nil
+}
+
+// Tests that a chain of indexers processes confirmed sections, rolls back on
+// reorgs and cascades its progress to child indexers.
+func TestChainIndexer(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	// inject inserts a new random canonical header into the database directly
+	inject := func(from, to uint64) {
+		for number := from; number <= to; number++ {
+			header := &types.Header{Number: new(big.Int).SetUint64(number), Extra: big.NewInt(rand.Int63()).Bytes()}
+			if number > 0 {
+				header.ParentHash = GetCanonicalHash(db, number-1)
+			}
+			WriteHeader(db, header)
+			WriteCanonicalHash(db, header.Hash(), number)
+		}
+	}
+	root := NewChainIndexer(db, ethdb.NewTable(db, "root-"), &testChainIndexBackend{t: t, sectionSize: 16}, 16, 4, 0, "root")
+	child := NewChainIndexer(db, ethdb.NewTable(db, "child-"), &testChainIndexBackend{t: t, sectionSize: 32}, 32, 0, 0, "child")
+	root.AddChildIndexer(child)
+	defer root.Close()
+
+	// Index an already existing chain
+	inject(0, 99)
+	root.newHead(99, false)
+	waitSections(t, root, 6)
+	waitSections(t, child, 3)
+
+	// Reorg into the middle of the indexed range, both indexers must roll back
+	root.newHead(50, true)
+	assertSections(t, root, 3)
+	assertSections(t, child, 1)
+
+	// Extend a new fork past the original chain, indexing the new sections
+	inject(51, 150)
+	root.newHead(150, false)
+	waitSections(t, root, 9)
+	waitSections(t, child, 4)
+
+	// Notify about more blocks than available, processing must stop at the gap
+	root.newHead(200, false)
+	time.Sleep(100 * time.Millisecond)
+	assertSections(t, root, 9)
+
+	// Fill the gap, processing must resume on the next head
+	inject(151, 250)
+	root.newHead(250, false)
+	waitSections(t, root, 15)
+	waitSections(t, child, 7)
+}
+
+// waitSections waits until the indexer reports the expected number of valid
+// sections, failing the test after a timeout.
+func waitSections(t *testing.T, indexer *ChainIndexer, want uint64) {
+	for i := 0; ; i++ {
+		if sections, _, _ := indexer.Sections(); sections == want {
+			break
+		}
+		if i == 100 {
+			sections, _, _ := indexer.Sections()
+			t.Fatalf("section count mismatch: have %d, want %d", sections, want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	assertSections(t, indexer, want)
+}
+
+// assertSections checks that the indexer reports the given number of valid
+// sections, and that the last indexed section is canonical.
+func assertSections(t *testing.T, indexer *ChainIndexer, want uint64) {
+	sections, last, head := indexer.Sections()
+	if sections != want {
+		t.Fatalf("section count mismatch: have %d, want %d", sections, want)
+	}
+	if sections == 0 {
+		return
+	}
+	if canon := GetCanonicalHash(indexer.chainDb, last); head != canon || head == (common.Hash{}) {
+		t.Fatalf("section head mismatch: have %x, want %x", head, canon)
+	}
+}
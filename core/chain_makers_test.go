@@ -19,7 +19,13 @@ package core
 import (
 	"fmt"
 	"math/big"
+	"testing"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -52,7 +58,7 @@ func ExampleGenerateChain() {
 	// This call generates a chain of 5 blocks. The function runs for
 	// each block and adds different features to gen based on the
 	// block index.
-	chain, _ := GenerateChain(chainConfig, genesis, db, 5, func(i int, gen *BlockGen) {
+	chain, _ := GenerateChain(chainConfig, genesis, ethash.NewFaker(), db, 5, func(i int, gen *BlockGen) {
 		switch i {
 		case 0:
 			// In block 1, addr1 sends addr2 some ether.
@@ -82,7 +88,7 @@ func ExampleGenerateChain() {
 
 	// Import the chain. This runs all block validation rules.
 	evmux := &event.TypeMux{}
-	blockchain, _ := NewBlockChain(db, chainConfig, FakePow{}, evmux, vm.Config{})
+	blockchain, _ := NewBlockChain(db, nil, chainConfig, ethash.NewFaker(), evmux, vm.Config{})
 	if i, err := blockchain.InsertChain(chain); err != nil {
 		fmt.Printf("insert error (block %d): %v\n", chain[i].NumberU64(), err)
 		return
@@ -99,3 +105,45 @@ func ExampleGenerateChain() {
 	// balance of addr2: 10000
 	// balance of addr3: 19687500000000001000
 }
+
+// Tests that generated blocks are finalized by the given consensus engine, not
+// by hard coded ethash rules.
+func TestGenerateChainEngine(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		coinbase = common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+		genesis  = WriteGenesisBlockForTesting(db)
+	)
+	// Ethash rewards both blocks, the uncle inclusion and the uncle itself (7/8 of
+	// a block reward), whereas clique gives no rewards and drops uncles.
+	ethashReward, _ := new(big.Int).SetString("14531250000000000000", 10)
+
+	tests := []struct {
+		engine consensus.Engine
+		reward *big.Int
+		uncles int
+	}{
+		{ethash.NewFaker(), ethashReward, 1},
+		{clique.New(&params.CliqueConfig{Period: 1, Epoch: 30000}, db), new(big.Int), 0},
+	}
+	for i, tt := range tests {
+		blocks, _ := GenerateChain(params.TestChainConfig, genesis, tt.engine, db, 2, func(n int, gen *BlockGen) {
+			gen.SetCoinbase(coinbase)
+			if n == 1 {
+				uncle := gen.PrevBlock(0).Header()
+				uncle.Extra = []byte("uncle")
+				gen.AddUncle(uncle)
+			}
+		})
+		if uncles := len(blocks[1].Uncles()); uncles != tt.uncles {
+			t.Errorf("test %d: uncle count mismatch: have %d, want %d", i, uncles, tt.uncles)
+		}
+		statedb, err := state.New(blocks[1].Root(), db)
+		if err != nil {
+			t.Fatalf("test %d: failed to open generated state: %v", i, err)
+		}
+		if balance := statedb.GetBalance(coinbase); balance.Cmp(tt.reward) != 0 {
+			t.Errorf("test %d: coinbase balance mismatch: have %v, want %v", i, balance, tt.reward)
+		}
+	}
+}
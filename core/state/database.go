@@ -0,0 +1,50 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// emptyRoot is the known root hash of an empty trie.
+var emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+// NewNodeDatabase creates an in-memory trie node cache on top of the given disk
+// database, aware of the account layout of the state trie: the storage tries and
+// contract code referenced from accounts are reference counted along with the
+// account trie itself.
+func NewNodeDatabase(diskdb ethdb.Database) *trie.NodeDatabase {
+	return trie.NewNodeDatabase(diskdb, func(leaf []byte) []common.Hash {
+		var account Account
+		if err := rlp.DecodeBytes(leaf, &account); err != nil {
+			return nil
+		}
+		var refs []common.Hash
+		if account.Root != emptyRoot {
+			refs = append(refs, account.Root)
+		}
+		if !bytes.Equal(account.CodeHash, emptyCodeHash) {
+			refs = append(refs, common.BytesToHash(account.CodeHash))
+		}
+		return refs
+	})
+}
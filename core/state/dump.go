@@ -19,8 +19,10 @@ package state
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -31,6 +33,9 @@ type DumpAccount struct {
 	CodeHash string            `json:"codeHash"`
 	Code     string            `json:"code"`
 	Storage  map[string]string `json:"storage"`
+
+	Address   *common.Address `json:"address,omitempty"` // Account address in iterative dumps, nil if the preimage is unknown
+	SecureKey hexutil.Bytes   `json:"key,omitempty"`     // Hash of the account address in iterative dumps
 }
 
 type Dump struct {
@@ -38,6 +43,49 @@ type Dump struct {
 	Accounts map[string]DumpAccount `json:"accounts"`
 }
 
+// AccountRange is a page of accounts iterated from the state, keyed by the hash
+// of their address, along with the hash of the next account to continue from.
+type AccountRange struct {
+	Root     string                      `json:"root"`
+	Accounts map[common.Hash]DumpAccount `json:"accounts"`
+	Next     *common.Hash                `json:"next"` // nil if no more accounts remain
+}
+
+// StorageEntry is a single storage slot of an account.
+type StorageEntry struct {
+	Key   *common.Hash `json:"key"` // nil if the preimage is unknown
+	Value common.Hash  `json:"value"`
+}
+
+// StorageRange is a page of storage slots iterated from an account, keyed by the
+// hash of the slot, along with the hash of the next slot to continue from.
+type StorageRange struct {
+	Storage map[common.Hash]StorageEntry `json:"storage"`
+	Next    *common.Hash                 `json:"nextKey"` // nil if no more slots remain
+}
+
+// dumpAccount assembles the dump of a single account, optionally including all
+// of its storage slots.
+func (self *StateDB) dumpAccount(addr common.Address, data Account, storage bool) DumpAccount {
+	obj := newObject(nil, addr, data, nil)
+	account := DumpAccount{
+		Balance:  data.Balance.String(),
+		Nonce:    data.Nonce,
+		Root:     common.Bytes2Hex(data.Root[:]),
+		CodeHash: common.Bytes2Hex(data.CodeHash),
+		Code:     common.Bytes2Hex(obj.Code(self.db)),
+	}
+	if storage {
+		account.Storage = make(map[string]string)
+
+		storageIt := obj.getTrie(self.db).Iterator()
+		for storageIt.Next() {
+			account.Storage[common.Bytes2Hex(self.trie.GetKey(storageIt.Key))] = common.Bytes2Hex(storageIt.Value)
+		}
+	}
+	return account
+}
+
 func (self *StateDB) RawDump() Dump {
 	dump := Dump{
 		Root:     common.Bytes2Hex(self.trie.Root()),
@@ -51,25 +99,111 @@ func (self *StateDB) RawDump() Dump {
 		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
 			panic(err)
 		}
+		dump.Accounts[common.Bytes2Hex(addr)] = self.dumpAccount(common.BytesToAddress(addr), data, true)
+	}
+	return dump
+}
 
-		obj := newObject(nil, common.BytesToAddress(addr), data, nil)
-		account := DumpAccount{
-			Balance:  data.Balance.String(),
-			Nonce:    data.Nonce,
-			Root:     common.Bytes2Hex(data.Root[:]),
-			CodeHash: common.Bytes2Hex(data.CodeHash),
-			Code:     common.Bytes2Hex(obj.Code(self.db)),
-			Storage:  make(map[string]string),
+// IterativeDump streams the entire state into the writer as JSON lines: first
+// the state root, followed by one line per account including its storage. As
+// opposed to RawDump, the state is never fully held in memory.
+func (self *StateDB) IterativeDump(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(struct {
+		Root string `json:"root"`
+	}{common.Bytes2Hex(self.trie.Root())}); err != nil {
+		return err
+	}
+	it := self.trie.Iterator()
+	for it.Next() {
+		var data Account
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			return fmt.Errorf("account %x: %v", it.Key, err)
 		}
-		storageIt := obj.getTrie(self.db).Iterator()
-		for storageIt.Next() {
-			account.Storage[common.Bytes2Hex(self.trie.GetKey(storageIt.Key))] = common.Bytes2Hex(storageIt.Value)
+		preimage := self.trie.GetKey(it.Key)
+		addr := common.BytesToAddress(preimage)
+
+		account := self.dumpAccount(addr, data, true)
+		if preimage != nil {
+			account.Address = &addr
+		}
+		account.SecureKey = common.CopyBytes(it.Key)
+
+		if err := enc.Encode(account); err != nil {
+			return err
 		}
-		dump.Accounts[common.Bytes2Hex(addr)] = account
 	}
-	return dump
+	return nil
+}
+
+// AccountRange iterates at most maxResults accounts from the state, starting at
+// the given account hash. The storage of the accounts is not included, it can be
+// retrieved page by page via StorageRange.
+func (self *StateDB) AccountRange(start common.Hash, maxResults int) (AccountRange, error) {
+	result := AccountRange{
+		Root:     common.Bytes2Hex(self.trie.Root()),
+		Accounts: make(map[common.Hash]DumpAccount),
+	}
+	it := self.trie.IteratorFrom(start[:])
+	for it.Next() {
+		hash := common.BytesToHash(it.Key)
+		if len(result.Accounts) >= maxResults {
+			result.Next = &hash
+			break
+		}
+		var data Account
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			return AccountRange{}, fmt.Errorf("account %x: %v", hash, err)
+		}
+		preimage := self.trie.GetKey(it.Key)
+		addr := common.BytesToAddress(preimage)
+
+		account := self.dumpAccount(addr, data, false)
+		if preimage != nil {
+			account.Address = &addr
+		}
+		result.Accounts[hash] = account
+	}
+	return result, nil
 }
 
+// StorageRange iterates at most maxResults storage slots of an account, starting
+// at the given slot hash. Any pending storage changes of the account are flushed
+// into its storage trie first, so the range reflects the current state.
+func (self *StateDB) StorageRange(addr common.Address, start common.Hash, maxResults int) (StorageRange, error) {
+	result := StorageRange{
+		Storage: make(map[common.Hash]StorageEntry),
+	}
+	stateObject := self.getStateObject(addr)
+	if stateObject == nil {
+		return result, nil
+	}
+	stateObject.updateTrie(self.db)
+	if stateObject.dbErr != nil {
+		return StorageRange{}, stateObject.dbErr
+	}
+	tr := stateObject.getTrie(self.db)
+
+	it := tr.IteratorFrom(start[:])
+	for it.Next() {
+		hash := common.BytesToHash(it.Key)
+		if len(result.Storage) >= maxResults {
+			result.Next = &hash
+			break
+		}
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return StorageRange{}, fmt.Errorf("slot %x: %v", hash, err)
+		}
+		entry := StorageEntry{Value: common.BytesToHash(content)}
+		if preimage := tr.GetKey(it.Key); preimage != nil {
+			key := common.BytesToHash(preimage)
+			entry.Key = &key
+		}
+		result.Storage[hash] = entry
+	}
+	return result, nil
+}
 func (self *StateDB) Dump() []byte {
 	json, err := json.MarshalIndent(self.RawDump(), "", "    ")
 	if err != nil {
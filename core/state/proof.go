@@ -0,0 +1,58 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// VerifyAccountProof checks a Merkle proof of an account against the given state
+// root, returning the proven account or nil if the proof shows its absence.
+func VerifyAccountProof(root common.Hash, addr common.Address, proof []rlp.RawValue) (*Account, error) {
+	if root == emptyRoot && len(proof) == 0 {
+		return nil, nil
+	}
+	blob, err := trie.VerifyProof(root, crypto.Keccak256(addr[:]), proof)
+	if err != nil || blob == nil {
+		return nil, err
+	}
+	account := new(Account)
+	if err := rlp.DecodeBytes(blob, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// VerifyStorageProof checks a Merkle proof of a storage slot against the given
+// storage root, returning the proven value (zero if the slot is empty).
+func VerifyStorageProof(root common.Hash, key common.Hash, proof []rlp.RawValue) (common.Hash, error) {
+	if root == emptyRoot && len(proof) == 0 {
+		return common.Hash{}, nil
+	}
+	blob, err := trie.VerifyProof(root, crypto.Keccak256(key[:]), proof)
+	if err != nil || blob == nil {
+		return common.Hash{}, err
+	}
+	_, content, _, err := rlp.Split(blob)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(content), nil
+}
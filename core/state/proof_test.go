@@ -0,0 +1,80 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// Tests that account and storage proofs generated from a state can be verified
+// against its root, both for existing and for missing entries.
+func TestStateProofs(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, db)
+
+	for i := byte(1); i < 100; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		state.AddBalance(addr, big.NewInt(int64(11*i)))
+		state.SetNonce(addr, uint64(42*i))
+		state.SetState(addr, common.BytesToHash([]byte{i}), common.BytesToHash([]byte{i, i}))
+	}
+	root, _ := state.Commit(false)
+	state, _ = New(root, db)
+
+	// Verify the proofs of existing accounts and slots
+	for i := byte(1); i < 100; i++ {
+		addr := common.BytesToAddress([]byte{i})
+
+		account, err := VerifyAccountProof(root, addr, state.GetProof(addr))
+		if err != nil {
+			t.Fatalf("account %x: failed to verify proof: %v", addr, err)
+		}
+		if account == nil || account.Balance.Cmp(big.NewInt(int64(11*i))) != 0 || account.Nonce != uint64(42*i) {
+			t.Fatalf("account %x: proven account mismatch: %+v", addr, account)
+		}
+		key := common.BytesToHash([]byte{i})
+		value, err := VerifyStorageProof(account.Root, key, state.GetStorageProof(addr, key))
+		if err != nil {
+			t.Fatalf("account %x: failed to verify storage proof: %v", addr, err)
+		}
+		if want := common.BytesToHash([]byte{i, i}); value != want {
+			t.Fatalf("account %x: proven storage mismatch: have %x, want %x", addr, value, want)
+		}
+		// Missing slots must be proven empty
+		missing := common.BytesToHash([]byte{i, i, i})
+		if value, err := VerifyStorageProof(account.Root, missing, state.GetStorageProof(addr, missing)); err != nil || value != (common.Hash{}) {
+			t.Fatalf("account %x: missing slot proof mismatch: value %x, err %v", addr, value, err)
+		}
+	}
+	// Verify the proof of a missing account
+	missing := common.BytesToAddress([]byte{0xff})
+	if account, err := VerifyAccountProof(root, missing, state.GetProof(missing)); err != nil || account != nil {
+		t.Fatalf("missing account proof mismatch: account %+v, err %v", account, err)
+	}
+	if value, err := VerifyStorageProof(emptyRoot, common.Hash{}, state.GetStorageProof(missing, common.Hash{})); err != nil || value != (common.Hash{}) {
+		t.Fatalf("missing account storage proof mismatch: value %x, err %v", value, err)
+	}
+	// Ensure proofs don't verify against a different root
+	addr := common.BytesToAddress([]byte{1})
+	if _, err := VerifyAccountProof(emptyRoot, addr, state.GetProof(addr)); err == nil {
+		t.Fatalf("proof verified against wrong root")
+	}
+}
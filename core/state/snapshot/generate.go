@@ -0,0 +1,332 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// generatorBatchSize is the number of snapshot entries accumulated in memory
+// before flushing them to disk during generation (or wiping).
+const generatorBatchSize = 1024
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// errNotIterable is returned if the snapshot needs to wipe data from a
+	// database that doesn't support iteration.
+	errNotIterable = errors.New("database not iterable")
+)
+
+// account is the consensus representation of accounts, decoded to find the
+// storage trie of each account during generation.
+type account struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// generateSnapshot regenerates a brand new snapshot based on an existing state
+// database and head block asynchronously. The snapshot is returned immediately
+// and generation is continued in the background until done.
+func generateSnapshot(diskdb ethdb.Database, triedb *trie.NodeDatabase, root common.Hash) *diskLayer {
+	// Drop the root marker first so a crash before generation starts doesn't
+	// resurrect the old snapshot, then flag the new one as being generated
+	if err := diskdb.Delete(snapshotRootKey); err != nil {
+		log.Crit("Failed to remove snapshot root marker", "err", err)
+	}
+	batch := diskdb.NewBatch()
+	batch.Put(snapshotGeneratorKey, []byte{})
+	batch.Put(snapshotRootKey, root[:])
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write initialized state marker", "err", err)
+	}
+	base := &diskLayer{
+		diskdb:    diskdb,
+		triedb:    triedb,
+		root:      root,
+		genMarker: []byte{}, // Initialized but empty!
+	}
+	base.startGeneration()
+	return base
+}
+
+// startGeneration launches the background generator of the disk layer.
+func (dl *diskLayer) startGeneration() {
+	dl.genAbort = make(chan chan struct{})
+	go dl.generate()
+}
+
+// stopGeneration interrupts the background generator of the disk layer (if any)
+// and waits until it terminates.
+func (dl *diskLayer) stopGeneration() {
+	if dl.genAbort == nil {
+		return
+	}
+	abort := make(chan struct{})
+	dl.genAbort <- abort
+	<-abort
+
+	dl.genAbort = nil
+}
+
+// generate is a background thread that iterates over the state and storage tries
+// of the layer's root and writes them into the flat snapshot, continuing from the
+// generation marker. Any data beyond the marker is considered left over from an
+// interrupted run (or an old snapshot) and is wiped before starting.
+func (dl *diskLayer) generate() {
+	var (
+		abort  chan struct{}
+		start  = time.Now()
+		logged = time.Now()
+
+		accounts, slots uint64
+	)
+	aborted := func() bool {
+		select {
+		case abort = <-dl.genAbort:
+			return true
+		default:
+			return false
+		}
+	}
+	// Wait for the abort signal after finishing (or failing), so that stopping
+	// the generator is always a synchronous operation
+	defer func() {
+		if abort == nil {
+			abort = <-dl.genAbort
+		}
+		close(abort)
+	}()
+	// Only the generator modifies the marker, reading it is safe without locks
+	marker := dl.genMarker
+
+	var origin common.Hash
+	if len(marker) > 0 {
+		next, ok := incHash(common.BytesToHash(marker))
+		if !ok {
+			dl.finishGeneration(accounts, slots, start)
+			return
+		}
+		origin = next
+	}
+	// Wipe anything beyond the marker, leftover from an interrupted generation
+	leftovers := []struct{ prefix, start []byte }{
+		{snapshotAccountPrefix, accountKey(origin)},
+		{snapshotStoragePrefix, storageKey(origin, common.Hash{})},
+	}
+	for _, wipe := range leftovers {
+		if err := wipeKeyRange(dl.diskdb, wipe.prefix, wipe.start, len(wipe.start), aborted); err != nil {
+			log.Error("Failed to wipe snapshot leftovers", "err", err)
+			return
+		}
+		if abort != nil {
+			return
+		}
+	}
+	accTrie, err := trie.New(dl.root, dl.triedb)
+	if err != nil {
+		log.Warn("Snapshot generation failed", "root", dl.root, "err", err)
+		return
+	}
+	// Iterate the account trie from the origin and index every account with its
+	// storage, only advancing the marker when accounts are fully written
+	var (
+		batch   = dl.diskdb.NewBatch()
+		pending int
+		genErr  error
+	)
+	flush := func() bool {
+		if err := batch.Write(); err != nil {
+			genErr = err
+			return false
+		}
+		batch, pending = dl.diskdb.NewBatch(), 0
+		return true
+	}
+	err = iterateFrom(accTrie, origin, func(accountHash common.Hash, blob []byte) bool {
+		var acc account
+		if err := rlp.DecodeBytes(blob, &acc); err != nil {
+			genErr = err
+			return false
+		}
+		if acc.Root != emptyRoot {
+			storeTrie, err := trie.New(acc.Root, dl.triedb)
+			if err != nil {
+				genErr = err
+				return false
+			}
+			err = iterateFrom(storeTrie, common.Hash{}, func(storageHash common.Hash, blob []byte) bool {
+				batch.Put(storageKey(accountHash, storageHash), blob)
+				slots++
+
+				if pending++; pending >= generatorBatchSize {
+					return flush() && !aborted()
+				}
+				return true
+			})
+			if err != nil {
+				genErr = err
+			}
+			if genErr != nil || abort != nil {
+				return false
+			}
+		}
+		batch.Put(accountKey(accountHash), blob)
+		accounts++
+
+		// Persist the progress if enough data accumulated, and expose the newly
+		// covered accounts to readers
+		if pending++; pending >= generatorBatchSize {
+			batch.Put(snapshotGeneratorKey, accountHash[:])
+			if !flush() {
+				return false
+			}
+			dl.lock.Lock()
+			dl.genMarker = common.CopyBytes(accountHash[:])
+			dl.lock.Unlock()
+
+			if time.Since(logged) > 8*time.Second {
+				log.Info("Generating state snapshot", "at", accountHash, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+				logged = time.Now()
+			}
+			return !aborted()
+		}
+		return true
+	})
+	if err != nil {
+		genErr = err
+	}
+	if genErr != nil {
+		log.Warn("Snapshot generation failed", "root", dl.root, "err", genErr)
+		return
+	}
+	if abort != nil {
+		return
+	}
+	if !flush() {
+		log.Warn("Snapshot generation failed", "root", dl.root, "err", genErr)
+		return
+	}
+	dl.finishGeneration(accounts, slots, start)
+}
+
+// finishGeneration flags the snapshot generation as complete.
+func (dl *diskLayer) finishGeneration(accounts, slots uint64, start time.Time) {
+	if err := dl.diskdb.Delete(snapshotGeneratorKey); err != nil {
+		log.Crit("Failed to remove snapshot generator marker", "err", err)
+	}
+	dl.lock.Lock()
+	dl.genMarker = nil
+	dl.lock.Unlock()
+
+	log.Info("Generated state snapshot", "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// iterateFrom walks the leaves of a trie with hashed keys in ascending order,
+// starting at origin and invoking fn until it returns false.
+func iterateFrom(tr *trie.Trie, origin common.Hash, fn func(hash common.Hash, blob []byte) bool) error {
+	start := keybytesToHex(origin[:])
+
+	it := trie.NewNodeIterator(tr)
+	for descend := true; it.Next(descend); {
+		// Skip any subtrie entirely before the origin
+		path := it.Path()
+		if n := len(path); n <= len(start) && bytes.Compare(path, start[:n]) < 0 {
+			descend = false
+			continue
+		}
+		descend = true
+
+		if it.Leaf() && len(path) == len(start) {
+			if !fn(hexToHash(path), it.LeafBlob()) {
+				return nil
+			}
+		}
+	}
+	return it.Error()
+}
+
+// wipeKeyRange deletes all the entries of the database with the given prefix and
+// key length, starting at a specific key. The snapshot prefixes are long enough
+// not to collide with any other chain data (e.g. hash keyed trie nodes or tx
+// lookup entries), the length check only guards against partial snapshot keys.
+// The optional interrupt callback is polled every few deletions, aborting the
+// wipe if it returns true.
+func wipeKeyRange(db ethdb.Database, prefix []byte, start []byte, keylen int, interrupt func() bool) error {
+	iteratee, ok := db.(ethdb.Iteratee)
+	if !ok {
+		return errNotIterable
+	}
+	it := iteratee.NewIteratorWithPrefix(prefix)
+	defer it.Release()
+
+	deleted := 0
+	for ok := it.Seek(start); ok; ok = it.Next() {
+		if len(it.Key()) != keylen {
+			continue
+		}
+		if err := db.Delete(common.CopyBytes(it.Key())); err != nil {
+			return err
+		}
+		if deleted++; interrupt != nil && deleted%generatorBatchSize == 0 && interrupt() {
+			return nil
+		}
+	}
+	return it.Error()
+}
+
+// incHash returns the hash directly following h, and false if h was the last
+// one possible.
+func incHash(h common.Hash) (common.Hash, bool) {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			return h, true
+		}
+	}
+	return h, false
+}
+
+// keybytesToHex expands a key into its nibbles (without terminator).
+func keybytesToHex(key []byte) []byte {
+	nibbles := make([]byte, len(key)*2)
+	for i, b := range key {
+		nibbles[i*2] = b / 16
+		nibbles[i*2+1] = b % 16
+	}
+	return nibbles
+}
+
+// hexToHash compacts a full length nibble path back into a hash.
+func hexToHash(nibbles []byte) (hash common.Hash) {
+	for i := range hash {
+		hash[i] = nibbles[i*2]<<4 | nibbles[i*2+1]
+	}
+	return hash
+}
@@ -0,0 +1,328 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// makeTestState writes a state trie into the database with the given accounts
+// and storage slots (keyed by hash), returning its root.
+func makeTestState(db ethdb.Database, accounts map[common.Hash]map[common.Hash][]byte) common.Hash {
+	accTrie, _ := trie.New(common.Hash{}, db)
+	for hash, slots := range accounts {
+		storeTrie, _ := trie.New(common.Hash{}, db)
+		for slot, value := range slots {
+			storeTrie.Update(slot[:], value)
+		}
+		storeRoot, _ := storeTrie.CommitTo(db)
+
+		blob, _ := rlp.EncodeToBytes(&account{
+			Nonce:    uint64(len(slots)),
+			Balance:  big.NewInt(1),
+			Root:     storeRoot,
+			CodeHash: crypto.Keccak256(nil),
+		})
+		accTrie.Update(hash[:], blob)
+	}
+	root, _ := accTrie.CommitTo(db)
+	return root
+}
+
+// hashSlice implements sort.Interface to sort hashes in ascending order.
+type hashSlice []common.Hash
+
+func (s hashSlice) Len() int           { return len(s) }
+func (s hashSlice) Less(i, j int) bool { return bytes.Compare(s[i][:], s[j][:]) < 0 }
+func (s hashSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// randomTestState generates the contents of a random state with the given number
+// of accounts, each with a random number of storage slots.
+func randomTestState(accounts int, maxSlots int) map[common.Hash]map[common.Hash][]byte {
+	state := make(map[common.Hash]map[common.Hash][]byte)
+	for i := 0; i < accounts; i++ {
+		slots := make(map[common.Hash][]byte)
+		for j := 0; j < int(randomHash()[0])%(maxSlots+1); j++ {
+			value, _ := rlp.EncodeToBytes(randomHash().Bytes())
+			slots[randomHash()] = value
+		}
+		state[randomHash()] = slots
+	}
+	return state
+}
+
+// waitGeneration waits until the snapshot generation of a disk layer finishes.
+func waitGeneration(t *testing.T, dl *diskLayer) {
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		dl.lock.RLock()
+		done := dl.genMarker == nil
+		dl.lock.RUnlock()
+
+		if done {
+			return
+		}
+	}
+	t.Fatalf("snapshot generation timed out")
+}
+
+// checkSnapshotConsistency ensures that the persisted snapshot contains exactly
+// the accounts and storage slots of the state trie with the given root.
+func checkSnapshotConsistency(t *testing.T, db *ethdb.MemDatabase, root common.Hash) {
+	if blob, _ := db.Get(snapshotRootKey); !bytes.Equal(blob, root[:]) {
+		t.Fatalf("snapshot root mismatch: have %x, want %x", blob, root)
+	}
+	if _, err := db.Get(snapshotGeneratorKey); err == nil {
+		t.Fatalf("generator marker present after generation")
+	}
+	accTrie, err := trie.New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open state trie: %v", err)
+	}
+	entries := 0
+	it := trie.NewIterator(accTrie)
+	for it.Next() {
+		entries++
+		if blob, _ := db.Get(accountKey(common.BytesToHash(it.Key))); !bytes.Equal(blob, it.Value) {
+			t.Fatalf("account %x: data mismatch: have %x, want %x", it.Key, blob, it.Value)
+		}
+		var acc account
+		rlp.DecodeBytes(it.Value, &acc)
+
+		storeTrie, _ := trie.New(acc.Root, db)
+		storeIt := trie.NewIterator(storeTrie)
+		for storeIt.Next() {
+			entries++
+			if blob, _ := db.Get(storageKey(common.BytesToHash(it.Key), common.BytesToHash(storeIt.Key))); !bytes.Equal(blob, storeIt.Value) {
+				t.Fatalf("slot %x/%x: data mismatch: have %x, want %x", it.Key, storeIt.Key, blob, storeIt.Value)
+			}
+		}
+	}
+	// Ensure there's no junk left in the snapshot
+	for _, prefix := range [][]byte{snapshotAccountPrefix, snapshotStoragePrefix} {
+		it := db.NewIteratorWithPrefix(prefix)
+		for it.Next() {
+			if len(it.Key()) == len(prefix)+common.HashLength || len(it.Key()) == len(prefix)+2*common.HashLength {
+				entries--
+			}
+		}
+		it.Release()
+	}
+	if entries != 0 {
+		t.Fatalf("snapshot entry count mismatch: %d unaccounted for", entries)
+	}
+}
+
+// Tests that a snapshot is generated from scratch correctly, wiping any junk
+// left over from a previous snapshot.
+func TestGeneration(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	root := makeTestState(db, randomTestState(128, 16))
+
+	// Leave some junk from an old snapshot in the database
+	for i := 0; i < 16; i++ {
+		db.Put(accountKey(randomHash()), []byte{0x01})
+		db.Put(storageKey(randomHash(), randomHash()), []byte{0x02})
+	}
+	tree, err := New(db, trie.NewNodeDatabase(db, nil), root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	waitGeneration(t, tree.layers[root].(*diskLayer))
+	checkSnapshotConsistency(t, db, root)
+
+	// Ensure the snapshot loads without regeneration
+	base, err := loadSnapshot(db, trie.NewNodeDatabase(db, nil), root)
+	if err != nil {
+		t.Fatalf("failed to load generated snapshot: %v", err)
+	}
+	if base.genMarker != nil {
+		t.Fatalf("generated snapshot reloaded with marker %x", base.genMarker)
+	}
+}
+
+// Tests that an interrupted snapshot generation is resumed on the next startup,
+// dropping anything left over beyond the progress marker.
+func TestGenerationResume(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	state := randomTestState(128, 16)
+	root := makeTestState(db, state)
+
+	tree, err := New(db, trie.NewNodeDatabase(db, nil), root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	waitGeneration(t, tree.layers[root].(*diskLayer))
+
+	// Rewind the generation to the middle of the accounts, dropping everything
+	// past it and leaving some junk behind as an interrupted run would
+	var hashes []common.Hash
+	for hash := range state {
+		hashes = append(hashes, hash)
+	}
+	sort.Sort(hashSlice(hashes))
+
+	marker := hashes[len(hashes)/2]
+	for _, hash := range hashes[len(hashes)/2+1:] {
+		db.Delete(accountKey(hash))
+		for slot := range state[hash] {
+			db.Delete(storageKey(hash, slot))
+		}
+	}
+	next, _ := incHash(marker)
+	db.Put(accountKey(next), []byte{0x01})
+	db.Put(storageKey(hashes[len(hashes)/2+1], randomHash()), []byte{0x02})
+	db.Put(snapshotGeneratorKey, marker[:])
+
+	// Ensure reads beyond the marker are rejected, before it accepted
+	base := &diskLayer{diskdb: db, root: root, genMarker: marker[:]}
+	if _, err := base.Account(marker); err != nil {
+		t.Errorf("covered account lookup failed: %v", err)
+	}
+	if _, err := base.Account(next); err != ErrNotCoveredYet {
+		t.Errorf("uncovered account error mismatch: have %v, want %v", err, ErrNotCoveredYet)
+	}
+	// Reopen the snapshot and ensure the generation is finished
+	if tree, err = New(db, trie.NewNodeDatabase(db, nil), root); err != nil {
+		t.Fatalf("failed to reopen snapshot tree: %v", err)
+	}
+	base = tree.layers[root].(*diskLayer)
+	if base.genAbort == nil {
+		t.Fatalf("snapshot generation not resumed")
+	}
+	waitGeneration(t, base)
+	checkSnapshotConsistency(t, db, root)
+}
+
+// Tests that flattening diff layers into a disk layer still being generated
+// results in a consistent snapshot of the new root.
+func TestGenerationWithDiffs(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	state := randomTestState(512, 16)
+	root := makeTestState(db, state)
+
+	tree, err := New(db, trie.NewNodeDatabase(db, nil), root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	// Modify, delete and recreate accounts, collecting the diffs
+	var (
+		destructs = make(map[common.Hash]struct{})
+		accounts  = make(map[common.Hash][]byte)
+		storage   = make(map[common.Hash]map[common.Hash][]byte)
+		updated   = make(map[common.Hash]map[common.Hash][]byte)
+	)
+	i := 0
+	for hash, slots := range state {
+		switch i++; i % 4 {
+		case 0:
+			// Delete the account along with its storage
+			destructs[hash] = struct{}{}
+			accounts[hash] = nil
+			continue
+		case 1:
+			// Recreate the account with a fresh storage
+			destructs[hash] = struct{}{}
+			value, _ := rlp.EncodeToBytes([]byte{0x01})
+			slots = map[common.Hash][]byte{randomHash(): value}
+			storage[hash] = slots
+		case 2:
+			// Modify a few storage slots
+			modified := make(map[common.Hash][]byte)
+			storage[hash] = make(map[common.Hash][]byte)
+			for slot, value := range slots {
+				if slot[0]%2 == 0 {
+					storage[hash][slot] = nil
+					continue
+				}
+				modified[slot] = value
+			}
+			slots = modified
+		}
+		updated[hash] = slots
+	}
+	newRoot := makeTestState(db, updated)
+
+	newTrie, _ := trie.New(newRoot, db)
+	for hash := range updated {
+		accounts[hash] = newTrie.Get(hash[:])
+	}
+	if err := tree.Update(newRoot, root, destructs, accounts, storage); err != nil {
+		t.Fatalf("failed to update snapshot tree: %v", err)
+	}
+	if err := tree.Cap(newRoot, 0); err != nil {
+		t.Fatalf("failed to flatten snapshot tree: %v", err)
+	}
+	waitGeneration(t, tree.layers[newRoot].(*diskLayer))
+	checkSnapshotConsistency(t, db, newRoot)
+}
+
+// Tests that generating and wiping the snapshot leaves other chain data sharing
+// the database intact, even if its keys have the same length as snapshot keys
+// (e.g. tx lookup metadata, keyed by tx hash + 0x01).
+func TestGenerationKeepsForeignData(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	state := randomTestState(128, 16)
+	root := makeTestState(db, state)
+
+	var foreign [][]byte
+	for _, first := range []byte{'a', 'o', 'S'} {
+		hash := randomHash()
+		hash[0] = first
+		foreign = append(foreign, append(hash.Bytes(), 0x01))                    // tx lookup metadata
+		foreign = append(foreign, append(hash.Bytes(), randomHash().Bytes()...)) // 64 byte key
+	}
+	for _, key := range foreign {
+		db.Put(key, []byte{0xff})
+	}
+	// Generate the snapshot and destruct an account, wiping its storage
+	tree, err := New(db, trie.NewNodeDatabase(db, nil), root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	waitGeneration(t, tree.layers[root].(*diskLayer))
+
+	var destructed common.Hash
+	for hash := range state {
+		destructed = hash
+		break
+	}
+	next := randomHash()
+	if err := tree.Update(next, root, map[common.Hash]struct{}{destructed: {}}, nil, nil); err != nil {
+		t.Fatalf("failed to create diff layer: %v", err)
+	}
+	if err := tree.Cap(next, 0); err != nil {
+		t.Fatalf("failed to flatten snapshot tree: %v", err)
+	}
+	for _, key := range foreign {
+		if blob, err := db.Get(key); err != nil || !bytes.Equal(blob, []byte{0xff}) {
+			t.Errorf("foreign entry %x lost: have %x, err %v", key, blob, err)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snapshot implements a flat, layered dump of the state for fast reads.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	snapshotRootKey       = []byte("SnapshotRoot")      // State root of the persisted snapshot
+	snapshotGeneratorKey  = []byte("SnapshotGenerator") // Progress marker of an unfinished generation
+	snapshotAccountPrefix = []byte("SnapshotAccount")   // snapshotAccountPrefix + account hash -> account trie value
+	snapshotStoragePrefix = []byte("SnapshotStorage")   // snapshotStoragePrefix + account hash + storage hash -> storage trie value
+)
+
+var (
+	// ErrSnapshotStale is returned from data accessors if the underlying snapshot
+	// layer had been invalidated due to the chain progressing forward far enough
+	// to not maintain the layer's original state.
+	ErrSnapshotStale = errors.New("snapshot stale")
+
+	// ErrNotCoveredYet is returned from data accessors if the underlying snapshot
+	// is being generated currently and the requested data item is not yet in the
+	// range of accounts covered.
+	ErrNotCoveredYet = errors.New("not covered yet")
+
+	// errSnapshotCycle is returned if a snapshot is attempted to be inserted
+	// that forms a cycle in the snapshot tree.
+	errSnapshotCycle = errors.New("snapshot cycle")
+)
+
+// Snapshot represents the functionality supported by a snapshot storage layer.
+// All values are returned in their trie encoding, a nil value meaning that the
+// item doesn't exist in the state.
+type Snapshot interface {
+	// Root returns the root hash for which this snapshot was made.
+	Root() common.Hash
+
+	// Account directly retrieves the account associated with a particular hash.
+	Account(hash common.Hash) ([]byte, error)
+
+	// Storage directly retrieves the storage data associated with a particular
+	// hash, within a particular account.
+	Storage(accountHash, storageHash common.Hash) ([]byte, error)
+}
+
+// snapshot is the internal version of the snapshot data layer that supports some
+// additional methods compared to the public API.
+type snapshot interface {
+	Snapshot
+
+	// Parent returns the subsequent layer of a snapshot, or nil if the base was
+	// reached.
+	Parent() snapshot
+
+	// Update creates a new layer on top of the existing snapshot diff tree with
+	// the specified data items. Note, the maps are retained by the method to avoid
+	// copying everything.
+	Update(blockRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) *diffLayer
+
+	// Stale return whether this layer has become stale (was flattened across) or
+	// if it's still live.
+	Stale() bool
+}
+
+// Tree is an Ethereum state snapshot tree. It consists of one persistent base
+// layer backed by a key-value store, on top of which arbitrarily many in-memory
+// diff layers are topped. The memory diffs can form a tree with branching, but
+// the disk layer is singleton and common to all. If a reorg goes deeper than the
+// disk layer, everything needs to be deleted.
+//
+// The goal of a state snapshot is to allow direct access to account and storage
+// data to avoid expensive multi-level trie lookups.
+type Tree struct {
+	diskdb ethdb.Database           // Persistent database to store the snapshot
+	triedb *trie.NodeDatabase       // In-memory cache to access the trie through
+	layers map[common.Hash]snapshot // Collection of all known layers
+	lock   sync.RWMutex
+}
+
+// New attempts to load an already existing snapshot from a persistent key-value
+// store, ensuring that its root matches the expected one.
+//
+// If the snapshot is missing or inconsistent, the entirety is deleted and will
+// be reconstructed from scratch based on the tries in the key-value store, on a
+// background thread. Diff layers are only kept in memory, so they need to be
+// flattened into the disk layer (Cap with zero layers) before shutting down.
+//
+// The database must support iteration, which is needed to wipe stale data.
+func New(diskdb ethdb.Database, triedb *trie.NodeDatabase, root common.Hash) (*Tree, error) {
+	if _, ok := diskdb.(ethdb.Iteratee); !ok {
+		return nil, errNotIterable
+	}
+	snap := &Tree{
+		diskdb: diskdb,
+		triedb: triedb,
+		layers: make(map[common.Hash]snapshot),
+	}
+	// Attempt to load a previously persisted snapshot, rebuilding on failure
+	head, err := loadSnapshot(diskdb, triedb, root)
+	if err != nil {
+		log.Warn("Failed to load snapshot, regenerating", "err", err)
+		snap.Rebuild(root)
+		return snap, nil
+	}
+	snap.layers[head.root] = head
+	return snap, nil
+}
+
+// Snapshot retrieves a snapshot belonging to the given block root, or nil if no
+// snapshot is maintained for that block.
+func (t *Tree) Snapshot(blockRoot common.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if snap, ok := t.layers[blockRoot]; ok {
+		return snap
+	}
+	return nil
+}
+
+// Update adds a new snapshot into the tree, if that can be linked to an existing
+// old parent. It is disallowed to insert a disk layer (the origin of all).
+func (t *Tree) Update(blockRoot common.Hash, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+	// Reject noop updates to avoid self-loops in the snapshot tree. This is a
+	// special case that can only happen for Clique networks where empty blocks
+	// don't modify the state (0 block subsidy).
+	if blockRoot == parentRoot {
+		return errSnapshotCycle
+	}
+	// Generate a new snapshot on top of the parent
+	parent, ok := t.Snapshot(parentRoot).(snapshot)
+	if !ok {
+		return fmt.Errorf("parent [%#x] snapshot missing", parentRoot)
+	}
+	snap := parent.Update(blockRoot, destructs, accounts, storage)
+
+	// Save the new snapshot for later
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.layers[snap.root] = snap
+	return nil
+}
+
+// Cap traverses downwards the snapshot tree from a head block hash until the
+// number of allowed layers are crossed. All layers beyond the permitted number
+// are flattened downwards into the disk layer.
+//
+// Note, the final diff layer count in general will be one more than the amount
+// requested. This happens because the bottom-most diff layer is the accumulator
+// which may or may not overflow and cascade to disk. Since this last layer's
+// survival is only known *after* capping, we need to omit it from the count if
+// we want to ensure that *at least* the requested number of diff layers remain.
+func (t *Tree) Cap(root common.Hash, layers int) error {
+	// Retrieve the head snapshot to cap from
+	snap := t.Snapshot(root)
+	if snap == nil {
+		return fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	diff, ok := snap.(*diffLayer)
+	if !ok {
+		return nil // Disk layer reached, nothing to cap
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var base *diskLayer
+	if layers == 0 {
+		// Full commit, flatten everything into the disk layer
+		base = diffToDisk(diff.flatten().(*diffLayer))
+		diff.markStale()
+	} else {
+		// Dive until we run out of layers or reach the persistent database
+		for i := 1; i < layers; i++ {
+			parent, ok := diff.Parent().(*diffLayer)
+			if !ok {
+				return nil
+			}
+			diff = parent
+		}
+		bottom, ok := diff.Parent().(*diffLayer)
+		if !ok {
+			return nil
+		}
+		// Flatten everything below the retained layers and push it to disk
+		base = diffToDisk(bottom.flatten().(*diffLayer))
+		bottom.markStale()
+
+		diff.lock.Lock()
+		diff.parent = base
+		diff.lock.Unlock()
+	}
+	// Swap in the new disk layer and drop everything not building on top of it
+	t.layers[base.root] = base
+	for removed := true; removed; {
+		removed = false
+		for root, snap := range t.layers {
+			if snap.Stale() {
+				delete(t.layers, root)
+				removed = true
+				continue
+			}
+			if diff, ok := snap.(*diffLayer); ok && diff.Parent().Stale() {
+				diff.markStale()
+				delete(t.layers, root)
+				removed = true
+			}
+		}
+	}
+	return nil
+}
+
+// Rebuild wipes all available snapshot data from the persistent database and
+// discard all caches and diff layers. Afterwards, it starts a new snapshot
+// generator with the given root hash.
+func (t *Tree) Rebuild(root common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Iterate over and mark all layers stale
+	for _, layer := range t.layers {
+		switch layer := layer.(type) {
+		case *diskLayer:
+			layer.stopGeneration()
+			layer.markStale()
+		case *diffLayer:
+			layer.markStale()
+		}
+	}
+	// Start generating a new snapshot from scratch on a background thread
+	log.Info("Rebuilding state snapshot", "root", root)
+	base := generateSnapshot(t.diskdb, t.triedb, root)
+	t.layers = map[common.Hash]snapshot{root: base}
+}
+
+// Close stops any background snapshot generation, persisting its progress so
+// that it can be resumed on the next startup.
+func (t *Tree) Close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, layer := range t.layers {
+		if disk, ok := layer.(*diskLayer); ok {
+			disk.stopGeneration()
+		}
+	}
+}
+
+// diffToDisk merges a bottom-most diff into the persistent disk layer underneath
+// it. The method will panic if called onto a non-bottom-most diff layer.
+func diffToDisk(bottom *diffLayer) *diskLayer {
+	base := bottom.parent.(*diskLayer)
+
+	// Mark the original base as stale as we're going to create a new wrapper,
+	// interrupting any running generation in the process
+	base.stopGeneration()
+	base.markStale()
+
+	// Delete the root marker first, so a crash midway is detected on startup
+	db := base.diskdb
+	if err := db.Delete(snapshotRootKey); err != nil {
+		log.Crit("Failed to remove snapshot root marker", "err", err)
+	}
+	// Wipe the destructed accounts and their storage. Anything beyond the
+	// generation marker is skipped, the generator will pick it up later.
+	for hash := range bottom.destructSet {
+		if !base.covered(hash) {
+			continue
+		}
+		if err := db.Delete(accountKey(hash)); err != nil {
+			log.Crit("Failed to delete snapshot account", "err", err)
+		}
+		prefix := storagePrefix(hash)
+		if err := wipeKeyRange(db, prefix, prefix, len(prefix)+common.HashLength, nil); err != nil {
+			log.Crit("Failed to wipe snapshot storage", "err", err)
+		}
+	}
+	// Push all the updated accounts and storage slots into the database
+	batch := db.NewBatch()
+	for hash, data := range bottom.accountData {
+		if !base.covered(hash) {
+			continue
+		}
+		if len(data) == 0 {
+			if err := db.Delete(accountKey(hash)); err != nil {
+				log.Crit("Failed to delete snapshot account", "err", err)
+			}
+			continue
+		}
+		if err := batch.Put(accountKey(hash), data); err != nil {
+			log.Crit("Failed to write snapshot account", "err", err)
+		}
+	}
+	for accountHash, storage := range bottom.storageData {
+		if !base.covered(accountHash) {
+			continue
+		}
+		for storageHash, data := range storage {
+			if len(data) == 0 {
+				if err := db.Delete(storageKey(accountHash, storageHash)); err != nil {
+					log.Crit("Failed to delete snapshot storage", "err", err)
+				}
+				continue
+			}
+			if err := batch.Put(storageKey(accountHash, storageHash), data); err != nil {
+				log.Crit("Failed to write snapshot storage", "err", err)
+			}
+		}
+	}
+	// Update the snapshot block marker and write any remainder data
+	if base.genMarker != nil {
+		batch.Put(snapshotGeneratorKey, base.genMarker)
+	}
+	batch.Put(snapshotRootKey, bottom.root[:])
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write leftover snapshot", "err", err)
+	}
+	res := &diskLayer{
+		diskdb:    base.diskdb,
+		triedb:    base.triedb,
+		root:      bottom.root,
+		genMarker: base.genMarker,
+	}
+	// If snapshot generation hasn't finished yet, continue where the previous
+	// round left off.
+	if res.genMarker != nil {
+		res.startGeneration()
+	}
+	return res
+}
+
+// accountKey = snapshotAccountPrefix + hash
+func accountKey(hash common.Hash) []byte {
+	return append(append([]byte{}, snapshotAccountPrefix...), hash[:]...)
+}
+
+// storagePrefix = snapshotStoragePrefix + account hash
+func storagePrefix(accountHash common.Hash) []byte {
+	return append(append([]byte{}, snapshotStoragePrefix...), accountHash[:]...)
+}
+
+// storageKey = snapshotStoragePrefix + account hash + storage hash
+func storageKey(accountHash, storageHash common.Hash) []byte {
+	return append(storagePrefix(accountHash), storageHash[:]...)
+}
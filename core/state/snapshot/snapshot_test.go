@@ -0,0 +1,222 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// randomHash generates a random blob of data and returns it as a hash.
+func randomHash() common.Hash {
+	var hash common.Hash
+	if n, err := rand.Read(hash[:]); n != common.HashLength || err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// checkAccount ensures that an account lookup in a snapshot returns the expected
+// data.
+func checkAccount(t *testing.T, snap Snapshot, hash common.Hash, want []byte) {
+	have, err := snap.Account(hash)
+	if err != nil {
+		t.Fatalf("snapshot %x: account %x: lookup failed: %v", snap.Root(), hash, err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("snapshot %x: account %x: data mismatch: have %x, want %x", snap.Root(), hash, have, want)
+	}
+}
+
+// checkStorage ensures that a storage lookup in a snapshot returns the expected
+// data.
+func checkStorage(t *testing.T, snap Snapshot, account, slot common.Hash, want []byte) {
+	have, err := snap.Storage(account, slot)
+	if err != nil {
+		t.Fatalf("snapshot %x: slot %x/%x: lookup failed: %v", snap.Root(), account, slot, err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("snapshot %x: slot %x/%x: data mismatch: have %x, want %x", snap.Root(), account, slot, have, want)
+	}
+}
+
+// newTestTree creates a snapshot tree with a fully generated disk layer at the
+// given root, with the given contents persisted.
+func newTestTree(root common.Hash, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) *Tree {
+	db, _ := ethdb.NewMemDatabase()
+	for hash, data := range accounts {
+		db.Put(accountKey(hash), data)
+	}
+	for account, slots := range storage {
+		for hash, data := range slots {
+			db.Put(storageKey(account, hash), data)
+		}
+	}
+	db.Put(snapshotRootKey, root[:])
+
+	return &Tree{
+		diskdb: db,
+		layers: map[common.Hash]snapshot{
+			root: &diskLayer{diskdb: db, root: root},
+		},
+	}
+}
+
+// Tests that account and storage lookups are resolved through the diff layers
+// correctly, including accounts that are deleted and recreated.
+func TestDiffLayerLookups(t *testing.T) {
+	var (
+		acc1, acc2   = randomHash(), randomHash()
+		slot1, slot2 = randomHash(), randomHash()
+		slot3        = randomHash()
+		root0, root1 = randomHash(), randomHash()
+		root2        = randomHash()
+	)
+	tree := newTestTree(root0,
+		map[common.Hash][]byte{acc1: []byte("acc1"), acc2: []byte("acc2")},
+		map[common.Hash]map[common.Hash][]byte{acc1: {slot1: []byte("slot1")}, acc2: {slot2: []byte("slot2")}},
+	)
+	// Modify the first account and delete the second
+	if err := tree.Update(root1, root0,
+		map[common.Hash]struct{}{acc2: {}},
+		map[common.Hash][]byte{acc1: []byte("acc1-new")},
+		map[common.Hash]map[common.Hash][]byte{acc1: {slot1: nil}},
+	); err != nil {
+		t.Fatalf("failed to create first diff layer: %v", err)
+	}
+	// Recreate the second account with different storage
+	if err := tree.Update(root2, root1,
+		nil,
+		map[common.Hash][]byte{acc2: []byte("acc2-new")},
+		map[common.Hash]map[common.Hash][]byte{acc2: {slot3: []byte("slot3")}},
+	); err != nil {
+		t.Fatalf("failed to create second diff layer: %v", err)
+	}
+	if err := tree.Update(root2, common.Hash{}, nil, nil, nil); err == nil {
+		t.Fatalf("diff layer created on missing parent")
+	}
+	// Ensure all the layers report the correct data
+	snap0, snap1, snap2 := tree.Snapshot(root0), tree.Snapshot(root1), tree.Snapshot(root2)
+
+	checkAccount(t, snap0, acc1, []byte("acc1"))
+	checkAccount(t, snap0, acc2, []byte("acc2"))
+	checkStorage(t, snap0, acc1, slot1, []byte("slot1"))
+	checkStorage(t, snap0, acc2, slot2, []byte("slot2"))
+
+	checkAccount(t, snap1, acc1, []byte("acc1-new"))
+	checkAccount(t, snap1, acc2, nil)
+	checkStorage(t, snap1, acc1, slot1, nil)
+	checkStorage(t, snap1, acc2, slot2, nil)
+
+	checkAccount(t, snap2, acc1, []byte("acc1-new"))
+	checkAccount(t, snap2, acc2, []byte("acc2-new"))
+	checkStorage(t, snap2, acc1, slot1, nil)
+	checkStorage(t, snap2, acc2, slot2, nil)
+	checkStorage(t, snap2, acc2, slot3, []byte("slot3"))
+
+	// Flatten the first diff into the disk and ensure the stale layer is rejected
+	if err := tree.Cap(root2, 1); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	if _, err := snap0.Account(acc1); err != ErrSnapshotStale {
+		t.Errorf("stale disk layer error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if _, err := snap1.Account(acc1); err != ErrSnapshotStale {
+		t.Errorf("stale diff layer error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if n := len(tree.layers); n != 2 {
+		t.Errorf("layer count mismatch: have %d, want %d", n, 2)
+	}
+	if _, ok := tree.Snapshot(root1).(*diskLayer); !ok {
+		t.Errorf("flattened layer not on disk")
+	}
+	checkAccount(t, tree.Snapshot(root1), acc2, nil)
+	checkStorage(t, tree.Snapshot(root1), acc2, slot2, nil)
+
+	checkAccount(t, snap2, acc1, []byte("acc1-new"))
+	checkAccount(t, snap2, acc2, []byte("acc2-new"))
+	checkStorage(t, snap2, acc1, slot1, nil)
+	checkStorage(t, snap2, acc2, slot3, []byte("slot3"))
+
+	// Flatten everything and ensure the disk contents are correct
+	if err := tree.Cap(root2, 0); err != nil {
+		t.Fatalf("failed to flatten snapshot tree: %v", err)
+	}
+	if n := len(tree.layers); n != 1 {
+		t.Errorf("layer count mismatch: have %d, want %d", n, 1)
+	}
+	db := tree.diskdb.(*ethdb.MemDatabase)
+	if n := len(db.Keys()); n != 4 {
+		t.Errorf("database entry count mismatch: have %d, want %d", n, 4)
+	}
+	if blob, _ := db.Get(snapshotRootKey); !bytes.Equal(blob, root2[:]) {
+		t.Errorf("snapshot root mismatch: have %x, want %x", blob, root2)
+	}
+	if blob, _ := db.Get(accountKey(acc2)); !bytes.Equal(blob, []byte("acc2-new")) {
+		t.Errorf("persisted account mismatch: have %x, want %x", blob, []byte("acc2-new"))
+	}
+	if blob, _ := db.Get(storageKey(acc2, slot3)); !bytes.Equal(blob, []byte("slot3")) {
+		t.Errorf("persisted slot mismatch: have %x, want %x", blob, []byte("slot3"))
+	}
+}
+
+// Tests that capping the snapshot tree drops all the forks that don't build on
+// top of the new disk layer.
+func TestCapDropsStaleForks(t *testing.T) {
+	var (
+		acc            = randomHash()
+		root0, root1a  = randomHash(), randomHash()
+		root1b, root2a = randomHash(), randomHash()
+		root3a, root2b = randomHash(), randomHash()
+		update         = func(data string) map[common.Hash][]byte { return map[common.Hash][]byte{acc: []byte(data)} }
+		tree           = newTestTree(root0, update("0"), nil)
+	)
+	tree.Update(root1a, root0, nil, update("1a"), nil)
+	tree.Update(root1b, root0, nil, update("1b"), nil)
+	tree.Update(root2a, root1a, nil, update("2a"), nil)
+	tree.Update(root2b, root1b, nil, update("2b"), nil)
+	tree.Update(root3a, root2a, nil, update("3a"), nil)
+
+	fork := tree.Snapshot(root2b)
+	if err := tree.Cap(root3a, 1); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	for _, root := range []common.Hash{root0, root1a, root1b, root2b} {
+		if tree.Snapshot(root) != nil {
+			t.Errorf("stale layer %x not dropped", root)
+		}
+	}
+	if _, err := fork.Account(acc); err != ErrSnapshotStale {
+		t.Errorf("dropped fork error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	checkAccount(t, tree.Snapshot(root2a), acc, []byte("2a"))
+	checkAccount(t, tree.Snapshot(root3a), acc, []byte("3a"))
+}
+
+// Tests that noop updates are rejected to avoid cycles in the snapshot tree.
+func TestUpdateCycle(t *testing.T) {
+	root := randomHash()
+	tree := newTestTree(root, nil, nil)
+
+	if err := tree.Update(root, root, nil, nil, nil); err != errSnapshotCycle {
+		t.Fatalf("cycle error mismatch: have %v, want %v", err, errSnapshotCycle)
+	}
+}
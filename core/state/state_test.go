@@ -18,7 +18,9 @@ package state
 
 import (
 	"bytes"
+	"encoding/json"
 	"math/big"
+	"strings"
 	"testing"
 
 	checker "gopkg.in/check.v1"
@@ -86,6 +88,124 @@ func (s *StateSuite) TestDump(c *checker.C) {
 	}
 }
 
+// Tests that the iterative dump streams the state root and every account as a
+// separate JSON line.
+func TestIterativeDump(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, db)
+
+	state.AddBalance(toAddr([]byte{0x01}), big.NewInt(22))
+	state.SetCode(toAddr([]byte{0x01, 0x02}), []byte{3, 3, 3})
+	state.SetState(toAddr([]byte{0x02}), common.Hash{0x01}, common.Hash{0x02})
+	root, _ := state.Commit(false)
+
+	out := new(bytes.Buffer)
+	if err := state.IterativeDump(out); err != nil {
+		t.Fatalf("failed to dump state: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("line count mismatch: have %d, want %d", len(lines), 4)
+	}
+	var header struct{ Root string }
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Root != common.Bytes2Hex(root[:]) {
+		t.Fatalf("root line mismatch: %s (err %v)", lines[0], err)
+	}
+	dumped := make(map[common.Address]DumpAccount)
+	for _, line := range lines[1:] {
+		var account DumpAccount
+		if err := json.Unmarshal([]byte(line), &account); err != nil {
+			t.Fatalf("failed to decode account line %s: %v", line, err)
+		}
+		if account.Address == nil {
+			t.Fatalf("account line without address: %s", line)
+		}
+		if hash := crypto.Keccak256(account.Address[:]); !bytes.Equal(account.SecureKey, hash) {
+			t.Errorf("account %x: key mismatch: have %x, want %x", *account.Address, account.SecureKey, hash)
+		}
+		dumped[*account.Address] = account
+	}
+	if acc := dumped[toAddr([]byte{0x01})]; acc.Balance != "22" {
+		t.Errorf("balance mismatch: have %s, want %s", acc.Balance, "22")
+	}
+	if acc := dumped[toAddr([]byte{0x01, 0x02})]; acc.Code != "030303" {
+		t.Errorf("code mismatch: have %s, want %s", acc.Code, "030303")
+	}
+	if acc := dumped[toAddr([]byte{0x02})]; len(acc.Storage) != 1 {
+		t.Errorf("storage mismatch: have %v, want 1 slot", acc.Storage)
+	}
+}
+
+// Tests that accounts and storage slots can be retrieved page by page, with the
+// cursors chaining the pages into the full sorted range.
+func TestAccountStorageRange(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, db)
+
+	contract := toAddr([]byte{0xff})
+	for i := byte(1); i <= 10; i++ {
+		state.AddBalance(toAddr([]byte{i}), big.NewInt(int64(i)))
+		state.SetState(contract, common.Hash{i}, common.Hash{i})
+	}
+	state.Commit(false)
+
+	// Iterate the accounts in pages of 3 and ensure they're all found in order
+	var (
+		accounts []common.Hash
+		start    common.Hash
+	)
+	for {
+		page, err := state.AccountRange(start, 3)
+		if err != nil {
+			t.Fatalf("failed to retrieve account range: %v", err)
+		}
+		if len(page.Accounts) > 3 {
+			t.Fatalf("page too large: have %d, want at most %d", len(page.Accounts), 3)
+		}
+		for hash, account := range page.Accounts {
+			if account.Address == nil || crypto.Keccak256Hash(account.Address[:]) != hash {
+				t.Errorf("account %x: address mismatch: %v", hash, account.Address)
+			}
+			accounts = append(accounts, hash)
+		}
+		if page.Next == nil {
+			break
+		}
+		start = *page.Next
+	}
+	if len(accounts) != 11 {
+		t.Fatalf("account count mismatch: have %d, want %d", len(accounts), 11)
+	}
+	// Add a pending storage change and iterate the slots in pages of 4
+	state.SetState(contract, common.Hash{0x0b}, common.Hash{0x0b})
+
+	slots := make(map[common.Hash]common.Hash)
+	for start = (common.Hash{}); ; {
+		page, err := state.StorageRange(contract, start, 4)
+		if err != nil {
+			t.Fatalf("failed to retrieve storage range: %v", err)
+		}
+		for hash, entry := range page.Storage {
+			if entry.Key == nil || crypto.Keccak256Hash(entry.Key[:]) != hash {
+				t.Errorf("slot %x: key mismatch: %v", hash, entry.Key)
+			}
+			slots[*entry.Key] = entry.Value
+		}
+		if page.Next == nil {
+			break
+		}
+		start = *page.Next
+	}
+	if len(slots) != 11 {
+		t.Fatalf("slot count mismatch: have %d, want %d", len(slots), 11)
+	}
+	for key, value := range slots {
+		if key != value {
+			t.Errorf("slot %x: value mismatch: have %x, want %x", key, value, key)
+		}
+	}
+}
+
 func (s *StateSuite) SetUpTest(c *checker.C) {
 	db, _ := ethdb.NewMemDatabase()
 	s.state, _ = New(common.Hash{}, db)
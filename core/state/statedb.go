@@ -20,10 +20,12 @@ package state
 import (
 	"fmt"
 	"math/big"
+	"runtime"
 	"sort"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
@@ -61,6 +63,16 @@ type StateDB struct {
 	pastTries     []*trie.SecureTrie
 	codeSizeCache *lru.Cache
 
+	// Flat state snapshot to read from, along with the modifications collected
+	// for the next snapshot layer. The snapshot is nil if not enabled or not
+	// available for the current root.
+	snaps         *snapshot.Tree
+	snap          snapshot.Snapshot
+	snapDestructs map[common.Hash]struct{}
+	snapAccounts  map[common.Hash][]byte
+	snapStorage   map[common.Hash]map[common.Hash][]byte
+	snapLock      sync.Mutex // Protects snapStorage during concurrent storage commits
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects      map[common.Address]*stateObject
 	stateObjectsDirty map[common.Address]struct{}
@@ -86,21 +98,31 @@ type StateDB struct {
 
 // Create a new state from a given trie
 func New(root common.Hash, db ethdb.Database) (*StateDB, error) {
+	return NewWithSnapshots(root, db, nil)
+}
+
+// NewWithSnapshots creates a new state from a given trie, reading accounts and
+// storage slots through the flat state snapshots first whenever available.
+// States derived from this one (New, Reset) keep using the snapshots too.
+func NewWithSnapshots(root common.Hash, db ethdb.Database, snaps *snapshot.Tree) (*StateDB, error) {
 	tr, err := trie.NewSecure(root, db, MaxTrieCacheGen)
 	if err != nil {
 		return nil, err
 	}
 	csc, _ := lru.New(codeSizeCacheSize)
-	return &StateDB{
+	state := &StateDB{
 		db:                db,
 		trie:              tr,
 		codeSizeCache:     csc,
+		snaps:             snaps,
 		stateObjects:      make(map[common.Address]*stateObject),
 		stateObjectsDirty: make(map[common.Address]struct{}),
 		refund:            new(big.Int),
 		logs:              make(map[common.Hash][]*types.Log),
 		preimages:         make(map[common.Hash][]byte),
-	}, nil
+	}
+	state.openSnapshot(root)
+	return state, nil
 }
 
 // New creates a new statedb by reusing any journalled tries to avoid costly
@@ -113,16 +135,19 @@ func (self *StateDB) New(root common.Hash) (*StateDB, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &StateDB{
+	state := &StateDB{
 		db:                self.db,
 		trie:              tr,
 		codeSizeCache:     self.codeSizeCache,
+		snaps:             self.snaps,
 		stateObjects:      make(map[common.Address]*stateObject),
 		stateObjectsDirty: make(map[common.Address]struct{}),
 		refund:            new(big.Int),
 		logs:              make(map[common.Hash][]*types.Log),
 		preimages:         make(map[common.Hash][]byte),
-	}, nil
+	}
+	state.openSnapshot(root)
+	return state, nil
 }
 
 // Reset clears out all emphemeral state objects from the state db, but keeps
@@ -144,11 +169,27 @@ func (self *StateDB) Reset(root common.Hash) error {
 	self.logs = make(map[common.Hash][]*types.Log)
 	self.logSize = 0
 	self.preimages = make(map[common.Hash][]byte)
+	self.openSnapshot(root)
 	self.clearJournalAndRefund()
 
 	return nil
 }
 
+// openSnapshot looks up the flat state snapshot belonging to the given root (if
+// snapshots are enabled) and resets the modifications collected for the next
+// snapshot layer.
+func (self *StateDB) openSnapshot(root common.Hash) {
+	self.snap, self.snapDestructs, self.snapAccounts, self.snapStorage = nil, nil, nil, nil
+	if self.snaps == nil {
+		return
+	}
+	if self.snap = self.snaps.Snapshot(root); self.snap != nil {
+		self.snapDestructs = make(map[common.Hash]struct{})
+		self.snapAccounts = make(map[common.Hash][]byte)
+		self.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
+	}
+}
+
 // openTrie creates a trie. It uses an existing trie if one is available
 // from the journal if available.
 func (self *StateDB) openTrie(root common.Hash) (*trie.SecureTrie, error) {
@@ -296,6 +337,23 @@ func (self *StateDB) GetState(a common.Address, b common.Hash) common.Hash {
 	return common.Hash{}
 }
 
+// GetProof returns the Merkle proof of the given account in the account trie,
+// proving its absence if it doesn't exist.
+func (self *StateDB) GetProof(a common.Address) []rlp.RawValue {
+	return self.trie.Prove(a[:])
+}
+
+// GetStorageProof returns the Merkle proof of the given storage slot in the
+// storage trie of an account. Accounts not present have an empty storage trie,
+// proven by an empty proof.
+func (self *StateDB) GetStorageProof(a common.Address, key common.Hash) []rlp.RawValue {
+	stateObject := self.getStateObject(a)
+	if stateObject == nil {
+		return nil
+	}
+	return stateObject.getTrie(self.db).Prove(key[:])
+}
+
 func (self *StateDB) HasSuicided(addr common.Address) bool {
 	stateObject := self.getStateObject(addr)
 	if stateObject != nil {
@@ -384,6 +442,10 @@ func (self *StateDB) updateStateObject(stateObject *stateObject) {
 		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
 	}
 	self.trie.Update(addr[:], data)
+
+	if self.snap != nil {
+		self.snapAccounts[stateObject.addrHash] = data
+	}
 }
 
 // deleteStateObject removes the given object from the state trie.
@@ -391,6 +453,12 @@ func (self *StateDB) deleteStateObject(stateObject *stateObject) {
 	stateObject.deleted = true
 	addr := stateObject.Address()
 	self.trie.Delete(addr[:])
+
+	if self.snap != nil {
+		self.snapDestructs[stateObject.addrHash] = struct{}{}
+		delete(self.snapAccounts, stateObject.addrHash)
+		delete(self.snapStorage, stateObject.addrHash)
+	}
 }
 
 // Retrieve a state object given my the address. Returns nil if not found.
@@ -403,8 +471,17 @@ func (self *StateDB) getStateObject(addr common.Address) (stateObject *stateObje
 		return obj
 	}
 
-	// Load the object from the database.
-	enc := self.trie.Get(addr[:])
+	// Load the object from the flat snapshot if available, or the database.
+	var (
+		enc []byte
+		err error
+	)
+	if self.snap != nil {
+		enc, err = self.snap.Account(crypto.Keccak256Hash(addr[:]))
+	}
+	if self.snap == nil || err != nil {
+		enc = self.trie.Get(addr[:])
+	}
 	if len(enc) == 0 {
 		return nil
 	}
@@ -442,12 +519,27 @@ func (self *StateDB) MarkStateObjectDirty(addr common.Address) {
 // the given address, it is overwritten and returned as the second return value.
 func (self *StateDB) createObject(addr common.Address) (newobj, prev *stateObject) {
 	prev = self.getStateObject(addr)
+
+	// Overwriting an existing account wipes its storage, flag it for the snapshot
+	// and drop any storage changes the previous incarnation accumulated
+	var (
+		prevdestruct bool
+		prevstorage  map[common.Hash][]byte
+	)
+	if self.snap != nil && prev != nil {
+		_, prevdestruct = self.snapDestructs[prev.addrHash]
+		if !prevdestruct {
+			self.snapDestructs[prev.addrHash] = struct{}{}
+		}
+		prevstorage = self.snapStorage[prev.addrHash]
+		delete(self.snapStorage, prev.addrHash)
+	}
 	newobj = newObject(self, addr, Account{}, self.MarkStateObjectDirty)
 	newobj.setNonce(0) // sets the object to dirty
 	if prev == nil {
 		self.journal = append(self.journal, createObjectChange{account: &addr})
 	} else {
-		self.journal = append(self.journal, resetObjectChange{prev: prev})
+		self.journal = append(self.journal, resetObjectChange{prev: prev, prevdestruct: prevdestruct, prevstorage: prevstorage})
 	}
 	self.setStateObject(newobj)
 	return newobj, prev
@@ -503,6 +595,8 @@ func (self *StateDB) Copy() *StateDB {
 		trie:              self.trie,
 		pastTries:         self.pastTries,
 		codeSizeCache:     self.codeSizeCache,
+		snaps:             self.snaps,
+		snap:              self.snap,
 		stateObjects:      make(map[common.Address]*stateObject, len(self.stateObjectsDirty)),
 		stateObjectsDirty: make(map[common.Address]struct{}, len(self.stateObjectsDirty)),
 		refund:            new(big.Int).Set(self.refund),
@@ -522,6 +616,23 @@ func (self *StateDB) Copy() *StateDB {
 	for hash, preimage := range self.preimages {
 		state.preimages[hash] = preimage
 	}
+	if self.snap != nil {
+		state.snapDestructs = make(map[common.Hash]struct{}, len(self.snapDestructs))
+		for hash := range self.snapDestructs {
+			state.snapDestructs[hash] = struct{}{}
+		}
+		state.snapAccounts = make(map[common.Hash][]byte, len(self.snapAccounts))
+		for hash, data := range self.snapAccounts {
+			state.snapAccounts[hash] = data
+		}
+		state.snapStorage = make(map[common.Hash]map[common.Hash][]byte, len(self.snapStorage))
+		for hash, storage := range self.snapStorage {
+			state.snapStorage[hash] = make(map[common.Hash][]byte, len(storage))
+			for key, data := range storage {
+				state.snapStorage[hash][key] = data
+			}
+		}
+	}
 	return state
 }
 
@@ -623,10 +734,47 @@ func (s *StateDB) clearJournalAndRefund() {
 	s.refund = new(big.Int)
 }
 
+// commitStorageTries commits the storage tries of the given state objects
+// concurrently, serializing the database writes.
+func (s *StateDB) commitStorageTries(objects []*stateObject, dbw trie.DatabaseWriter) error {
+	if len(objects) == 0 {
+		return nil
+	}
+	var (
+		tasks = make(chan *stateObject, len(objects))
+		errc  = make(chan error, len(objects))
+		sink  = trie.NewLockedWriter(dbw)
+	)
+	for _, stateObject := range objects {
+		tasks <- stateObject
+	}
+	close(tasks)
+
+	threads := runtime.GOMAXPROCS(0)
+	if threads > len(objects) {
+		threads = len(objects)
+	}
+	for i := 0; i < threads; i++ {
+		go func() {
+			for stateObject := range tasks {
+				errc <- stateObject.CommitTrie(s.db, sink)
+			}
+		}()
+	}
+	var failure error
+	for range objects {
+		if err := <-errc; err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
 func (s *StateDB) commit(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (root common.Hash, err error) {
 	defer s.clearJournalAndRefund()
 
 	// Commit objects to the trie.
+	var committed []*stateObject
 	for addr, stateObject := range s.stateObjects {
 		_, isDirty := s.stateObjectsDirty[addr]
 		switch {
@@ -642,19 +790,31 @@ func (s *StateDB) commit(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (root
 				}
 				stateObject.dirtyCode = false
 			}
-			// Write any storage changes in the state object to its storage trie.
-			if err := stateObject.CommitTrie(s.db, dbw); err != nil {
-				return common.Hash{}, err
-			}
-			// Update the object in the main account trie.
-			s.updateStateObject(stateObject)
+			committed = append(committed, stateObject)
 		}
 		delete(s.stateObjectsDirty, addr)
 	}
+	// Write any storage changes in the state objects to their storage tries.
+	if err := s.commitStorageTries(committed, dbw); err != nil {
+		return common.Hash{}, err
+	}
+	// Update the objects in the main account trie.
+	for _, stateObject := range committed {
+		s.updateStateObject(stateObject)
+	}
 	// Write trie changes.
 	root, err = s.trie.CommitTo(dbw)
 	if err == nil {
 		s.pushTrie(s.trie)
 	}
+	// Push the collected modifications as a new layer into the snapshot tree
+	if err == nil && s.snap != nil {
+		if parent := s.snap.Root(); parent != root {
+			if err := s.snaps.Update(root, parent, s.snapDestructs, s.snapAccounts, s.snapStorage); err != nil {
+				log.Debug("Failed to update snapshot tree", "from", parent, "to", root, "err", err)
+			}
+		}
+		s.snap, s.snapDestructs, s.snapAccounts, s.snapStorage = nil, nil, nil, nil
+	}
 	return root, err
 }
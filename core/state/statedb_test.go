@@ -27,9 +27,12 @@ import (
 	"strings"
 	"testing"
 	"testing/quick"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 )
 
@@ -373,3 +376,118 @@ func TestTouchDelete(t *testing.T) {
 		t.Fatal("expected no dirty state object")
 	}
 }
+
+// Tests that state reads served from the flat snapshot are consistent with the
+// state trie across blocks deleting, recreating and modifying accounts.
+func TestSnapshotConsistency(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	triedb := NewNodeDatabase(db)
+
+	// Create a base state with a handful of accounts and storage slots
+	var (
+		addrs = make([]common.Address, 16)
+		keys  = make([]common.Hash, 8)
+	)
+	for i := range addrs {
+		addrs[i] = common.BytesToAddress([]byte{byte(i + 1)})
+	}
+	for i := range keys {
+		keys[i] = common.BytesToHash([]byte{byte(i + 1)})
+	}
+	state, _ := New(common.Hash{}, triedb)
+	for i, addr := range addrs {
+		state.SetNonce(addr, uint64(i+1))
+		for j, key := range keys {
+			state.SetState(addr, key, common.BytesToHash([]byte{byte(i + 1), byte(j + 1)}))
+		}
+	}
+	root, _ := state.Commit(false)
+
+	// Generate a snapshot of the base state and wait until it's complete
+	snaps, err := snapshot.New(db, triedb, root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	var last common.Hash
+	for i := range last {
+		last[i] = 0xff
+	}
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := snaps.Snapshot(root).Account(last); err == nil {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("snapshot generation timed out")
+		}
+	}
+	// Run a number of blocks of random modifications on top
+	rng := rand.New(rand.NewSource(1))
+	for block := 0; block < 32; block++ {
+		state, _ := NewWithSnapshots(root, triedb, snaps)
+		if state.snap == nil {
+			t.Fatalf("block %d: snapshot unavailable", block)
+		}
+		for i := 0; i < 8; i++ {
+			addr := addrs[rng.Intn(len(addrs))]
+			switch rng.Intn(4) {
+			case 0:
+				state.Suicide(addr)
+			case 1:
+				state.CreateAccount(addr)
+				state.SetNonce(addr, uint64(block+1))
+			default:
+				state.SetState(addr, keys[rng.Intn(len(keys))], common.BytesToHash([]byte{byte(rng.Intn(3))}))
+			}
+			state.IntermediateRoot(false)
+		}
+		if root, err = state.Commit(false); err != nil {
+			t.Fatalf("block %d: failed to commit state: %v", block, err)
+		}
+		if err := snaps.Cap(root, 4); err != nil {
+			t.Fatalf("block %d: failed to cap snapshot: %v", block, err)
+		}
+		// Cross check the snapshot backed state with the trie backed one
+		snapState, _ := NewWithSnapshots(root, triedb, snaps)
+		if snapState.snap == nil {
+			t.Fatalf("block %d: snapshot missing", block)
+		}
+		trieState, _ := New(root, triedb)
+		for _, addr := range addrs {
+			if have, want := snapState.Exist(addr), trieState.Exist(addr); have != want {
+				t.Fatalf("block %d: account %x: existence mismatch: have %v, want %v", block, addr, have, want)
+			}
+			if have, want := snapState.GetNonce(addr), trieState.GetNonce(addr); have != want {
+				t.Fatalf("block %d: account %x: nonce mismatch: have %d, want %d", block, addr, have, want)
+			}
+			for _, key := range keys {
+				if have, want := snapState.GetState(addr, key), trieState.GetState(addr, key); have != want {
+					t.Fatalf("block %d: slot %x/%x: value mismatch: have %x, want %x", block, addr, key, have, want)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkCommit measures committing a state with many modified storage tries.
+// Run it with e.g. -cpu 1,4 to compare sequential and concurrent storage commits.
+func BenchmarkCommit(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		db, _ := ethdb.NewMemDatabase()
+		state, _ := New(common.Hash{}, db)
+		for j := 0; j < 256; j++ {
+			addr := common.BytesToAddress(crypto.Keccak256(big.NewInt(int64(j)).Bytes()))
+			state.SetNonce(addr, 1)
+			for k := 0; k < 128; k++ {
+				key := common.BigToHash(big.NewInt(int64(k + 1)))
+				state.SetState(addr, key, key)
+			}
+		}
+		b.StartTimer()
+
+		if _, err := state.Commit(false); err != nil {
+			b.Fatalf("failed to commit state: %v", err)
+		}
+	}
+}
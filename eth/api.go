@@ -19,7 +19,6 @@ package eth
 import (
 	"bytes"
 	"compress/gzip"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -36,6 +35,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/miner"
@@ -82,7 +82,7 @@ type PublicMinerAPI struct {
 
 // NewPublicMinerAPI create a new PublicMinerAPI instance.
 func NewPublicMinerAPI(e *Ethereum) *PublicMinerAPI {
-	agent := miner.NewRemoteAgent(e.Pow())
+	agent := miner.NewRemoteAgent(e.BlockChain(), e.Engine())
 	e.Miner().Register(agent)
 
 	return &PublicMinerAPI{e, agent}
@@ -313,6 +313,33 @@ func (api *PublicDebugAPI) DumpBlock(number uint64) (state.Dump, error) {
 	return stateDb.RawDump(), nil
 }
 
+// maxRangeResults is the maximum number of accounts or storage slots returned
+// in a single page by the range retrieval methods.
+const maxRangeResults = 256
+
+// AccountRange retrieves a page of at most maxResults accounts from the state of
+// the given block, starting at the account with the given address hash. Storage
+// of the accounts isn't included, see debug_storageRangeAt.
+func (api *PublicDebugAPI) AccountRange(number rpc.BlockNumber, start common.Hash, maxResults int) (state.AccountRange, error) {
+	var block *types.Block
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		block = api.eth.BlockChain().CurrentBlock()
+	} else {
+		block = api.eth.BlockChain().GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return state.AccountRange{}, fmt.Errorf("block #%d not found", number)
+	}
+	stateDb, err := api.eth.BlockChain().StateAt(block.Root())
+	if err != nil {
+		return state.AccountRange{}, err
+	}
+	if maxResults <= 0 || maxResults > maxRangeResults {
+		maxResults = maxRangeResults
+	}
+	return stateDb.AccountRange(start, maxResults)
+}
+
 // PrivateDebugAPI is the collection of Etheruem full node APIs exposed over
 // the private debugging endpoint.
 type PrivateDebugAPI struct {
@@ -334,7 +361,9 @@ type BlockTraceResult struct {
 	Error      string                `json:"error"`
 }
 
-// TraceArgs holds extra parameters to trace functions
+// TraceArgs holds extra parameters to trace functions. Tracer is either the
+// name of a built-in native tracer (ethapi.CallTracerName) or the source code
+// of a Javascript tracer.
 type TraceArgs struct {
 	*vm.LogConfig
 	Tracer  *string
@@ -416,7 +445,7 @@ func (api *PrivateDebugAPI) traceBlock(block *types.Block, logConfig *vm.LogConf
 		Tracer: structLogger,
 	}
 
-	if err := core.ValidateHeader(api.config, blockchain.AuxValidator(), block.Header(), blockchain.GetHeader(block.ParentHash(), block.NumberU64()-1), true, false); err != nil {
+	if err := blockchain.Engine().VerifyHeader(blockchain, block.Header(), true); err != nil {
 		return false, structLogger.StructLogs(), err
 	}
 	statedb, err := blockchain.StateAt(blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1).Root())
@@ -469,37 +498,88 @@ func (t *timeoutError) Error() string {
 	return "Execution time exceeded"
 }
 
-// TraceTransaction returns the structured logs created during the execution of EVM
-// and returns them as a JSON object.
-func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, txHash common.Hash, config *TraceArgs) (interface{}, error) {
-	var tracer vm.Tracer
-	if config != nil && config.Tracer != nil {
-		timeout := defaultTraceTimeout
-		if config.Timeout != nil {
-			var err error
-			if timeout, err = time.ParseDuration(*config.Timeout); err != nil {
-				return nil, err
-			}
+// newTracer creates the tracer requested by the trace configuration. Custom
+// tracers are interrupted after the configured timeout or when ctx is cancelled;
+// the returned function releases the resources guarding them.
+func newTracer(ctx context.Context, config *TraceArgs) (vm.Tracer, context.CancelFunc, error) {
+	if config == nil {
+		return vm.NewStructLogger(nil), func() {}, nil
+	}
+	if config.Tracer == nil {
+		return vm.NewStructLogger(config.LogConfig), func() {}, nil
+	}
+	timeout := defaultTraceTimeout
+	if config.Timeout != nil {
+		var err error
+		if timeout, err = time.ParseDuration(*config.Timeout); err != nil {
+			return nil, nil, err
 		}
-
+	}
+	var tracer vm.Tracer
+	switch *config.Tracer {
+	case ethapi.CallTracerName:
+		tracer = ethapi.NewCallTracer()
+	default:
 		var err error
 		if tracer, err = ethapi.NewJavascriptTracer(*config.Tracer); err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+	}
+	// Handle timeouts and RPC cancellations
+	deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
+	go func() {
+		<-deadlineCtx.Done()
+		switch tracer := tracer.(type) {
+		case *ethapi.CallTracer:
+			tracer.Stop(&timeoutError{})
+		case *ethapi.JavascriptTracer:
+			tracer.Stop(&timeoutError{})
 		}
+	}()
+	return tracer, cancel, nil
+}
 
-		// Handle timeouts and RPC cancellations
-		deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
-		go func() {
-			<-deadlineCtx.Done()
-			tracer.(*ethapi.JavascriptTracer).Stop(&timeoutError{})
-		}()
-		defer cancel()
-	} else if config == nil {
-		tracer = vm.NewStructLogger(nil)
-	} else {
-		tracer = vm.NewStructLogger(config.LogConfig)
+// traceMessage executes a message in an EVM set up with the given tracer, and
+// returns the tracer specific results.
+func traceMessage(vmenv *vm.EVM, msg core.Message, tracer vm.Tracer) (interface{}, error) {
+	if tracer, ok := tracer.(*ethapi.CallTracer); ok {
+		to := crypto.CreateAddress(msg.From(), vmenv.StateDB.GetNonce(msg.From()))
+		if msg.To() != nil {
+			to = *msg.To()
+		}
+		tracer.CaptureStart(msg.From(), to, msg.To() == nil, msg.Data(), msg.Gas().Uint64(), msg.Value())
+	}
+	ret, gas, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()))
+	if err != nil {
+		return nil, fmt.Errorf("tracing failed: %v", err)
 	}
 
+	switch tracer := tracer.(type) {
+	case *ethapi.CallTracer:
+		tracer.CaptureEnd(ret, gas.Uint64())
+		return tracer.GetResult()
+	case *vm.StructLogger:
+		return &ethapi.ExecutionResult{
+			Gas:         gas,
+			ReturnValue: fmt.Sprintf("%x", ret),
+			StructLogs:  ethapi.FormatLogs(tracer.StructLogs()),
+		}, nil
+	case *ethapi.JavascriptTracer:
+		return tracer.GetResult()
+	default:
+		panic(fmt.Sprintf("bad tracer type %T", tracer))
+	}
+}
+
+// TraceTransaction returns the structured logs created during the execution of EVM
+// and returns them as a JSON object.
+func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, txHash common.Hash, config *TraceArgs) (interface{}, error) {
+	tracer, cancel, err := newTracer(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
 	// Retrieve the tx from the chain and the containing block
 	tx, blockHash, _, txIndex := core.GetTransaction(api.eth.ChainDb(), txHash)
 	if tx == nil {
@@ -509,55 +589,47 @@ func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, txHash common.
 	if block == nil {
 		return nil, fmt.Errorf("block %x not found", blockHash)
 	}
-	// Create the state database to mutate and eventually trace
-	parent := api.eth.BlockChain().GetBlock(block.ParentHash(), block.NumberU64()-1)
-	if parent == nil {
-		return nil, fmt.Errorf("block parent %x not found", block.ParentHash())
-	}
-	stateDb, err := api.eth.BlockChain().StateAt(parent.Root())
+	// Recreate the state right before the transaction and trace it on top
+	stateDb, err := api.stateAtTransaction(block, int(txIndex))
 	if err != nil {
 		return nil, err
 	}
-
 	signer := types.MakeSigner(api.config, block.Number())
-	// Mutate the state and trace the selected transaction
-	for idx, tx := range block.Transactions() {
-		// Assemble the transaction call message
-		msg, err := tx.AsMessage(signer)
-		if err != nil {
-			return nil, fmt.Errorf("sender retrieval failed: %v", err)
-		}
-		context := core.NewEVMContext(msg, block.Header(), api.eth.BlockChain())
 
-		// Mutate the state if we haven't reached the tracing transaction yet
-		if uint64(idx) < txIndex {
-			vmenv := vm.NewEVM(context, stateDb, api.config, vm.Config{})
-			_, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas()))
-			if err != nil {
-				return nil, fmt.Errorf("mutation failed: %v", err)
-			}
-			stateDb.DeleteSuicides()
-			continue
-		}
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		return nil, fmt.Errorf("sender retrieval failed: %v", err)
+	}
+	context := core.NewEVMContext(msg, block.Header(), api.eth.BlockChain())
 
-		vmenv := vm.NewEVM(context, stateDb, api.config, vm.Config{Debug: true, Tracer: tracer})
-		ret, gas, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas()))
-		if err != nil {
-			return nil, fmt.Errorf("tracing failed: %v", err)
-		}
+	vmenv := vm.NewEVM(context, stateDb, api.config, vm.Config{Debug: true, Tracer: tracer})
+	return traceMessage(vmenv, msg, tracer)
+}
 
-		switch tracer := tracer.(type) {
-		case *vm.StructLogger:
-			return &ethapi.ExecutionResult{
-				Gas:         gas,
-				ReturnValue: fmt.Sprintf("%x", ret),
-				StructLogs:  ethapi.FormatLogs(tracer.StructLogs()),
-			}, nil
-		case *ethapi.JavascriptTracer:
-			return tracer.GetResult()
+// TraceCall executes a call on top of the state of the requested block, the
+// same way eth_call would, and returns the structured logs or custom tracer
+// results of the execution. Nothing is persisted into the chain or its state.
+func (api *PrivateDebugAPI) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNr rpc.BlockNumber, config *TraceArgs) (interface{}, error) {
+	tracer, cancel, err := newTracer(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	state, header, err := api.eth.ApiBackend.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		if err == nil {
+			err = fmt.Errorf("block #%d not found", blockNr)
 		}
+		return nil, err
+	}
+	msg := args.ToMessage(api.eth.AccountManager())
+
+	vmenv, _, err := api.eth.ApiBackend.GetEVM(ctx, msg, state, header, vm.Config{Debug: true, Tracer: tracer})
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("database inconsistency")
+	return traceMessage(vmenv, msg, tracer)
 }
 
 // Preimage is a debug API function that returns the preimage for a sha3 hash, if known.
@@ -571,3 +643,54 @@ func (api *PrivateDebugAPI) Preimage(ctx context.Context, hash common.Hash) (hex
 func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]core.BadBlockArgs, error) {
 	return api.eth.BlockChain().BadBlocks()
 }
+
+// StorageRangeAt retrieves a page of at most maxResults storage slots of an
+// account, as seen right before the execution of the transaction at txIndex in
+// the given block, starting at the slot with the given key hash.
+func (api *PrivateDebugAPI) StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex int, contractAddress common.Address, keyStart common.Hash, maxResult int) (state.StorageRange, error) {
+	block := api.eth.BlockChain().GetBlockByHash(blockHash)
+	if block == nil {
+		return state.StorageRange{}, fmt.Errorf("block %x not found", blockHash)
+	}
+	stateDb, err := api.stateAtTransaction(block, txIndex)
+	if err != nil {
+		return state.StorageRange{}, err
+	}
+	if maxResult <= 0 || maxResult > maxRangeResults {
+		maxResult = maxRangeResults
+	}
+	return stateDb.StorageRange(contractAddress, keyStart, maxResult)
+}
+
+// stateAtTransaction returns the state of a block right before the execution of
+// the transaction at the given index, reexecuting all the preceding ones on top
+// of the parent state. It's shared by all the debug endpoints operating on the
+// state within a block, so they all observe exactly the same state.
+func (api *PrivateDebugAPI) stateAtTransaction(block *types.Block, txIndex int) (*state.StateDB, error) {
+	if txIndex < 0 || txIndex > len(block.Transactions()) {
+		return nil, fmt.Errorf("transaction index %d out of range [0, %d]", txIndex, len(block.Transactions()))
+	}
+	parent := api.eth.BlockChain().GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("block parent %x not found", block.ParentHash())
+	}
+	stateDb, err := api.eth.BlockChain().StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	signer := types.MakeSigner(api.config, block.Number())
+	for _, tx := range block.Transactions()[:txIndex] {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, fmt.Errorf("sender retrieval failed: %v", err)
+		}
+		context := core.NewEVMContext(msg, block.Header(), api.eth.BlockChain())
+
+		vmenv := vm.NewEVM(context, stateDb, api.config, vm.Config{})
+		if _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas())); err != nil {
+			return nil, fmt.Errorf("transaction %x failed: %v", tx.Hash(), err)
+		}
+		stateDb.IntermediateRoot(api.config.IsEIP158(block.Number()))
+	}
+	return stateDb, nil
+}
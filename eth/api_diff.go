@@ -0,0 +1,350 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// BalanceDiff is the change of an account's balance between two states.
+type BalanceDiff struct {
+	From *hexutil.Big `json:"from"`
+	To   *hexutil.Big `json:"to"`
+}
+
+// NonceDiff is the change of an account's nonce between two states.
+type NonceDiff struct {
+	From hexutil.Uint64 `json:"from"`
+	To   hexutil.Uint64 `json:"to"`
+}
+
+// CodeDiff is the change of an account's code between two states.
+type CodeDiff struct {
+	From hexutil.Bytes `json:"from"`
+	To   hexutil.Bytes `json:"to"`
+}
+
+// StorageDiff is the change of a single storage slot between two states.
+type StorageDiff struct {
+	From common.Hash `json:"from"`
+	To   common.Hash `json:"to"`
+}
+
+// AccountDiff contains the changes of a single account between two states. The
+// fields of the properties left unchanged are omitted.
+type AccountDiff struct {
+	Created bool                         `json:"created,omitempty"` // Account did not exist in the origin state
+	Deleted bool                         `json:"deleted,omitempty"` // Account does not exist in the final state
+	Balance *BalanceDiff                 `json:"balance,omitempty"`
+	Nonce   *NonceDiff                   `json:"nonce,omitempty"`
+	Code    *CodeDiff                    `json:"code,omitempty"`
+	Storage map[common.Hash]*StorageDiff `json:"storage,omitempty"`
+}
+
+// GetModifiedAccountsByNumber returns all accounts that have changed between the
+// two blocks specified. A change is defined as a difference in nonce, balance,
+// code hash or storage hash. Accounts deleted in between are not included.
+//
+// With one parameter, returns the list of accounts modified in the specified block.
+func (api *PrivateDebugAPI) GetModifiedAccountsByNumber(startNum uint64, endNum *uint64) ([]common.Address, error) {
+	startBlock, endBlock, err := api.blockRangeByNumber(startNum, endNum)
+	if err != nil {
+		return nil, err
+	}
+	return api.getModifiedAccounts(startBlock, endBlock)
+}
+
+// GetModifiedAccountsByHash returns all accounts that have changed between the
+// two blocks specified. A change is defined as a difference in nonce, balance,
+// code hash or storage hash. Accounts deleted in between are not included.
+//
+// With one parameter, returns the list of accounts modified in the specified block.
+func (api *PrivateDebugAPI) GetModifiedAccountsByHash(startHash common.Hash, endHash *common.Hash) ([]common.Address, error) {
+	var startBlock, endBlock *types.Block
+
+	startBlock = api.eth.blockchain.GetBlockByHash(startHash)
+	if startBlock == nil {
+		return nil, fmt.Errorf("start block %x not found", startHash)
+	}
+	if endHash == nil {
+		endBlock = startBlock
+		startBlock = api.eth.blockchain.GetBlockByHash(startBlock.ParentHash())
+		if startBlock == nil {
+			return nil, fmt.Errorf("block %x has no parent", endBlock.Hash())
+		}
+	} else {
+		endBlock = api.eth.blockchain.GetBlockByHash(*endHash)
+		if endBlock == nil {
+			return nil, fmt.Errorf("end block %x not found", *endHash)
+		}
+	}
+	return api.getModifiedAccounts(startBlock, endBlock)
+}
+
+// StateDiff returns the balance, nonce, code and storage changes of all the
+// accounts that differ between the states of the start and end blocks, keyed
+// by account address.
+func (api *PrivateDebugAPI) StateDiff(start, end rpc.BlockNumber) (map[common.Address]*AccountDiff, error) {
+	startBlock, err := api.blockByNumber(start)
+	if err != nil {
+		return nil, err
+	}
+	endBlock, err := api.blockByNumber(end)
+	if err != nil {
+		return nil, err
+	}
+	return api.stateDiff(startBlock.Root(), endBlock.Root())
+}
+
+// blockRangeByNumber resolves the canonical blocks delimiting a range. If the end
+// is omitted, the range spans the single block at start.
+func (api *PrivateDebugAPI) blockRangeByNumber(startNum uint64, endNum *uint64) (*types.Block, *types.Block, error) {
+	var startBlock, endBlock *types.Block
+
+	startBlock = api.eth.blockchain.GetBlockByNumber(startNum)
+	if startBlock == nil {
+		return nil, nil, fmt.Errorf("start block #%d not found", startNum)
+	}
+	if endNum == nil {
+		endBlock = startBlock
+		startBlock = api.eth.blockchain.GetBlockByHash(startBlock.ParentHash())
+		if startBlock == nil {
+			return nil, nil, fmt.Errorf("block #%d has no parent", startNum)
+		}
+	} else {
+		endBlock = api.eth.blockchain.GetBlockByNumber(*endNum)
+		if endBlock == nil {
+			return nil, nil, fmt.Errorf("end block #%d not found", *endNum)
+		}
+	}
+	return startBlock, endBlock, nil
+}
+
+// getModifiedAccounts collects the addresses of all the accounts present in the
+// state of the end block which differ from the state of the start block.
+func (api *PrivateDebugAPI) getModifiedAccounts(startBlock, endBlock *types.Block) ([]common.Address, error) {
+	if startBlock.Number().Uint64() >= endBlock.Number().Uint64() {
+		return nil, fmt.Errorf("start block height (%d) must be less than end block height (%d)", startBlock.Number().Uint64(), endBlock.Number().Uint64())
+	}
+	db := api.eth.blockchain.StateDatabase()
+
+	oldTrie, err := trie.NewSecure(startBlock.Root(), db, 0)
+	if err != nil {
+		return nil, err
+	}
+	newTrie, err := trie.NewSecure(endBlock.Root(), db, 0)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := leafDifference(oldTrie, newTrie)
+	if err != nil {
+		return nil, err
+	}
+	dirty := make([]common.Address, 0, len(keys))
+	for _, key := range keys {
+		preimage := newTrie.GetKey(key)
+		if preimage == nil {
+			return nil, fmt.Errorf("no preimage found for hash %x", key)
+		}
+		dirty = append(dirty, common.BytesToAddress(preimage))
+	}
+	return dirty, nil
+}
+
+// stateDiff computes the changes of all the accounts differing between the two
+// state roots, including their storage and code.
+func (api *PrivateDebugAPI) stateDiff(oldRoot, newRoot common.Hash) (map[common.Address]*AccountDiff, error) {
+	db := api.eth.blockchain.StateDatabase()
+
+	oldTrie, err := trie.NewSecure(oldRoot, db, 0)
+	if err != nil {
+		return nil, err
+	}
+	newTrie, err := trie.NewSecure(newRoot, db, 0)
+	if err != nil {
+		return nil, err
+	}
+	// Gather the accounts which are either new/modified or deleted
+	keys, err := leafDifference(oldTrie, newTrie)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := leafDifference(newTrie, oldTrie)
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, deleted...)
+
+	diffs := make(map[common.Address]*AccountDiff)
+	for _, key := range keys {
+		preimage := newTrie.GetKey(key)
+		if preimage == nil {
+			return nil, fmt.Errorf("no preimage found for hash %x", key)
+		}
+		addr := common.BytesToAddress(preimage)
+		if _, ok := diffs[addr]; ok {
+			continue // modified accounts are present in both differences
+		}
+		oldAcc, err := decodeAccount(oldTrie.Get(addr[:]))
+		if err != nil {
+			return nil, fmt.Errorf("account %x: %v", addr, err)
+		}
+		newAcc, err := decodeAccount(newTrie.Get(addr[:]))
+		if err != nil {
+			return nil, fmt.Errorf("account %x: %v", addr, err)
+		}
+		diff := &AccountDiff{
+			Created: oldAcc == nil,
+			Deleted: newAcc == nil,
+		}
+		// Fill in any missing side with an empty account to simplify comparisons
+		if oldAcc == nil {
+			oldAcc = &state.Account{Balance: new(big.Int), CodeHash: crypto.Keccak256(nil)}
+		}
+		if newAcc == nil {
+			newAcc = &state.Account{Balance: new(big.Int), CodeHash: crypto.Keccak256(nil)}
+		}
+		if oldAcc.Balance.Cmp(newAcc.Balance) != 0 {
+			diff.Balance = &BalanceDiff{From: (*hexutil.Big)(oldAcc.Balance), To: (*hexutil.Big)(newAcc.Balance)}
+		}
+		if oldAcc.Nonce != newAcc.Nonce {
+			diff.Nonce = &NonceDiff{From: hexutil.Uint64(oldAcc.Nonce), To: hexutil.Uint64(newAcc.Nonce)}
+		}
+		if !bytes.Equal(oldAcc.CodeHash, newAcc.CodeHash) {
+			diff.Code = &CodeDiff{}
+			if diff.Code.From, err = api.contractCode(oldAcc.CodeHash); err != nil {
+				return nil, fmt.Errorf("account %x: %v", addr, err)
+			}
+			if diff.Code.To, err = api.contractCode(newAcc.CodeHash); err != nil {
+				return nil, fmt.Errorf("account %x: %v", addr, err)
+			}
+		}
+		if oldAcc.Root != newAcc.Root {
+			if diff.Storage, err = storageDiff(db, oldAcc.Root, newAcc.Root); err != nil {
+				return nil, fmt.Errorf("account %x: %v", addr, err)
+			}
+		}
+		diffs[addr] = diff
+	}
+	return diffs, nil
+}
+
+// storageDiff computes the changes of all the storage slots differing between
+// the two storage roots.
+func storageDiff(db trie.Database, oldRoot, newRoot common.Hash) (map[common.Hash]*StorageDiff, error) {
+	oldTrie, err := trie.NewSecure(oldRoot, db, 0)
+	if err != nil {
+		return nil, err
+	}
+	newTrie, err := trie.NewSecure(newRoot, db, 0)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := leafDifference(oldTrie, newTrie)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := leafDifference(newTrie, oldTrie)
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, deleted...)
+
+	diffs := make(map[common.Hash]*StorageDiff)
+	for _, key := range keys {
+		preimage := newTrie.GetKey(key)
+		if preimage == nil {
+			return nil, fmt.Errorf("no preimage found for hash %x", key)
+		}
+		slot := common.BytesToHash(preimage)
+		if _, ok := diffs[slot]; ok {
+			continue
+		}
+		oldVal, err := decodeStorage(oldTrie.Get(slot[:]))
+		if err != nil {
+			return nil, fmt.Errorf("slot %x: %v", slot, err)
+		}
+		newVal, err := decodeStorage(newTrie.Get(slot[:]))
+		if err != nil {
+			return nil, fmt.Errorf("slot %x: %v", slot, err)
+		}
+		diffs[slot] = &StorageDiff{From: oldVal, To: newVal}
+	}
+	return diffs, nil
+}
+
+// leafDifference returns the (hashed) keys of all the leaves in trie b which are
+// either missing from trie a or hold a different value.
+func leafDifference(a, b *trie.SecureTrie) ([][]byte, error) {
+	diff, _ := trie.NewDifferenceIterator(a.NodeIterator(), b.NodeIterator())
+	iter := trie.NewIteratorFromNodeIterator(diff)
+
+	var keys [][]byte
+	for iter.Next() {
+		keys = append(keys, common.CopyBytes(iter.Key))
+	}
+	return keys, diff.Error()
+}
+
+// decodeAccount parses an RLP encoded account, returning nil if missing.
+func decodeAccount(blob []byte) (*state.Account, error) {
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	account := new(state.Account)
+	if err := rlp.DecodeBytes(blob, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// decodeStorage parses an RLP encoded storage slot value, returning the empty
+// hash if missing.
+func decodeStorage(blob []byte) (common.Hash, error) {
+	if len(blob) == 0 {
+		return common.Hash{}, nil
+	}
+	_, content, _, err := rlp.Split(blob)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(content), nil
+}
+
+// contractCode retrieves the code associated with a code hash from the state
+// database.
+func (api *PrivateDebugAPI) contractCode(hash []byte) (hexutil.Bytes, error) {
+	if bytes.Equal(hash, crypto.Keccak256(nil)) {
+		return nil, nil
+	}
+	code, err := api.eth.blockchain.StateDatabase().Get(hash)
+	if err != nil {
+		return nil, fmt.Errorf("code %x not found: %v", hash, err)
+	}
+	return code, nil
+}
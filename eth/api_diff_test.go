@@ -0,0 +1,128 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that the modified accounts and the detailed state diffs between blocks
+// are reported correctly for created, modified and self-destructed accounts.
+func TestStateDiff(t *testing.T) {
+	// Contract storing 0x2a at slot 1 and deploying a runtime self-destructing
+	// to the caller (CALLER SELFDESTRUCT)
+	deployCode := common.FromHex("602a6001556133ff6000526002601ef3")
+
+	var (
+		db, _       = ethdb.NewMemDatabase()
+		genesis     = core.WriteGenesisBlockForTesting(db, testBank)
+		chainConfig = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		engine      = ethash.NewFaker()
+		signer      = types.HomesteadSigner{}
+		recipient   = common.HexToAddress("0xdeadbeef")
+		contract    = crypto.CreateAddress(testBank.Address, 0)
+	)
+	blockchain, _ := core.NewBlockChain(db, nil, chainConfig, engine, new(event.TypeMux), vm.Config{})
+	chain, _ := core.GenerateChain(chainConfig, genesis, engine, db, 2, func(i int, block *core.BlockGen) {
+		switch i {
+		case 0:
+			tx, _ := types.SignTx(types.NewContractCreation(block.TxNonce(testBank.Address), new(big.Int), big.NewInt(100000), nil, deployCode), signer, testBankKey)
+			block.AddTx(tx)
+			tx, _ = types.SignTx(types.NewTransaction(block.TxNonce(testBank.Address), recipient, big.NewInt(1000), bigTxGas, nil, nil), signer, testBankKey)
+			block.AddTx(tx)
+		case 1:
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBank.Address), contract, new(big.Int), big.NewInt(100000), nil, nil), signer, testBankKey)
+			block.AddTx(tx)
+		}
+	})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	api := NewPrivateDebugAPI(chainConfig, &Ethereum{chainConfig: chainConfig, chainDb: db, blockchain: blockchain})
+
+	// Check the modified account lists of the first block
+	one := uint64(1)
+	for i, fn := range []func() ([]common.Address, error){
+		func() ([]common.Address, error) { return api.GetModifiedAccountsByNumber(1, nil) },
+		func() ([]common.Address, error) { return api.GetModifiedAccountsByNumber(0, &one) },
+		func() ([]common.Address, error) { return api.GetModifiedAccountsByHash(chain[0].Hash(), nil) },
+	} {
+		dirty, err := fn()
+		if err != nil {
+			t.Fatalf("query %d: failed to retrieve modified accounts: %v", i, err)
+		}
+		for _, addr := range []common.Address{testBank.Address, recipient, contract} {
+			found := false
+			for _, have := range dirty {
+				found = found || have == addr
+			}
+			if !found {
+				t.Errorf("query %d: account %x missing from modified set %x", i, addr, dirty)
+			}
+		}
+	}
+	if _, err := api.GetModifiedAccountsByNumber(1, &one); err == nil {
+		t.Errorf("empty range accepted")
+	}
+	// Check the detailed diff of the contract creation
+	diff, err := api.StateDiff(rpc.BlockNumber(0), rpc.BlockNumber(1))
+	if err != nil {
+		t.Fatalf("failed to diff creation block: %v", err)
+	}
+	if acc := diff[recipient]; acc == nil || !acc.Created || acc.Balance == nil || acc.Balance.To.ToInt().Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("recipient diff mismatch: %+v", acc)
+	}
+	if acc := diff[testBank.Address]; acc == nil || acc.Created || acc.Nonce == nil || acc.Nonce.From != 0 || acc.Nonce.To != 2 || acc.Balance == nil {
+		t.Errorf("sender diff mismatch: %+v", acc)
+	}
+	acc := diff[contract]
+	if acc == nil || !acc.Created || acc.Code == nil || !bytes.Equal(acc.Code.To, common.FromHex("33ff")) {
+		t.Fatalf("contract diff mismatch: %+v", acc)
+	}
+	slot := common.BigToHash(big.NewInt(1))
+	if len(acc.Storage) != 1 || acc.Storage[slot] == nil || acc.Storage[slot].To != common.BigToHash(big.NewInt(0x2a)) {
+		t.Errorf("contract storage diff mismatch: %v", acc.Storage)
+	}
+	// Check the detailed diff of the self destruct
+	diff, err = api.StateDiff(rpc.BlockNumber(1), rpc.BlockNumber(2))
+	if err != nil {
+		t.Fatalf("failed to diff destruction block: %v", err)
+	}
+	acc = diff[contract]
+	if acc == nil || !acc.Deleted || acc.Code == nil || len(acc.Code.To) != 0 {
+		t.Fatalf("destructed contract diff mismatch: %+v", acc)
+	}
+	if len(acc.Storage) != 1 || acc.Storage[slot] == nil || acc.Storage[slot].From != common.BigToHash(big.NewInt(0x2a)) || (acc.Storage[slot].To != common.Hash{}) {
+		t.Errorf("destructed contract storage diff mismatch: %v", acc.Storage)
+	}
+	if _, ok := diff[recipient]; ok {
+		t.Errorf("untouched account reported as modified")
+	}
+}
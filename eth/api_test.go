@@ -0,0 +1,161 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/net/context"
+)
+
+// Tests that accounts can be paged through and that storage ranges are served
+// from the state in between the transactions of a block.
+func TestAccountAndStorageRange(t *testing.T) {
+	// Contract storing 0x2a at slot 1 and deploying an empty runtime
+	deployCode := common.FromHex("602a600155")
+
+	var (
+		db, _       = ethdb.NewMemDatabase()
+		genesis     = core.WriteGenesisBlockForTesting(db, testBank)
+		chainConfig = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		engine      = ethash.NewFaker()
+		signer      = types.HomesteadSigner{}
+		contract    = crypto.CreateAddress(testBank.Address, 0)
+	)
+	blockchain, _ := core.NewBlockChain(db, nil, chainConfig, engine, new(event.TypeMux), vm.Config{})
+	chain, _ := core.GenerateChain(chainConfig, genesis, engine, db, 1, func(i int, block *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewContractCreation(block.TxNonce(testBank.Address), new(big.Int), big.NewInt(100000), nil, deployCode), signer, testBankKey)
+		block.AddTx(tx)
+		for j := 0; j < 4; j++ {
+			tx, _ = types.SignTx(types.NewTransaction(block.TxNonce(testBank.Address), common.BytesToAddress([]byte{byte(j + 1)}), big.NewInt(1000), bigTxGas, nil, nil), signer, testBankKey)
+			block.AddTx(tx)
+		}
+	})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	eth := &Ethereum{chainConfig: chainConfig, chainDb: db, blockchain: blockchain}
+
+	// Page through the accounts two by two: bank, contract, coinbase and 4 recipients
+	var (
+		public   = NewPublicDebugAPI(eth)
+		accounts = make(map[common.Hash]bool)
+		start    common.Hash
+	)
+	for {
+		page, err := public.AccountRange(rpc.LatestBlockNumber, start, 2)
+		if err != nil {
+			t.Fatalf("failed to retrieve account range: %v", err)
+		}
+		for hash := range page.Accounts {
+			accounts[hash] = true
+		}
+		if page.Next == nil {
+			break
+		}
+		start = *page.Next
+	}
+	if len(accounts) != 7 {
+		t.Fatalf("account count mismatch: have %d, want %d", len(accounts), 7)
+	}
+	// Check the contract storage before and after its creation
+	private := NewPrivateDebugAPI(chainConfig, eth)
+
+	res, err := private.StorageRangeAt(context.Background(), chain[0].Hash(), 0, contract, common.Hash{}, 10)
+	if err != nil {
+		t.Fatalf("failed to retrieve storage before creation: %v", err)
+	}
+	if len(res.Storage) != 0 {
+		t.Errorf("storage before creation mismatch: have %v, want none", res.Storage)
+	}
+	res, err = private.StorageRangeAt(context.Background(), chain[0].Hash(), 1, contract, common.Hash{}, 10)
+	if err != nil {
+		t.Fatalf("failed to retrieve storage after creation: %v", err)
+	}
+	slot := common.BigToHash(big.NewInt(1))
+	entry, ok := res.Storage[crypto.Keccak256Hash(slot[:])]
+	if len(res.Storage) != 1 || !ok || entry.Key == nil || *entry.Key != slot || entry.Value != common.BigToHash(big.NewInt(0x2a)) {
+		t.Errorf("storage after creation mismatch: %v", res.Storage)
+	}
+	if res.Next != nil {
+		t.Errorf("unexpected continuation key: %x", *res.Next)
+	}
+	if _, err := private.StorageRangeAt(context.Background(), chain[0].Hash(), 6, contract, common.Hash{}, 10); err == nil {
+		t.Errorf("out of range transaction index accepted")
+	}
+}
+
+// Tests that underpriced transaction replacements are rejected over the RPC API
+// with the transaction pool's error, and that the minimum bump is accepted.
+func TestSendRawTransactionReplacement(t *testing.T) {
+	var (
+		db, _       = ethdb.NewMemDatabase()
+		chainConfig = &params.ChainConfig{ChainId: big.NewInt(1), HomesteadBlock: big.NewInt(0)}
+		mux         = new(event.TypeMux)
+		signer      = types.HomesteadSigner{}
+	)
+	core.WriteGenesisBlockForTesting(db, testBank)
+	blockchain, _ := core.NewBlockChain(db, nil, chainConfig, ethash.NewFaker(), mux, vm.Config{})
+
+	config := core.DefaultTxPoolConfig
+	config.Journal = ""
+	config.PriceBump = 20
+
+	pool := core.NewTxPool(config, chainConfig, mux, blockchain.State, blockchain.GasLimit)
+	defer pool.Stop()
+
+	eth := &Ethereum{chainConfig: chainConfig, chainDb: db, blockchain: blockchain, txPool: pool}
+	eth.ApiBackend = &EthApiBackend{eth, nil}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", ethapi.NewPublicTransactionPoolAPI(eth.ApiBackend)); err != nil {
+		t.Fatalf("failed to register transaction pool API: %v", err)
+	}
+	defer server.Stop()
+	client := rpc.DialInProc(server)
+
+	send := func(price int64) error {
+		tx, _ := types.SignTx(types.NewTransaction(0, common.Address{0x01}, big.NewInt(1000), bigTxGas, big.NewInt(price), nil), signer, testBankKey)
+		raw, _ := rlp.EncodeToBytes(tx)
+
+		var hash common.Hash
+		return client.Call(&hash, "eth_sendRawTransaction", hexutil.Bytes(raw))
+	}
+	if err := send(10); err != nil {
+		t.Fatalf("failed to send original transaction: %v", err)
+	}
+	if err := send(11); err == nil || err.Error() != core.ErrReplaceUnderpriced.Error() {
+		t.Fatalf("underpriced replacement error mismatch: have %v, want %v", err, core.ErrReplaceUnderpriced)
+	}
+	if err := send(12); err != nil {
+		t.Fatalf("failed to replace transaction at the price bump threshold: %v", err)
+	}
+}
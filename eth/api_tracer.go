@@ -0,0 +1,331 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/net/context"
+)
+
+// TxTraceResult is the result of tracing a single transaction, either the
+// tracer specific output or the error that aborted tracing.
+type TxTraceResult struct {
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// ChainTraceResult is the notification streamed for each traced block of a
+// chain segment, containing the results of all its transactions.
+type ChainTraceResult struct {
+	Block  hexutil.Uint64   `json:"block"`
+	Hash   common.Hash      `json:"hash"`
+	Traces []*TxTraceResult `json:"traces"`
+}
+
+// chainTraceTask is the work item of a single block, traced on top of the
+// state of its parent.
+type chainTraceTask struct {
+	db      ethdb.Database   // Database holding the state to trace on top of
+	root    common.Hash      // State root of the block's parent
+	block   *types.Block     // Block to trace the transactions of
+	results []*TxTraceResult // Trace results of the individual transactions
+}
+
+// TraceChain returns the structured logs or custom tracer results of all the
+// transactions in the blocks (start, end], streamed block by block through an
+// RPC subscription. The chain segment is re-executed only once, keeping the
+// generated state in memory, while the transactions of the individual blocks
+// are traced concurrently.
+func (api *PrivateDebugAPI) TraceChain(ctx context.Context, start, end rpc.BlockNumber, config *TraceArgs) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	// Resolve the chain segment to trace and its starting state
+	from, err := api.blockByNumber(start)
+	if err != nil {
+		return nil, err
+	}
+	to, err := api.blockByNumber(end)
+	if err != nil {
+		return nil, err
+	}
+	if from.NumberU64() >= to.NumberU64() {
+		return nil, fmt.Errorf("end block #%d needs to come after start block #%d", to.NumberU64(), from.NumberU64())
+	}
+	if config != nil && config.Tracer != nil {
+		// Fail early on bad tracers, instead of streaming errors for every transaction
+		_, cancel, err := newTracer(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		cancel()
+	}
+	db := newTraceDatabase(api.eth.BlockChain().StateDatabase())
+	statedb, err := state.New(from.Root(), db)
+	if err != nil {
+		return nil, fmt.Errorf("missing state of start block #%d: %v", from.NumberU64(), err)
+	}
+	sub := notifier.CreateSubscription()
+
+	// Execute all the transactions contained within the chain concurrently for each block
+	blocks := int(to.NumberU64() - from.NumberU64())
+	threads := runtime.NumCPU()
+	if threads > blocks {
+		threads = blocks
+	}
+	var (
+		pend    = new(sync.WaitGroup)
+		tasks   = make(chan *chainTraceTask, threads)
+		results = make(chan *chainTraceTask, threads)
+	)
+	for th := 0; th < threads; th++ {
+		pend.Add(1)
+		go func() {
+			defer pend.Done()
+
+			for task := range tasks {
+				api.traceChainTask(task, config)
+
+				// Stream the result back to the user or abort on teardown
+				select {
+				case results <- task:
+				case <-notifier.Closed():
+					return
+				case <-sub.Err():
+					return
+				}
+			}
+		}()
+	}
+	// Start a goroutine to regenerate the states and feed the blocks into the tracers
+	go func() {
+		var (
+			blockchain = api.eth.BlockChain()
+			parent     = from
+			begin      = time.Now()
+			logged     time.Time
+			traced     uint64
+			failed     error
+		)
+		defer func() {
+			close(tasks)
+			pend.Wait()
+
+			switch {
+			case failed != nil:
+				log.Warn("Chain tracing failed", "start", from.NumberU64(), "end", to.NumberU64(), "transactions", traced, "elapsed", time.Since(begin), "err", failed)
+			case parent.NumberU64() < to.NumberU64():
+				log.Warn("Chain tracing aborted", "start", from.NumberU64(), "end", to.NumberU64(), "transactions", traced, "elapsed", time.Since(begin))
+			default:
+				log.Info("Chain tracing finished", "start", from.NumberU64(), "end", to.NumberU64(), "transactions", traced, "elapsed", time.Since(begin))
+			}
+			close(results)
+		}()
+		for number := from.NumberU64() + 1; number <= to.NumberU64(); number++ {
+			// Stop tracing if the subscription was torn down
+			select {
+			case <-notifier.Closed():
+				return
+			case <-sub.Err():
+				return
+			default:
+			}
+			if time.Since(logged) > 8*time.Second {
+				log.Info("Tracing chain segment", "start", from.NumberU64(), "end", to.NumberU64(), "current", number, "transactions", traced, "elapsed", time.Since(begin))
+				logged = time.Now()
+			}
+			block := blockchain.GetBlockByNumber(number)
+			if block == nil {
+				failed = fmt.Errorf("block #%d not found", number)
+				return
+			}
+			// Send the block over to the concurrent tracers
+			txs := block.Transactions()
+			select {
+			case tasks <- &chainTraceTask{db: db, root: parent.Root(), block: block, results: make([]*TxTraceResult, len(txs))}:
+			case <-notifier.Closed():
+				return
+			case <-sub.Err():
+				return
+			}
+			traced += uint64(len(txs))
+
+			// Generate the next state without tracing and keep it in memory
+			receipts, _, usedGas, err := blockchain.Processor().Process(block, statedb, vm.Config{})
+			if err != nil {
+				failed = err
+				return
+			}
+			if err := blockchain.Validator().ValidateState(block, parent, statedb, receipts, usedGas); err != nil {
+				failed = err
+				return
+			}
+			root, err := statedb.Commit(api.config.IsEIP158(block.Number()))
+			if err != nil {
+				failed = err
+				return
+			}
+			// If the state is available in the chain, drop the overlay to bound memory use
+			if _, err := api.eth.BlockChain().StateDatabase().Get(root[:]); err == nil {
+				db = newTraceDatabase(api.eth.BlockChain().StateDatabase())
+				if statedb, err = state.New(root, db); err != nil {
+					failed = err
+					return
+				}
+			}
+			parent = block
+		}
+	}()
+	// Keep reading the trace results and stream them to the user in order
+	go func() {
+		var (
+			done = make(map[uint64]*ChainTraceResult)
+			next = from.NumberU64() + 1
+		)
+		for task := range results {
+			done[task.block.NumberU64()] = &ChainTraceResult{
+				Block:  hexutil.Uint64(task.block.NumberU64()),
+				Hash:   task.block.Hash(),
+				Traces: task.results,
+			}
+			// Stream completed traces to the user, skipping empty blocks except the last
+			for result, ok := done[next]; ok; result, ok = done[next] {
+				if len(result.Traces) > 0 || next == to.NumberU64() {
+					notifier.Notify(sub.ID, result)
+				}
+				delete(done, next)
+				next++
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// traceChainTask traces all the transactions of a single block on top of the
+// state of its parent. Tracing stops at the first failure, as the state of any
+// subsequent transaction would be unreliable; their results are marked skipped.
+func (api *PrivateDebugAPI) traceChainTask(task *chainTraceTask, config *TraceArgs) {
+	// fail records the error of the given transaction and skips all later ones
+	fail := func(index int, err string) {
+		task.results[index] = &TxTraceResult{Error: err}
+		for i := index + 1; i < len(task.results); i++ {
+			task.results[i] = &TxTraceResult{Error: fmt.Sprintf("skipped after failure at tx %d", index)}
+		}
+	}
+	statedb, err := state.New(task.root, task.db)
+	if err != nil {
+		if len(task.results) > 0 {
+			fail(0, err.Error())
+		}
+		return
+	}
+	signer := types.MakeSigner(api.config, task.block.Number())
+
+	for i, tx := range task.block.Transactions() {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			fail(i, fmt.Sprintf("sender retrieval failed: %v", err))
+			return
+		}
+		tracer, cancel, err := newTracer(context.Background(), config)
+		if err != nil {
+			fail(i, err.Error())
+			return
+		}
+		vmctx := core.NewEVMContext(msg, task.block.Header(), api.eth.BlockChain())
+		vmenv := vm.NewEVM(vmctx, statedb, api.config, vm.Config{Debug: true, Tracer: tracer})
+
+		res, err := traceMessage(vmenv, msg, tracer)
+		cancel()
+		if err != nil {
+			log.Warn("Tracing failed", "block", task.block.NumberU64(), "hash", tx.Hash(), "err", err)
+			fail(i, err.Error())
+			return
+		}
+		statedb.IntermediateRoot(api.config.IsEIP158(task.block.Number()))
+		task.results[i] = &TxTraceResult{Result: res}
+	}
+}
+
+// blockByNumber retrieves a canonical block by number, resolving the latest and
+// pending tags to the current head.
+func (api *PrivateDebugAPI) blockByNumber(number rpc.BlockNumber) (*types.Block, error) {
+	var block *types.Block
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		block = api.eth.BlockChain().CurrentBlock()
+	} else {
+		block = api.eth.BlockChain().GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return block, nil
+}
+
+// traceDatabase is an in-memory overlay on top of the chain database, which
+// accumulates the state generated while re-executing a chain segment without
+// persisting any of it to disk.
+type traceDatabase struct {
+	ethdb.Database                    // Chain database to fall back to for reads
+	mem            *ethdb.MemDatabase // Locally generated state
+}
+
+// newTraceDatabase creates an empty in-memory overlay on top of the database.
+func newTraceDatabase(db ethdb.Database) *traceDatabase {
+	mem, _ := ethdb.NewMemDatabase()
+	return &traceDatabase{Database: db, mem: mem}
+}
+
+// Put stores the value into the overlay.
+func (db *traceDatabase) Put(key []byte, value []byte) error {
+	return db.mem.Put(key, value)
+}
+
+// Get retrieves a value from the overlay, falling back to the chain database.
+func (db *traceDatabase) Get(key []byte) ([]byte, error) {
+	if value, err := db.mem.Get(key); err == nil {
+		return value, nil
+	}
+	return db.Database.Get(key)
+}
+
+// Delete removes a value from the overlay. The chain database is never touched.
+func (db *traceDatabase) Delete(key []byte) error {
+	return db.mem.Delete(key)
+}
+
+// NewBatch creates a write batch flushing into the overlay.
+func (db *traceDatabase) NewBatch() ethdb.Batch {
+	return db.mem.NewBatch()
+}
+
+// Close does nothing, the chain database is owned by the node.
+func (db *traceDatabase) Close() {}
@@ -0,0 +1,291 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/net/context"
+)
+
+// Tests that a chain segment can be traced through an RPC subscription, with the
+// results of all non-empty blocks (and the last one) streamed in order.
+func TestTraceChain(t *testing.T) {
+	// Create a chain where every odd block contains a value transfer
+	var (
+		db, _       = ethdb.NewMemDatabase()
+		genesis     = core.WriteGenesisBlockForTesting(db, testBank)
+		chainConfig = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		engine      = ethash.NewFaker()
+		signer      = types.HomesteadSigner{}
+		recipient   = common.HexToAddress("0xdeadbeef")
+	)
+	blockchain, _ := core.NewBlockChain(db, nil, chainConfig, engine, new(event.TypeMux), vm.Config{})
+	chain, _ := core.GenerateChain(chainConfig, genesis, engine, db, 10, func(i int, block *core.BlockGen) {
+		if i%2 == 0 {
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBank.Address), recipient, big.NewInt(1000), bigTxGas, nil, nil), signer, testBankKey)
+			block.AddTx(tx)
+		}
+	})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Expose the debug API over an in-process RPC connection
+	eth := &Ethereum{chainConfig: chainConfig, chainDb: db, blockchain: blockchain}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("debug", NewPrivateDebugAPI(chainConfig, eth)); err != nil {
+		t.Fatalf("failed to register debug API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	tracer := ethapi.CallTracerName
+	for i, config := range []*TraceArgs{nil, {Tracer: &tracer}} {
+		results := make(chan *ChainTraceResult)
+		sub, err := client.Subscribe(context.Background(), "debug", results, "traceChain", rpc.BlockNumber(2), rpc.BlockNumber(9), config)
+		if err != nil {
+			t.Fatalf("config %d: failed to subscribe: %v", i, err)
+		}
+		// Blocks 3, 5 and 7 contain transactions, block 9 is the last one
+		for _, number := range []uint64{3, 5, 7, 9} {
+			select {
+			case res := <-results:
+				if uint64(res.Block) != number || res.Hash != chain[number-1].Hash() {
+					t.Fatalf("config %d: block mismatch: have #%d [%x], want #%d [%x]", i, res.Block, res.Hash, number, chain[number-1].Hash())
+				}
+				if len(res.Traces) != 1 {
+					t.Fatalf("config %d, block %d: trace count mismatch: have %d, want %d", i, number, len(res.Traces), 1)
+				}
+				if res.Traces[0].Error != "" {
+					t.Fatalf("config %d, block %d: tracing failed: %v", i, number, res.Traces[0].Error)
+				}
+				blob, _ := json.Marshal(res.Traces[0].Result)
+				switch config {
+				case nil:
+					var result ethapi.ExecutionResult
+					if err := json.Unmarshal(blob, &result); err != nil {
+						t.Fatalf("config %d, block %d: failed to decode struct logs: %v", i, number, err)
+					}
+					if result.Gas.Cmp(bigTxGas) != 0 {
+						t.Errorf("config %d, block %d: gas mismatch: have %v, want %v", i, number, result.Gas, params.TxGas)
+					}
+				default:
+					var result ethapi.CallFrame
+					if err := json.Unmarshal(blob, &result); err != nil {
+						t.Fatalf("config %d, block %d: failed to decode call frame: %v", i, number, err)
+					}
+					if result.Type != "CALL" || result.From != testBank.Address || *result.To != recipient {
+						t.Errorf("config %d, block %d: call mismatch: have %s %x -> %x", i, number, result.Type, result.From, *result.To)
+					}
+				}
+			case err := <-sub.Err():
+				t.Fatalf("config %d: subscription failed: %v", i, err)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("config %d: timeout waiting for block #%d", i, number)
+			}
+		}
+		sub.Unsubscribe()
+	}
+}
+
+// Tests that a call can be traced on top of a generated chain's state, both with
+// the default struct logger and with a custom javascript tracer.
+func TestTraceCall(t *testing.T) {
+	// Create a chain with a contract returning the number 42 on every call
+	var (
+		db, _       = ethdb.NewMemDatabase()
+		genesis     = core.WriteGenesisBlockForTesting(db, testBank)
+		chainConfig = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		engine      = ethash.NewFaker()
+		signer      = types.HomesteadSigner{}
+		contract    = crypto.CreateAddress(testBank.Address, 0)
+
+		// PUSH1 0x2a PUSH1 0 MSTORE PUSH1 0x20 PUSH1 0 RETURN
+		runtime = common.Hex2Bytes("602a60005260206000f3")
+		// PUSH10 <runtime> PUSH1 0 MSTORE PUSH1 10 PUSH1 22 RETURN
+		initcode = append(append([]byte{0x69}, runtime...), common.Hex2Bytes("600052600a6016f3")...)
+	)
+	blockchain, _ := core.NewBlockChain(db, nil, chainConfig, engine, new(event.TypeMux), vm.Config{})
+	chain, _ := core.GenerateChain(chainConfig, genesis, engine, db, 1, func(i int, block *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewContractCreation(block.TxNonce(testBank.Address), new(big.Int), big.NewInt(100000), nil, initcode), signer, testBankKey)
+		block.AddTx(tx)
+	})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Expose the debug API over an in-process RPC connection
+	eth := &Ethereum{chainConfig: chainConfig, chainDb: db, blockchain: blockchain}
+	eth.ApiBackend = &EthApiBackend{eth, nil}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("debug", NewPrivateDebugAPI(chainConfig, eth)); err != nil {
+		t.Fatalf("failed to register debug API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	call := ethapi.CallArgs{From: testBank.Address, To: &contract}
+	want := []string{"PUSH1", "PUSH1", "MSTORE", "PUSH1", "PUSH1", "RETURN"}
+
+	// Trace the call with the struct logger and check the executed opcodes
+	var result ethapi.ExecutionResult
+	if err := client.Call(&result, "debug_traceCall", call, "latest", nil); err != nil {
+		t.Fatalf("failed to trace call with struct logger: %v", err)
+	}
+	if have := common.Hex2Bytes(result.ReturnValue); new(big.Int).SetBytes(have).Uint64() != 42 || len(have) != 32 {
+		t.Errorf("return value mismatch: have %s, want 42", result.ReturnValue)
+	}
+	if len(result.StructLogs) != len(want) {
+		t.Fatalf("struct log count mismatch: have %d, want %d", len(result.StructLogs), len(want))
+	}
+	for i, log := range result.StructLogs {
+		if log.Op != want[i] {
+			t.Errorf("struct log %d: opcode mismatch: have %s, want %s", i, log.Op, want[i])
+		}
+	}
+	// Trace the call with a javascript tracer and check the collected opcodes
+	tracer := "{ops: [], step: function(log) { this.ops.push(log.op.toString()); }, result: function() { return this.ops; }}"
+
+	var ops []string
+	if err := client.Call(&ops, "debug_traceCall", call, "latest", &TraceArgs{Tracer: &tracer}); err != nil {
+		t.Fatalf("failed to trace call with javascript tracer: %v", err)
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("javascript trace mismatch: have %v, want %v", ops, want)
+	}
+	// Tracing on top of the genesis state must not find any code to execute
+	var empty ethapi.ExecutionResult
+	if err := client.Call(&empty, "debug_traceCall", call, rpc.BlockNumber(0), nil); err != nil {
+		t.Fatalf("failed to trace call on genesis: %v", err)
+	}
+	if len(empty.StructLogs) != 0 {
+		t.Errorf("genesis struct log count mismatch: have %d, want 0", len(empty.StructLogs))
+	}
+}
+
+// Tests that if tracing a transaction of a block fails, all subsequent ones are
+// reported as skipped instead of being left without results.
+func TestTraceChainTaskFailure(t *testing.T) {
+	// Create a single block containing multiple value transfers
+	var (
+		db, _       = ethdb.NewMemDatabase()
+		genesis     = core.WriteGenesisBlockForTesting(db, testBank)
+		chainConfig = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		engine      = ethash.NewFaker()
+		signer      = types.HomesteadSigner{}
+		recipient   = common.HexToAddress("0xdeadbeef")
+	)
+	blockchain, _ := core.NewBlockChain(db, nil, chainConfig, engine, new(event.TypeMux), vm.Config{})
+	chain, _ := core.GenerateChain(chainConfig, genesis, engine, db, 1, func(i int, block *core.BlockGen) {
+		for j := 0; j < 3; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBank.Address), recipient, big.NewInt(1000), bigTxGas, nil, nil), signer, testBankKey)
+			block.AddTx(tx)
+		}
+	})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	api := NewPrivateDebugAPI(chainConfig, &Ethereum{chainConfig: chainConfig, chainDb: db, blockchain: blockchain})
+
+	// Trace the block with a tracer that cannot be created
+	tracer, timeout := ethapi.CallTracerName, "invalid"
+	task := &chainTraceTask{db: db, root: genesis.Root(), block: chain[0], results: make([]*TxTraceResult, 3)}
+	api.traceChainTask(task, &TraceArgs{Tracer: &tracer, Timeout: &timeout})
+
+	if task.results[0] == nil || task.results[0].Error == "" {
+		t.Fatalf("tx 0: expected tracing failure, have %+v", task.results[0])
+	}
+	for i := 1; i < len(task.results); i++ {
+		if task.results[i] == nil {
+			t.Fatalf("tx %d: missing trace result", i)
+		}
+		if want := "skipped after failure at tx 0"; task.results[i].Error != want {
+			t.Errorf("tx %d: error mismatch: have %q, want %q", i, task.results[i].Error, want)
+		}
+	}
+}
+
+// Tests that a transaction is traced on top of the state produced by all the
+// preceding transactions of its block.
+func TestTraceTransaction(t *testing.T) {
+	// Create a block with multiple value transfers from the same account
+	var (
+		db, _       = ethdb.NewMemDatabase()
+		genesis     = core.WriteGenesisBlockForTesting(db, testBank)
+		chainConfig = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		engine      = ethash.NewFaker()
+		signer      = types.HomesteadSigner{}
+		recipient   = common.HexToAddress("0xdeadbeef")
+		txs         []*types.Transaction
+	)
+	blockchain, _ := core.NewBlockChain(db, nil, chainConfig, engine, new(event.TypeMux), vm.Config{})
+	chain, _ := core.GenerateChain(chainConfig, genesis, engine, db, 1, func(i int, block *core.BlockGen) {
+		for j := 0; j < 3; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testBank.Address), recipient, big.NewInt(int64(j+1)), bigTxGas, nil, nil), signer, testBankKey)
+			block.AddTx(tx)
+			txs = append(txs, tx)
+		}
+	})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	api := NewPrivateDebugAPI(chainConfig, &Ethereum{chainConfig: chainConfig, chainDb: db, blockchain: blockchain})
+
+	tracer := ethapi.CallTracerName
+	for i, tx := range txs {
+		res, err := api.TraceTransaction(context.Background(), tx.Hash(), &TraceArgs{Tracer: &tracer})
+		if err != nil {
+			t.Fatalf("tx %d: failed to trace: %v", i, err)
+		}
+		blob, _ := json.Marshal(res)
+
+		var frame ethapi.CallFrame
+		if err := json.Unmarshal(blob, &frame); err != nil {
+			t.Fatalf("tx %d: failed to decode call frame: %v", i, err)
+		}
+		if frame.From != testBank.Address || *frame.To != recipient || frame.Error != "" {
+			t.Errorf("tx %d: call mismatch: have %x -> %x (%s)", i, frame.From, *frame.To, frame.Error)
+		}
+		if frame.Value == nil || frame.Value.ToInt().Cmp(tx.Value()) != 0 {
+			t.Errorf("tx %d: value mismatch: have %v, want %v", i, frame.Value, tx.Value())
+		}
+		// The state before each transfer must contain all the preceding ones
+		stateDb, err := api.stateAtTransaction(chain[0], i)
+		if err != nil {
+			t.Fatalf("tx %d: failed to recreate state: %v", i, err)
+		}
+		if have, want := stateDb.GetBalance(recipient), big.NewInt(int64(i*(i+1)/2)); have.Cmp(want) != 0 {
+			t.Errorf("tx %d: recipient balance mismatch: have %v, want %v", i, have, want)
+		}
+	}
+}
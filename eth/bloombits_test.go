@@ -0,0 +1,78 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the bloom indexer only processes confirmed sections, storing the
+// rotated bloom bits of the section into the database.
+func TestBloomIndexer(t *testing.T) {
+	var (
+		db, _   = ethdb.NewMemDatabase()
+		mux     = new(event.TypeMux)
+		genesis = core.WriteGenesisBlockForTesting(db)
+	)
+	chain, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, int(params.BloomBitsBlocks+bloomConfirms-1), func(i int, gen *core.BlockGen) {})
+
+	// Insert all but the last block, leaving the first section unconfirmed
+	for _, block := range chain[:len(chain)-1] {
+		if err := core.WriteHeader(db, block.Header()); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		core.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+	}
+	indexer := NewBloomIndexer(db, params.BloomBitsBlocks)
+	defer indexer.Close()
+
+	indexer.Start(chain[len(chain)-2].Header(), mux)
+
+	time.Sleep(100 * time.Millisecond)
+	if sections, _, _ := indexer.Sections(); sections != 0 {
+		t.Fatalf("unconfirmed section indexed: have %d sections, want %d", sections, 0)
+	}
+	// Insert the last block, confirming the first section
+	head := chain[len(chain)-1]
+	core.WriteHeader(db, head.Header())
+	core.WriteCanonicalHash(db, head.Hash(), head.NumberU64())
+	mux.Post(core.ChainHeadEvent{Block: head})
+
+	for i := 0; ; i++ {
+		if sections, _, _ := indexer.Sections(); sections == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("confirmed section not indexed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	last := core.GetCanonicalHash(db, params.BloomBitsBlocks-1)
+	for bit := uint(0); bit < types.BloomBitLength; bit++ {
+		if _, err := core.GetBloomBits(db, bit, 0, last); err != nil {
+			t.Fatalf("bloom bit %d: vector missing: %v", bit, err)
+		}
+	}
+}
@@ -103,6 +103,10 @@ type queue struct {
 	stateScheduler *state.StateSync // [eth/63] State trie synchronisation scheduler and integrator
 	stateWriters   int              // [eth/63] Number of running state DB writer goroutines
 
+	stateSyncer     StateSyncer   // [snap] Range based state syncer to run before node data retrieval
+	stateSyncCancel chan struct{} // [snap] Channel to abort the running range based state sync
+	stateSyncs      int           // [snap] Number of running range based state syncs
+
 	resultCache  []*fetchResult // Downloaded but not yet delivered fetch results
 	resultOffset uint64         // Offset of the first cached fetch result in the block chain
 
@@ -112,7 +116,7 @@ type queue struct {
 }
 
 // newQueue creates a new download queue for scheduling block retrieval.
-func newQueue(stateDb ethdb.Database) *queue {
+func newQueue(stateDb ethdb.Database, stateSyncer StateSyncer) *queue {
 	lock := new(sync.Mutex)
 	return &queue{
 		headerPendPool:   make(map[string]*fetchRequest),
@@ -129,6 +133,7 @@ func newQueue(stateDb ethdb.Database) *queue {
 		stateTaskQueue:   prque.New(),
 		statePendPool:    make(map[string]*fetchRequest),
 		stateDatabase:    stateDb,
+		stateSyncer:      stateSyncer,
 		resultCache:      make([]*fetchResult, blockCacheLimit),
 		active:           sync.NewCond(lock),
 		lock:             lock,
@@ -163,6 +168,7 @@ func (q *queue) Reset() {
 	q.stateTaskQueue.Reset()
 	q.statePendPool = make(map[string]*fetchRequest)
 	q.stateScheduler = nil
+	q.abortStateSync()
 
 	q.resultCache = make([]*fetchResult, blockCacheLimit)
 	q.resultOffset = 0
@@ -173,6 +179,7 @@ func (q *queue) Reset() {
 func (q *queue) Close() {
 	q.lock.Lock()
 	q.closed = true
+	q.abortStateSync()
 	q.lock.Unlock()
 	q.active.Broadcast()
 }
@@ -217,7 +224,7 @@ func (q *queue) pendingNodeDataLocked() int {
 		n = q.stateScheduler.Pending()
 	}
 	// Ensure that PendingNodeData doesn't return 0 until all state is written.
-	if q.stateWriters > 0 {
+	if q.stateWriters > 0 || q.stateSyncs > 0 {
 		n++
 	}
 	return n
@@ -256,7 +263,7 @@ func (q *queue) InFlightNodeData() bool {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 
-	return len(q.statePendPool)+q.stateWriters > 0
+	return len(q.statePendPool)+q.stateWriters+q.stateSyncs > 0
 }
 
 // Idle returns if the queue is fully idle or has some data still inside. This
@@ -272,6 +279,7 @@ func (q *queue) Idle() bool {
 	if q.stateScheduler != nil {
 		queued += q.stateScheduler.Pending()
 	}
+	queued += q.stateSyncs
 	return (queued + pending + cached) == 0
 }
 
@@ -400,7 +408,7 @@ func (q *queue) Schedule(headers []*types.Header, from uint64) []*types.Header {
 				req.Hashes = make(map[common.Hash]int) // Make sure executing requests fail, but don't disappear
 			}
 
-			q.stateScheduler = state.NewStateSync(header.Root, q.stateDatabase)
+			q.scheduleStateSync(header.Root)
 		}
 		inserts = append(inserts, header)
 		q.headerHead = hash
@@ -1137,6 +1145,56 @@ func (q *queue) Prepare(offset uint64, mode SyncMode, pivot uint64, head *types.
 
 	// If long running fast sync, also start up a head stateretrieval immediately
 	if mode == FastSync && pivot > 0 {
-		q.stateScheduler = state.NewStateSync(head.Root, q.stateDatabase)
+		q.scheduleStateSync(head.Root)
+	}
+}
+
+// scheduleStateSync switches the state retrieval over to the given root. If a
+// range based state syncer is configured, the bulk of the state is retrieved by
+// it first and node data retrieval only picks up whatever it left out.
+//
+// The caller must hold q.lock.
+func (q *queue) scheduleStateSync(root common.Hash) {
+	q.abortStateSync()
+	if q.stateSyncer == nil {
+		q.stateScheduler = state.NewStateSync(root, q.stateDatabase)
+		return
+	}
+	q.stateScheduler = nil
+	q.stateSyncCancel = make(chan struct{})
+	q.stateSyncs++
+
+	go q.runStateSync(root, q.stateSyncCancel)
+}
+
+// runStateSync runs a range based state sync for the given root, and schedules
+// node data retrieval for the remainder once it's done.
+func (q *queue) runStateSync(root common.Hash, cancel chan struct{}) {
+	err := q.stateSyncer.Sync(root, cancel)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.stateSyncs--
+	select {
+	case <-cancel:
+		// Sync aborted or superseded by a new root, nothing left to do
+		return
+	default:
+	}
+	if err != nil {
+		log.Debug("Range based state sync failed, retrieving node data", "root", root, "err", err)
+	}
+	q.stateSyncCancel = nil
+	q.stateScheduler = state.NewStateSync(root, q.stateDatabase)
+}
+
+// abortStateSync cancels any running range based state sync.
+//
+// The caller must hold q.lock.
+func (q *queue) abortStateSync() {
+	if q.stateSyncCancel != nil {
+		close(q.stateSyncCancel)
+		q.stateSyncCancel = nil
 	}
 }
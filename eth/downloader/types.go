@@ -66,6 +66,14 @@ type chainRollbackFn func([]common.Hash)
 // peerDropFn is a callback type for dropping a peer detected as malicious.
 type peerDropFn func(id string)
 
+// StateSyncer is a range based state retriever (e.g. snap) that fast sync can use
+// to download the bulk of the state before falling back to node data retrieval.
+type StateSyncer interface {
+	// Sync retrieves the state rooted at the given hash, returning when the state
+	// is complete, cannot be continued any more, or the cancel channel is closed.
+	Sync(root common.Hash, cancel chan struct{}) error
+}
+
 // dataPack is a data message returned by a peer for some query.
 type dataPack interface {
 	PeerId() string
@@ -25,7 +25,10 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
@@ -34,8 +37,9 @@ import (
 )
 
 type testBackend struct {
-	mux *event.TypeMux
-	db  ethdb.Database
+	mux      *event.TypeMux
+	db       ethdb.Database
+	sections uint64
 }
 
 func (b *testBackend) ChainDb() ethdb.Database {
@@ -64,6 +68,43 @@ func (b *testBackend) GetReceipts(ctx context.Context, blockHash common.Hash) (t
 	return core.GetBlockReceipts(b.db, blockHash, num), nil
 }
 
+func (b *testBackend) BloomStatus() (uint64, uint64) {
+	return params.BloomBitsBlocks, b.sections
+}
+
+func (b *testBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
+	requests := make(chan chan *bloombits.Retrieval)
+
+	go session.Multiplex(16, 0, requests)
+	go func() {
+		for {
+			// Wait for a service request or a shutdown
+			select {
+			case <-ctx.Done():
+				return
+
+			case request := <-requests:
+				task := <-request
+
+				task.Bitsets = make([][]byte, len(task.Sections))
+				for i, section := range task.Sections {
+					head := core.GetCanonicalHash(b.db, (section+1)*params.BloomBitsBlocks-1)
+					blob, err := core.GetBloomBits(b.db, task.Bit, section, head)
+					if err != nil {
+						task.Error = err
+						break
+					}
+					if task.Bitsets[i], err = bitutil.DecompressBytes(blob, int(params.BloomBitsBlocks)/8); err != nil {
+						task.Error = err
+						break
+					}
+				}
+				request <- task
+			}
+		}
+	}()
+}
+
 // TestBlockSubscription tests if a block subscription returns block hashes for posted chain events.
 // It creates multiple subscriptions:
 // - one at the start and should receive all posted chain events and a second (blockHashes)
@@ -75,11 +116,11 @@ func TestBlockSubscription(t *testing.T) {
 	var (
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
-		backend = &testBackend{mux, db}
+		backend = &testBackend{mux, db, 0}
 		api     = NewPublicFilterAPI(backend, false)
 
 		genesis     = core.WriteGenesisBlockForTesting(db)
-		chain, _    = core.GenerateChain(params.TestChainConfig, genesis, db, 10, func(i int, gen *core.BlockGen) {})
+		chain, _    = core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {})
 		chainEvents = []core.ChainEvent{}
 	)
 
@@ -129,7 +170,7 @@ func TestPendingTxFilter(t *testing.T) {
 	var (
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
-		backend = &testBackend{mux, db}
+		backend = &testBackend{mux, db, 0}
 		api     = NewPublicFilterAPI(backend, false)
 
 		transactions = []*types.Transaction{
@@ -179,7 +220,7 @@ func TestLogFilterCreation(t *testing.T) {
 	var (
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
-		backend = &testBackend{mux, db}
+		backend = &testBackend{mux, db, 0}
 		api     = NewPublicFilterAPI(backend, false)
 
 		testCases = []struct {
@@ -224,7 +265,7 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 	var (
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
-		backend = &testBackend{mux, db}
+		backend = &testBackend{mux, db, 0}
 		api     = NewPublicFilterAPI(backend, false)
 	)
 
@@ -250,7 +291,7 @@ func TestLogFilter(t *testing.T) {
 	var (
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
-		backend = &testBackend{mux, db}
+		backend = &testBackend{mux, db, 0}
 		api     = NewPublicFilterAPI(backend, false)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
@@ -358,7 +399,7 @@ func TestPendingLogsSubscription(t *testing.T) {
 	var (
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
-		backend = &testBackend{mux, db}
+		backend = &testBackend{mux, db, 0}
 		api     = NewPublicFilterAPI(backend, false)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
@@ -0,0 +1,370 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	softResponseLimit = 2 * 1024 * 1024 // Target maximum size of returned data, and the default for requests
+
+	maxCodeLookups     = 1024 // Maximum number of bytecodes to serve in one request
+	maxTrieNodeLookups = 1024 // Maximum number of state trie nodes to serve in one request
+)
+
+// Handler serves snap protocol requests out of the local state database and
+// routes all received responses to the state syncer.
+type Handler struct {
+	db     ethdb.Database // State database (usually the blockchain's trie cache) to serve from
+	syncer *Syncer        // State syncer to deliver responses to, nil if not syncing
+}
+
+// NewHandler creates a snap protocol handler serving state from db. If syncer
+// is non-nil, connecting peers are registered with it as state sources.
+func NewHandler(db ethdb.Database, syncer *Syncer) *Handler {
+	return &Handler{
+		db:     db,
+		syncer: syncer,
+	}
+}
+
+// Protocols returns the snap sub-protocols to register with the p2p server.
+func (h *Handler) Protocols() []p2p.Protocol {
+	protocols := make([]p2p.Protocol, 0, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		version := version // Closure for the run
+		protocols = append(protocols, p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  ProtocolLengths[i],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return h.handle(newPeer(int(version), p, rw))
+			},
+		})
+	}
+	return protocols
+}
+
+// handle is the callback invoked to manage the life cycle of a snap peer. When
+// this function terminates, the peer is disconnected.
+func (h *Handler) handle(p *Peer) error {
+	p.logger.Debug("Snapshot peer connected", "name", p.Name())
+
+	if h.syncer != nil {
+		if err := h.syncer.Register(p); err != nil {
+			p.logger.Error("Snapshot peer registration failed", "err", err)
+			return err
+		}
+		defer h.syncer.Unregister(p.id)
+	}
+	for {
+		if err := h.handleMsg(p); err != nil {
+			p.logger.Debug("Snapshot message handling failed", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMsg is invoked whenever an inbound message is received from a remote
+// peer. The remote connection is torn down upon returning any error.
+func (h *Handler) handleMsg(p *Peer) error {
+	// Read the next message from the remote peer, and ensure it's fully consumed
+	msg, err := p.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return fmt.Errorf("%v: %v > %v", errMsgTooLarge, msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	// Handle the message depending on its contents
+	switch msg.Code {
+	case GetAccountRangeMsg:
+		var req getAccountRangeData
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		accounts, proof := h.serviceAccountRange(&req)
+		return p2p.Send(p.rw, AccountRangeMsg, &accountRangeData{
+			ID:       req.ID,
+			Accounts: accounts,
+			Proof:    proof,
+		})
+
+	case AccountRangeMsg:
+		var res accountRangeData
+		if err := msg.Decode(&res); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		if h.syncer == nil {
+			return nil
+		}
+		hashes := make([]common.Hash, len(res.Accounts))
+		accounts := make([][]byte, len(res.Accounts))
+		for i, acc := range res.Accounts {
+			hashes[i], accounts[i] = acc.Hash, acc.Body
+		}
+		return h.syncer.OnAccounts(p, res.ID, hashes, accounts, res.Proof)
+
+	case GetStorageRangesMsg:
+		var req getStorageRangesData
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		slots, proof := h.serviceStorageRanges(&req)
+		return p2p.Send(p.rw, StorageRangesMsg, &storageRangesData{
+			ID:    req.ID,
+			Slots: slots,
+			Proof: proof,
+		})
+
+	case StorageRangesMsg:
+		var res storageRangesData
+		if err := msg.Decode(&res); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		if h.syncer == nil {
+			return nil
+		}
+		hashes := make([][]common.Hash, len(res.Slots))
+		slots := make([][][]byte, len(res.Slots))
+		for i, storage := range res.Slots {
+			hashes[i] = make([]common.Hash, len(storage))
+			slots[i] = make([][]byte, len(storage))
+			for j, slot := range storage {
+				hashes[i][j], slots[i][j] = slot.Hash, slot.Body
+			}
+		}
+		return h.syncer.OnStorage(p, res.ID, hashes, slots, res.Proof)
+
+	case GetByteCodesMsg:
+		var req getByteCodesData
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		return p2p.Send(p.rw, ByteCodesMsg, &byteCodesData{
+			ID:    req.ID,
+			Codes: h.serviceBlobs(req.Hashes, req.Bytes, maxCodeLookups),
+		})
+
+	case ByteCodesMsg:
+		var res byteCodesData
+		if err := msg.Decode(&res); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		if h.syncer == nil {
+			return nil
+		}
+		return h.syncer.OnByteCodes(p, res.ID, res.Codes)
+
+	case GetTrieNodesMsg:
+		var req getTrieNodesData
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		return p2p.Send(p.rw, TrieNodesMsg, &trieNodesData{
+			ID:    req.ID,
+			Nodes: h.serviceBlobs(req.Hashes, req.Bytes, maxTrieNodeLookups),
+		})
+
+	case TrieNodesMsg:
+		var res trieNodesData
+		if err := msg.Decode(&res); err != nil {
+			return fmt.Errorf("%v: %v: %v", errDecode, msg, err)
+		}
+		if h.syncer == nil {
+			return nil
+		}
+		return h.syncer.OnTrieNodes(p, res.ID, res.Nodes)
+
+	default:
+		return fmt.Errorf("%v: %v", errInvalidMsgCode, msg.Code)
+	}
+}
+
+// serviceAccountRange assembles the response to an account range query. If the
+// requested state is not available, an empty response is returned.
+func (h *Handler) serviceAccountRange(req *getAccountRangeData) ([]*accountData, [][]byte) {
+	if req.Bytes > softResponseLimit {
+		req.Bytes = softResponseLimit
+	}
+	tr, err := trie.New(req.Root, h.db)
+	if err != nil {
+		return nil, nil
+	}
+	// Gather accounts until the limit is passed or the response is full
+	var (
+		accounts []*accountData
+		size     uint64
+	)
+	err = iterateRange(tr, req.Origin, func(hash common.Hash, blob []byte) bool {
+		accounts = append(accounts, &accountData{Hash: hash, Body: common.CopyBytes(blob)})
+		size += uint64(common.HashLength + len(blob))
+
+		return bytes.Compare(hash[:], req.Limit[:]) < 0 && size < req.Bytes
+	})
+	if err != nil {
+		return nil, nil
+	}
+	// Prove the range from the origin to the last returned account
+	last := req.Origin
+	if len(accounts) > 0 {
+		last = accounts[len(accounts)-1].Hash
+	}
+	return accounts, toBytes(tr.ProveRange(req.Origin[:], last[:]))
+}
+
+// serviceStorageRanges assembles the response to a storage ranges query. Tries
+// are served in full until the response is full; the last one may be served
+// partially, in which case a proof is attached to it.
+func (h *Handler) serviceStorageRanges(req *getStorageRangesData) ([][]*storageData, [][]byte) {
+	if req.Bytes > softResponseLimit {
+		req.Bytes = softResponseLimit
+	}
+	var (
+		slots [][]*storageData
+		size  uint64
+	)
+	for i, root := range req.Roots {
+		if size >= req.Bytes {
+			break
+		}
+		var origin common.Hash
+		if i == 0 {
+			origin = req.Origin
+		}
+		tr, err := trie.New(root, h.db)
+		if err != nil {
+			break
+		}
+		var (
+			storage []*storageData
+			more    bool
+		)
+		err = iterateRange(tr, origin, func(hash common.Hash, blob []byte) bool {
+			if size >= req.Bytes {
+				more = true
+				return false
+			}
+			storage = append(storage, &storageData{Hash: hash, Body: common.CopyBytes(blob)})
+			size += uint64(common.HashLength + len(blob))
+			return true
+		})
+		if err != nil {
+			break
+		}
+		slots = append(slots, storage)
+
+		// If the storage range is partial, prove it and stop serving
+		if origin != (common.Hash{}) || more {
+			last := origin
+			if len(storage) > 0 {
+				last = storage[len(storage)-1].Hash
+			}
+			return slots, toBytes(tr.ProveRange(origin[:], last[:]))
+		}
+	}
+	return slots, nil
+}
+
+// serviceBlobs retrieves the database entries (bytecodes or trie nodes) for the
+// requested hashes, skipping any unknown ones.
+func (h *Handler) serviceBlobs(hashes []common.Hash, limit uint64, maxLookups int) [][]byte {
+	if limit > softResponseLimit {
+		limit = softResponseLimit
+	}
+	if len(hashes) > maxLookups {
+		hashes = hashes[:maxLookups]
+	}
+	var (
+		blobs [][]byte
+		size  uint64
+	)
+	for _, hash := range hashes {
+		if blob, err := h.db.Get(hash[:]); err == nil && len(blob) > 0 {
+			blobs = append(blobs, blob)
+			size += uint64(len(blob))
+		}
+		if size >= limit {
+			break
+		}
+	}
+	return blobs
+}
+
+// iterateRange walks the leaves of a trie with 32 byte keys in ascending order,
+// starting at origin, until fn returns false. Subtries lying completely before
+// the origin are skipped without being resolved.
+func iterateRange(tr *trie.Trie, origin common.Hash, fn func(hash common.Hash, blob []byte) bool) error {
+	start := keybytesToHex(origin[:])
+
+	it := trie.NewNodeIterator(tr)
+	for descend := true; it.Next(descend); {
+		path := it.Path()
+		if n := len(path); n <= len(start) && bytes.Compare(path, start[:n]) < 0 {
+			descend = false
+			continue
+		}
+		descend = true
+
+		if it.Leaf() {
+			if len(path) != len(start) {
+				return errBadRequest
+			}
+			if !fn(hexToHash(path), it.LeafBlob()) {
+				return nil
+			}
+		}
+	}
+	return it.Error()
+}
+
+// keybytesToHex expands a key into its nibbles (without terminator).
+func keybytesToHex(key []byte) []byte {
+	nibbles := make([]byte, len(key)*2)
+	for i, b := range key {
+		nibbles[i*2] = b / 16
+		nibbles[i*2+1] = b % 16
+	}
+	return nibbles
+}
+
+// hexToHash compacts a full length nibble path back into a hash.
+func hexToHash(nibbles []byte) (hash common.Hash) {
+	for i := range hash {
+		hash[i] = nibbles[i*2]<<4 | nibbles[i*2+1]
+	}
+	return hash
+}
+
+// toBytes converts a list of trie nodes to its network representation.
+func toBytes(nodes []rlp.RawValue) [][]byte {
+	blobs := make([][]byte, len(nodes))
+	for i, node := range nodes {
+		blobs[i] = node
+	}
+	return blobs
+}
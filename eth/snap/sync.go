@@ -0,0 +1,1149 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+)
+
+const (
+	// accountConcurrency is the number of chunks to split the account trie into
+	// to allow concurrent retrievals.
+	accountConcurrency = 16
+
+	// maxStorageRequestCount is the maximum number of storage tries to request
+	// in a single query.
+	maxStorageRequestCount = 128
+
+	// maxCodeRequestCount is the maximum number of bytecodes to request in a
+	// single query.
+	maxCodeRequestCount = 64
+
+	// maxTrieRequestCount is the maximum number of trie nodes to request in a
+	// single query while healing.
+	maxTrieRequestCount = 256
+
+	// commitThreshold is the number of leaves to insert into a trie being
+	// assembled before flushing it to the database.
+	commitThreshold = 16384
+)
+
+var (
+	// requestTimeout is the maximum time a peer is allowed to spend on serving
+	// a single request before it's considered failed.
+	requestTimeout = 10 * time.Second
+
+	// requestBytes is the soft response size limit to request from peers.
+	requestBytes = uint64(softResponseLimit)
+)
+
+var (
+	errCancelled         = errors.New("sync cancelled")
+	errStateUnavailable  = errors.New("no peers available to serve the state")
+	errAlreadyRegistered = errors.New("peer is already registered")
+	errNotRegistered     = errors.New("peer is not registered")
+)
+
+// Request kinds tracked by the syncer.
+const (
+	accountRequest = iota
+	storageRequest
+	codeRequest
+	healRequest
+)
+
+// request tracks a pending query sent to a remote peer.
+type request struct {
+	id   uint64 // Request ID of this request
+	kind int    // Type of the request (account, storage, code or heal)
+	peer string // Peer to which this request is assigned
+
+	root   common.Hash   // State root the accounts are requested from (account only)
+	task   *accountTask  // Account range task this request belongs to (account only)
+	origin common.Hash   // First account or storage slot requested
+	limit  common.Hash   // Last account requested (account only)
+	hashes []common.Hash // Storage roots, code hashes or trie nodes requested
+
+	timeout *time.Timer   // Timer to track delivery timeout
+	stale   chan struct{} // Channel to signal the sync cycle has ended
+}
+
+// response is a verified reply to a request, waiting to be processed by the
+// sync loop.
+type response struct {
+	req *request
+
+	hashes   []common.Hash // Account hashes in an account range response
+	accounts [][]byte      // Account bodies in an account range response
+	cont     bool          // Whether the account range or last storage range has more leaves
+
+	complete []*trie.Trie  // Fully retrieved and verified storage tries
+	partial  []common.Hash // Slot hashes of the last, partially retrieved storage trie
+	slots    [][]byte      // Slot values of the last, partially retrieved storage trie
+	blobs    [][]byte      // Bytecodes or trie nodes, in requested order
+	missing  []common.Hash // Requested items the peer didn't deliver
+}
+
+// accountTask is a contiguous range of the account hash space to retrieve.
+type accountTask struct {
+	next common.Hash // Next account to retrieve in this range
+	last common.Hash // Last account to retrieve in this range
+	req  *request    // Pending request filling this task, if any
+	done bool        // Flag whether the range was fully retrieved
+}
+
+// accountBatch is a verified range of accounts waiting for its storage tries
+// and bytecodes to be retrieved before being inserted into the account trie.
+type accountBatch struct {
+	hashes   []common.Hash         // Account hashes of the batch
+	accounts [][]byte              // Account bodies of the batch
+	deps     map[common.Hash][]int // Missing storage roots and codes, mapped to dependent accounts
+	dropped  map[int]bool          // Accounts left for healing due to unavailable dependencies
+}
+
+// storageTask is a storage trie to retrieve.
+type storageTask struct {
+	root   common.Hash         // Root hash of the storage trie
+	next   common.Hash         // Next slot to retrieve if the trie is chunked
+	trie   *trie.Trie          // Partially assembled trie if it's chunked
+	failed map[string]struct{} // Peers that failed to deliver this trie
+}
+
+// Syncer is a state synchroniser which downloads the state trie of a given root
+// in contiguous, range proven leaf ranges instead of node by node. Any nodes
+// not covered by the ranges (e.g. because the root changed midway) are healed
+// afterwards using trie node retrievals.
+//
+// The syncer keeps its progress across sync cycles, so a cycle interrupted by
+// a new pivot root can be continued and healed with the new one.
+type Syncer struct {
+	db ethdb.Database // Database to store the trie nodes into (and dedup)
+
+	root        common.Hash    // Current state trie root being synced
+	tasks       []*accountTask // Account ranges to retrieve
+	accountTrie *trie.Trie     // Account trie being assembled from the ranges
+	accountDirt int            // Number of accounts inserted since the last flush
+
+	waiting      map[common.Hash][]*accountBatch     // Account batches waiting for a storage root or code
+	storageTasks map[common.Hash]*storageTask        // Storage tries scheduled for retrieval
+	storageQueue []common.Hash                       // Storage tries pending assignment
+	codeTasks    map[common.Hash]map[string]struct{} // Bytecodes scheduled for retrieval, with failed peers
+	codeQueue    []common.Hash                       // Bytecodes pending assignment
+
+	healer     *state.StateSync                    // Trie node scheduler for healing the state
+	healQueue  []common.Hash                       // Trie nodes pending assignment
+	healFailed map[common.Hash]map[string]struct{} // Peers failing to deliver specific trie nodes
+
+	responseCh chan *response // Verified responses to process
+	revertCh   chan *request  // Failed requests to reschedule
+	update     chan struct{}  // Notification channel for possible assignments
+
+	peers      map[string]*Peer    // Currently active peers to download from
+	idlers     map[string]struct{} // Peers that aren't serving requests
+	stateless  map[string]struct{} // Peers that don't have the current root
+	reqs       map[uint64]*request // Pending requests keyed by id
+	nextReqID  uint64              // Request ID counter
+	delivering int                 // Responses and reverts handed to the loop, but not yet processed
+	stale      chan struct{}       // Channel closed when the current cycle ends
+	lock       sync.Mutex          // Protects the peer and request sets
+	cycleLock  sync.Mutex          // Serializes concurrent sync cycles
+
+	accountSynced uint64 // Number of accounts retrieved (stats)
+	storageSynced uint64 // Number of storage tries retrieved (stats)
+	codeSynced    uint64 // Number of bytecodes retrieved (stats)
+	healSynced    uint64 // Number of trie nodes healed (stats)
+}
+
+// NewSyncer creates a new snapshot state syncer storing into db.
+func NewSyncer(db ethdb.Database) *Syncer {
+	return &Syncer{
+		db:         db,
+		responseCh: make(chan *response),
+		revertCh:   make(chan *request),
+		update:     make(chan struct{}, 1),
+		peers:      make(map[string]*Peer),
+		idlers:     make(map[string]struct{}),
+		stateless:  make(map[string]struct{}),
+		reqs:       make(map[uint64]*request),
+	}
+}
+
+// Register injects a new data source into the syncer's peerset.
+func (s *Syncer) Register(peer *Peer) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[peer.id]; ok {
+		return errAlreadyRegistered
+	}
+	s.peers[peer.id] = peer
+	s.idlers[peer.id] = struct{}{}
+
+	s.notify()
+	return nil
+}
+
+// Unregister removes a data source from the syncer's peerset, rescheduling any
+// requests it was serving.
+func (s *Syncer) Unregister(id string) error {
+	s.lock.Lock()
+	if _, ok := s.peers[id]; !ok {
+		s.lock.Unlock()
+		return errNotRegistered
+	}
+	delete(s.peers, id)
+	delete(s.idlers, id)
+	delete(s.stateless, id)
+
+	var reverts []*request
+	for reqid, req := range s.reqs {
+		if req.peer == id {
+			req.timeout.Stop()
+			delete(s.reqs, reqid)
+			s.delivering++
+			reverts = append(reverts, req)
+		}
+	}
+	s.lock.Unlock()
+
+	for _, req := range reverts {
+		s.scheduleRevert(req)
+	}
+	return nil
+}
+
+// notify signals the sync loop that new assignments might be possible. The
+// caller must hold s.lock.
+func (s *Syncer) notify() {
+	select {
+	case s.update <- struct{}{}:
+	default:
+	}
+}
+
+// Sync starts (or resumes) a sync cycle to retrieve the state trie with the
+// given root, blocking until it's fully available in the database, the cycle
+// is cancelled or no connected peer is able to serve the remaining data.
+// Concurrent calls are serialized, each waiting for the previous to return.
+func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
+	s.cycleLock.Lock()
+	defer s.cycleLock.Unlock()
+
+	s.lock.Lock()
+	if s.tasks == nil {
+		s.reset()
+	}
+	if s.root != root {
+		// Keep the range progress, healing will fix up the differences
+		s.root = root
+		s.stateless = make(map[string]struct{})
+	}
+	s.healer = nil
+	s.healQueue = nil
+	s.healFailed = make(map[common.Hash]map[string]struct{})
+	s.delivering = 0
+	s.stale = make(chan struct{})
+	s.lock.Unlock()
+
+	// Requests of any previous cycle are gone, reschedule all the pending tasks
+	for _, task := range s.tasks {
+		task.req = nil
+	}
+	s.storageQueue = s.storageQueue[:0]
+	for root := range s.storageTasks {
+		s.storageQueue = append(s.storageQueue, root)
+	}
+	s.codeQueue = s.codeQueue[:0]
+	for hash := range s.codeTasks {
+		s.codeQueue = append(s.codeQueue, hash)
+	}
+
+	defer s.cleanup()
+
+	if s.known(root) {
+		return nil
+	}
+	log.Debug("Starting snapshot state sync", "root", root)
+	for {
+		// Assign all the data retrieval tasks to any free peers
+		s.assignAccountTasks()
+		s.assignStorageTasks()
+		s.assignCodeTasks()
+
+		// Once the leaf ranges are done, heal whatever is still missing
+		if s.rangesDone() {
+			if s.healer == nil {
+				if err := s.flushAccounts(); err != nil {
+					return err
+				}
+				s.healer = state.NewStateSync(root, s.db)
+			}
+			s.assignHealTasks()
+			if s.healer.Pending() == 0 && len(s.healQueue) == 0 && s.inFlight() == 0 {
+				log.Debug("Snapshot state sync completed", "root", root, "accounts", s.accountSynced,
+					"storage", s.storageSynced, "codes", s.codeSynced, "healed", s.healSynced)
+				return nil
+			}
+		}
+		// If nothing could be assigned to any peer, no progress can be made
+		if s.inFlight() == 0 {
+			return errStateUnavailable
+		}
+		// Wait for something to happen
+		select {
+		case <-s.update:
+		case <-cancel:
+			return errCancelled
+		case req := <-s.revertCh:
+			s.handled()
+			s.revert(req)
+		case res := <-s.responseCh:
+			s.handled()
+			if err := s.process(res); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// reset initializes the range tasks for retrieving the whole account space.
+func (s *Syncer) reset() {
+	s.accountTrie, _ = trie.New(common.Hash{}, s.db)
+
+	step := new(big.Int).Sub(
+		new(big.Int).Div(
+			new(big.Int).Exp(common.Big2, common.Big256, nil),
+			big.NewInt(accountConcurrency),
+		), common.Big1,
+	)
+	var next common.Hash
+	for i := 0; i < accountConcurrency; i++ {
+		last := common.BigToHash(new(big.Int).Add(next.Big(), step))
+		if i == accountConcurrency-1 {
+			// Make sure we don't overflow if the step is not a proper divisor
+			last = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+		}
+		s.tasks = append(s.tasks, &accountTask{next: next, last: last})
+		next = common.BigToHash(new(big.Int).Add(last.Big(), common.Big1))
+	}
+	s.waiting = make(map[common.Hash][]*accountBatch)
+	s.storageTasks = make(map[common.Hash]*storageTask)
+	s.codeTasks = make(map[common.Hash]map[string]struct{})
+}
+
+// cleanup terminates the current sync cycle, abandoning all in-flight requests.
+// Their tasks are rescheduled when the next cycle starts.
+func (s *Syncer) cleanup() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, req := range s.reqs {
+		req.timeout.Stop()
+		delete(s.reqs, id)
+		if _, ok := s.peers[req.peer]; ok {
+			s.idlers[req.peer] = struct{}{}
+		}
+	}
+	close(s.stale)
+}
+
+// inFlight returns the number of requests currently pending, including the ones
+// already handed to the sync loop.
+func (s *Syncer) inFlight() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.reqs) + s.delivering
+}
+
+// handled marks a response or revert handed to the sync loop as consumed.
+func (s *Syncer) handled() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.delivering--
+}
+
+// rangesDone returns whether all account ranges, storage tries and bytecodes
+// have been retrieved.
+func (s *Syncer) rangesDone() bool {
+	for _, task := range s.tasks {
+		if !task.done {
+			return false
+		}
+	}
+	return len(s.waiting) == 0 && len(s.storageTasks) == 0 && len(s.codeTasks) == 0
+}
+
+// idlePeers returns the currently idle peers having the state. The caller must
+// hold s.lock.
+func (s *Syncer) idlePeers() []string {
+	var ids []string
+	for id := range s.idlers {
+		if _, ok := s.stateless[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// track registers a new request to the given peer, arming its timeout. The
+// caller must hold s.lock.
+func (s *Syncer) track(req *request) {
+	s.nextReqID++
+	req.id = s.nextReqID
+	req.stale = s.stale
+
+	delete(s.idlers, req.peer)
+	s.reqs[req.id] = req
+
+	req.timeout = time.AfterFunc(requestTimeout, func() {
+		s.lock.Lock()
+		if _, ok := s.reqs[req.id]; !ok {
+			s.lock.Unlock()
+			return
+		}
+		log.Debug("Snapshot request timed out", "peer", req.peer, "reqid", req.id)
+		delete(s.reqs, req.id)
+		if _, ok := s.peers[req.peer]; ok {
+			s.idlers[req.peer] = struct{}{}
+		}
+		s.delivering++
+		s.lock.Unlock()
+
+		s.scheduleRevert(req)
+	})
+}
+
+// untrack retrieves and removes a pending request upon its delivery, marking
+// the peer idle again. Nil is returned for unknown (stale) requests. The caller
+// must hand the request back to the sync loop via deliver or scheduleRevert.
+func (s *Syncer) untrack(peer *Peer, id uint64, kind int) *request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	req, ok := s.reqs[id]
+	if !ok || req.peer != peer.id || req.kind != kind {
+		return nil
+	}
+	req.timeout.Stop()
+	delete(s.reqs, id)
+	if _, ok := s.peers[peer.id]; ok {
+		s.idlers[peer.id] = struct{}{}
+	}
+	s.delivering++
+
+	return req
+}
+
+// scheduleRevert hands a failed request over to the sync loop for rescheduling.
+func (s *Syncer) scheduleRevert(req *request) {
+	select {
+	case s.revertCh <- req:
+	case <-req.stale:
+	}
+}
+
+// deliver hands a verified response over to the sync loop for processing.
+func (s *Syncer) deliver(res *response) {
+	select {
+	case s.responseCh <- res:
+	case <-res.req.stale:
+	}
+}
+
+// revert reschedules all the tasks of a failed request.
+func (s *Syncer) revert(req *request) {
+	switch req.kind {
+	case accountRequest:
+		req.task.req = nil
+	case storageRequest:
+		s.storageQueue = append(req.hashes, s.storageQueue...)
+	case codeRequest:
+		s.codeQueue = append(s.codeQueue, req.hashes...)
+	case healRequest:
+		s.healQueue = append(s.healQueue, req.hashes...)
+	}
+}
+
+// send dispatches a tracked request to its peer, reverting it on failure. It
+// is meant to be run on its own goroutine, as the network may block.
+func (s *Syncer) send(peer *Peer, req *request, send func() error) {
+	if err := send(); err != nil {
+		peer.logger.Debug("Failed to send snapshot request", "err", err)
+		if s.untrack(peer, req.id, req.kind) != nil {
+			s.scheduleRevert(req)
+		}
+	}
+}
+
+// assignAccountTasks attempts to match idle peers to pending account ranges.
+func (s *Syncer) assignAccountTasks() {
+	for _, task := range s.tasks {
+		if task.done || task.req != nil {
+			continue
+		}
+		s.lock.Lock()
+		idles := s.idlePeers()
+		if len(idles) == 0 {
+			s.lock.Unlock()
+			return
+		}
+		peer := s.peers[idles[0]]
+		req := &request{
+			kind:   accountRequest,
+			peer:   peer.id,
+			root:   s.root,
+			task:   task,
+			origin: task.next,
+			limit:  task.last,
+		}
+		s.track(req)
+		task.req = req
+		s.lock.Unlock()
+
+		go s.send(peer, req, func() error {
+			return peer.RequestAccountRange(req.id, req.root, req.origin, req.limit, requestBytes)
+		})
+	}
+}
+
+// assignStorageTasks attempts to match idle peers to pending storage tries.
+func (s *Syncer) assignStorageTasks() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, id := range s.idlePeers() {
+		if len(s.storageQueue) == 0 {
+			return
+		}
+		peer := s.peers[id]
+
+		// Gather a batch of tries the peer didn't fail on yet. A chunked trie
+		// is always requested alone, continuing from its next slot.
+		var (
+			roots  []common.Hash
+			origin common.Hash
+			queue  []common.Hash
+		)
+		for _, root := range s.storageQueue {
+			task := s.storageTasks[root]
+			if _, failed := task.failed[id]; failed || len(roots) >= maxStorageRequestCount {
+				queue = append(queue, root)
+				continue
+			}
+			if task.next != (common.Hash{}) {
+				if len(roots) > 0 {
+					queue = append(queue, root)
+					continue
+				}
+				origin = task.next
+			} else if origin != (common.Hash{}) {
+				queue = append(queue, root)
+				continue
+			}
+			roots = append(roots, root)
+		}
+		if len(roots) == 0 {
+			continue
+		}
+		s.storageQueue = queue
+
+		req := &request{
+			kind:   storageRequest,
+			peer:   id,
+			origin: origin,
+			hashes: roots,
+		}
+		s.track(req)
+		go s.send(peer, req, func() error {
+			return peer.RequestStorageRanges(req.id, req.hashes, req.origin, requestBytes)
+		})
+	}
+}
+
+// assignCodeTasks attempts to match idle peers to pending bytecodes.
+func (s *Syncer) assignCodeTasks() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, id := range s.idlePeers() {
+		if len(s.codeQueue) == 0 {
+			return
+		}
+		peer := s.peers[id]
+
+		var hashes, queue []common.Hash
+		for _, hash := range s.codeQueue {
+			if _, failed := s.codeTasks[hash][id]; failed || len(hashes) >= maxCodeRequestCount {
+				queue = append(queue, hash)
+				continue
+			}
+			hashes = append(hashes, hash)
+		}
+		if len(hashes) == 0 {
+			continue
+		}
+		s.codeQueue = queue
+
+		req := &request{
+			kind:   codeRequest,
+			peer:   id,
+			hashes: hashes,
+		}
+		s.track(req)
+		go s.send(peer, req, func() error {
+			return peer.RequestByteCodes(req.id, req.hashes, requestBytes)
+		})
+	}
+}
+
+// assignHealTasks attempts to match idle peers to missing trie nodes.
+func (s *Syncer) assignHealTasks() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, id := range s.idlePeers() {
+		peer := s.peers[id]
+
+		var hashes, queue []common.Hash
+		for _, hash := range s.healQueue {
+			if _, failed := s.healFailed[hash][id]; failed || len(hashes) >= maxTrieRequestCount {
+				queue = append(queue, hash)
+				continue
+			}
+			hashes = append(hashes, hash)
+		}
+		s.healQueue = queue
+		if len(hashes) < maxTrieRequestCount {
+			hashes = append(hashes, s.healer.Missing(maxTrieRequestCount-len(hashes))...)
+		}
+		if len(hashes) == 0 {
+			continue
+		}
+		req := &request{
+			kind:   healRequest,
+			peer:   id,
+			hashes: hashes,
+		}
+		s.track(req)
+		go s.send(peer, req, func() error {
+			return peer.RequestTrieNodes(req.id, req.hashes, requestBytes)
+		})
+	}
+}
+
+// OnAccounts is a callback method to invoke when a range of accounts are
+// received from a remote peer. The range is verified against the requested
+// root before being scheduled for processing.
+func (s *Syncer) OnAccounts(peer *Peer, id uint64, hashes []common.Hash, accounts [][]byte, proof [][]byte) error {
+	req := s.untrack(peer, id, accountRequest)
+	if req == nil {
+		peer.logger.Trace("Unexpected account range packet", "reqid", id)
+		return nil
+	}
+	// An empty response without a proof means the peer doesn't have the state
+	if len(hashes) == 0 && len(proof) == 0 {
+		peer.logger.Debug("Peer rejected account range request", "reqid", id)
+		s.markStateless(peer.id)
+		s.scheduleRevert(req)
+		return nil
+	}
+	keys := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = common.CopyBytes(hash[:])
+	}
+	last := req.origin[:]
+	if len(keys) > 0 {
+		last = keys[len(keys)-1]
+	}
+	cont, err := trie.VerifyRangeProof(req.root, req.origin[:], last, keys, accounts, toNodes(proof))
+	if err != nil {
+		peer.logger.Debug("Account range failed proof", "err", err)
+		s.scheduleRevert(req)
+		return err
+	}
+	s.deliver(&response{req: req, hashes: hashes, accounts: accounts, cont: cont})
+	return nil
+}
+
+// OnStorage is a callback method to invoke when ranges of storage slots are
+// received from a remote peer. Fully delivered tries are assembled and checked
+// against their roots, a partial last trie is verified against its proof.
+func (s *Syncer) OnStorage(peer *Peer, id uint64, hashes [][]common.Hash, slots [][][]byte, proof [][]byte) error {
+	req := s.untrack(peer, id, storageRequest)
+	if req == nil {
+		peer.logger.Trace("Unexpected storage ranges packet", "reqid", id)
+		return nil
+	}
+	if len(hashes) != len(slots) || len(hashes) > len(req.hashes) {
+		s.scheduleRevert(req)
+		return fmt.Errorf("%v: storage ranges mismatch: hashes %d, slots %d, requested %d", errBadRequest, len(hashes), len(slots), len(req.hashes))
+	}
+	res := &response{req: req, missing: req.hashes[len(hashes):]}
+	for i := range hashes {
+		root := req.hashes[i]
+		if i == len(hashes)-1 && len(proof) > 0 {
+			// Last storage range is partial, verify it against the proof
+			var origin common.Hash
+			if i == 0 {
+				origin = req.origin
+			}
+			keys := make([][]byte, len(hashes[i]))
+			for j, hash := range hashes[i] {
+				keys[j] = common.CopyBytes(hash[:])
+			}
+			last := origin[:]
+			if len(keys) > 0 {
+				last = keys[len(keys)-1]
+			}
+			cont, err := trie.VerifyRangeProof(root, origin[:], last, keys, slots[i], toNodes(proof))
+			if err != nil {
+				peer.logger.Debug("Storage range failed proof", "root", root, "err", err)
+				s.scheduleRevert(req)
+				return err
+			}
+			res.partial, res.slots, res.cont = hashes[i], slots[i], cont
+			break
+		}
+		// Storage trie delivered in full, assemble it and check its root
+		tr, _ := trie.New(common.Hash{}, s.db)
+		for j, hash := range hashes[i] {
+			if len(slots[i][j]) == 0 {
+				s.scheduleRevert(req)
+				return fmt.Errorf("%v: empty storage slot %x", errBadRequest, hash)
+			}
+			tr.Update(hash[:], slots[i][j])
+		}
+		if have := tr.Hash(); have != root {
+			s.scheduleRevert(req)
+			return fmt.Errorf("%v: storage root mismatch: have %x, want %x", errBadRequest, have, root)
+		}
+		res.complete = append(res.complete, tr)
+	}
+	s.deliver(res)
+	return nil
+}
+
+// OnByteCodes is a callback method to invoke when a batch of contract bytecodes
+// are received from a remote peer.
+func (s *Syncer) OnByteCodes(peer *Peer, id uint64, codes [][]byte) error {
+	req := s.untrack(peer, id, codeRequest)
+	if req == nil {
+		peer.logger.Trace("Unexpected bytecode packet", "reqid", id)
+		return nil
+	}
+	blobs, missing, err := matchBlobs(req.hashes, codes)
+	if err != nil {
+		s.scheduleRevert(req)
+		return err
+	}
+	s.deliver(&response{req: req, blobs: blobs, missing: missing})
+	return nil
+}
+
+// OnTrieNodes is a callback method to invoke when a batch of trie nodes are
+// received from a remote peer during healing.
+func (s *Syncer) OnTrieNodes(peer *Peer, id uint64, nodes [][]byte) error {
+	req := s.untrack(peer, id, healRequest)
+	if req == nil {
+		peer.logger.Trace("Unexpected trie nodes packet", "reqid", id)
+		return nil
+	}
+	blobs, missing, err := matchBlobs(req.hashes, nodes)
+	if err != nil {
+		s.scheduleRevert(req)
+		return err
+	}
+	s.deliver(&response{req: req, blobs: blobs, missing: missing})
+	return nil
+}
+
+// matchBlobs cross references delivered data blobs with the requested hashes,
+// returning the blobs in requested order (nil for undelivered ones) and the
+// list of hashes not delivered. Blobs not matching any request are rejected.
+func matchBlobs(hashes []common.Hash, blobs [][]byte) ([][]byte, []common.Hash, error) {
+	if len(blobs) > len(hashes) {
+		return nil, nil, fmt.Errorf("%v: %d items delivered for %d requested", errBadRequest, len(blobs), len(hashes))
+	}
+	var (
+		ordered = make([][]byte, len(hashes))
+		missing []common.Hash
+		index   int
+	)
+	for _, blob := range blobs {
+		hash := crypto.Keccak256Hash(blob)
+		for index < len(hashes) && hashes[index] != hash {
+			index++
+		}
+		if index == len(hashes) {
+			return nil, nil, fmt.Errorf("%v: unrequested item %x delivered", errBadRequest, hash)
+		}
+		ordered[index] = blob
+		index++
+	}
+	for i, blob := range ordered {
+		if blob == nil {
+			missing = append(missing, hashes[i])
+		}
+	}
+	return ordered, missing, nil
+}
+
+// markStateless flags a peer as not having the current state.
+func (s *Syncer) markStateless(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[id]; ok {
+		s.stateless[id] = struct{}{}
+	}
+}
+
+// process integrates a verified response into the sync progress.
+func (s *Syncer) process(res *response) error {
+	switch res.req.kind {
+	case accountRequest:
+		return s.processAccounts(res)
+	case storageRequest:
+		return s.processStorage(res)
+	case codeRequest:
+		return s.processCodes(res)
+	case healRequest:
+		return s.processHeal(res)
+	}
+	return nil
+}
+
+// processAccounts moves an account range task forward and schedules the storage
+// tries and bytecodes of the delivered accounts for retrieval.
+func (s *Syncer) processAccounts(res *response) error {
+	task := res.req.task
+	task.req = nil
+
+	// Accounts beyond the range of the task belong to another one
+	hashes, accounts := res.hashes, res.accounts
+	for len(hashes) > 0 && bytes.Compare(hashes[len(hashes)-1][:], task.last[:]) > 0 {
+		hashes, accounts = hashes[:len(hashes)-1], accounts[:len(accounts)-1]
+	}
+	if !res.cont || len(hashes) < len(res.hashes) || (len(hashes) > 0 && hashes[len(hashes)-1] == task.last) {
+		task.done = true
+	} else if len(hashes) > 0 {
+		task.next = common.BigToHash(new(big.Int).Add(hashes[len(hashes)-1].Big(), common.Big1))
+	}
+	s.accountSynced += uint64(len(hashes))
+
+	// Gather the missing storage tries and bytecodes of the accounts
+	batch := &accountBatch{
+		hashes:   hashes,
+		accounts: accounts,
+		deps:     make(map[common.Hash][]int),
+		dropped:  make(map[int]bool),
+	}
+	for i, blob := range accounts {
+		var account state.Account
+		if err := rlp.DecodeBytes(blob, &account); err != nil {
+			return err
+		}
+		if account.Root != emptyRoot && !s.known(account.Root) {
+			if _, ok := s.storageTasks[account.Root]; !ok {
+				s.storageTasks[account.Root] = &storageTask{root: account.Root, failed: make(map[string]struct{})}
+				s.storageQueue = append(s.storageQueue, account.Root)
+			}
+			batch.deps[account.Root] = append(batch.deps[account.Root], i)
+		}
+		if code := common.BytesToHash(account.CodeHash); code != emptyCode && !s.known(code) {
+			if _, ok := s.codeTasks[code]; !ok {
+				s.codeTasks[code] = make(map[string]struct{})
+				s.codeQueue = append(s.codeQueue, code)
+			}
+			batch.deps[code] = append(batch.deps[code], i)
+		}
+	}
+	if len(batch.deps) == 0 {
+		return s.insertAccounts(batch)
+	}
+	for dep := range batch.deps {
+		s.waiting[dep] = append(s.waiting[dep], batch)
+	}
+	return nil
+}
+
+// known returns whether a trie node or bytecode is already in the database.
+func (s *Syncer) known(hash common.Hash) bool {
+	blob, err := s.db.Get(hash[:])
+	return err == nil && len(blob) > 0
+}
+
+// resolve notifies the account batches waiting on a storage trie or bytecode
+// that it's been retrieved (or dropped), inserting any batch that's complete.
+func (s *Syncer) resolve(dep common.Hash, ok bool) error {
+	batches := s.waiting[dep]
+	delete(s.waiting, dep)
+
+	for _, batch := range batches {
+		if !ok {
+			for _, i := range batch.deps[dep] {
+				batch.dropped[i] = true
+			}
+		}
+		delete(batch.deps, dep)
+		if len(batch.deps) == 0 {
+			if err := s.insertAccounts(batch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// insertAccounts inserts a batch of accounts with all their data available into
+// the account trie, flushing it to disk if enough data accumulated. Dropped
+// accounts are left out, to be retrieved during healing.
+func (s *Syncer) insertAccounts(batch *accountBatch) error {
+	for i, hash := range batch.hashes {
+		if batch.dropped[i] {
+			continue
+		}
+		if err := s.accountTrie.TryUpdate(hash[:], batch.accounts[i]); err != nil {
+			return err
+		}
+		s.accountDirt++
+	}
+	if s.accountDirt >= commitThreshold {
+		return s.flushAccounts()
+	}
+	return nil
+}
+
+// flushAccounts writes the account trie assembled so far into the database.
+func (s *Syncer) flushAccounts() error {
+	if s.accountDirt == 0 {
+		return nil
+	}
+	dbw := s.db.NewBatch()
+	if _, err := s.accountTrie.CommitTo(dbw); err != nil {
+		return err
+	}
+	if err := dbw.Write(); err != nil {
+		return err
+	}
+	s.accountDirt = 0
+	return nil
+}
+
+// processStorage stores the fully retrieved storage tries and moves a chunked
+// one forward, rescheduling any undelivered ones.
+func (s *Syncer) processStorage(res *response) error {
+	req := res.req
+
+	for i, tr := range res.complete {
+		if err := commitTrie(tr, s.db); err != nil {
+			return err
+		}
+		if err := s.finishStorage(req.hashes[i], true); err != nil {
+			return err
+		}
+	}
+	if res.partial != nil {
+		root := req.hashes[len(res.complete)]
+		task := s.storageTasks[root]
+		if task.trie == nil {
+			task.trie, _ = trie.New(common.Hash{}, s.db)
+		}
+		for i, hash := range res.partial {
+			if err := task.trie.TryUpdate(hash[:], res.slots[i]); err != nil {
+				return err
+			}
+		}
+		switch {
+		case res.cont && len(res.partial) > 0:
+			task.next = common.BigToHash(new(big.Int).Add(res.partial[len(res.partial)-1].Big(), common.Big1))
+			if err := commitTrie(task.trie, s.db); err != nil {
+				return err
+			}
+			s.storageQueue = append([]common.Hash{root}, s.storageQueue...)
+
+		case res.cont:
+			// Proof claims more slots but none delivered, try someone else
+			task.failed[req.peer] = struct{}{}
+			s.storageQueue = append([]common.Hash{root}, s.storageQueue...)
+
+		default:
+			if err := commitTrie(task.trie, s.db); err != nil {
+				return err
+			}
+			if err := s.finishStorage(root, task.trie.Hash() == root); err != nil {
+				return err
+			}
+		}
+	}
+	// Reschedule anything not delivered, dropping tries nobody can serve
+	for _, root := range res.missing {
+		task := s.storageTasks[root]
+		if len(res.complete) == 0 && res.partial == nil {
+			task.failed[req.peer] = struct{}{}
+			if s.unservable(task.failed) {
+				log.Debug("Storage trie unavailable, leaving for healing", "root", root)
+				if err := s.finishStorage(root, false); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		s.storageQueue = append(s.storageQueue, root)
+	}
+	return nil
+}
+
+// finishStorage marks a storage trie retrieval done and releases its accounts.
+func (s *Syncer) finishStorage(root common.Hash, ok bool) error {
+	delete(s.storageTasks, root)
+	if ok {
+		s.storageSynced++
+	}
+	return s.resolve(root, ok)
+}
+
+// unservable returns whether all the peers having the state failed to deliver
+// some data.
+func (s *Syncer) unservable(failed map[string]struct{}) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id := range s.peers {
+		if _, stateless := s.stateless[id]; stateless {
+			continue
+		}
+		if _, ok := failed[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// processCodes stores the retrieved bytecodes, rescheduling any undelivered.
+func (s *Syncer) processCodes(res *response) error {
+	dbw := s.db.NewBatch()
+	for i, blob := range res.blobs {
+		if blob != nil {
+			if err := dbw.Put(res.req.hashes[i][:], blob); err != nil {
+				return err
+			}
+		}
+	}
+	if err := dbw.Write(); err != nil {
+		return err
+	}
+	for i, blob := range res.blobs {
+		if blob != nil {
+			delete(s.codeTasks, res.req.hashes[i])
+			s.codeSynced++
+			if err := s.resolve(res.req.hashes[i], true); err != nil {
+				return err
+			}
+		}
+	}
+	for _, hash := range res.missing {
+		failed := s.codeTasks[hash]
+		failed[res.req.peer] = struct{}{}
+		if s.unservable(failed) {
+			log.Debug("Bytecode unavailable, leaving for healing", "hash", hash)
+			delete(s.codeTasks, hash)
+			if err := s.resolve(hash, false); err != nil {
+				return err
+			}
+			continue
+		}
+		s.codeQueue = append(s.codeQueue, hash)
+	}
+	return nil
+}
+
+// processHeal feeds the retrieved trie nodes into the healing scheduler,
+// rescheduling any undelivered ones.
+func (s *Syncer) processHeal(res *response) error {
+	var results []trie.SyncResult
+	for i, blob := range res.blobs {
+		if blob != nil {
+			results = append(results, trie.SyncResult{Hash: res.req.hashes[i], Data: blob})
+		}
+	}
+	if len(results) > 0 {
+		dbw := s.db.NewBatch()
+		if _, index, err := s.healer.Process(results, dbw); err != nil {
+			return fmt.Errorf("failed to heal trie node %x: %v", results[index].Hash, err)
+		}
+		if err := dbw.Write(); err != nil {
+			return err
+		}
+		s.healSynced += uint64(len(results))
+	}
+	for _, hash := range res.missing {
+		if s.healFailed[hash] == nil {
+			s.healFailed[hash] = make(map[string]struct{})
+		}
+		s.healFailed[hash][res.req.peer] = struct{}{}
+		if s.unservable(s.healFailed[hash]) {
+			return errStateUnavailable
+		}
+		s.healQueue = append(s.healQueue, hash)
+	}
+	return nil
+}
+
+// commitTrie flushes a trie into the database.
+func commitTrie(tr *trie.Trie, db ethdb.Database) error {
+	dbw := db.NewBatch()
+	if _, err := tr.CommitTo(dbw); err != nil {
+		return err
+	}
+	return dbw.Write()
+}
+
+// toNodes converts a network representation of a proof to a list of trie nodes.
+func toNodes(proof [][]byte) []rlp.RawValue {
+	if len(proof) == 0 {
+		return nil
+	}
+	nodes := make([]rlp.RawValue, len(proof))
+	for i, node := range proof {
+		nodes[i] = node
+	}
+	return nodes
+}
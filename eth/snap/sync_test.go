@@ -0,0 +1,210 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// makeTestState creates a state with the given number of accounts, every third
+// of them having some storage and every fifth some code. The last account gets
+// a large storage trie to exercise chunked retrievals.
+func makeTestState(db ethdb.Database, accounts int, large int) common.Hash {
+	statedb, _ := state.New(common.Hash{}, db)
+	for i := 0; i < accounts; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i)))
+		statedb.AddBalance(addr, big.NewInt(int64(i+1)))
+		statedb.SetNonce(addr, uint64(i))
+		if i%3 == 0 {
+			for j := 0; j < i%17+1; j++ {
+				statedb.SetState(addr, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(i*j+1))))
+			}
+		}
+		if i%5 == 0 {
+			statedb.SetCode(addr, []byte{byte(i), byte(i >> 8), 0x60, 0x00})
+		}
+	}
+	addr := common.BigToAddress(big.NewInt(int64(accounts)))
+	statedb.AddBalance(addr, big.NewInt(1))
+	for j := 0; j < large; j++ {
+		statedb.SetState(addr, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(j+1))))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		panic(err)
+	}
+	return root
+}
+
+// checkStateConsistency iterates over the entire state, failing if any trie
+// node or bytecode is missing.
+func checkStateConsistency(t *testing.T, db ethdb.Database, root common.Hash) {
+	statedb, err := state.New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	it := state.NewNodeIterator(statedb)
+	for it.Next() {
+	}
+	if it.Error != nil {
+		t.Fatalf("state %x inconsistent: %v", root, it.Error)
+	}
+}
+
+// connectPeer connects a syncer to a snap handler serving the given database
+// over an in-memory pipe, returning a function to disconnect them.
+func connectPeer(syncer *Syncer, db ethdb.Database) func() {
+	var server, client discover.NodeID
+	rand.Read(server[:])
+	rand.Read(client[:])
+
+	app, net := p2p.MsgPipe()
+	go NewHandler(db, nil).handle(newPeer(snap1, p2p.NewPeer(client, "client", nil), net))
+	go NewHandler(nil, syncer).handle(newPeer(snap1, p2p.NewPeer(server, "server", nil), app))
+
+	// Wait for the server to be registered as a data source
+	for {
+		syncer.lock.Lock()
+		_, ok := syncer.peers[newPeer(snap1, p2p.NewPeer(server, "", nil), nil).id]
+		syncer.lock.Unlock()
+		if ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return func() { app.Close() }
+}
+
+// Tests that a state can be synced in ranges from a single peer.
+func TestSync(t *testing.T)          { testSync(t, 1, 0) }
+func TestSyncMultiPeer(t *testing.T) { testSync(t, 4, 0) }
+func TestSyncChunked(t *testing.T)   { testSync(t, 4, 2048) }
+
+func testSync(t *testing.T, peers int, bytes uint64) {
+	if bytes > 0 {
+		defer func(old uint64) { requestBytes = old }(requestBytes)
+		requestBytes = bytes
+	}
+	source, _ := ethdb.NewMemDatabase()
+	root := makeTestState(source, 1000, 500)
+
+	db, _ := ethdb.NewMemDatabase()
+	syncer := NewSyncer(db)
+	for i := 0; i < peers; i++ {
+		defer connectPeer(syncer, source)()
+	}
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	checkStateConsistency(t, db, root)
+
+	if syncer.accountSynced != 1001 {
+		t.Errorf("accounts retrieved mismatch: have %d, want %d", syncer.accountSynced, 1001)
+	}
+	if syncer.healSynced != 0 {
+		t.Errorf("unexpected trie nodes healed: %d", syncer.healSynced)
+	}
+}
+
+// Tests that an interrupted sync can be continued with a new root, healing the
+// differences between the two states.
+func TestSyncHealing(t *testing.T) {
+	source, _ := ethdb.NewMemDatabase()
+	root := makeTestState(source, 1000, 100)
+
+	db, _ := ethdb.NewMemDatabase()
+	syncer := NewSyncer(db)
+	defer connectPeer(syncer, source)()
+
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	// Modify a few accounts in the source and continue syncing from the new root
+	statedb, _ := state.New(root, source)
+	for i := 0; i < 1000; i += 100 {
+		addr := common.BigToAddress(big.NewInt(int64(i)))
+		statedb.AddBalance(addr, big.NewInt(1))
+		statedb.SetState(addr, common.Hash{0x01}, common.Hash{0x02})
+	}
+	statedb.SetCode(common.BigToAddress(big.NewInt(1)), []byte{0x60, 0x01})
+	newRoot, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit modified state: %v", err)
+	}
+	if err := syncer.Sync(newRoot, make(chan struct{})); err != nil {
+		t.Fatalf("healing failed: %v", err)
+	}
+	checkStateConsistency(t, db, newRoot)
+
+	if syncer.healSynced == 0 {
+		t.Errorf("no trie nodes healed")
+	}
+	if syncer.accountSynced != 1001 {
+		t.Errorf("accounts retrieved mismatch: have %d, want %d", syncer.accountSynced, 1001)
+	}
+}
+
+// Tests that peers not having the requested state are skipped, and that the
+// sync fails if no peer can serve it.
+func TestSyncStatelessPeers(t *testing.T) {
+	source, _ := ethdb.NewMemDatabase()
+	root := makeTestState(source, 100, 0)
+
+	empty, _ := ethdb.NewMemDatabase()
+	db, _ := ethdb.NewMemDatabase()
+	syncer := NewSyncer(db)
+
+	defer connectPeer(syncer, empty)()
+	if err := syncer.Sync(root, make(chan struct{})); err != errStateUnavailable {
+		t.Fatalf("sync error mismatch: have %v, want %v", err, errStateUnavailable)
+	}
+	defer connectPeer(syncer, source)()
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	checkStateConsistency(t, db, root)
+}
+
+// Tests that a sync cycle can be cancelled.
+func TestSyncCancel(t *testing.T) {
+	source, _ := ethdb.NewMemDatabase()
+	root := makeTestState(source, 100, 0)
+
+	db, _ := ethdb.NewMemDatabase()
+	syncer := NewSyncer(db)
+	defer connectPeer(syncer, source)()
+
+	cancel := make(chan struct{})
+	close(cancel)
+	if err := syncer.Sync(root, cancel); err != errCancelled {
+		t.Fatalf("sync error mismatch: have %v, want %v", err, errCancelled)
+	}
+	// A cancelled cycle can be resumed
+	if err := syncer.Sync(root, make(chan struct{})); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	checkStateConsistency(t, db, root)
+}
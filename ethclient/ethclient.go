@@ -290,6 +290,29 @@ func (ec *Client) NonceAt(ctx context.Context, account common.Address, blockNumb
 	return uint64(result), err
 }
 
+// ProofAt returns the Merkle proof of the given account and of the given storage
+// slots of it, which can be checked against a trusted state root with Verify.
+// The block number can be nil, in which case the proof is taken from the latest known block.
+func (ec *Client) ProofAt(ctx context.Context, account common.Address, keys []common.Hash, blockNumber *big.Int) (*AccountProof, error) {
+	var result *rpcAccountProof
+	if err := ec.c.CallContext(ctx, &result, "eth_getProof", account, keys, toBlockNumArg(blockNumber)); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, ethereum.NotFound
+	}
+	// Make sure the server proved exactly the requested storage slots
+	if len(result.StorageProof) != len(keys) {
+		return nil, fmt.Errorf("storage proof count mismatch: have %d, want %d", len(result.StorageProof), len(keys))
+	}
+	for i, slot := range result.StorageProof {
+		if slot.Key != keys[i] {
+			return nil, fmt.Errorf("storage proof %d: key mismatch: have %x, want %x", i, slot.Key, keys[i])
+		}
+	}
+	return result.toProof(), nil
+}
+
 // Filters
 
 // FilterLogs executes a filter query.
@@ -0,0 +1,143 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// errAccountMismatch is returned if the account fields reported alongside a
+	// proof don't match the account actually proven.
+	errAccountMismatch = errors.New("account fields mismatch proof")
+
+	// errStorageMismatch is returned if a storage value reported alongside a proof
+	// doesn't match the value actually proven.
+	errStorageMismatch = errors.New("storage value mismatch proof")
+)
+
+// AccountProof is the Merkle proof of an account along with the account fields
+// it proves, and the proofs of some of the account's storage slots.
+type AccountProof struct {
+	Address      common.Address
+	AccountProof []rlp.RawValue // Account trie nodes from the state root to the account
+	Balance      *big.Int
+	CodeHash     common.Hash
+	Nonce        uint64
+	StorageHash  common.Hash // Root of the account's storage trie
+	StorageProof []StorageProof
+}
+
+// StorageProof is the Merkle proof of a single storage slot of an account.
+type StorageProof struct {
+	Key   common.Hash
+	Value *big.Int
+	Proof []rlp.RawValue // Storage trie nodes from the storage root to the slot
+}
+
+// Verify checks the account proof against the given (trusted) state root, and
+// all the storage proofs against the proven storage root of the account, making
+// sure all the reported fields and values match the proven ones.
+func (p *AccountProof) Verify(root common.Hash) error {
+	account, err := state.VerifyAccountProof(root, p.Address, p.AccountProof)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		// Proof of absence, the fields must be the ones of an empty account
+		if p.Balance.Sign() != 0 || p.Nonce != 0 || p.CodeHash != crypto.Keccak256Hash(nil) || p.StorageHash != emptyRoot {
+			return errAccountMismatch
+		}
+	} else {
+		if p.Balance.Cmp(account.Balance) != 0 || p.Nonce != account.Nonce || p.CodeHash != common.BytesToHash(account.CodeHash) || p.StorageHash != account.Root {
+			return errAccountMismatch
+		}
+	}
+	for _, slot := range p.StorageProof {
+		value, err := state.VerifyStorageProof(p.StorageHash, slot.Key, slot.Proof)
+		if err != nil {
+			return fmt.Errorf("storage slot %x: %v", slot.Key, err)
+		}
+		if value.Big().Cmp(slot.Value) != 0 {
+			return fmt.Errorf("storage slot %x: %v", slot.Key, errStorageMismatch)
+		}
+	}
+	return nil
+}
+
+type rpcAccountProof struct {
+	Address      common.Address    `json:"address"`
+	AccountProof []hexutil.Bytes   `json:"accountProof"`
+	Balance      *hexutil.Big      `json:"balance"`
+	CodeHash     common.Hash       `json:"codeHash"`
+	Nonce        hexutil.Uint64    `json:"nonce"`
+	StorageHash  common.Hash       `json:"storageHash"`
+	StorageProof []rpcStorageProof `json:"storageProof"`
+}
+
+type rpcStorageProof struct {
+	Key   common.Hash     `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// toProof converts the JSON representation of a proof into the native one.
+func (p *rpcAccountProof) toProof() *AccountProof {
+	proof := &AccountProof{
+		Address:      p.Address,
+		AccountProof: toRawValues(p.AccountProof),
+		Balance:      (*big.Int)(p.Balance),
+		CodeHash:     p.CodeHash,
+		Nonce:        uint64(p.Nonce),
+		StorageHash:  p.StorageHash,
+		StorageProof: make([]StorageProof, len(p.StorageProof)),
+	}
+	if proof.Balance == nil {
+		proof.Balance = new(big.Int)
+	}
+	for i, slot := range p.StorageProof {
+		proof.StorageProof[i] = StorageProof{
+			Key:   slot.Key,
+			Value: (*big.Int)(slot.Value),
+			Proof: toRawValues(slot.Proof),
+		}
+		if proof.StorageProof[i].Value == nil {
+			proof.StorageProof[i].Value = new(big.Int)
+		}
+	}
+	return proof
+}
+
+// toRawValues converts a list of hex decoded trie nodes into RLP values.
+func toRawValues(nodes []hexutil.Bytes) []rlp.RawValue {
+	raw := make([]rlp.RawValue, len(nodes))
+	for i, node := range nodes {
+		raw[i] = rlp.RawValue(node)
+	}
+	return raw
+}
@@ -0,0 +1,202 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/net/context"
+)
+
+// Tests that account proofs are only accepted if they are valid against the
+// trusted root and the reported fields match the proven ones.
+func TestAccountProofVerify(t *testing.T) {
+	var (
+		addr = common.HexToAddress("0xdeadbeef")
+		key  = common.HexToHash("0x01")
+	)
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, db)
+	statedb.AddBalance(addr, big.NewInt(1000))
+	statedb.SetNonce(addr, 7)
+	statedb.SetState(addr, key, common.HexToHash("0x2a"))
+	root, _ := statedb.Commit(false)
+	statedb, _ = state.New(root, db)
+	account, _ := state.VerifyAccountProof(root, addr, statedb.GetProof(addr))
+
+	// Assemble a proof as a server would and make sure it verifies
+	proof := func() *AccountProof {
+		return &AccountProof{
+			Address:      addr,
+			AccountProof: statedb.GetProof(addr),
+			Balance:      big.NewInt(1000),
+			CodeHash:     statedb.GetCodeHash(addr),
+			Nonce:        7,
+			StorageHash:  account.Root,
+			StorageProof: []StorageProof{{
+				Key:   key,
+				Value: big.NewInt(0x2a),
+				Proof: statedb.GetStorageProof(addr, key),
+			}},
+		}
+	}
+	if err := proof().Verify(root); err != nil {
+		t.Fatalf("failed to verify valid proof: %v", err)
+	}
+	// Tamper with various fields and ensure the proof is rejected
+	tampered := proof()
+	tampered.Balance = big.NewInt(1001)
+	if err := tampered.Verify(root); err != errAccountMismatch {
+		t.Errorf("tampered balance: error mismatch: have %v, want %v", err, errAccountMismatch)
+	}
+	tampered = proof()
+	tampered.StorageProof[0].Value = big.NewInt(0x2b)
+	if err := tampered.Verify(root); err == nil {
+		t.Errorf("tampered storage value: proof accepted")
+	}
+	if err := proof().Verify(common.Hash{1}); err == nil {
+		t.Errorf("wrong root: proof accepted")
+	}
+}
+
+// proofBackend is an API backend serving a single state, enough to answer proof
+// requests. All other backend methods are unimplemented.
+type proofBackend struct {
+	ethapi.Backend
+
+	db   ethdb.Database
+	root common.Hash
+}
+
+func (b *proofBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (ethapi.State, *types.Header, error) {
+	statedb, err := state.New(b.root, b.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proofState{statedb}, &types.Header{Number: new(big.Int), Root: b.root}, nil
+}
+
+// proofState wraps a state database to be served through the API.
+type proofState struct {
+	state *state.StateDB
+}
+
+func (s proofState) GetBalance(ctx context.Context, addr common.Address) (*big.Int, error) {
+	return s.state.GetBalance(addr), nil
+}
+
+func (s proofState) GetCode(ctx context.Context, addr common.Address) ([]byte, error) {
+	return s.state.GetCode(addr), nil
+}
+
+func (s proofState) GetState(ctx context.Context, addr common.Address, key common.Hash) (common.Hash, error) {
+	return s.state.GetState(addr, key), nil
+}
+
+func (s proofState) GetNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	return s.state.GetNonce(addr), nil
+}
+
+func (s proofState) GetProof(ctx context.Context, addr common.Address) ([]rlp.RawValue, error) {
+	return s.state.GetProof(addr), nil
+}
+
+func (s proofState) GetStorageProof(ctx context.Context, addr common.Address, key common.Hash) ([]rlp.RawValue, error) {
+	return s.state.GetStorageProof(addr, key), nil
+}
+
+// Tests that proofs retrieved through eth_getProof verify against the state root,
+// both for existing and missing accounts and storage slots.
+func TestProofAt(t *testing.T) {
+	var (
+		addr    = common.HexToAddress("0xdeadbeef")
+		missing = common.HexToAddress("0xcafebabe")
+		key     = common.HexToHash("0x01")
+		empty   = common.HexToHash("0x02")
+	)
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, db)
+	statedb.AddBalance(addr, big.NewInt(1000))
+	statedb.SetNonce(addr, 7)
+	statedb.SetState(addr, key, common.HexToHash("0x2a"))
+	root, _ := statedb.Commit(false)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", ethapi.NewPublicBlockChainAPI(&proofBackend{db: db, root: root})); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	rpcClient := rpc.DialInProc(server)
+	defer rpcClient.Close()
+	client := NewClient(rpcClient)
+
+	// Retrieve the proofs of an existing account and verify them by hand
+	proof, err := client.ProofAt(context.Background(), addr, []common.Hash{key, empty}, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve proof: %v", err)
+	}
+	account, err := state.VerifyAccountProof(root, addr, proof.AccountProof)
+	if err != nil || account == nil {
+		t.Fatalf("failed to verify account proof: %v, %v", account, err)
+	}
+	if account.Balance.Cmp(big.NewInt(1000)) != 0 || account.Nonce != 7 || account.Root != proof.StorageHash {
+		t.Errorf("proven account mismatch: balance %v, nonce %d, root %x", account.Balance, account.Nonce, account.Root)
+	}
+	for i, want := range []common.Hash{common.HexToHash("0x2a"), {}} {
+		value, err := state.VerifyStorageProof(account.Root, proof.StorageProof[i].Key, proof.StorageProof[i].Proof)
+		if err != nil {
+			t.Fatalf("slot %d: failed to verify storage proof: %v", i, err)
+		}
+		if value != want || proof.StorageProof[i].Value.Cmp(want.Big()) != 0 {
+			t.Errorf("slot %d: value mismatch: proven %x, reported %v, want %x", i, value, proof.StorageProof[i].Value, want)
+		}
+	}
+	if err := proof.Verify(root); err != nil {
+		t.Errorf("failed to verify proof: %v", err)
+	}
+	// Retrieve the proof of a missing account and verify its absence
+	proof, err = client.ProofAt(context.Background(), missing, []common.Hash{key}, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve absence proof: %v", err)
+	}
+	if account, err := state.VerifyAccountProof(root, missing, proof.AccountProof); err != nil || account != nil {
+		t.Errorf("absence proof mismatch: have %v, %v", account, err)
+	}
+	if err := proof.Verify(root); err != nil {
+		t.Errorf("failed to verify absence proof: %v", err)
+	}
+	// Short storage keys are padded, malformed ones rejected
+	var result ethapi.AccountResult
+	if err := rpcClient.Call(&result, "eth_getProof", addr, []string{"0x01"}, "latest"); err != nil {
+		t.Fatalf("failed to retrieve proof for short key: %v", err)
+	}
+	if result.StorageProof[0].Key != key || result.StorageProof[0].Value.ToInt().Uint64() != 0x2a {
+		t.Errorf("short key mismatch: have %x = %v, want %x = 0x2a", result.StorageProof[0].Key, result.StorageProof[0].Value, key)
+	}
+	for _, bad := range []string{"01", "0x1", "0xzz", "0x" + common.Bytes2Hex(make([]byte, 33))} {
+		if err := rpcClient.Call(&result, "eth_getProof", addr, []string{bad}, "latest"); err == nil {
+			t.Errorf("malformed key %q: proof returned", bad)
+		}
+	}
+}
@@ -16,8 +16,15 @@
 
 package ethdb
 
-type Database interface {
+import "github.com/syndtr/goleveldb/leveldb/iterator"
+
+// Putter wraps the database write operation supported by both batches and regular databases.
+type Putter interface {
 	Put(key []byte, value []byte) error
+}
+
+type Database interface {
+	Putter
 	Get(key []byte) ([]byte, error)
 	Delete(key []byte) error
 	Close()
@@ -25,6 +32,12 @@ type Database interface {
 }
 
 type Batch interface {
-	Put(key, value []byte) error
+	Putter
 	Write() error
 }
+
+// Iteratee wraps the NewIteratorWithPrefix method of databases that are able to
+// iterate over the subset of their contents sharing a key prefix.
+type Iteratee interface {
+	NewIteratorWithPrefix(prefix []byte) iterator.Iterator
+}
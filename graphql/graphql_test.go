@@ -0,0 +1,325 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/net/context"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+	testFunds   = big.NewInt(1000000000)
+	testPayee   = common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+)
+
+// testBackend is a minimal ethapi.Backend serving a local blockchain. Methods
+// not needed by the resolvers are left unimplemented.
+type testBackend struct {
+	ethapi.Backend
+
+	db     ethdb.Database
+	chain  *core.BlockChain
+	config *params.ChainConfig
+}
+
+func (b *testBackend) ChainDb() ethdb.Database                           { return b.db }
+func (b *testBackend) ChainConfig() *params.ChainConfig                  { return b.config }
+func (b *testBackend) CurrentBlock() *types.Block                        { return b.chain.CurrentBlock() }
+func (b *testBackend) GetTd(hash common.Hash) *big.Int                   { return b.chain.GetTdByHash(hash) }
+func (b *testBackend) GetPoolTransaction(common.Hash) *types.Transaction { return nil }
+
+func (b *testBackend) BloomStatus() (uint64, uint64) { return params.BloomBitsBlocks, 0 }
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		return b.chain.CurrentBlock().Header(), nil
+	}
+	return b.chain.GetHeaderByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		return b.chain.CurrentBlock(), nil
+	}
+	return b.chain.GetBlockByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) GetBlock(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return b.chain.GetBlockByHash(hash), nil
+}
+
+func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return core.GetBlockReceipts(b.db, hash, core.GetBlockNumber(b.db, hash)), nil
+}
+
+func (b *testBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (ethapi.State, *types.Header, error) {
+	header, _ := b.HeaderByNumber(ctx, number)
+	if header == nil {
+		return nil, nil, nil
+	}
+	statedb, err := b.chain.StateAt(header.Root)
+	return testState{statedb}, header, err
+}
+
+// testState wraps a state database into an ethapi.State.
+type testState struct {
+	*state.StateDB
+}
+
+func (s testState) GetBalance(ctx context.Context, addr common.Address) (*big.Int, error) {
+	return s.StateDB.GetBalance(addr), nil
+}
+
+func (s testState) GetCode(ctx context.Context, addr common.Address) ([]byte, error) {
+	return s.StateDB.GetCode(addr), nil
+}
+
+func (s testState) GetState(ctx context.Context, addr common.Address, key common.Hash) (common.Hash, error) {
+	return s.StateDB.GetState(addr, key), nil
+}
+
+func (s testState) GetNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	return s.StateDB.GetNonce(addr), nil
+}
+
+func (s testState) GetProof(ctx context.Context, addr common.Address) ([]rlp.RawValue, error) {
+	return nil, nil
+}
+
+func (s testState) GetStorageProof(ctx context.Context, addr common.Address, key common.Hash) ([]rlp.RawValue, error) {
+	return nil, nil
+}
+
+// newTestBackend creates a chain of two blocks, the first containing a value
+// transfer from the test account.
+func newTestBackend(t *testing.T) (*testBackend, []*types.Block) {
+	var (
+		db, _   = ethdb.NewMemDatabase()
+		genesis = core.WriteGenesisBlockForTesting(db, core.GenesisAccount{Address: testAddress, Balance: testFunds})
+		config  = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		engine  = ethash.NewFaker()
+	)
+	chain, err := core.NewBlockChain(db, nil, config, engine, new(event.TypeMux), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	blocks, _ := core.GenerateChain(config, genesis, engine, db, 2, func(i int, block *core.BlockGen) {
+		if i == 0 {
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testAddress), testPayee, big.NewInt(1000), new(big.Int).SetUint64(params.TxGas), big.NewInt(1), nil), types.HomesteadSigner{}, testKey)
+			block.AddTx(tx)
+		}
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	return &testBackend{db: db, chain: chain, config: config}, blocks
+}
+
+// query runs a GraphQL query against the handler and decodes the result.
+func query(t *testing.T, handler http.Handler, query string, result interface{}) {
+	body, _ := json.Marshal(map[string]string{"query": query})
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("POST", "/graphql", bytes.NewReader(body)))
+
+	var response struct {
+		Data   json.RawMessage
+		Errors []struct{ Message string }
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response %s: %v", res.Body, err)
+	}
+	if len(response.Errors) > 0 {
+		t.Fatalf("query failed: %v", response.Errors)
+	}
+	if err := json.Unmarshal(response.Data, result); err != nil {
+		t.Fatalf("failed to decode data %s: %v", response.Data, err)
+	}
+}
+
+func TestBuildSchema(t *testing.T) {
+	if _, err := NewHandler(nil); err != nil {
+		t.Errorf("could not construct GraphQL handler: %v", err)
+	}
+}
+
+// Tests that blocks, transactions, receipts and accounts can be selectively
+// queried in a single request.
+func TestQueryBlock(t *testing.T) {
+	backend, blocks := newTestBackend(t)
+	handler, err := NewHandler(backend)
+	if err != nil {
+		t.Fatalf("could not construct GraphQL handler: %v", err)
+	}
+	var result struct {
+		Block struct {
+			Number       string
+			Hash         common.Hash
+			Parent       struct{ Number string }
+			Transactions []struct {
+				Hash    common.Hash
+				Index   int
+				Value   string
+				GasUsed string
+				From    struct{ Address common.Address }
+				To      struct {
+					Address common.Address
+					Balance string
+				}
+			}
+		}
+	}
+	query(t, handler, `{
+		block(number: 1) {
+			number hash parent { number }
+			transactions {
+				hash index value gasUsed
+				from { address }
+				to { address balance }
+			}
+		}
+	}`, &result)
+
+	block := result.Block
+	if block.Number != "0x1" || block.Hash != blocks[0].Hash() || block.Parent.Number != "0x0" {
+		t.Errorf("block mismatch: have %+v", block)
+	}
+	if len(block.Transactions) != 1 {
+		t.Fatalf("transaction count mismatch: have %d, want 1", len(block.Transactions))
+	}
+	tx := block.Transactions[0]
+	if tx.Hash != blocks[0].Transactions()[0].Hash() || tx.Index != 0 || tx.Value != "0x3e8" || tx.GasUsed != "0x5208" {
+		t.Errorf("transaction mismatch: have %+v", tx)
+	}
+	if tx.From.Address != testAddress || tx.To.Address != testPayee || tx.To.Balance != "0x3e8" {
+		t.Errorf("transaction accounts mismatch: have %+v", tx)
+	}
+	// Unknown blocks and transactions should be null instead of failing
+	var missing struct {
+		Block       *struct{ Number string }
+		Transaction *struct{ Hash common.Hash }
+	}
+	query(t, handler, `{
+		block(number: 10) { number }
+		transaction(hash: "0x0000000000000000000000000000000000000000000000000000000000000001") { hash }
+	}`, &missing)
+	if missing.Block != nil || missing.Transaction != nil {
+		t.Errorf("unknown items returned: %+v", missing)
+	}
+}
+
+// Tests that transactions can be queried by hash along with their inclusion
+// block, and that block ranges are returned in order, clamped to the chain head.
+func TestQueryTransactionAndBlocks(t *testing.T) {
+	backend, blocks := newTestBackend(t)
+	handler, err := NewHandler(backend)
+	if err != nil {
+		t.Fatalf("could not construct GraphQL handler: %v", err)
+	}
+	var result struct {
+		Transaction struct {
+			Nonce string
+			Block struct{ Hash common.Hash }
+		}
+		Blocks []struct {
+			Number           string
+			TransactionCount int
+		}
+		Logs []struct{ Index int }
+	}
+	query(t, handler, `{
+		transaction(hash: "`+blocks[0].Transactions()[0].Hash().Hex()+`") {
+			nonce block { hash }
+		}
+		blocks(from: 0, to: "0xe8d4a51000") { number transactionCount }
+		logs(filter: { fromBlock: 0 }) { index }
+	}`, &result)
+
+	if result.Transaction.Nonce != "0x0" || result.Transaction.Block.Hash != blocks[0].Hash() {
+		t.Errorf("transaction mismatch: have %+v", result.Transaction)
+	}
+	if len(result.Logs) != 0 {
+		t.Errorf("log count mismatch: have %d, want 0", len(result.Logs))
+	}
+	if len(result.Blocks) != 3 {
+		t.Fatalf("block count mismatch: have %d, want 3", len(result.Blocks))
+	}
+	for i, block := range result.Blocks {
+		want := 0
+		if i == 1 {
+			want = 1
+		}
+		if block.Number != fmt.Sprintf("0x%x", i) || block.TransactionCount != want {
+			t.Errorf("block %d mismatch: have %+v", i, block)
+		}
+	}
+}
+
+// Tests that block ranges with bounds beyond the signed 64 bit range neither
+// alias the special block numbers nor overflow, but are clamped to the head.
+func TestQueryBlocksOutOfRange(t *testing.T) {
+	backend, _ := newTestBackend(t)
+	handler, err := NewHandler(backend)
+	if err != nil {
+		t.Fatalf("could not construct GraphQL handler: %v", err)
+	}
+	type blocks []struct{ Number string }
+	var result struct {
+		Signed    blocks
+		Latest    blocks
+		Pending   blocks
+		Unbounded blocks
+		Clamped   blocks
+	}
+	query(t, handler, `{
+		signed: blocks(from: "0x8000000000000000") { number }
+		latest: blocks(from: "0xffffffffffffffff") { number }
+		pending: blocks(from: "0xfffffffffffffffe", to: "0xffffffffffffffff") { number }
+		unbounded: blocks(from: "0x8000000000000000", to: "0x8000000000000000") { number }
+		clamped: blocks(from: 1, to: "0x8000000000000000") { number }
+	}`, &result)
+
+	for name, res := range map[string]blocks{"signed": result.Signed, "latest": result.Latest, "pending": result.Pending, "unbounded": result.Unbounded} {
+		if len(res) != 0 {
+			t.Errorf("%s: block count mismatch: have %d, want 0", name, len(res))
+		}
+	}
+	if len(result.Clamped) != 2 || result.Clamped[0].Number != "0x1" || result.Clamped[1].Number != "0x2" {
+		t.Errorf("clamped range mismatch: have %+v, want blocks 0x1 and 0x2", result.Clamped)
+	}
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -248,6 +249,22 @@ func (s *PrivateAccountAPI) ListWallets() []rawWallet {
 	return wallets
 }
 
+// OpenWallet initiates a hardware wallet opening procedure, establishing a USB
+// connection and attempting to authenticate via the provided passphrase. Note,
+// the method may return an extra challenge requiring a second open (e.g. the
+// Trezor PIN matrix challenge).
+func (s *PrivateAccountAPI) OpenWallet(url string, passphrase *string) error {
+	wallet, err := s.am.Wallet(url)
+	if err != nil {
+		return err
+	}
+	pass := ""
+	if passphrase != nil {
+		pass = *passphrase
+	}
+	return wallet.Open(pass)
+}
+
 // DeriveAccount requests a HD wallet to derive a new account, optionally pinning
 // it for later reuse.
 func (s *PrivateAccountAPI) DeriveAccount(url string, path string, pin *bool) (accounts.Account, error) {
@@ -548,6 +565,108 @@ func (s *PublicBlockChainAPI) GetStorageAt(ctx context.Context, address common.A
 	return res.Hex(), nil
 }
 
+// AccountResult is the Merkle proof of an account, along with the proven account
+// fields and the proofs of any requested storage slots.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the Merkle proof of a single storage slot of an account.
+type StorageResult struct {
+	Key   common.Hash     `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// GetProof returns the Merkle proof of an account and of the given storage slots
+// of it at the given block number, against the state root of that block. The
+// rpc.LatestBlockNumber and rpc.PendingBlockNumber meta block numbers are also
+// allowed.
+func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*AccountResult, error) {
+	// Reject any malformed storage keys before assembling the proofs
+	keys := make([]common.Hash, len(storageKeys))
+	for i, key := range storageKeys {
+		hash, err := decodeStorageKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid storage key %q: %v", key, err)
+		}
+		keys[i] = hash
+	}
+	statedb, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	proof, err := statedb.GetProof(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	// Extract the account fields from the proof itself, ensuring they match
+	account, err := state.VerifyAccountProof(header.Root, address, proof)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account proof: %v", err)
+	}
+	result := &AccountResult{
+		Address:      address,
+		AccountProof: toHexSlice(proof),
+		Balance:      new(hexutil.Big),
+		CodeHash:     crypto.Keccak256Hash(nil),
+		StorageHash:  types.EmptyRootHash,
+		StorageProof: make([]StorageResult, len(storageKeys)),
+	}
+	if account != nil {
+		result.Balance = (*hexutil.Big)(account.Balance)
+		result.CodeHash = common.BytesToHash(account.CodeHash)
+		result.Nonce = hexutil.Uint64(account.Nonce)
+		result.StorageHash = account.Root
+	}
+	// Prove all the requested storage slots against the account's storage root
+	for i, hash := range keys {
+		proof, err := statedb.GetStorageProof(ctx, address, hash)
+		if err != nil {
+			return nil, err
+		}
+		value, err := state.VerifyStorageProof(result.StorageHash, hash, proof)
+		if err != nil {
+			return nil, fmt.Errorf("invalid storage proof for %x: %v", hash, err)
+		}
+		result.StorageProof[i] = StorageResult{
+			Key:   hash,
+			Value: (*hexutil.Big)(value.Big()),
+			Proof: toHexSlice(proof),
+		}
+	}
+	return result, nil
+}
+
+// decodeStorageKey parses a hex encoded storage slot of at most 32 bytes, left
+// padding shorter keys with zeroes.
+func decodeStorageKey(key string) (common.Hash, error) {
+	blob, err := hexutil.Decode(key)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(blob) > common.HashLength {
+		return common.Hash{}, fmt.Errorf("key too long: %d bytes", len(blob))
+	}
+	return common.BytesToHash(blob), nil
+}
+
+// toHexSlice converts a list of RLP encoded trie nodes into their JSON friendly
+// hex representation.
+func toHexSlice(nodes []rlp.RawValue) []hexutil.Bytes {
+	hexed := make([]hexutil.Bytes, len(nodes))
+	for i, node := range nodes {
+		hexed[i] = hexutil.Bytes(node)
+	}
+	return hexed
+}
+
 // callmsg is the message type used for call transitions.
 type callmsg struct {
 	addr          common.Address
@@ -578,17 +697,13 @@ type CallArgs struct {
 	Data     hexutil.Bytes   `json:"data"`
 }
 
-func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, vmCfg vm.Config) ([]byte, *big.Int, error) {
-	defer func(start time.Time) { log.Debug(fmt.Sprintf("call took %v", time.Since(start))) }(time.Now())
-
-	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
-	if state == nil || err != nil {
-		return nil, common.Big0, err
-	}
+// ToMessage converts the call arguments into a message executable by the EVM,
+// filling in defaults for the sender, gas and gas price if they are not set.
+func (args *CallArgs) ToMessage(am *accounts.Manager) types.Message {
 	// Set sender address or use a default if none specified
 	addr := args.From
 	if addr == (common.Address{}) {
-		if wallets := s.b.AccountManager().Wallets(); len(wallets) > 0 {
+		if wallets := am.Wallets(); len(wallets) > 0 {
 			if accounts := wallets[0].Accounts(); len(accounts) > 0 {
 				addr = accounts[0].Address
 			}
@@ -602,9 +717,18 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	if gasPrice.Sign() == 0 {
 		gasPrice = new(big.Int).SetUint64(defaultGasPrice)
 	}
+	return types.NewMessage(addr, args.To, 0, args.Value.ToInt(), gas, gasPrice, args.Data, false)
+}
+
+func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, vmCfg vm.Config) ([]byte, *big.Int, error) {
+	defer func(start time.Time) { log.Debug(fmt.Sprintf("call took %v", time.Since(start))) }(time.Now())
 
+	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, common.Big0, err
+	}
 	// Create new call message
-	msg := types.NewMessage(addr, args.To, 0, args.Value.ToInt(), gas, gasPrice, args.Data, false)
+	msg := args.ToMessage(s.b.AccountManager())
 
 	// Setup context so it may be cancelled the call has completed
 	// or, in case of unmetered gas, setup a context with a timeout.
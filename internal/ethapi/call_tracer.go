@@ -0,0 +1,260 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"errors"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// CallTracerName is the name by which the native call tracer can be selected
+// in place of a Javascript tracer.
+const CallTracerName = "callTracer"
+
+// errInternalFailure is reported for calls that returned a failure without the
+// callee itself erroring (e.g. call depth or balance checks failed).
+var errInternalFailure = errors.New("internal failure")
+
+// CallFrame is a single (nested) call made during the execution of a transaction.
+type CallFrame struct {
+	Type    string          `json:"type"`
+	From    common.Address  `json:"from"`
+	To      *common.Address `json:"to,omitempty"`
+	Value   *hexutil.Big    `json:"value,omitempty"`
+	Gas     *hexutil.Uint64 `json:"gas,omitempty"`
+	GasUsed *hexutil.Uint64 `json:"gasUsed,omitempty"`
+	Input   hexutil.Bytes   `json:"input"`
+	Output  hexutil.Bytes   `json:"output,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Calls   []*CallFrame    `json:"calls,omitempty"`
+
+	gasIn  uint64 // Gas available to the caller after paying for the call
+	outOff int64  // Memory offset of the call output in the caller
+	outLen int64  // Memory size of the call output in the caller
+}
+
+// CallTracer is a native implementation of vm.Tracer, which reconstructs the
+// tree of calls and contract creations made by a transaction, without the
+// overhead of evaluating a Javascript tracer on every VM step.
+//
+// As individual VM steps don't expose the parameters and results of the top
+// level call, those need to be injected via CaptureStart and CaptureEnd.
+type CallTracer struct {
+	callstack []*CallFrame // Currently active calls, the outermost being the transaction
+	descended bool         // Whether the last step entered into a new call
+
+	interrupt uint32 // Atomic flag to signal the tracer to abort execution
+	reason    error  // Reason for the interruption, set before the flag
+}
+
+// NewCallTracer creates a new native call tracer.
+func NewCallTracer() *CallTracer {
+	return &CallTracer{
+		callstack: []*CallFrame{{}},
+	}
+}
+
+// CaptureStart records the parameters of the top level call, which are not
+// visible to the tracer from the individual execution steps.
+func (t *CallTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	call := t.callstack[0]
+
+	call.Type = "CALL"
+	if create {
+		call.Type = "CREATE"
+	}
+	call.From, call.To = from, &to
+	call.Input = common.CopyBytes(input)
+	call.Gas = newUint64(gas)
+	call.Value = (*hexutil.Big)(new(big.Int).Set(value))
+}
+
+// CaptureEnd records the results of the top level call.
+func (t *CallTracer) CaptureEnd(output []byte, gasUsed uint64) {
+	call := t.callstack[0]
+
+	call.Output = common.CopyBytes(output)
+	call.GasUsed = newUint64(gasUsed)
+}
+
+// Stop terminates the execution of the traced transaction at the next VM step.
+func (t *CallTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
+
+// CaptureState implements the vm.Tracer interface to trace a single step of VM
+// execution, tracking the calls entered and returned from.
+func (t *CallTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost *big.Int, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	// Abort the execution if the tracer was interrupted
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		env.Cancel()
+		return nil
+	}
+	if err != nil {
+		t.fault(gas.Uint64(), err)
+		return nil
+	}
+	// If a new call was just entered, record the gas it was given. Calls into
+	// accounts without code return without executing any steps: creations were
+	// handed all the caller's gas, whereas plain calls gave all of theirs back.
+	if t.descended {
+		call := t.callstack[len(t.callstack)-1]
+		switch {
+		case depth >= len(t.callstack):
+			call.Gas = newUint64(gas.Uint64() + cost.Uint64())
+		case call.Type == vm.CREATE.String():
+			call.Gas = newUint64(call.gasIn)
+		default:
+			call.Gas = newUint64(gas.Uint64() + cost.Uint64() - call.gasIn)
+		}
+		t.descended = false
+	}
+	// If a call just returned, finalize it and attach it to its parent
+	if depth == len(t.callstack)-1 {
+		t.exit(env, gas.Uint64()+cost.Uint64(), memory, stack)
+	}
+	// Open up a new call frame for any call made by the current step
+	switch op {
+	case vm.CREATE:
+		inOff, inLen := stack.Back(1).Int64(), stack.Back(2).Int64()
+		t.enter(&CallFrame{
+			Type:  op.String(),
+			From:  contract.Address(),
+			Input: memory.Get(inOff, inLen),
+			Value: (*hexutil.Big)(new(big.Int).Set(stack.Back(0))),
+			gasIn: gas.Uint64(),
+		})
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL:
+		to := common.BigToAddress(stack.Back(1))
+		if _, ok := vm.PrecompiledContracts[to]; ok {
+			return nil
+		}
+		off := 1
+		if op == vm.DELEGATECALL {
+			off = 0
+		}
+		inOff, inLen := stack.Back(2+off).Int64(), stack.Back(3+off).Int64()
+		call := &CallFrame{
+			Type:   op.String(),
+			From:   contract.Address(),
+			To:     &to,
+			Input:  memory.Get(inOff, inLen),
+			gasIn:  gas.Uint64(),
+			outOff: stack.Back(4 + off).Int64(),
+			outLen: stack.Back(5 + off).Int64(),
+		}
+		if op != vm.DELEGATECALL {
+			call.Value = (*hexutil.Big)(new(big.Int).Set(stack.Back(2)))
+		}
+		t.enter(call)
+
+	case vm.SELFDESTRUCT:
+		to := common.BigToAddress(stack.Back(0))
+
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, &CallFrame{
+			Type:  op.String(),
+			From:  contract.Address(),
+			To:    &to,
+			Value: (*hexutil.Big)(new(big.Int).Set(env.StateDB.GetBalance(contract.Address()))),
+		})
+	}
+	return nil
+}
+
+// enter pushes a new call frame onto the call stack.
+func (t *CallTracer) enter(call *CallFrame) {
+	t.callstack = append(t.callstack, call)
+	t.descended = true
+}
+
+// exit pops the innermost call frame after it returned, filling in its results
+// from the state of the caller and attaching it to the caller's frame.
+func (t *CallTracer) exit(env *vm.EVM, gas uint64, memory *vm.Memory, stack *vm.Stack) {
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+
+	ret := stack.Back(0)
+	switch call.Type {
+	case vm.CREATE.String():
+		call.GasUsed = newUint64(call.gasIn - gas)
+		if ret.Sign() != 0 {
+			addr := common.BigToAddress(ret)
+			call.To = &addr
+			call.Output = env.StateDB.GetCode(addr)
+		}
+	default:
+		if call.Gas != nil {
+			call.GasUsed = newUint64(uint64(*call.Gas) + call.gasIn - gas)
+		}
+		if ret.Sign() != 0 {
+			call.Output = memory.Get(call.outOff, call.outLen)
+		}
+	}
+	if ret.Sign() == 0 && call.Error == "" {
+		call.Error = errInternalFailure.Error()
+	}
+	parent := t.callstack[len(t.callstack)-1]
+	parent.Calls = append(parent.Calls, call)
+}
+
+// fault marks the innermost call frame as failed. As failures consume all the
+// gas of a call, the frame is also returned to its caller immediately.
+func (t *CallTracer) fault(gas uint64, err error) {
+	call := t.callstack[len(t.callstack)-1]
+	if call.Error != "" {
+		return
+	}
+	call.Error = err.Error()
+
+	// If the call failed on its first step, its gas allowance is still unknown
+	if t.descended {
+		call.Gas = newUint64(gas)
+		t.descended = false
+	}
+	if call.Gas != nil {
+		call.GasUsed = newUint64(uint64(*call.Gas))
+	}
+	if len(t.callstack) > 1 {
+		t.callstack = t.callstack[:len(t.callstack)-1]
+
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+	}
+}
+
+// GetResult returns the reconstructed call tree of the traced transaction, or
+// the reason the tracing was interrupted.
+func (t *CallTracer) GetResult() (*CallFrame, error) {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return nil, t.reason
+	}
+	return t.callstack[0], nil
+}
+
+// newUint64 returns a pointer to a hexutil.Uint64 with the given value.
+func newUint64(n uint64) *hexutil.Uint64 {
+	v := hexutil.Uint64(n)
+	return &v
+}
@@ -0,0 +1,226 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	callTracerCaller = common.HexToAddress("0x01000000000000000000000000000000000000ca")
+	callTracerOuter  = common.HexToAddress("0x01000000000000000000000000000000000000aa")
+	callTracerInner  = common.HexToAddress("0x01000000000000000000000000000000000000bb")
+	callTracerFaulty = common.HexToAddress("0x01000000000000000000000000000000000000cc")
+)
+
+// callCode assembles the code calling the given address with the specified value
+// and gas allowance, returning 32 bytes of output at memory offset zero.
+func callCode(to common.Address, value byte, gas uint16) []byte {
+	code := []byte{
+		byte(vm.PUSH1), 0x20, // out size
+		byte(vm.PUSH1), 0x00, // out offset
+		byte(vm.PUSH1), 0x00, // in size
+		byte(vm.PUSH1), 0x00, // in offset
+		byte(vm.PUSH1), value,
+		byte(vm.PUSH20),
+	}
+	code = append(code, to[:]...)
+	return append(code, byte(vm.PUSH2), byte(gas>>8), byte(gas), byte(vm.CALL), byte(vm.POP))
+}
+
+// runCallTrace deploys a contract calling into a successful and a failing one,
+// and traces a top level call into it.
+func runCallTrace(t *testing.T, tracer *CallTracer) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, db)
+
+	// The inner contract returns 32 bytes of 0x2a, the faulty one hits an invalid opcode
+	statedb.SetCode(callTracerInner, []byte{
+		byte(vm.PUSH1), 0x2a, byte(vm.PUSH1), 0x00, byte(vm.MSTORE),
+		byte(vm.PUSH1), 0x20, byte(vm.PUSH1), 0x00, byte(vm.RETURN),
+	})
+	statedb.SetCode(callTracerFaulty, []byte{0xfe})
+
+	// The outer contract calls both, returning the output of the first
+	code := append(callCode(callTracerInner, 0, 0xffff), callCode(callTracerFaulty, 0, 0x1000)...)
+	code = append(code, byte(vm.PUSH1), 0x20, byte(vm.PUSH1), 0x00, byte(vm.RETURN))
+	statedb.SetCode(callTracerOuter, code)
+
+	cfg := &runtime.Config{
+		ChainConfig: params.TestChainConfig,
+		State:       statedb,
+		GasLimit:    100000,
+		Origin:      callTracerCaller,
+		EVMConfig:   vm.Config{Debug: true, Tracer: tracer},
+		BlockNumber: new(big.Int),
+		Time:        new(big.Int),
+		Value:       new(big.Int),
+	}
+	env := runtime.NewEnv(cfg, statedb)
+
+	tracer.CaptureStart(callTracerCaller, callTracerOuter, false, nil, cfg.GasLimit, cfg.Value)
+	ret, gas, err := env.Call(vm.AccountRef(callTracerCaller), callTracerOuter, nil, cfg.GasLimit, cfg.Value)
+	if err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	tracer.CaptureEnd(ret, cfg.GasLimit-gas)
+}
+
+func TestCallTracer(t *testing.T) {
+	tracer := NewCallTracer()
+	runCallTrace(t, tracer)
+
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	// Verify the top level call
+	if res.Type != "CALL" || res.From != callTracerCaller || *res.To != callTracerOuter {
+		t.Errorf("top call mismatch: have %s %x -> %x, want CALL %x -> %x", res.Type, res.From, *res.To, callTracerCaller, callTracerOuter)
+	}
+	if uint64(*res.Gas) != 100000 {
+		t.Errorf("top call gas mismatch: have %d, want %d", *res.Gas, 100000)
+	}
+	if want := common.LeftPadBytes([]byte{0x2a}, 32); !bytes.Equal(res.Output, want) {
+		t.Errorf("top call output mismatch: have %x, want %x", res.Output, want)
+	}
+	if res.Error != "" {
+		t.Errorf("top call failed: %v", res.Error)
+	}
+	if len(res.Calls) != 2 {
+		t.Fatalf("inner call count mismatch: have %d, want %d", len(res.Calls), 2)
+	}
+	// Verify the successful inner call
+	inner := res.Calls[0]
+	if inner.Type != "CALL" || inner.From != callTracerOuter || *inner.To != callTracerInner {
+		t.Errorf("inner call mismatch: have %s %x -> %x, want CALL %x -> %x", inner.Type, inner.From, *inner.To, callTracerOuter, callTracerInner)
+	}
+	if inner.Gas == nil || inner.GasUsed == nil {
+		t.Fatalf("inner call gas missing: gas %v, used %v", inner.Gas, inner.GasUsed)
+	}
+	if uint64(*inner.Gas) != 0xffff {
+		t.Errorf("inner call gas mismatch: have %d, want %d", *inner.Gas, 0xffff)
+	}
+	if uint64(*inner.GasUsed) != 18 { // 4 pushes + mstore with one word of memory
+		t.Errorf("inner call gas used mismatch: have %d, want %d", *inner.GasUsed, 18)
+	}
+	if want := common.LeftPadBytes([]byte{0x2a}, 32); !bytes.Equal(inner.Output, want) {
+		t.Errorf("inner call output mismatch: have %x, want %x", inner.Output, want)
+	}
+	if inner.Error != "" {
+		t.Errorf("inner call failed: %v", inner.Error)
+	}
+	// Verify the failing inner call
+	faulty := res.Calls[1]
+	if faulty.Type != "CALL" || faulty.From != callTracerOuter || *faulty.To != callTracerFaulty {
+		t.Errorf("faulty call mismatch: have %s %x -> %x, want CALL %x -> %x", faulty.Type, faulty.From, *faulty.To, callTracerOuter, callTracerFaulty)
+	}
+	if faulty.Error == "" {
+		t.Errorf("faulty call succeeded")
+	}
+	if faulty.Gas == nil || faulty.GasUsed == nil || *faulty.GasUsed != *faulty.Gas {
+		t.Errorf("faulty call gas mismatch: gas %v, used %v", faulty.Gas, faulty.GasUsed)
+	}
+	if len(faulty.Output) != 0 {
+		t.Errorf("faulty call returned output: %x", faulty.Output)
+	}
+}
+
+func TestCallTracerHalt(t *testing.T) {
+	stop := errors.New("stop")
+
+	tracer := NewCallTracer()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		tracer.Stop(stop)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	runCallTrace(t, tracer)
+
+	if _, err := tracer.GetResult(); err != stop {
+		t.Errorf("expected interruption error, have %v", err)
+	}
+}
+
+// Tests that value transfers to accounts without code report the gas they were
+// given, and that none of it was used.
+func TestCallTracerPlainTransfer(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, db)
+
+	// The outer contract sends some of its funds to a plain account
+	statedb.SetCode(callTracerOuter, append(callCode(callTracerInner, 0x2a, 0x1000), byte(vm.STOP)))
+	statedb.AddBalance(callTracerOuter, big.NewInt(1000))
+
+	tracer := NewCallTracer()
+	cfg := &runtime.Config{
+		ChainConfig: params.TestChainConfig,
+		State:       statedb,
+		GasLimit:    100000,
+		Origin:      callTracerCaller,
+		EVMConfig:   vm.Config{Debug: true, Tracer: tracer},
+		BlockNumber: new(big.Int),
+		Time:        new(big.Int),
+		Value:       new(big.Int),
+	}
+	env := runtime.NewEnv(cfg, statedb)
+
+	tracer.CaptureStart(callTracerCaller, callTracerOuter, false, nil, cfg.GasLimit, cfg.Value)
+	ret, gas, err := env.Call(vm.AccountRef(callTracerCaller), callTracerOuter, nil, cfg.GasLimit, cfg.Value)
+	if err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	tracer.CaptureEnd(ret, cfg.GasLimit-gas)
+
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	if len(res.Calls) != 1 {
+		t.Fatalf("inner call count mismatch: have %d, want %d", len(res.Calls), 1)
+	}
+	transfer := res.Calls[0]
+	if transfer.Type != "CALL" || *transfer.To != callTracerInner || transfer.Value.ToInt().Cmp(big.NewInt(0x2a)) != 0 {
+		t.Errorf("transfer mismatch: have %s -> %x (%v), want CALL -> %x (%d)", transfer.Type, *transfer.To, transfer.Value, callTracerInner, 0x2a)
+	}
+	if transfer.Gas == nil || transfer.GasUsed == nil {
+		t.Fatalf("transfer gas missing: gas %v, used %v", transfer.Gas, transfer.GasUsed)
+	}
+	if want := uint64(0x1000) + params.CallStipend; uint64(*transfer.Gas) != want {
+		t.Errorf("transfer gas mismatch: have %d, want %d", *transfer.Gas, want)
+	}
+	if *transfer.GasUsed != 0 {
+		t.Errorf("transfer gas used mismatch: have %d, want 0", *transfer.GasUsed)
+	}
+	if transfer.Error != "" {
+		t.Errorf("transfer failed: %v", transfer.Error)
+	}
+	if balance := statedb.GetBalance(callTracerInner); balance.Cmp(big.NewInt(0x2a)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v, want %d", balance, 0x2a)
+	}
+}
@@ -42,11 +42,12 @@ type LesServer struct {
 	fcManager       *flowcontrol.ClientManager // nil if our node is client only
 	fcCostStats     *requestCostStats
 	defParams       *flowcontrol.ServerParams
+	chtIndexer      *core.ChainIndexer
 	stopped         bool
 }
 
 func NewLesServer(eth *eth.Ethereum, config *eth.Config) (*LesServer, error) {
-	pm, err := NewProtocolManager(config.ChainConfig, false, config.NetworkId, eth.EventMux(), eth.Pow(), eth.BlockChain(), eth.TxPool(), eth.ChainDb(), nil, nil)
+	pm, err := NewProtocolManager(config.ChainConfig, false, config.NetworkId, eth.EventMux(), eth.Engine(), eth.BlockChain(), eth.TxPool(), eth.ChainDb(), nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +62,10 @@ func NewLesServer(eth *eth.Ethereum, config *eth.Config) (*LesServer, error) {
 	}
 	srv.fcManager = flowcontrol.NewClientManager(uint64(config.LightServ), 10, 1000000000)
 	srv.fcCostStats = newCostStats(eth.ChainDb())
+
+	srv.chtIndexer = newChtIndexer(eth.ChainDb())
+	srv.chtIndexer.Start(eth.BlockChain().CurrentHeader(), eth.EventMux())
+
 	return srv, nil
 }
 
@@ -75,6 +80,7 @@ func (s *LesServer) Start(srvr *p2p.Server) {
 
 // Stop stops the LES service
 func (s *LesServer) Stop() {
+	s.chtIndexer.Close()
 	s.fcCostStats.store()
 	s.fcManager.Stop()
 	go func() {
@@ -269,10 +275,7 @@ func (s *requestCostStats) update(msgCode, reqCnt, cost uint64) {
 func (pm *ProtocolManager) blockLoop() {
 	pm.wg.Add(1)
 	sub := pm.eventMux.Subscribe(core.ChainHeadEvent{})
-	newCht := make(chan struct{}, 10)
-	newCht <- struct{}{}
 	go func() {
-		var mu sync.Mutex
 		var lastHead *types.Header
 		lastBroadcastTd := common.Big0
 		for {
@@ -304,17 +307,6 @@ func (pm *ProtocolManager) blockLoop() {
 						}
 					}
 				}
-				newCht <- struct{}{}
-			case <-newCht:
-				go func() {
-					mu.Lock()
-					more := makeCht(pm.chainDb)
-					mu.Unlock()
-					if more {
-						time.Sleep(time.Millisecond * 10)
-						newCht <- struct{}{}
-					}
-				}()
 			case <-pm.quitSync:
 				sub.Unsubscribe()
 				pm.wg.Done()
@@ -325,10 +317,14 @@ func (pm *ProtocolManager) blockLoop() {
 }
 
 var (
-	lastChtKey = []byte("LastChtNumber") // chtNum (uint64 big endian)
-	chtPrefix  = []byte("cht")           // chtPrefix + chtNum (uint64 big endian) -> trie root hash
+	chtPrefix      = []byte("cht")       // chtPrefix + chtNum (uint64 big endian) -> trie root hash
+	chtIndexPrefix = []byte("chtIndex-") // chtIndexPrefix is the data table of the CHT indexer to track its progress
 )
 
+// chtThrottling is the time to wait between processing two consecutive CHT
+// sections, preventing a full rebuild from hogging the disk.
+const chtThrottling = 100 * time.Millisecond
+
 func getChtRoot(db ethdb.Database, num uint64) common.Hash {
 	var encNumber [8]byte
 	binary.BigEndian.PutUint64(encNumber[:], num)
@@ -342,67 +338,67 @@ func storeChtRoot(db ethdb.Database, num uint64, root common.Hash) {
 	db.Put(append(chtPrefix, encNumber[:]...), root[:])
 }
 
-func makeCht(db ethdb.Database) bool {
-	headHash := core.GetHeadBlockHash(db)
-	headNum := core.GetBlockNumber(db, headHash)
+// chtIndexerBackend implements core.ChainIndexerBackend, building up the
+// canonical hash tries served to light clients. Every section extends the trie
+// of the previous one, the root after N sections being stored as CHT number N.
+type chtIndexerBackend struct {
+	db      ethdb.Database
+	section uint64
+	trie    *trie.Trie
+	err     error
+}
 
-	var newChtNum uint64
-	if headNum > light.ChtConfirmations {
-		newChtNum = (headNum - light.ChtConfirmations) / light.ChtFrequency
-	}
+// newChtIndexer creates a chain indexer generating the canonical hash tries of
+// the local chain.
+func newChtIndexer(db ethdb.Database) *core.ChainIndexer {
+	backend := &chtIndexerBackend{db: db}
+	table := ethdb.NewTable(db, string(chtIndexPrefix))
 
-	var lastChtNum uint64
-	data, _ := db.Get(lastChtKey)
-	if len(data) == 8 {
-		lastChtNum = binary.BigEndian.Uint64(data[:])
-	}
-	if newChtNum <= lastChtNum {
-		return false
-	}
+	return core.NewChainIndexer(db, table, backend, light.ChtFrequency, light.ChtConfirmations+1, chtThrottling, "cht")
+}
 
-	var t *trie.Trie
-	if lastChtNum > 0 {
-		var err error
-		t, err = trie.New(getChtRoot(db, lastChtNum), db)
-		if err != nil {
-			lastChtNum = 0
-		}
-	}
-	if lastChtNum == 0 {
-		t, _ = trie.New(common.Hash{}, db)
+// Reset implements core.ChainIndexerBackend, opening the trie of the previous
+// section to extend it.
+func (c *chtIndexerBackend) Reset(section uint64) error {
+	var root common.Hash
+	if section > 0 {
+		root = getChtRoot(c.db, section)
 	}
+	t, err := trie.New(root, c.db)
+	c.trie, c.section, c.err = t, section, err
+	return err
+}
 
-	for num := lastChtNum * light.ChtFrequency; num < (lastChtNum+1)*light.ChtFrequency; num++ {
-		hash := core.GetCanonicalHash(db, num)
-		if hash == (common.Hash{}) {
-			panic("Canonical hash not found")
-		}
-		td := core.GetTd(db, hash, num)
-		if td == nil {
-			panic("TD not found")
+// Process implements core.ChainIndexerBackend, adding the hash and total
+// difficulty of a canonical header into the trie.
+func (c *chtIndexerBackend) Process(header *types.Header) {
+	hash, num := header.Hash(), header.Number.Uint64()
+
+	td := core.GetTd(c.db, hash, num)
+	if td == nil {
+		if c.err == nil {
+			c.err = fmt.Errorf("total difficulty of block #%d [%x…] unknown", num, hash[:4])
 		}
-		var encNumber [8]byte
-		binary.BigEndian.PutUint64(encNumber[:], num)
-		var node light.ChtNode
-		node.Hash = hash
-		node.Td = td
-		data, _ := rlp.EncodeToBytes(node)
-		t.Update(encNumber[:], data)
+		return
 	}
+	var encNumber [8]byte
+	binary.BigEndian.PutUint64(encNumber[:], num)
+	data, _ := rlp.EncodeToBytes(light.ChtNode{Hash: hash, Td: td})
+	c.trie.Update(encNumber[:], data)
+}
 
-	root, err := t.Commit()
+// Commit implements core.ChainIndexerBackend, storing the root of the extended
+// trie as the next CHT.
+func (c *chtIndexerBackend) Commit() error {
+	if c.err != nil {
+		return c.err
+	}
+	root, err := c.trie.Commit()
 	if err != nil {
-		lastChtNum = 0
-	} else {
-		lastChtNum++
-
-		log.Trace(fmt.Sprintf("cht: %d %064x", lastChtNum, root))
-
-		storeChtRoot(db, lastChtNum, root)
-		var data [8]byte
-		binary.BigEndian.PutUint64(data[:], lastChtNum)
-		db.Put(lastChtKey, data[:])
+		return err
 	}
+	storeChtRoot(c.db, c.section+1, root)
+	log.Trace("Stored new CHT", "number", c.section+1, "root", root)
 
-	return newChtNum > lastChtNum
+	return nil
 }
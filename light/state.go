@@ -23,6 +23,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
 	"golang.org/x/net/context"
 )
 
@@ -118,6 +119,23 @@ func (self *LightState) GetState(ctx context.Context, a common.Address, b common
 	return common.Hash{}, err
 }
 
+// GetProof returns the Merkle proof of the given account in the account trie,
+// proving its absence if it doesn't exist.
+func (self *LightState) GetProof(ctx context.Context, addr common.Address) ([]rlp.RawValue, error) {
+	return self.trie.Prove(ctx, addr[:])
+}
+
+// GetStorageProof returns the Merkle proof of the given storage slot in the
+// storage trie of an account. Accounts not present have an empty storage trie,
+// proven by an empty proof.
+func (self *LightState) GetStorageProof(ctx context.Context, addr common.Address, key common.Hash) ([]rlp.RawValue, error) {
+	stateObject, err := self.GetStateObject(ctx, addr)
+	if stateObject == nil || err != nil {
+		return nil, err
+	}
+	return stateObject.trie.Prove(ctx, key[:])
+}
+
 // HasSuicided returns true if the given account has been marked for deletion
 // or false if the account does not exist
 func (self *LightState) HasSuicided(ctx context.Context, addr common.Address) (bool, error) {
@@ -18,6 +18,7 @@ package light
 
 import (
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 	"golang.org/x/net/context"
 )
@@ -120,3 +121,12 @@ func (t *LightTrie) Delete(ctx context.Context, key []byte) (err error) {
 	})
 	return
 }
+
+// Prove constructs a merkle proof for key, retrieving any trie nodes missing on
+// the path to it from the network first.
+func (t *LightTrie) Prove(ctx context.Context, key []byte) ([]rlp.RawValue, error) {
+	if _, err := t.Get(ctx, key); err != nil {
+		return nil, err
+	}
+	return t.trie.Prove(key), nil
+}
@@ -27,6 +27,7 @@ import (
 	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/accounts/usbwallet"
 	"github.com/ethereum/go-ethereum/common"
@@ -36,6 +37,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/discv5"
 	"github.com/ethereum/go-ethereum/p2p/nat"
 	"github.com/ethereum/go-ethereum/p2p/netutil"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 var (
@@ -82,6 +84,10 @@ type Config struct {
 	// scrypt KDF at the expense of security.
 	UseLightweightKDF bool
 
+	// ExternalSigner is the endpoint (IPC path or HTTP URL) of an external signer
+	// to forward transaction signing to, keeping the keys out of the node.
+	ExternalSigner string
+
 	// IPCPath is the requested location to place the IPC endpoint. If the path is
 	// a simple file name, it is placed inside the data directory (or on the root
 	// pipe path on Windows), whereas if it's a resolvable path name (absolute or
@@ -158,6 +164,16 @@ type Config struct {
 	// exposed.
 	HTTPModules []string
 
+	// HTTPVirtualHosts is the list of virtual hostnames which are allowed on incoming
+	// HTTP requests, protecting against DNS rebinding attacks. Requests addressed to
+	// IP addresses are always accepted. Use "*" to allow any host name. If the list
+	// is empty, only localhost is allowed.
+	HTTPVirtualHosts []string
+
+	// HTTPServerConfig contains the request limits and method restrictions of the
+	// HTTP RPC interface.
+	HTTPServerConfig rpc.ServerConfig
+
 	// WSHost is the host interface on which to start the websocket RPC server. If
 	// this field is empty, no websocket API endpoint will be started.
 	WSHost string
@@ -176,6 +192,10 @@ type Config struct {
 	// If the module list is empty, all RPC API endpoints designated public will be
 	// exposed.
 	WSModules []string
+
+	// WSServerConfig contains the request limits and method restrictions of the
+	// websocket RPC interface.
+	WSServerConfig rpc.ServerConfig
 }
 
 // IPCEndpoint resolves an IPC endpoint based on a configured value, taking into
@@ -440,10 +460,22 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 	backends := []accounts.Backend{
 		keystore.NewKeyStore(keydir, scryptN, scryptP),
 	}
+	if conf.ExternalSigner != "" {
+		signer, err := external.NewExternalBackend(conf.ExternalSigner)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to connect to external signer: %v", err)
+		}
+		backends = append(backends, signer)
+	}
 	if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
 		log.Warn(fmt.Sprintf("Failed to start Ledger hub, disabling: %v", err))
 	} else {
 		backends = append(backends, ledgerhub)
 	}
+	if trezorhub, err := usbwallet.NewTrezorHub(); err != nil {
+		log.Warn(fmt.Sprintf("Failed to start Trezor hub, disabling: %v", err))
+	} else {
+		backends = append(backends, trezorhub)
+	}
 	return accounts.NewManager(backends...), ephemeral, nil
 }
@@ -0,0 +1,81 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"strings"
+	"time"
+)
+
+// ServerConfig contains the request limits and method access restrictions of an
+// RPC server. Public endpoints usually configure these separately per transport.
+type ServerConfig struct {
+	// AllowedMethods is the list of methods which may be called, all methods of
+	// the registered modules being callable if empty. Entries are either full
+	// method names (e.g. eth_getBalance) or whole namespaces (e.g. eth_*).
+	AllowedMethods []string
+
+	// DeniedMethods is the list of methods which may not be called, even if they
+	// are allowed by AllowedMethods. Entries use the same format.
+	DeniedMethods []string
+
+	// BatchLimit is the maximum number of requests accepted in a single batch,
+	// or zero for no limit.
+	BatchLimit int
+
+	// BodyLimit is the maximum size in bytes of an HTTP request body or of a
+	// websocket message, or zero for the transport default.
+	BodyLimit int
+
+	// CallTimeout is the maximum execution time of a single method call, after
+	// which its context is cancelled and an error returned. Zero means no limit.
+	CallTimeout time.Duration
+}
+
+// SetConfig configures the request limits and method restrictions of the server.
+// It must be called before the server starts serving requests.
+func (s *Server) SetConfig(config ServerConfig) {
+	s.config = config
+}
+
+// methodAllowed checks whether a method (in namespace_method format) may be
+// called based on the configured allow and deny lists.
+func (c *ServerConfig) methodAllowed(method string) bool {
+	for _, pattern := range c.DeniedMethods {
+		if matchMethod(pattern, method) {
+			return false
+		}
+	}
+	if len(c.AllowedMethods) == 0 {
+		return true
+	}
+	for _, pattern := range c.AllowedMethods {
+		if matchMethod(pattern, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMethod checks whether a method matches an allow/deny list entry, which is
+// either a full method name or a namespace wildcard.
+func matchMethod(pattern, method string) bool {
+	if strings.HasSuffix(pattern, serviceMethodSeparator+"*") {
+		return strings.HasPrefix(method, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == method
+}
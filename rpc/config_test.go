@@ -0,0 +1,149 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMethodAllowed(t *testing.T) {
+	config := ServerConfig{
+		AllowedMethods: []string{"eth_*", "net_version"},
+		DeniedMethods:  []string{"eth_sign"},
+	}
+	tests := []struct {
+		method  string
+		allowed bool
+	}{
+		{"eth_getBalance", true},
+		{"eth_sign", false},
+		{"net_version", true},
+		{"net_peerCount", false},
+		{"ethx_call", false},
+		{"personal_unlockAccount", false},
+	}
+	for _, tt := range tests {
+		if allowed := config.methodAllowed(tt.method); allowed != tt.allowed {
+			t.Errorf("%s: allowed mismatch: have %v, want %v", tt.method, allowed, tt.allowed)
+		}
+	}
+	// An empty allow list should permit everything not explicitly denied
+	config.AllowedMethods = nil
+	if !config.methodAllowed("personal_unlockAccount") {
+		t.Errorf("method denied with empty allow list")
+	}
+}
+
+func TestServerMethodFilter(t *testing.T) {
+	server := newTestServer("service", new(Service))
+	server.SetConfig(ServerConfig{DeniedMethods: []string{"service_echo"}})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var resp Result
+	err := client.Call(&resp, "service_echo", "hello", 10, &Args{"world"})
+	if rpcErr, ok := err.(Error); !ok || rpcErr.ErrorCode() != -32601 {
+		t.Fatalf("denied method error mismatch: have %v, want method not found", err)
+	}
+	if err := client.Call(nil, "service_noArgsRets"); err != nil {
+		t.Fatalf("allowed method failed: %v", err)
+	}
+}
+
+func TestServerBatchLimit(t *testing.T) {
+	server := newTestServer("service", new(Service))
+	server.SetConfig(ServerConfig{BatchLimit: 2})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	// Batches within the limit should be executed
+	batch := []BatchElem{
+		{Method: "service_echo", Args: []interface{}{"hello", 10, &Args{"world"}}, Result: new(Result)},
+		{Method: "service_echo", Args: []interface{}{"hello", 11, &Args{"world"}}, Result: new(Result)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	for i, elem := range batch {
+		if elem.Error != nil {
+			t.Errorf("request %d: unexpected error: %v", i, elem.Error)
+		}
+	}
+	// Batches over the limit should be rejected as a whole
+	batch = append(batch, BatchElem{Method: "service_echo", Args: []interface{}{"hello", 12, &Args{"world"}}, Result: new(Result)})
+	for i := range batch {
+		batch[i].Error = nil
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	for i, elem := range batch {
+		if rpcErr, ok := elem.Error.(Error); !ok || rpcErr.ErrorCode() != -32600 {
+			t.Errorf("request %d: error mismatch: have %v, want invalid request", i, elem.Error)
+		}
+	}
+}
+
+func TestServerCallTimeout(t *testing.T) {
+	server := newTestServer("service", new(Service))
+	server.SetConfig(ServerConfig{CallTimeout: 50 * time.Millisecond})
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	err := client.Call(nil, "service_sleep", time.Second)
+	if rpcErr, ok := err.(Error); !ok || rpcErr.ErrorCode() != -32002 {
+		t.Fatalf("slow call error mismatch: have %v, want timeout", err)
+	}
+	if err := client.Call(nil, "service_sleep", time.Millisecond); err != nil {
+		t.Fatalf("fast call failed: %v", err)
+	}
+}
+
+func TestVirtualHostHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		vhosts []string
+		host   string
+		code   int
+	}{
+		{nil, "localhost:8545", http.StatusOK},
+		{nil, "", http.StatusOK},
+		{nil, "127.0.0.1:8545", http.StatusOK},
+		{nil, "[::1]:8545", http.StatusOK},
+		{nil, "evil.com", http.StatusForbidden},
+		{[]string{"node.example.com"}, "Node.Example.com:8545", http.StatusOK},
+		{[]string{"node.example.com"}, "localhost", http.StatusForbidden},
+		{[]string{"*"}, "evil.com", http.StatusOK},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Host = tt.host
+
+		rec := httptest.NewRecorder()
+		newVHostHandler(tt.vhosts, ok).ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("test %d: status mismatch: have %d, want %d", i, rec.Code, tt.code)
+		}
+	}
+}
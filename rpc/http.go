@@ -137,32 +137,37 @@ func (t *httpReadWriteNopCloser) Close() error {
 	return nil
 }
 
-// NewHTTPServer creates a new HTTP RPC server around an API provider.
-//
-// Deprecated: Server implements http.Handler
-func NewHTTPServer(corsString string, srv *Server) *http.Server {
-	return &http.Server{Handler: newCorsHandler(srv, corsString)}
+// NewHTTPServer creates a new HTTP server around an API provider (usually an RPC
+// server, but any HTTP handler is accepted), only serving requests addressed to
+// one of the allowed virtual hosts.
+func NewHTTPServer(corsString string, vhosts []string, srv http.Handler) *http.Server {
+	return &http.Server{Handler: newVHostHandler(vhosts, newCorsHandler(srv, corsString))}
 }
 
 // ServeHTTP serves JSON-RPC requests over HTTP.
 func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.ContentLength > maxHTTPRequestContentLength {
+	limit := int64(maxHTTPRequestContentLength)
+	if srv.config.BodyLimit > 0 {
+		limit = int64(srv.config.BodyLimit)
+	}
+	if r.ContentLength > limit {
 		http.Error(w,
-			fmt.Sprintf("content length too large (%d>%d)", r.ContentLength, maxHTTPRequestContentLength),
+			fmt.Sprintf("content length too large (%d>%d)", r.ContentLength, limit),
 			http.StatusRequestEntityTooLarge)
 		return
 	}
 	w.Header().Set("content-type", "application/json")
 
 	// create a codec that reads direct from the request body until
-	// EOF and writes the response to w and order the server to process
+	// EOF (or the size limit for requests without a content length)
+	// and writes the response to w and order the server to process
 	// a single request.
-	codec := NewJSONCodec(&httpReadWriteNopCloser{r.Body, w})
+	codec := NewJSONCodec(&httpReadWriteNopCloser{io.LimitReader(r.Body, limit), w})
 	defer codec.Close()
 	srv.ServeSingleRequest(codec, OptionMethodInvocation)
 }
 
-func newCorsHandler(srv *Server, corsString string) http.Handler {
+func newCorsHandler(srv http.Handler, corsString string) http.Handler {
 	var allowedOrigins []string
 	for _, domain := range strings.Split(corsString, ",") {
 		allowedOrigins = append(allowedOrigins, strings.TrimSpace(domain))
@@ -174,3 +179,55 @@ func newCorsHandler(srv *Server, corsString string) http.Handler {
 	})
 	return c.Handler(srv)
 }
+
+// virtualHostHandler is a handler which validates the Host header of incoming
+// requests. Requests addressed to IP addresses are always accepted, as virtual
+// host checking protects against DNS rebinding attacks, which can only forge
+// host names, not addresses.
+type virtualHostHandler struct {
+	vhosts map[string]struct{}
+	next   http.Handler
+}
+
+// newVHostHandler creates a handler accepting requests only for the given virtual
+// hosts, or any of them if "*" is specified. If no virtual hosts are specified,
+// only localhost is allowed.
+func newVHostHandler(vhosts []string, next http.Handler) http.Handler {
+	allowed := make(map[string]struct{})
+	for _, host := range vhosts {
+		if host = strings.TrimSpace(host); host != "" {
+			allowed[strings.ToLower(host)] = struct{}{}
+		}
+	}
+	if len(allowed) == 0 {
+		allowed["localhost"] = struct{}{}
+	}
+	return &virtualHostHandler{vhosts: allowed, next: next}
+}
+
+// ServeHTTP serves the request if its Host header is allowed.
+func (h *virtualHostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// If the Host header is missing, it wasn't sent by a browser, allow it
+	if r.Host == "" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		// Either invalid (too many colons) or no port specified
+		host = r.Host
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	if _, ok := h.vhosts["*"]; ok {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	if _, ok := h.vhosts[strings.ToLower(host)]; ok {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "invalid host specified", http.StatusForbidden)
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/log"
@@ -201,6 +202,21 @@ func (s *Server) serveRequest(codec ServerCodec, singleShot bool, options CodecO
 			return nil
 		}
 
+		// reject batches exceeding the configured limit without executing
+		// any of the contained requests.
+		if batch && s.config.BatchLimit > 0 && len(reqs) > s.config.BatchLimit {
+			err = &invalidRequestError{fmt.Sprintf("batch too large (%d>%d)", len(reqs), s.config.BatchLimit)}
+			resps := make([]interface{}, len(reqs))
+			for i, r := range reqs {
+				resps[i] = codec.CreateErrorResponse(&r.id, err)
+			}
+			codec.Write(resps)
+			if singleShot {
+				return nil
+			}
+			continue
+		}
+
 		if singleShot && batch {
 			s.execBatch(ctx, codec, reqs)
 			return nil
@@ -254,6 +270,12 @@ func (s *Server) createSubscription(ctx context.Context, c ServerCodec, req *ser
 	reply := req.callb.method.Func.Call(args)
 
 	if !reply[1].IsNil() { // subscription creation failed
+		// Drop the subscription if it was created nonetheless, it will never be activated
+		if sub, ok := reply[0].Interface().(*Subscription); ok && sub != nil {
+			if notifier, supported := NotifierFromContext(ctx); supported {
+				notifier.deactivate(sub.ID)
+			}
+		}
 		return "", reply[1].Interface().(error)
 	}
 
@@ -261,7 +283,7 @@ func (s *Server) createSubscription(ctx context.Context, c ServerCodec, req *ser
 }
 
 // handle executes a request and returns the response from the callback.
-func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverRequest) (interface{}, func()) {
+func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverRequest) (interface{}, func(bool)) {
 	if req.err != nil {
 		return codec.CreateErrorResponse(&req.id, req.err), nil
 	}
@@ -289,10 +311,15 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 			return codec.CreateErrorResponse(&req.id, &callbackError{err.Error()}), nil
 		}
 
-		// active the subscription after the sub id was successfully sent to the client
-		activateSub := func() {
+		// active the subscription after the sub id was successfully sent to the client,
+		// or drop it if the client never got to know about it
+		activateSub := func(delivered bool) {
 			notifier, _ := NotifierFromContext(ctx)
-			notifier.activate(subid)
+			if !delivered {
+				notifier.deactivate(subid)
+				return
+			}
+			notifier.activate(subid, req.svcname)
 		}
 
 		return codec.CreateResponse(req.id, subid), activateSub
@@ -306,6 +333,12 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 		return codec.CreateErrorResponse(&req.id, rpcErr), nil
 	}
 
+	// limit the execution time of the call if requested
+	if s.config.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.CallTimeout)
+		defer cancel()
+	}
 	arguments := []reflect.Value{req.callb.rcvr}
 	if req.callb.hasCtx {
 		arguments = append(arguments, reflect.ValueOf(ctx))
@@ -315,7 +348,24 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 	}
 
 	// execute RPC method and return result
-	reply := req.callb.method.Func.Call(arguments)
+	var reply []reflect.Value
+	if s.config.CallTimeout > 0 {
+		// abandon the call if it doesn't return in time, its result is discarded
+		replyc := make(chan []reflect.Value, 1)
+		go func() {
+			replyc <- req.callb.method.Func.Call(arguments)
+		}()
+		select {
+		case reply = <-replyc:
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return codec.CreateErrorResponse(&req.id, &timeoutError{}), nil
+			}
+			return codec.CreateErrorResponse(&req.id, &callbackError{ctx.Err().Error()}), nil
+		}
+	} else {
+		reply = req.callb.method.Func.Call(arguments)
+	}
 	if len(reply) == 0 {
 		return codec.CreateResponse(req.id, nil), nil
 	}
@@ -333,21 +383,22 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 // exec executes the given request and writes the result back using the codec.
 func (s *Server) exec(ctx context.Context, codec ServerCodec, req *serverRequest) {
 	var response interface{}
-	var callback func()
+	var callback func(bool)
 	if req.err != nil {
 		response = codec.CreateErrorResponse(&req.id, req.err)
 	} else {
 		response, callback = s.handle(ctx, codec, req)
 	}
 
-	if err := codec.Write(response); err != nil {
+	err := codec.Write(response)
+	if err != nil {
 		log.Error(fmt.Sprintf("%v\n", err))
 		codec.Close()
 	}
 
 	// when request was a subscribe request this allows these subscriptions to be actived
 	if callback != nil {
-		callback()
+		callback(err == nil)
 	}
 }
 
@@ -355,26 +406,27 @@ func (s *Server) exec(ctx context.Context, codec ServerCodec, req *serverRequest
 // It will only write the response back when the last request is processed.
 func (s *Server) execBatch(ctx context.Context, codec ServerCodec, requests []*serverRequest) {
 	responses := make([]interface{}, len(requests))
-	var callbacks []func()
+	var callbacks []func(bool)
 	for i, req := range requests {
 		if req.err != nil {
 			responses[i] = codec.CreateErrorResponse(&req.id, req.err)
 		} else {
-			var callback func()
+			var callback func(bool)
 			if responses[i], callback = s.handle(ctx, codec, req); callback != nil {
 				callbacks = append(callbacks, callback)
 			}
 		}
 	}
 
-	if err := codec.Write(responses); err != nil {
+	err := codec.Write(responses)
+	if err != nil {
 		log.Error(fmt.Sprintf("%v\n", err))
 		codec.Close()
 	}
 
 	// when request holds one of more subscribe requests this allows these subscriptions to be actived
 	for _, c := range callbacks {
-		c()
+		c(err == nil)
 	}
 }
 
@@ -399,7 +451,7 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 			continue
 		}
 
-		if r.isPubSub && r.method == unsubscribeMethod {
+		if r.isPubSub && strings.HasSuffix(r.method, unsubscribeMethodSuffix) {
 			requests[i] = &serverRequest{id: r.id, isUnsubscribe: true}
 			argTypes := []reflect.Type{reflect.TypeOf("")} // expect subscription id as first arg
 			if args, err := codec.ParseRequestArguments(argTypes, r.params); err == nil {
@@ -415,6 +467,16 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 			continue
 		}
 
+		// subscriptions are filtered by the subscribe method, regular calls by name
+		name := r.service + serviceMethodSeparator + r.method
+		if r.isPubSub {
+			name = r.service + subscribeMethodSuffix
+		}
+		if !s.config.methodAllowed(name) { // rpc method is disabled
+			requests[i] = &serverRequest{id: r.id, err: &methodNotFoundError{r.service, r.method}}
+			continue
+		}
+
 		if r.isPubSub { // eth_subscribe, r.method contains the subscription method name
 			if callb, ok := svc.subscriptions[r.method]; ok {
 				requests[i] = &serverRequest{id: r.id, svcname: svc.name, callb: callb}
@@ -428,7 +490,7 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 					}
 				}
 			} else {
-				requests[i] = &serverRequest{id: r.id, err: &methodNotFoundError{subscribeMethod, r.method}}
+				requests[i] = &serverRequest{id: r.id, err: &methodNotFoundError{r.service + subscribeMethodSuffix, r.method}}
 			}
 			continue
 		}
@@ -0,0 +1,64 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DialStdIO creates a client on stdin/stdout. This can be used for bidirectional
+// RPC where the parent process is the server.
+func DialStdIO(ctx context.Context) (*Client, error) {
+	return DialIO(ctx, os.Stdin, os.Stdout)
+}
+
+// DialIO creates a client which uses the given IO channels.
+func DialIO(ctx context.Context, in io.Reader, out io.Writer) (*Client, error) {
+	return newClient(ctx, func(_ context.Context) (net.Conn, error) {
+		return stdioConn{in, out}, nil
+	})
+}
+
+// stdioConn wraps a pair of IO streams into a net.Conn. Deadlines are silently
+// ignored as the streams have no notion of them.
+type stdioConn struct {
+	in  io.Reader
+	out io.Writer
+}
+
+func (c stdioConn) Read(b []byte) (int, error)  { return c.in.Read(b) }
+func (c stdioConn) Write(b []byte) (int, error) { return c.out.Write(b) }
+
+func (c stdioConn) Close() error { return nil }
+
+func (c stdioConn) LocalAddr() net.Addr  { return stdioAddr{} }
+func (c stdioConn) RemoteAddr() net.Addr { return stdioAddr{} }
+
+func (c stdioConn) SetDeadline(t time.Time) error      { return nil }
+func (c stdioConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c stdioConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// stdioAddr is the net.Addr of both ends of a stdio connection.
+type stdioAddr struct{}
+
+func (stdioAddr) Network() string { return "stdio" }
+func (stdioAddr) String() string  { return "stdio" }
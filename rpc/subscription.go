@@ -28,19 +28,29 @@ var (
 	ErrNotificationsUnsupported = errors.New("notifications not supported")
 	// ErrNotificationNotFound is returned when the notification for the given id is not found
 	ErrSubscriptionNotFound = errors.New("subscription not found")
+	// ErrPendingOverflow is returned when too many notifications are queued up for a
+	// subscription that was never activated, after which the subscription is dropped
+	ErrPendingOverflow = errors.New("too many notifications pending activation")
 )
 
+// maxPendingNotifications is the maximum number of notifications queued up for a
+// subscription before its activation.
+const maxPendingNotifications = 10000
+
 // ID defines a pseudo random number that is used to identify RPC subscriptions.
 type ID string
 
 // a Subscription is created by a notifier and tight to that notifier. The client can use
 // this subscription to wait for an unsubscribe request for the client, see Err().
 type Subscription struct {
-	ID  ID
-	err chan error // closed on unsubscribe
+	ID        ID
+	namespace string        // service the subscription was made on, naming its notifications
+	err       chan error    // closed on unsubscribe
+	pending   []interface{} // notifications queued up until activation
 }
 
-// Err returns a channel that is closed when the client send an unsubscribe request.
+// Err returns a channel that is closed when the client send an unsubscribe request,
+// or when the subscription is dropped before being activated.
 func (s *Subscription) Err() <-chan error {
 	return s.err
 }
@@ -76,10 +86,10 @@ func NotifierFromContext(ctx context.Context) (*Notifier, bool) {
 
 // CreateSubscription returns a new subscription that is coupled to the
 // RPC connection. By default subscriptions are inactive and notifications
-// are dropped until the subscription is marked as active. This is done
+// are queued up until the subscription is marked as active. This is done
 // by the RPC server after the subscription ID is send to the client.
 func (n *Notifier) CreateSubscription() *Subscription {
-	s := &Subscription{NewID(), make(chan error)}
+	s := &Subscription{ID: NewID(), err: make(chan error)}
 	n.subMu.Lock()
 	n.inactive[s.ID] = s
 	n.subMu.Unlock()
@@ -87,18 +97,39 @@ func (n *Notifier) CreateSubscription() *Subscription {
 }
 
 // Notify sends a notification to the client with the given data as payload.
-// If an error occurs the RPC connection is closed and the error is returned.
+// Notifications of subscriptions not yet activated are queued up and sent on
+// activation. If an error occurs the RPC connection is closed and the error is
+// returned.
 func (n *Notifier) Notify(id ID, data interface{}) error {
-	n.subMu.RLock()
-	defer n.subMu.RUnlock()
-
-	_, active := n.active[id]
-	if active {
-		notification := n.codec.CreateNotification(string(id), data)
-		if err := n.codec.Write(notification); err != nil {
-			n.codec.Close()
-			return err
+	n.subMu.Lock()
+	defer n.subMu.Unlock()
+
+	if sub, inactive := n.inactive[id]; inactive {
+		if len(sub.pending) >= maxPendingNotifications {
+			n.drop(sub)
+			return ErrPendingOverflow
 		}
+		sub.pending = append(sub.pending, data)
+		return nil
+	}
+	if sub, active := n.active[id]; active {
+		return n.send(sub, data)
+	}
+	return nil
+}
+
+// send writes a single notification of the subscription to the client, closing
+// the connection on failure.
+func (n *Notifier) send(sub *Subscription, data interface{}) error {
+	var notification interface{}
+	if codec, ok := n.codec.(namespacedCodec); ok && sub.namespace != "" {
+		notification = codec.createNamespacedNotification(string(sub.ID), sub.namespace, data)
+	} else {
+		notification = n.codec.CreateNotification(string(sub.ID), data)
+	}
+	if err := n.codec.Write(notification); err != nil {
+		n.codec.Close()
+		return err
 	}
 	return nil
 }
@@ -122,14 +153,64 @@ func (n *Notifier) unsubscribe(id ID) error {
 }
 
 // activate enables a subscription. Until a subscription is enabled all
-// notifications are dropped. This method is called by the RPC server after
+// notifications are queued up. This method is called by the RPC server after
 // the subscription ID was sent to client. This prevents notifications being
 // send to the client before the subscription ID is send to the client.
-func (n *Notifier) activate(id ID) {
+// The namespace is the service the subscription was made on, used to name the
+// notifications sent for it.
+func (n *Notifier) activate(id ID, namespace string) {
+	n.subMu.Lock()
+	sub, found := n.inactive[id]
+	if !found {
+		n.subMu.Unlock()
+		return
+	}
+	sub.namespace = namespace
+
+	// Flush the queued up notifications without holding the lock, repeating until
+	// no new ones arrive in the meantime to retain their order
+	for {
+		pending := sub.pending
+		sub.pending = nil
+
+		if len(pending) == 0 {
+			n.active[id] = sub
+			delete(n.inactive, id)
+			n.subMu.Unlock()
+			return
+		}
+		n.subMu.Unlock()
+		for _, data := range pending {
+			if err := n.send(sub, data); err != nil {
+				n.subMu.Lock()
+				delete(n.inactive, id)
+				n.subMu.Unlock()
+				return
+			}
+		}
+		n.subMu.Lock()
+		if n.inactive[id] != sub { // dropped while flushing
+			n.subMu.Unlock()
+			return
+		}
+	}
+}
+
+// deactivate drops a subscription which failed to be activated, along with all
+// the notifications queued up for it, signalling its end through Err().
+func (n *Notifier) deactivate(id ID) {
 	n.subMu.Lock()
 	defer n.subMu.Unlock()
+
 	if sub, found := n.inactive[id]; found {
-		n.active[id] = sub
-		delete(n.inactive, id)
+		n.drop(sub)
 	}
 }
+
+// drop removes an inactive subscription and closes its error channel. The caller
+// must hold subMu.
+func (n *Notifier) drop(sub *Subscription) {
+	delete(n.inactive, sub.ID)
+	sub.pending = nil
+	close(sub.err)
+}
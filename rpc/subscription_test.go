@@ -163,3 +163,90 @@ func TestNotifications(t *testing.T) {
 		t.Error("unsubscribe callback not called after closing connection")
 	}
 }
+
+// Tests that notifications queued up for a subscription that is never activated
+// are capped, dropping the subscription when the limit is exceeded.
+func TestNotifierPendingOverflow(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	notifier := newNotifier(NewJSONCodec(server))
+	sub := notifier.CreateSubscription()
+
+	for i := 0; i < maxPendingNotifications; i++ {
+		if err := notifier.Notify(sub.ID, i); err != nil {
+			t.Fatalf("notification %d: failed to queue: %v", i, err)
+		}
+	}
+	if err := notifier.Notify(sub.ID, maxPendingNotifications); err != ErrPendingOverflow {
+		t.Fatalf("overflow error mismatch: have %v, want %v", err, ErrPendingOverflow)
+	}
+	select {
+	case <-sub.Err():
+	default:
+		t.Fatalf("overflowed subscription not closed")
+	}
+	if len(notifier.inactive) != 0 || len(notifier.active) != 0 {
+		t.Fatalf("overflowed subscription retained: %d inactive, %d active", len(notifier.inactive), len(notifier.active))
+	}
+}
+
+// Tests that a subscription which failed to be activated is dropped along with
+// its queued up notifications, and cannot be activated afterwards.
+func TestNotifierDeactivate(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	notifier := newNotifier(NewJSONCodec(server))
+	sub := notifier.CreateSubscription()
+	notifier.Notify(sub.ID, 1)
+
+	notifier.deactivate(sub.ID)
+	select {
+	case <-sub.Err():
+	default:
+		t.Fatalf("deactivated subscription not closed")
+	}
+	notifier.activate(sub.ID, "eth")
+	if len(notifier.inactive) != 0 || len(notifier.active) != 0 {
+		t.Fatalf("deactivated subscription retained: %d inactive, %d active", len(notifier.inactive), len(notifier.active))
+	}
+}
+
+// Tests that notifications queued up before activation are delivered in order,
+// even if new ones are raised while the backlog is being flushed.
+func TestNotifierActivationOrder(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	notifier := newNotifier(NewJSONCodec(server))
+	sub := notifier.CreateSubscription()
+
+	const queued, total = 100, 200
+	for i := 0; i < queued; i++ {
+		notifier.Notify(sub.ID, i+1)
+	}
+	// Activate the subscription while concurrently raising further notifications
+	go notifier.activate(sub.ID, "eth")
+	go func() {
+		for i := queued; i < total; i++ {
+			notifier.Notify(sub.ID, i+1)
+		}
+	}()
+	dec := json.NewDecoder(client)
+	for i := 0; i < total; i++ {
+		var msg jsonNotification
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatalf("notification %d: failed to decode: %v", i, err)
+		}
+		if msg.Method != "eth"+notificationMethodSuffix {
+			t.Fatalf("notification %d: method mismatch: have %s", i, msg.Method)
+		}
+		if have, ok := msg.Params.Result.(float64); !ok || int(have) != i+1 {
+			t.Fatalf("notification %d: order mismatch: have %v, want %d", i, msg.Params.Result, i+1)
+		}
+	}
+}
@@ -79,6 +79,8 @@ type Server struct {
 	run      int32
 	codecsMu sync.Mutex
 	codecs   *set.Set
+
+	config ServerConfig // Request limits and method restrictions
 }
 
 // rpcRequest represents a raw incoming RPC request
@@ -121,6 +123,12 @@ type ServerCodec interface {
 	Closed() <-chan interface{}
 }
 
+// namespacedCodec is implemented by server codecs that can name notifications
+// after the namespace the subscription was made on, instead of "eth".
+type namespacedCodec interface {
+	createNamespacedNotification(subid, namespace string, event interface{}) interface{}
+}
+
 var (
 	pendingBlockNumber  = big.NewInt(-2)
 	latestBlockNumber   = big.NewInt(-1)
@@ -40,6 +40,9 @@ func (srv *Server) WebsocketHandler(allowedOrigins string) http.Handler {
 	return websocket.Server{
 		Handshake: wsHandshakeValidator(strings.Split(allowedOrigins, ",")),
 		Handler: func(conn *websocket.Conn) {
+			if srv.config.BodyLimit > 0 {
+				conn.MaxPayloadBytes = srv.config.BodyLimit
+			}
 			srv.ServeCodec(NewJSONCodec(conn), OptionMethodInvocation|OptionSubscriptions)
 		},
 	}
@@ -0,0 +1,171 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package core implements an external signer, which keeps the keys out of the
+// node and delegates every signing decision to a user interface.
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"golang.org/x/net/context"
+)
+
+// ErrRequestDenied is returned if the user (or a rule) rejected a request.
+var ErrRequestDenied = errors.New("request denied")
+
+// errSenderModified is returned if the UI approved a transaction with a different
+// sender than the requested one.
+var errSenderModified = errors.New("transaction sender modified by UI")
+
+// SignerAPI is the account_* API exposed by the signer. Every operation has to
+// be approved by the UI before any key is touched.
+type SignerAPI struct {
+	chainID *big.Int
+	am      *accounts.Manager
+	UI      UIClientAPI
+}
+
+// NewSignerAPI creates a new API that can be used for account management, signing
+// transactions for the given chain with the accounts of the manager.
+func NewSignerAPI(chainID int64, am *accounts.Manager, ui UIClientAPI) *SignerAPI {
+	return &SignerAPI{big.NewInt(chainID), am, ui}
+}
+
+// List returns the set of accounts this signer manages, limited to the ones the
+// UI allows to reveal.
+func (api *SignerAPI) List(ctx context.Context) ([]common.Address, error) {
+	var accs []accounts.Account
+	for _, wallet := range api.am.Wallets() {
+		accs = append(accs, wallet.Accounts()...)
+	}
+	result, err := api.UI.ApproveListing(&ListRequest{Accounts: accs})
+	if err != nil {
+		return nil, err
+	}
+	if result.Accounts == nil {
+		return nil, ErrRequestDenied
+	}
+	addresses := make([]common.Address, 0, len(result.Accounts))
+	for _, acc := range result.Accounts {
+		addresses = append(addresses, acc.Address)
+	}
+	return addresses, nil
+}
+
+// SignTransaction signs the given transaction once approved by the UI, and
+// returns both the RLP encoded and the JSON form of the signed transaction. The
+// transaction is not submitted anywhere.
+func (api *SignerAPI) SignTransaction(ctx context.Context, args SendTxArgs) (*ethapi.SignTransactionResult, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	result, err := api.UI.ApproveTx(&SignTxRequest{Transaction: args})
+	if err != nil {
+		return nil, err
+	}
+	if !result.Approved {
+		return nil, ErrRequestDenied
+	}
+	// The UI may have modified the transaction, make sure it's still sane
+	if result.Transaction.From != args.From {
+		return nil, errSenderModified
+	}
+	if err := result.Transaction.validate(); err != nil {
+		return nil, err
+	}
+	account := accounts.Account{Address: args.From}
+	wallet, err := api.am.Find(account)
+	if err != nil {
+		return nil, err
+	}
+	tx := result.Transaction.toTransaction()
+	if result.Password != "" {
+		tx, err = wallet.SignTxWithPassphrase(account, result.Password, tx, api.chainID)
+	} else {
+		tx, err = wallet.SignTx(account, tx, api.chainID)
+	}
+	if err != nil {
+		api.UI.ShowError(err.Error())
+		return nil, err
+	}
+	data, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return nil, err
+	}
+	response := ethapi.SignTransactionResult{Raw: data, Tx: tx}
+
+	log.Info("Signed transaction", "hash", tx.Hash(), "from", args.From)
+	api.UI.OnApprovedTx(response)
+	return &response, nil
+}
+
+// Sign calculates an Ethereum ECDSA signature for:
+// keccack256("\x19Ethereum Signed Message:\n" + len(message) + message))
+//
+// Note, the produced signature conforms to the secp256k1 curve R, S and V values,
+// where the V value will be 27 or 28 for legacy reasons.
+func (api *SignerAPI) Sign(ctx context.Context, addr common.Address, data hexutil.Bytes) (hexutil.Bytes, error) {
+	sighash, msg := signHash(data)
+
+	req := &SignDataRequest{Address: addr, Rawdata: data, Message: msg, Hash: sighash}
+	result, err := api.UI.ApproveSignData(req)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Approved {
+		return nil, ErrRequestDenied
+	}
+	account := accounts.Account{Address: addr}
+	wallet, err := api.am.Find(account)
+	if err != nil {
+		return nil, err
+	}
+	var signature []byte
+	if result.Password != "" {
+		signature, err = wallet.SignHashWithPassphrase(account, result.Password, sighash)
+	} else {
+		signature, err = wallet.SignHash(account, sighash)
+	}
+	if err != nil {
+		api.UI.ShowError(err.Error())
+		return nil, err
+	}
+	signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+	return signature, nil
+}
+
+// signHash is a helper function that calculates a hash for the given message that
+// can be safely used to calculate a signature from. It also returns the message
+// that was hashed, for display purposes.
+//
+// The hash is calulcated as
+//   keccak256("\x19Ethereum Signed Message:\n"${message length}${message}).
+//
+// This gives context to the signed message and prevents signing of transactions.
+func signHash(data []byte) ([]byte, string) {
+	msg := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(data), data)
+	return crypto.Keccak256([]byte(msg)), msg
+}
@@ -0,0 +1,182 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"golang.org/x/net/context"
+)
+
+// headlessUI is a UI answering every request with preset decisions.
+type headlessUI struct {
+	approve  bool
+	password string
+	gasPrice *hexutil.Big // Gas price to replace in approved transactions, if set
+	signed   []ethapi.SignTransactionResult
+}
+
+func (ui *headlessUI) ApproveTx(request *SignTxRequest) (SignTxResponse, error) {
+	tx := request.Transaction
+	if ui.gasPrice != nil {
+		tx.GasPrice = ui.gasPrice
+	}
+	return SignTxResponse{tx, ui.approve, ui.password}, nil
+}
+
+func (ui *headlessUI) ApproveSignData(request *SignDataRequest) (SignDataResponse, error) {
+	return SignDataResponse{ui.approve, ui.password}, nil
+}
+
+func (ui *headlessUI) ApproveListing(request *ListRequest) (ListResponse, error) {
+	if !ui.approve {
+		return ListResponse{}, nil
+	}
+	return ListResponse{request.Accounts}, nil
+}
+
+func (ui *headlessUI) OnApprovedTx(tx ethapi.SignTransactionResult) {
+	ui.signed = append(ui.signed, tx)
+}
+
+func (ui *headlessUI) ShowError(message string)         {}
+func (ui *headlessUI) ShowInfo(message string)          {}
+func (ui *headlessUI) OnSignerStartup(info StartupInfo) {}
+
+// setup creates a signer backed by a keystore with a single account.
+func setup(t *testing.T) (*SignerAPI, *headlessUI, accounts.Account, func()) {
+	dir, err := ioutil.TempDir("", "signer-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary keystore: %v", err)
+	}
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.NewAccount("password")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	ui := &headlessUI{approve: true, password: "password"}
+	return NewSignerAPI(1337, accounts.NewManager(ks), ui), ui, account, func() { os.RemoveAll(dir) }
+}
+
+// testTx creates transaction signing arguments sent from the given address.
+func testTx(from common.Address) SendTxArgs {
+	to := common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+	nonce := hexutil.Uint64(7)
+	return SendTxArgs{
+		From:     from,
+		To:       &to,
+		Gas:      (*hexutil.Big)(big.NewInt(21000)),
+		GasPrice: (*hexutil.Big)(big.NewInt(1)),
+		Value:    (*hexutil.Big)(big.NewInt(1000)),
+		Nonce:    &nonce,
+	}
+}
+
+// Tests that accounts are only revealed if the UI allows it.
+func TestListAccounts(t *testing.T) {
+	api, ui, account, teardown := setup(t)
+	defer teardown()
+
+	addrs, err := api.List(context.Background())
+	if err != nil {
+		t.Fatalf("failed to list accounts: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0] != account.Address {
+		t.Fatalf("account list mismatch: have %v, want [%x]", addrs, account.Address)
+	}
+	ui.approve = false
+	if _, err := api.List(context.Background()); err != ErrRequestDenied {
+		t.Fatalf("denied listing error mismatch: have %v, want %v", err, ErrRequestDenied)
+	}
+}
+
+// Tests that transactions are signed as approved by the UI, and only then.
+func TestSignTransaction(t *testing.T) {
+	api, ui, account, teardown := setup(t)
+	defer teardown()
+
+	// Sign a transaction, letting the UI modify the gas price
+	ui.gasPrice = (*hexutil.Big)(big.NewInt(2))
+	res, err := api.SignTransaction(context.Background(), testTx(account.Address))
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	signer := types.NewEIP155Signer(big.NewInt(1337))
+	if from, err := types.Sender(signer, res.Tx); err != nil || from != account.Address {
+		t.Fatalf("sender mismatch: have %x, want %x, err %v", from, account.Address, err)
+	}
+	if res.Tx.GasPrice().Int64() != 2 {
+		t.Fatalf("gas price mismatch: have %v, want 2", res.Tx.GasPrice())
+	}
+	if len(ui.signed) != 1 || ui.signed[0].Tx.Hash() != res.Tx.Hash() {
+		t.Fatalf("signed transaction not reported to the UI")
+	}
+	// Wrong passwords and denials should both fail
+	ui.password = "wrong"
+	if _, err := api.SignTransaction(context.Background(), testTx(account.Address)); err != keystore.ErrDecrypt {
+		t.Fatalf("wrong password error mismatch: have %v, want %v", err, keystore.ErrDecrypt)
+	}
+	ui.approve = false
+	if _, err := api.SignTransaction(context.Background(), testTx(account.Address)); err != ErrRequestDenied {
+		t.Fatalf("denied signing error mismatch: have %v, want %v", err, ErrRequestDenied)
+	}
+	// Incomplete transactions should be rejected before reaching the UI
+	args := testTx(account.Address)
+	args.Nonce = nil
+	if _, err := api.SignTransaction(context.Background(), args); err == nil {
+		t.Fatalf("incomplete transaction signed")
+	}
+}
+
+// Tests that data signatures recover to the signing account.
+func TestSignData(t *testing.T) {
+	api, ui, account, teardown := setup(t)
+	defer teardown()
+
+	data := []byte("hello signer")
+	sig, err := api.Sign(context.Background(), account.Address, data)
+	if err != nil {
+		t.Fatalf("failed to sign data: %v", err)
+	}
+	if sig[64] != 27 && sig[64] != 28 {
+		t.Fatalf("invalid V value: %d", sig[64])
+	}
+	sig[64] -= 27
+
+	hash, _ := signHash(data)
+	pubkey, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		t.Fatalf("failed to recover signer: %v", err)
+	}
+	if addr := crypto.PubkeyToAddress(*pubkey); addr != account.Address {
+		t.Fatalf("recovered address mismatch: have %x, want %x", addr, account.Address)
+	}
+	ui.approve = false
+	if _, err := api.Sign(context.Background(), account.Address, data); err != ErrRequestDenied {
+		t.Fatalf("denied signing error mismatch: have %v, want %v", err, ErrRequestDenied)
+	}
+}
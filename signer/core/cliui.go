@@ -0,0 +1,112 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/console"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+)
+
+// CommandlineUI is a UI which asks the user for every decision on the terminal.
+type CommandlineUI struct {
+	mu sync.Mutex // Serializes the prompts of concurrent requests
+}
+
+// NewCommandlineUI creates a UI prompting on the terminal.
+func NewCommandlineUI() *CommandlineUI {
+	return &CommandlineUI{}
+}
+
+// confirm asks the user a yes/no question, returning false on any failure.
+func (ui *CommandlineUI) confirm(prompt string) bool {
+	ok, err := console.Stdin.PromptConfirm(prompt)
+	return err == nil && ok
+}
+
+// password asks the user for the password of an account, if needed.
+func (ui *CommandlineUI) password() string {
+	password, _ := console.Stdin.PromptPassword("Password (leave empty if unlocked): ")
+	return password
+}
+
+// ApproveTx prompts the user for confirmation to sign a transaction.
+func (ui *CommandlineUI) ApproveTx(request *SignTxRequest) (SignTxResponse, error) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+
+	fmt.Printf("-------- Transaction signing request --------\n%v\n", request.Transaction)
+	if !ui.confirm("Approve?") {
+		return SignTxResponse{request.Transaction, false, ""}, nil
+	}
+	return SignTxResponse{request.Transaction, true, ui.password()}, nil
+}
+
+// ApproveSignData prompts the user for confirmation to sign arbitrary data.
+func (ui *CommandlineUI) ApproveSignData(request *SignDataRequest) (SignDataResponse, error) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+
+	fmt.Printf("-------- Data signing request --------\n")
+	fmt.Printf("account: %s\nmessage: %q\nhash: %v\n", request.Address.Hex(), request.Message, request.Hash)
+	if !ui.confirm("Approve?") {
+		return SignDataResponse{false, ""}, nil
+	}
+	return SignDataResponse{true, ui.password()}, nil
+}
+
+// ApproveListing prompts the user for confirmation to list the accounts.
+func (ui *CommandlineUI) ApproveListing(request *ListRequest) (ListResponse, error) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+
+	fmt.Printf("-------- List accounts request --------\n")
+	for _, account := range request.Accounts {
+		fmt.Printf("  [x] %s (%s)\n", account.Address.Hex(), account.URL)
+	}
+	if !ui.confirm("Reveal the accounts above?") {
+		return ListResponse{nil}, nil
+	}
+	return ListResponse{request.Accounts}, nil
+}
+
+// ShowError displays an error message to the user.
+func (ui *CommandlineUI) ShowError(message string) {
+	fmt.Printf("ERROR: %s\n", message)
+}
+
+// ShowInfo displays an info message to the user.
+func (ui *CommandlineUI) ShowInfo(message string) {
+	fmt.Printf("INFO: %s\n", message)
+}
+
+// OnApprovedTx notifies the user about a signed transaction.
+func (ui *CommandlineUI) OnApprovedTx(tx ethapi.SignTransactionResult) {
+	fmt.Printf("Transaction signed: %x\n", tx.Tx.Hash())
+}
+
+// OnSignerStartup displays the endpoints the signer is listening on.
+func (ui *CommandlineUI) OnSignerStartup(info StartupInfo) {
+	var lines []string
+	for key, value := range info.Info {
+		lines = append(lines, fmt.Sprintf("  %s: %s", key, value))
+	}
+	fmt.Printf("Signer started\n%s\n", strings.Join(lines, "\n"))
+}
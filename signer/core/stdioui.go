@@ -0,0 +1,95 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/net/context"
+)
+
+// StdIOUI is a UI speaking JSON-RPC over the signer's stdin/stdout, allowing an
+// external program (which started the signer) to make the decisions. Every UI
+// method maps to a ui_* call, e.g. ApproveTx to ui_approveTx.
+type StdIOUI struct {
+	client *rpc.Client
+}
+
+// NewStdIOUI creates a UI talking to the parent process over stdin/stdout.
+func NewStdIOUI() *StdIOUI {
+	client, err := rpc.DialStdIO(context.Background())
+	if err != nil {
+		log.Crit("Could not create stdio client", "err", err)
+	}
+	return NewUIClient(client)
+}
+
+// NewUIClient creates a UI forwarding the decisions over an RPC connection.
+func NewUIClient(client *rpc.Client) *StdIOUI {
+	return &StdIOUI{client: client}
+}
+
+// dispatch sends a request to the UI, waiting for its reply.
+func (ui *StdIOUI) dispatch(method string, args interface{}, reply interface{}) error {
+	err := ui.client.Call(reply, method, args)
+	if err != nil {
+		log.Info("Error", "method", method, "err", err)
+	}
+	return err
+}
+
+// ApproveTx prompts the UI for confirmation to sign a transaction.
+func (ui *StdIOUI) ApproveTx(request *SignTxRequest) (SignTxResponse, error) {
+	var result SignTxResponse
+	err := ui.dispatch("ui_approveTx", request, &result)
+	return result, err
+}
+
+// ApproveSignData prompts the UI for confirmation to sign arbitrary data.
+func (ui *StdIOUI) ApproveSignData(request *SignDataRequest) (SignDataResponse, error) {
+	var result SignDataResponse
+	err := ui.dispatch("ui_approveSignData", request, &result)
+	return result, err
+}
+
+// ApproveListing prompts the UI for confirmation to list the accounts.
+func (ui *StdIOUI) ApproveListing(request *ListRequest) (ListResponse, error) {
+	var result ListResponse
+	err := ui.dispatch("ui_approveListing", request, &result)
+	return result, err
+}
+
+// ShowError displays an error message in the UI.
+func (ui *StdIOUI) ShowError(message string) {
+	ui.dispatch("ui_showError", &message, nil)
+}
+
+// ShowInfo displays an info message in the UI.
+func (ui *StdIOUI) ShowInfo(message string) {
+	ui.dispatch("ui_showInfo", &message, nil)
+}
+
+// OnApprovedTx notifies the UI about a signed transaction.
+func (ui *StdIOUI) OnApprovedTx(tx ethapi.SignTransactionResult) {
+	ui.dispatch("ui_onApprovedTx", tx, nil)
+}
+
+// OnSignerStartup tells the UI the endpoints the signer is listening on.
+func (ui *StdIOUI) OnSignerStartup(info StartupInfo) {
+	ui.dispatch("ui_onSignerStartup", info, nil)
+}
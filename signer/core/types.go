@@ -0,0 +1,149 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+)
+
+// UIClientAPI specifies what method a UI needs to implement to be able to be used as a
+// UI for the signer. Every request needing a decision is routed through it, so the
+// policy of what gets signed lives outside of the node.
+type UIClientAPI interface {
+	// ApproveTx prompts the user for confirmation to sign a transaction
+	ApproveTx(request *SignTxRequest) (SignTxResponse, error)
+
+	// ApproveSignData prompts the user for confirmation to sign arbitrary data
+	ApproveSignData(request *SignDataRequest) (SignDataResponse, error)
+
+	// ApproveListing prompts the user for confirmation to list the accounts, the
+	// list of accounts to actually reveal is returned
+	ApproveListing(request *ListRequest) (ListResponse, error)
+
+	// ShowError displays an error message to the user
+	ShowError(message string)
+
+	// ShowInfo displays an info message to the user
+	ShowInfo(message string)
+
+	// OnApprovedTx notifies the UI about a transaction having been successfully
+	// signed, allowing it to keep track of signed transactions
+	OnApprovedTx(tx ethapi.SignTransactionResult)
+
+	// OnSignerStartup is invoked when the signer boots, telling the UI about the
+	// endpoints it's listening on
+	OnSignerStartup(info StartupInfo)
+}
+
+// SendTxArgs represents a transaction to be signed. Unlike for the node, all the
+// fields need to be specified, since the signer has no access to the chain to
+// fill in defaults.
+type SendTxArgs struct {
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      *hexutil.Big    `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Value    *hexutil.Big    `json:"value"`
+	Data     hexutil.Bytes   `json:"data"`
+	Nonce    *hexutil.Uint64 `json:"nonce"`
+}
+
+// validate checks that all the fields needed to assemble a transaction are set.
+func (args *SendTxArgs) validate() error {
+	switch {
+	case args.Gas == nil:
+		return errors.New("gas not specified")
+	case args.GasPrice == nil:
+		return errors.New("gas price not specified")
+	case args.Value == nil:
+		return errors.New("value not specified")
+	case args.Nonce == nil:
+		return errors.New("nonce not specified")
+	case args.To == nil && len(args.Data) == 0:
+		return errors.New("contract creation without any data provided")
+	}
+	return nil
+}
+
+// toTransaction assembles the unsigned transaction described by the arguments.
+func (args *SendTxArgs) toTransaction() *types.Transaction {
+	if args.To == nil {
+		return types.NewContractCreation(uint64(*args.Nonce), (*big.Int)(args.Value), (*big.Int)(args.Gas), (*big.Int)(args.GasPrice), args.Data)
+	}
+	return types.NewTransaction(uint64(*args.Nonce), *args.To, (*big.Int)(args.Value), (*big.Int)(args.Gas), (*big.Int)(args.GasPrice), args.Data)
+}
+
+// String implements fmt.Stringer, rendering the transaction for user display.
+func (args SendTxArgs) String() string {
+	to := "<contract creation>"
+	if args.To != nil {
+		to = args.To.Hex()
+	}
+	return fmt.Sprintf("from: %s\nto: %s\nvalue: %v wei\ngas: %v\ngasprice: %v wei\nnonce: %v\ndata: %v",
+		args.From.Hex(), to, args.Value, args.Gas, args.GasPrice, args.Nonce, args.Data)
+}
+
+// SignTxRequest contains info about a transaction to sign.
+type SignTxRequest struct {
+	Transaction SendTxArgs `json:"transaction"`
+}
+
+// SignTxResponse is the result of a transaction approval. The UI may modify the
+// transaction (e.g. the gas price) before approving it, but not its sender. The
+// password is used to unlock the key if needed.
+type SignTxResponse struct {
+	Transaction SendTxArgs `json:"transaction"`
+	Approved    bool       `json:"approved"`
+	Password    string     `json:"password"`
+}
+
+// SignDataRequest contains info about some data to sign.
+type SignDataRequest struct {
+	Address common.Address `json:"address"`
+	Rawdata hexutil.Bytes  `json:"raw_data"`
+	Message string         `json:"message"`
+	Hash    hexutil.Bytes  `json:"hash"`
+}
+
+// SignDataResponse is the result of a data signing approval.
+type SignDataResponse struct {
+	Approved bool   `json:"approved"`
+	Password string `json:"password"`
+}
+
+// ListRequest contains the accounts the signer could reveal.
+type ListRequest struct {
+	Accounts []accounts.Account `json:"accounts"`
+}
+
+// ListResponse contains the accounts to reveal, nil if the listing was denied.
+type ListResponse struct {
+	Accounts []accounts.Account `json:"accounts"`
+}
+
+// StartupInfo contains the endpoints the signer is reachable on.
+type StartupInfo struct {
+	Info map[string]string `json:"info"`
+}
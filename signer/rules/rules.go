@@ -0,0 +1,177 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package rules implements a rule based approval engine for the signer, which
+// decides on requests using a javascript rule file before bothering the user.
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/signer/core"
+	"github.com/robertkrimen/otto"
+)
+
+// Verdicts a rule function may return. Anything else forwards the request to the
+// next UI.
+const (
+	verdictApprove = "Approve"
+	verdictReject  = "Reject"
+)
+
+// errNoRules is returned if the evaluator is used before loading any rules.
+var errNoRules = errors.New("no rules loaded")
+
+// RuleEvaluator is a UI which consults a javascript rule file for every request.
+// The rules may define the functions ApproveTx, ApproveSignData and ApproveListing,
+// each receiving the request as a plain object and returning "Approve", "Reject"
+// or anything else to let the next UI (usually the user) decide.
+//
+// The rules are evaluated in a fresh javascript environment for every request, so
+// they cannot accumulate state between decisions.
+type RuleEvaluator struct {
+	next  core.UIClientAPI // UI to forward undecided requests to
+	rules string           // Javascript source of the rules
+}
+
+// NewRuleEvaluator creates a rule engine forwarding undecided requests to next.
+func NewRuleEvaluator(next core.UIClientAPI) *RuleEvaluator {
+	return &RuleEvaluator{next: next}
+}
+
+// Init loads the javascript rules, checking that they evaluate cleanly.
+func (r *RuleEvaluator) Init(rules string) error {
+	if _, err := newVM(rules); err != nil {
+		return err
+	}
+	r.rules = rules
+	return nil
+}
+
+// newVM creates a javascript environment with the rules loaded.
+func newVM(rules string) (*otto.Otto, error) {
+	vm := otto.New()
+	vm.Set("console", map[string]interface{}{
+		"log": func(call otto.FunctionCall) otto.Value {
+			log.Info("Rule log", "msg", call.ArgumentList)
+			return otto.UndefinedValue()
+		},
+	})
+	if _, err := vm.Run(rules); err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+// execute runs the given rule function on the request, returning its verdict.
+// A missing function yields an empty verdict.
+func (r *RuleEvaluator) execute(function string, request interface{}) (string, error) {
+	if r.rules == "" {
+		return "", errNoRules
+	}
+	vm, err := newVM(r.rules)
+	if err != nil {
+		return "", err
+	}
+	if fn, err := vm.Get(function); err != nil || !fn.IsFunction() {
+		return "", nil
+	}
+	// Pass the request as a plain javascript object, as seen over the API
+	blob, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	arg, err := vm.Call("JSON.parse", nil, string(blob))
+	if err != nil {
+		return "", err
+	}
+	verdict, err := vm.Call(function, nil, arg)
+	if err != nil {
+		return "", err
+	}
+	return verdict.String(), nil
+}
+
+// decide evaluates a rule function, returning whether the request was approved
+// and whether the rules made a decision at all. Failing rules reject the request.
+func (r *RuleEvaluator) decide(function string, request interface{}) (approved bool, decided bool) {
+	verdict, err := r.execute(function, request)
+	if err != nil {
+		log.Warn("Rule evaluation failed, rejecting", "function", function, "err", err)
+		return false, true
+	}
+	switch verdict {
+	case verdictApprove:
+		log.Info("Request approved by rules", "function", function)
+		return true, true
+	case verdictReject:
+		log.Info("Request rejected by rules", "function", function)
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// ApproveTx decides on a transaction signing request.
+func (r *RuleEvaluator) ApproveTx(request *core.SignTxRequest) (core.SignTxResponse, error) {
+	if approved, decided := r.decide("ApproveTx", request); decided {
+		return core.SignTxResponse{Transaction: request.Transaction, Approved: approved}, nil
+	}
+	return r.next.ApproveTx(request)
+}
+
+// ApproveSignData decides on a data signing request.
+func (r *RuleEvaluator) ApproveSignData(request *core.SignDataRequest) (core.SignDataResponse, error) {
+	if approved, decided := r.decide("ApproveSignData", request); decided {
+		return core.SignDataResponse{Approved: approved}, nil
+	}
+	return r.next.ApproveSignData(request)
+}
+
+// ApproveListing decides on an account listing request, revealing either all or
+// none of the accounts.
+func (r *RuleEvaluator) ApproveListing(request *core.ListRequest) (core.ListResponse, error) {
+	if approved, decided := r.decide("ApproveListing", request); decided {
+		if approved {
+			return core.ListResponse{Accounts: request.Accounts}, nil
+		}
+		return core.ListResponse{}, nil
+	}
+	return r.next.ApproveListing(request)
+}
+
+// ShowError forwards an error message to the next UI.
+func (r *RuleEvaluator) ShowError(message string) {
+	r.next.ShowError(message)
+}
+
+// ShowInfo forwards an info message to the next UI.
+func (r *RuleEvaluator) ShowInfo(message string) {
+	r.next.ShowInfo(message)
+}
+
+// OnApprovedTx forwards a signed transaction notification to the next UI.
+func (r *RuleEvaluator) OnApprovedTx(tx ethapi.SignTransactionResult) {
+	r.next.OnApprovedTx(tx)
+}
+
+// OnSignerStartup forwards the signer startup notification to the next UI.
+func (r *RuleEvaluator) OnSignerStartup(info core.StartupInfo) {
+	r.next.OnSignerStartup(info)
+}
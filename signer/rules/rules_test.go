@@ -0,0 +1,139 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// alwaysDenyUI is a UI rejecting everything, counting the requests reaching it.
+type alwaysDenyUI struct {
+	asked int
+}
+
+func (ui *alwaysDenyUI) ApproveTx(request *core.SignTxRequest) (core.SignTxResponse, error) {
+	ui.asked++
+	return core.SignTxResponse{Transaction: request.Transaction}, nil
+}
+
+func (ui *alwaysDenyUI) ApproveSignData(request *core.SignDataRequest) (core.SignDataResponse, error) {
+	ui.asked++
+	return core.SignDataResponse{}, nil
+}
+
+func (ui *alwaysDenyUI) ApproveListing(request *core.ListRequest) (core.ListResponse, error) {
+	ui.asked++
+	return core.ListResponse{}, nil
+}
+
+func (ui *alwaysDenyUI) ShowError(message string)                     {}
+func (ui *alwaysDenyUI) ShowInfo(message string)                      {}
+func (ui *alwaysDenyUI) OnApprovedTx(tx ethapi.SignTransactionResult) {}
+func (ui *alwaysDenyUI) OnSignerStartup(info core.StartupInfo)        {}
+
+// txRequest creates a transaction signing request for the given recipient and value.
+func txRequest(to common.Address, value int64) *core.SignTxRequest {
+	return &core.SignTxRequest{Transaction: core.SendTxArgs{
+		From:  common.HexToAddress("0x01"),
+		To:    &to,
+		Value: (*hexutil.Big)(big.NewInt(value)),
+	}}
+}
+
+const testRules = `
+function ApproveTx(req) {
+	var to = req.transaction.to.toLowerCase();
+	if (to == "0x000000000000000000000000000000000000dead") {
+		return "Reject";
+	}
+	if (to == "0x000000000000000000000000000000000000beef" && parseInt(req.transaction.value, 16) <= 1000) {
+		return "Approve";
+	}
+}
+
+function ApproveListing() {
+	return "Approve";
+}
+`
+
+// Tests that rules approve and reject requests, forwarding the undecided ones.
+func TestRuleDecisions(t *testing.T) {
+	ui := new(alwaysDenyUI)
+	r := NewRuleEvaluator(ui)
+	if err := r.Init(testRules); err != nil {
+		t.Fatalf("failed to load rules: %v", err)
+	}
+	tests := []struct {
+		to       string
+		value    int64
+		approved bool
+		asked    int
+	}{
+		{"0x000000000000000000000000000000000000beef", 1000, true, 0},
+		{"0x000000000000000000000000000000000000dead", 1, false, 0},
+		{"0x000000000000000000000000000000000000beef", 1001, false, 1},
+		{"0x0000000000000000000000000000000000001234", 1, false, 1},
+	}
+	for i, tt := range tests {
+		ui.asked = 0
+		res, err := r.ApproveTx(txRequest(common.HexToAddress(tt.to), tt.value))
+		if err != nil {
+			t.Fatalf("test %d: failed to evaluate: %v", i, err)
+		}
+		if res.Approved != tt.approved {
+			t.Errorf("test %d: approval mismatch: have %v, want %v", i, res.Approved, tt.approved)
+		}
+		if ui.asked != tt.asked {
+			t.Errorf("test %d: forwarded requests mismatch: have %d, want %d", i, ui.asked, tt.asked)
+		}
+	}
+	// Listing is approved by the rules, data signing is not covered at all
+	accs := []accounts.Account{{Address: common.HexToAddress("0x01")}}
+	if res, _ := r.ApproveListing(&core.ListRequest{Accounts: accs}); len(res.Accounts) != 1 {
+		t.Errorf("listing not approved by rules")
+	}
+	ui.asked = 0
+	if res, _ := r.ApproveSignData(&core.SignDataRequest{}); res.Approved || ui.asked != 1 {
+		t.Errorf("data signing not forwarded: approved %v, asked %d", res.Approved, ui.asked)
+	}
+}
+
+// Tests that broken rules are refused and failing ones reject the request.
+func TestRuleFailures(t *testing.T) {
+	ui := new(alwaysDenyUI)
+	r := NewRuleEvaluator(ui)
+	if err := r.Init("function ApproveTx(req) {"); err == nil {
+		t.Fatalf("invalid rules loaded")
+	}
+	if err := r.Init("function ApproveTx(req) { throw 'boom'; }"); err != nil {
+		t.Fatalf("failed to load rules: %v", err)
+	}
+	res, err := r.ApproveTx(txRequest(common.Address{}, 1))
+	if err != nil {
+		t.Fatalf("failed to evaluate: %v", err)
+	}
+	if res.Approved || ui.asked != 0 {
+		t.Fatalf("failing rule not rejected: approved %v, asked %d", res.Approved, ui.asked)
+	}
+}
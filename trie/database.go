@@ -0,0 +1,320 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// LeafCallback is invoked for every value leaf of a trie node inserted into a
+// NodeDatabase, and returns the hashes of any external objects referenced by the
+// leaf (e.g. storage tries and contract code in the case of the state trie).
+// These are reference counted exactly like regular child nodes.
+type LeafCallback func(leaf []byte) []common.Hash
+
+// NodeDatabase is an intermediate write layer between the trie data structures
+// and the disk database. Trie nodes written into it are accumulated in memory
+// along with the number of references to each, so that tries which are not needed
+// any more can be garbage collected without ever touching the disk, and only the
+// ones explicitly committed get flushed.
+//
+// Any key that isn't a 32 byte hash (e.g. secure trie preimages) is considered
+// to be non-trie data and is written straight through to the disk database.
+type NodeDatabase struct {
+	diskdb ethdb.Database // Persistent storage for matured trie nodes
+	onleaf LeafCallback   // Resolver for references embedded in trie leaves
+
+	nodes map[common.Hash]*cachedNode // Data and references relationships of cached nodes
+	size  common.StorageSize          // Storage size of the cached nodes
+
+	gcnodes uint64             // Nodes garbage collected since last commit
+	gcsize  common.StorageSize // Data storage garbage collected since last commit
+
+	lock sync.RWMutex
+}
+
+// cachedNode is a trie node (or any other hash addressed blob) held in memory,
+// along with the reference counting metadata required for garbage collection.
+type cachedNode struct {
+	blob     []byte        // Encoded data of the cached node
+	parents  int           // Number of live nodes (or external pins) referencing this one
+	children []common.Hash // Hashes of the objects referenced by this node
+}
+
+// NewNodeDatabase creates a new trie node cache on top of the given disk
+// database. The optional leaf callback is used to discover references to other
+// tries or blobs embedded into the leaves of the stored tries.
+func NewNodeDatabase(diskdb ethdb.Database, onleaf LeafCallback) *NodeDatabase {
+	return &NodeDatabase{
+		diskdb: diskdb,
+		onleaf: onleaf,
+		nodes:  make(map[common.Hash]*cachedNode),
+	}
+}
+
+// DiskDB retrieves the persistent database backing the node cache.
+func (db *NodeDatabase) DiskDB() ethdb.Database {
+	return db.diskdb
+}
+
+// Put stores a trie node into the memory cache, or any non-trie data directly
+// into the disk database.
+func (db *NodeDatabase) Put(key []byte, value []byte) error {
+	if len(key) != common.HashLength {
+		return db.diskdb.Put(key, value)
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.insert(common.BytesToHash(key), value)
+	return nil
+}
+
+// insert caches a new node, bumping the reference counts of all its already
+// cached children. This method assumes that the database lock is held.
+func (db *NodeDatabase) insert(hash common.Hash, blob []byte) {
+	// If the node's already cached, skip
+	if _, ok := db.nodes[hash]; ok {
+		return
+	}
+	node := &cachedNode{
+		blob:     common.CopyBytes(blob),
+		children: db.references(hash, blob),
+	}
+	// Children not in the cache are already on disk and need no tracking
+	for _, child := range node.children {
+		if c, ok := db.nodes[child]; ok {
+			c.parents++
+		}
+	}
+	db.nodes[hash] = node
+	db.size += common.StorageSize(common.HashLength + len(blob))
+}
+
+// references decodes a blob as a trie node and gathers the hashes of all objects
+// referenced from it. Blobs that aren't valid trie nodes (e.g. contract code)
+// reference nothing.
+func (db *NodeDatabase) references(hash common.Hash, blob []byte) []common.Hash {
+	n, err := decodeNode(hash[:], blob, 0)
+	if err != nil {
+		return nil
+	}
+	var refs []common.Hash
+	db.gather(n, &refs)
+	return refs
+}
+
+// gather recursively walks a decoded trie node (including any embedded children)
+// and collects the hashes of the nodes and leaf objects it references.
+func (db *NodeDatabase) gather(n node, refs *[]common.Hash) {
+	switch n := n.(type) {
+	case *shortNode:
+		db.gather(n.Val, refs)
+	case *fullNode:
+		for _, child := range n.Children {
+			if child != nil {
+				db.gather(child, refs)
+			}
+		}
+	case hashNode:
+		*refs = append(*refs, common.BytesToHash(n))
+	case valueNode:
+		if db.onleaf != nil {
+			*refs = append(*refs, db.onleaf(n)...)
+		}
+	}
+}
+
+// Get retrieves a node from the memory cache if available, or from the disk
+// database otherwise.
+func (db *NodeDatabase) Get(key []byte) ([]byte, error) {
+	if len(key) == common.HashLength {
+		db.lock.RLock()
+		node := db.nodes[common.BytesToHash(key)]
+		db.lock.RUnlock()
+
+		if node != nil {
+			return common.CopyBytes(node.blob), nil
+		}
+	}
+	return db.diskdb.Get(key)
+}
+
+// Delete removes a key from the disk database. Cached trie nodes are only ever
+// removed via garbage collection.
+func (db *NodeDatabase) Delete(key []byte) error {
+	return db.diskdb.Delete(key)
+}
+
+// Close is a noop to implement the Database interface, the disk database is
+// owned (and closed) by the caller.
+func (db *NodeDatabase) Close() {}
+
+// NewBatch creates a write batch which inserts its trie nodes into the memory
+// cache in one go when written.
+func (db *NodeDatabase) NewBatch() ethdb.Batch {
+	return &nodeBatch{db: db}
+}
+
+// Size returns the current storage size of the memory cache in front of the
+// persistent database layer.
+func (db *NodeDatabase) Size() common.StorageSize {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.size
+}
+
+// Reference pins the trie rooted at the given hash in memory, preventing it from
+// being garbage collected until a matching call to Dereference.
+func (db *NodeDatabase) Reference(root common.Hash) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if node, ok := db.nodes[root]; ok {
+		node.parents++
+	}
+}
+
+// Dereference removes a pin from the trie rooted at the given hash, garbage
+// collecting every cached node that isn't referenced any more.
+func (db *NodeDatabase) Dereference(root common.Hash) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	nodes, size := len(db.nodes), db.size
+	db.dereference(root)
+
+	db.gcnodes += uint64(nodes - len(db.nodes))
+	db.gcsize += size - db.size
+
+	log.Trace("Dereferenced trie from memory database", "nodes", nodes-len(db.nodes), "size", size-db.size, "livenodes", len(db.nodes), "livesize", db.size)
+}
+
+// dereference decrements the reference count of a cached node, and deletes it
+// along with all its unreferenced descendants if no live references remain.
+// This method assumes that the database lock is held.
+func (db *NodeDatabase) dereference(hash common.Hash) {
+	// Nodes not in the cache are on disk, nothing to collect
+	node, ok := db.nodes[hash]
+	if !ok {
+		return
+	}
+	if node.parents > 0 {
+		node.parents--
+	}
+	if node.parents == 0 {
+		delete(db.nodes, hash)
+		db.size -= common.StorageSize(common.HashLength + len(node.blob))
+
+		for _, child := range node.children {
+			db.dereference(child)
+		}
+	}
+}
+
+// Commit flushes the trie rooted at the given hash, along with all its cached
+// descendants, to the disk database and removes them from the memory cache.
+func (db *NodeDatabase) Commit(root common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	// Write all the cached nodes of the trie into a single batch
+	var (
+		batch   = db.diskdb.NewBatch()
+		written = make(map[common.Hash]struct{})
+	)
+	if err := db.commit(root, batch, written); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	// Data is safe on disk, drop it from the memory cache
+	nodes, size := len(db.nodes), db.size
+	for hash := range written {
+		node := db.nodes[hash]
+		delete(db.nodes, hash)
+		db.size -= common.StorageSize(common.HashLength + len(node.blob))
+	}
+	log.Debug("Persisted trie from memory database", "nodes", nodes-len(db.nodes), "size", size-db.size,
+		"gcnodes", db.gcnodes, "gcsize", db.gcsize, "livenodes", len(db.nodes), "livesize", db.size)
+
+	db.gcnodes, db.gcsize = 0, 0
+	return nil
+}
+
+// commit recursively writes a cached node and all its cached descendants into a
+// database batch, children first so that a parent never hits the disk without
+// the nodes it references. This method assumes that the database lock is held.
+func (db *NodeDatabase) commit(hash common.Hash, batch ethdb.Batch, written map[common.Hash]struct{}) error {
+	node, ok := db.nodes[hash]
+	if !ok {
+		return nil
+	}
+	if _, ok := written[hash]; ok {
+		return nil
+	}
+	for _, child := range node.children {
+		if err := db.commit(child, batch, written); err != nil {
+			return err
+		}
+	}
+	if err := batch.Put(hash[:], node.blob); err != nil {
+		return err
+	}
+	written[hash] = struct{}{}
+	return nil
+}
+
+// nodeBatch is a write batch on top of a NodeDatabase, accumulating the inserted
+// data until it's written into the memory cache (or the disk for non-trie data).
+type nodeBatch struct {
+	db     *NodeDatabase
+	keys   [][]byte
+	values [][]byte
+}
+
+// Put schedules a key/value pair to be inserted into the database.
+func (b *nodeBatch) Put(key, value []byte) error {
+	b.keys = append(b.keys, common.CopyBytes(key))
+	b.values = append(b.values, common.CopyBytes(value))
+	return nil
+}
+
+// Write inserts all the accumulated trie nodes into the memory cache, in the
+// order they were added, and flushes any non-trie data to disk.
+func (b *nodeBatch) Write() error {
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+
+	disk := b.db.diskdb.NewBatch()
+	for i, key := range b.keys {
+		if len(key) != common.HashLength {
+			if err := disk.Put(key, b.values[i]); err != nil {
+				return err
+			}
+			continue
+		}
+		b.db.insert(common.BytesToHash(key), b.values[i])
+	}
+	return disk.Write()
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// makeCachedTrie creates a trie with the given number of entries (with the first
+// value derived from the salt) and commits it into the given node database.
+func makeCachedTrie(t *testing.T, db *NodeDatabase, entries int, salt byte) common.Hash {
+	trie, _ := New(common.Hash{}, db)
+	for i := 0; i < entries; i++ {
+		val := bytes.Repeat([]byte{byte(i)}, 40)
+		if i == 0 {
+			val[0] = salt
+		}
+		trie.Update(cachedTrieKey(i), val)
+	}
+	root, err := trie.CommitTo(db)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	return root
+}
+
+// cachedTrieKey returns the key of the i-th entry in a test trie.
+func cachedTrieKey(i int) []byte {
+	return []byte(fmt.Sprintf("key-%03d", i))
+}
+
+// checkCachedTrie verifies that all entries of a test trie can be retrieved from
+// the given database.
+func checkCachedTrie(t *testing.T, db Database, root common.Hash, entries int) {
+	trie, err := New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open trie: %v", err)
+	}
+	for i := 0; i < entries; i++ {
+		if _, err := trie.TryGet(cachedTrieKey(i)); err != nil {
+			t.Fatalf("entry %d: failed to retrieve: %v", i, err)
+		}
+	}
+}
+
+// Tests that tries sharing nodes are reference counted properly, and that
+// dereferencing a trie only garbage collects the nodes no longer in use.
+func TestNodeDatabaseGarbageCollection(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	db := NewNodeDatabase(diskdb, nil)
+
+	first := makeCachedTrie(t, db, 100, 1)
+	db.Reference(first)
+	size := db.Size()
+
+	second := makeCachedTrie(t, db, 100, 2)
+	db.Reference(second)
+
+	if db.Size() <= size {
+		t.Fatalf("cache didn't grow: have %v, had %v", db.Size(), size)
+	}
+	if db.Size() >= 2*size {
+		t.Fatalf("tries don't share nodes: have %v, single trie %v", db.Size(), size)
+	}
+	// Drop the first trie and ensure the second is still fully accessible
+	db.Dereference(first)
+	if _, err := db.Get(first[:]); err == nil {
+		t.Errorf("dereferenced root still available")
+	}
+	checkCachedTrie(t, db, second, 100)
+
+	// Drop the second trie too, nothing should remain
+	db.Dereference(second)
+	if size := db.Size(); size != 0 {
+		t.Errorf("dangling nodes after full dereference: %v", size)
+	}
+	if len(db.nodes) != 0 {
+		t.Errorf("dangling nodes after full dereference: %d", len(db.nodes))
+	}
+	if keys := diskdb.Keys(); len(keys) != 0 {
+		t.Errorf("garbage written to disk: %d items", len(keys))
+	}
+}
+
+// Tests that committing a trie flushes all its nodes to disk and drops them from
+// memory, while leaving unrelated tries cached.
+func TestNodeDatabaseCommit(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+	db := NewNodeDatabase(diskdb, nil)
+
+	first := makeCachedTrie(t, db, 100, 1)
+	db.Reference(first)
+	second := makeCachedTrie(t, db, 100, 2)
+	db.Reference(second)
+
+	if err := db.Commit(first); err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	// The committed trie must be fully available from disk alone
+	checkCachedTrie(t, diskdb, first, 100)
+
+	// The other trie must remain accessible until dereferenced
+	checkCachedTrie(t, db, second, 100)
+
+	db.Dereference(second)
+	if size := db.Size(); size != 0 {
+		t.Errorf("dangling nodes after commit and dereference: %v", size)
+	}
+	if _, err := New(second, diskdb); err == nil {
+		t.Errorf("uncommitted trie leaked to disk")
+	}
+}
+
+// Tests that the leaf callback references are tracked, keeping external objects
+// alive as long as a trie referencing them is.
+func TestNodeDatabaseLeafReferences(t *testing.T) {
+	diskdb, _ := ethdb.NewMemDatabase()
+
+	blob := []byte("external object")
+	hash := common.BytesToHash(bytes.Repeat([]byte{0xff}, 32))
+
+	db := NewNodeDatabase(diskdb, func(leaf []byte) []common.Hash {
+		return []common.Hash{hash}
+	})
+	db.Put(hash[:], blob)
+
+	root := makeCachedTrie(t, db, 10, 1)
+	db.Reference(root)
+
+	if _, err := db.Get(hash[:]); err != nil {
+		t.Fatalf("referenced object missing: %v", err)
+	}
+	db.Dereference(root)
+	if _, err := db.Get(hash[:]); err == nil {
+		t.Fatalf("unreferenced object not collected")
+	}
+}
@@ -24,6 +24,7 @@ import (
 // Iterator is a key-value trie iterator that traverses a Trie.
 type Iterator struct {
 	nodeIt NodeIterator
+	start  []byte // Hex encoded key to start iterating from, skipping anything before
 
 	Key   []byte // Current data key on which the iterator is positioned on
 	Value []byte // Current data value on which the iterator is positioned on
@@ -36,6 +37,18 @@ func NewIterator(trie *Trie) *Iterator {
 	}
 }
 
+// NewIteratorFrom creates a new key-value iterator, which skips all the entries
+// with keys ordered before start. An empty start iterates the entire trie.
+func NewIteratorFrom(trie *Trie, start []byte) *Iterator {
+	if len(start) == 0 {
+		return NewIterator(trie)
+	}
+	return &Iterator{
+		nodeIt: NewNodeIterator(trie),
+		start:  compactHexDecode(start),
+	}
+}
+
 // FromNodeIterator creates a new key-value iterator from a node iterator
 func NewIteratorFromNodeIterator(it NodeIterator) *Iterator {
 	return &Iterator{
@@ -45,7 +58,16 @@ func NewIteratorFromNodeIterator(it NodeIterator) *Iterator {
 
 // Next moves the iterator forward one key-value entry.
 func (it *Iterator) Next() bool {
-	for it.nodeIt.Next(true) {
+	for descend := true; it.nodeIt.Next(descend); {
+		// Skip any subtrie entirely before the starting key
+		if it.start != nil {
+			path := it.nodeIt.Path()
+			if n := len(path); n <= len(it.start) && bytes.Compare(path, it.start[:n]) < 0 {
+				descend = false
+				continue
+			}
+			descend = true
+		}
 		if it.nodeIt.Leaf() {
 			it.Key = decodeCompact(it.nodeIt.Path())
 			it.Value = it.nodeIt.LeafBlob()
@@ -17,6 +17,7 @@
 package trie
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -54,6 +55,57 @@ func TestIterator(t *testing.T) {
 	}
 }
 
+// Tests that the key-value iterator can start from an arbitrary position, with
+// all the entries ordered before the starting key skipped.
+func TestIteratorFrom(t *testing.T) {
+	trie := newEmpty()
+
+	var keys [][]byte
+	for i := 0; i < 256; i += 2 {
+		key := common.LeftPadBytes([]byte{byte(i)}, 32)
+		key[0] = byte(i)
+		trie.Update(key, []byte{byte(i)})
+		keys = append(keys, key)
+	}
+	trie.Commit()
+
+	for i := 0; i < 256; i++ {
+		// Construct a starting key which might or might not be present
+		start := common.LeftPadBytes([]byte{byte(i)}, 32)
+		start[0] = byte(i)
+
+		// Ensure exactly the entries at and after the starting key are iterated
+		var found [][]byte
+		for it := NewIteratorFrom(trie, start); it.Next(); {
+			found = append(found, common.CopyBytes(it.Key))
+		}
+		want := keys[(i+1)/2:]
+		if len(found) != len(want) {
+			t.Fatalf("start %x: entry count mismatch: have %d, want %d", start, len(found), len(want))
+		}
+		for j := range found {
+			if !bytes.Equal(found[j], want[j]) {
+				t.Fatalf("start %x, entry %d: key mismatch: have %x, want %x", start, j, found[j], want[j])
+			}
+		}
+	}
+	// Ensure an empty starting key iterates over all the entries
+	for _, start := range [][]byte{nil, {}} {
+		var found [][]byte
+		for it := NewIteratorFrom(trie, start); it.Next(); {
+			found = append(found, common.CopyBytes(it.Key))
+		}
+		if len(found) != len(keys) {
+			t.Fatalf("empty start %#v: entry count mismatch: have %d, want %d", start, len(found), len(keys))
+		}
+		for j := range found {
+			if !bytes.Equal(found[j], keys[j]) {
+				t.Fatalf("empty start %#v, entry %d: key mismatch: have %x, want %x", start, j, found[j], keys[j])
+			}
+		}
+	}
+}
+
 type kv struct {
 	k, v []byte
 	t    bool
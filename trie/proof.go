@@ -22,7 +22,9 @@ import (
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/crypto/sha3"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
 )
@@ -67,7 +69,7 @@ func (t *Trie) Prove(key []byte) []rlp.RawValue {
 			panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
 		}
 	}
-	hasher := newHasher(0, 0)
+	hasher := newHasher(0, 0, false)
 	proof := make([]rlp.RawValue, 0, len(nodes))
 	for i, n := range nodes {
 		// Don't bother checking for errors here since hasher panics
@@ -102,7 +104,7 @@ func VerifyProof(rootHash common.Hash, key []byte, proof []rlp.RawValue) (value
 		if err != nil {
 			return nil, fmt.Errorf("bad proof node %d: %v", i, err)
 		}
-		keyrest, cld := get(n, key)
+		keyrest, cld := get(n, key, true)
 		switch cld := cld.(type) {
 		case nil:
 			if i != len(proof)-1 {
@@ -124,8 +126,416 @@ func VerifyProof(rootHash common.Hash, key []byte, proof []rlp.RawValue) (value
 	return nil, errors.New("unexpected end of proof")
 }
 
-func get(tn node, key []byte) ([]byte, node) {
-	for len(key) > 0 {
+// ProveRange constructs a merkle proof for the key range [first, last]. The
+// result is the union of the proofs of the two edge keys, either of which may
+// be a proof of absence. Together with the leaves in between, it can be used
+// to verify the range against the root with VerifyRangeProof.
+func (t *Trie) ProveRange(first, last []byte) []rlp.RawValue {
+	proof := t.Prove(first)
+	if proof == nil {
+		return nil
+	}
+	seen := make(map[string]struct{})
+	for _, node := range proof {
+		seen[string(node)] = struct{}{}
+	}
+	right := t.Prove(last)
+	if right == nil {
+		return nil
+	}
+	for _, node := range right {
+		if _, ok := seen[string(node)]; !ok {
+			seen[string(node)] = struct{}{}
+			proof = append(proof, node)
+		}
+	}
+	return proof
+}
+
+// VerifyRangeProof checks whether the given leaf nodes and edge proof can prove
+// that the keys/values are exactly the contents of the trie with the given root
+// in the range [firstKey, lastKey]: no leaf inside the range may be missing and
+// no extra leaf may be injected.
+//
+// The edge proof may prove the existence or the absence of the edge keys. There
+// are a few special cases besides the common one:
+//
+//   - If the proof is nil, the key/value pairs must be the entire leaf set of
+//     the trie, which is then rebuilt from scratch and compared to the root.
+//   - If there are no key/value pairs, the proof must show that there are no
+//     leaves in the trie at or after firstKey.
+//   - If there is a single key/value pair and firstKey equals lastKey, the
+//     proof is a plain single key proof of it.
+//
+// The returned flag reports whether there are more leaves in the trie after the
+// verified range.
+func VerifyRangeProof(rootHash common.Hash, firstKey, lastKey []byte, keys, values [][]byte, proof []rlp.RawValue) (bool, error) {
+	if len(keys) != len(values) {
+		return false, fmt.Errorf("inconsistent proof data, keys: %d, values: %d", len(keys), len(values))
+	}
+	// Ensure the received batch is monotonically increasing and contains no deletions
+	for i := 0; i < len(keys)-1; i++ {
+		if bytes.Compare(keys[i], keys[i+1]) >= 0 {
+			return false, errors.New("range is not monotonically increasing")
+		}
+	}
+	for _, value := range values {
+		if len(value) == 0 {
+			return false, errors.New("range contains deletion")
+		}
+	}
+	// Special case, there is no edge proof at all: the given range is expected
+	// to be the whole leaf set in the trie.
+	if proof == nil {
+		tr := new(Trie)
+		for i, key := range keys {
+			tr.Update(key, values[i])
+		}
+		if have := tr.Hash(); have != rootHash {
+			return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+		}
+		return false, nil
+	}
+	if len(keys) > 0 {
+		if bytes.Compare(firstKey, keys[0]) > 0 || bytes.Compare(keys[len(keys)-1], lastKey) > 0 {
+			return false, errors.New("range exceeds edge keys")
+		}
+	}
+	nodes := make(map[common.Hash][]byte)
+	for _, node := range proof {
+		nodes[crypto.Keccak256Hash(node)] = node
+	}
+	// Special case, there is an edge proof but no key/value pairs, ensure there
+	// are no more leaves in the trie.
+	if len(keys) == 0 {
+		root, val, err := proofToPath(rootHash, nil, firstKey, nodes, true)
+		if err != nil {
+			return false, err
+		}
+		if val != nil || hasRightElement(root, firstKey) {
+			return false, errors.New("more entries available")
+		}
+		return false, nil
+	}
+	// Special case, there is a single element and the two edge keys are the same,
+	// so two distinct edge paths cannot be constructed.
+	if len(keys) == 1 && bytes.Equal(firstKey, lastKey) {
+		root, val, err := proofToPath(rootHash, nil, firstKey, nodes, false)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(firstKey, keys[0]) {
+			return false, errors.New("correct proof but invalid key")
+		}
+		if !bytes.Equal(val, values[0]) {
+			return false, errors.New("correct proof but invalid data")
+		}
+		return hasRightElement(root, firstKey), nil
+	}
+	// In all other cases two distinct edge paths are required.
+	if bytes.Compare(firstKey, lastKey) >= 0 {
+		return false, errors.New("invalid edge keys")
+	}
+	if len(firstKey) != len(lastKey) {
+		return false, errors.New("inconsistent edge keys")
+	}
+	// Convert the edge proofs into edge paths of a partial trie, which then
+	// has the same shape as the original one. Both edges may be proofs of absence.
+	root, _, err := proofToPath(rootHash, nil, firstKey, nodes, true)
+	if err != nil {
+		return false, err
+	}
+	root, _, err = proofToPath(rootHash, root, lastKey, nodes, true)
+	if err != nil {
+		return false, err
+	}
+	// Remove all references between the two edge paths. The removed parts must
+	// be reconstructed by the given leaves.
+	empty, err := unsetInternal(root, firstKey, lastKey)
+	if err != nil {
+		return false, err
+	}
+	db, _ := ethdb.NewMemDatabase()
+	tr := &Trie{root: root, db: db}
+	if empty {
+		tr.root = nil
+	}
+	for i, key := range keys {
+		if err := tr.TryUpdate(key, values[i]); err != nil {
+			return false, fmt.Errorf("invalid proof: %v", err)
+		}
+	}
+	if have := tr.Hash(); have != rootHash {
+		return false, fmt.Errorf("invalid proof, want hash %x, got %x", rootHash, have)
+	}
+	return hasRightElement(tr.root, keys[len(keys)-1]), nil
+}
+
+// proofToPath converts a merkle proof into a trie node path, resolving all the
+// nodes on the path to key from the proof and leaving the rest as hash nodes.
+// If root is non-nil, the path is merged into the existing partial trie.
+//
+// If allowNonExistent is set, the proof may be a proof of absence of key.
+func proofToPath(rootHash common.Hash, root node, key []byte, proof map[common.Hash][]byte, allowNonExistent bool) (node, []byte, error) {
+	// resolveNode retrieves and decodes a trie node from the proof
+	resolveNode := func(hash common.Hash) (node, error) {
+		buf, ok := proof[hash]
+		if !ok {
+			return nil, fmt.Errorf("proof node (hash %064x) missing", hash)
+		}
+		n, err := decodeNode(hash[:], buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %v", err)
+		}
+		return n, nil
+	}
+	// The root node must always be included in the proof
+	if root == nil {
+		n, err := resolveNode(rootHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		root = n
+	}
+	var (
+		err           error
+		child, parent node
+		keyrest       []byte
+		valnode       []byte
+	)
+	key, parent = compactHexDecode(key), root
+	for {
+		keyrest, child = get(parent, key, false)
+		switch cld := child.(type) {
+		case nil:
+			// The trie doesn't contain the key. All resolved nodes are proven
+			// correct though, which is enough for proving a range.
+			if allowNonExistent {
+				return root, nil, nil
+			}
+			return nil, nil, errors.New("the node is not contained in trie")
+		case *shortNode, *fullNode:
+			// Already resolved
+			key, parent = keyrest, child
+			continue
+		case hashNode:
+			child, err = resolveNode(common.BytesToHash(cld))
+			if err != nil {
+				return nil, nil, err
+			}
+		case valueNode:
+			valnode = cld
+		}
+		// Link the resolved child into its parent
+		switch pnode := parent.(type) {
+		case *shortNode:
+			pnode.Val = child
+		case *fullNode:
+			pnode.Children[key[0]] = child
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", pnode, pnode))
+		}
+		if len(valnode) > 0 {
+			return root, valnode, nil
+		}
+		key, parent = keyrest, child
+	}
+}
+
+// unsetInternal removes all node references (hash nodes and embedded nodes)
+// strictly between the two edge paths of a partial trie built by proofToPath.
+// Every node touched is marked dirty, since its content may change. Some full
+// nodes may be left with a single child, which is invalid on its own, but for
+// a valid proof the given leaves fill them up again.
+//
+// The edge keys must be different, the same length and left must be smaller.
+// The returned flag reports whether the whole trie was unset.
+func unsetInternal(n node, left []byte, right []byte) (bool, error) {
+	left, right = compactHexDecode(left), compactHexDecode(right)
+
+	// Step down to the fork point of the two paths. It is either a short node
+	// whose key doesn't match one of the edge paths, or a full node where the
+	// edge paths diverge (either of them possibly ending in a missing child).
+	var (
+		pos    = 0
+		parent node
+
+		// Fork indicators: 0 means no fork, -1 the path is smaller, 1 the path is larger
+		shortForkLeft, shortForkRight int
+	)
+findFork:
+	for {
+		switch rn := n.(type) {
+		case *shortNode:
+			rn.flags = nodeFlag{dirty: true}
+
+			if len(left)-pos < len(rn.Key) {
+				shortForkLeft = bytes.Compare(left[pos:], rn.Key)
+			} else {
+				shortForkLeft = bytes.Compare(left[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if len(right)-pos < len(rn.Key) {
+				shortForkRight = bytes.Compare(right[pos:], rn.Key)
+			} else {
+				shortForkRight = bytes.Compare(right[pos:pos+len(rn.Key)], rn.Key)
+			}
+			if shortForkLeft != 0 || shortForkRight != 0 {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Val, pos+len(rn.Key)
+		case *fullNode:
+			rn.flags = nodeFlag{dirty: true}
+
+			leftnode, rightnode := rn.Children[left[pos]], rn.Children[right[pos]]
+			if leftnode == nil || rightnode == nil || left[pos] != right[pos] {
+				break findFork
+			}
+			parent = n
+			n, pos = rn.Children[left[pos]], pos+1
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+		}
+	}
+	switch rn := n.(type) {
+	case *shortNode:
+		// Both edges smaller or both larger than the short node means the
+		// range is empty, which contradicts the given leaves.
+		if shortForkLeft == -1 && shortForkRight == -1 {
+			return false, errors.New("empty range")
+		}
+		if shortForkLeft == 1 && shortForkRight == 1 {
+			return false, errors.New("empty range")
+		}
+		// The short node lies completely within the range, unset it entirely
+		if shortForkLeft != 0 && shortForkRight != 0 {
+			if parent == nil {
+				return true, nil
+			}
+			parent.(*fullNode).Children[left[pos-1]] = nil
+			return false, nil
+		}
+		// Only the right edge deviates from the short node, it is larger
+		if shortForkRight != 0 {
+			if _, ok := rn.Val.(valueNode); ok {
+				if parent == nil {
+					return true, nil
+				}
+				parent.(*fullNode).Children[left[pos-1]] = nil
+				return false, nil
+			}
+			return false, unset(rn, rn.Val, left[pos:], len(rn.Key), false)
+		}
+		// Only the left edge deviates from the short node, it is smaller
+		if shortForkLeft != 0 {
+			if _, ok := rn.Val.(valueNode); ok {
+				if parent == nil {
+					return true, nil
+				}
+				parent.(*fullNode).Children[right[pos-1]] = nil
+				return false, nil
+			}
+			return false, unset(rn, rn.Val, right[pos:], len(rn.Key), true)
+		}
+		return false, nil
+	case *fullNode:
+		// Unset all children between the two edge paths
+		for i := left[pos] + 1; i < right[pos]; i++ {
+			rn.Children[i] = nil
+		}
+		if err := unset(rn, rn.Children[left[pos]], left[pos:], 1, false); err != nil {
+			return false, err
+		}
+		if err := unset(rn, rn.Children[right[pos]], right[pos:], 1, true); err != nil {
+			return false, err
+		}
+		return false, nil
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+	}
+}
+
+// unset removes all node references on one side of the given path: the right
+// side of the left edge path, or the left side (removeLeft) of the right edge
+// path. If the path doesn't exist in the trie and ends in a short node, that
+// node is dropped if it falls within the range and kept otherwise.
+func unset(parent node, child node, key []byte, pos int, removeLeft bool) error {
+	switch cld := child.(type) {
+	case *fullNode:
+		if removeLeft {
+			for i := 0; i < int(key[pos]); i++ {
+				cld.Children[i] = nil
+			}
+		} else {
+			for i := key[pos] + 1; i < 16; i++ {
+				cld.Children[i] = nil
+			}
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Children[key[pos]], key, pos+1, removeLeft)
+	case *shortNode:
+		if len(key[pos:]) < len(cld.Key) || !bytes.Equal(cld.Key, key[pos:pos+len(cld.Key)]) {
+			// The path forks off at this short node, so it's a non-existent
+			// branch. Drop the short node if it falls within the range.
+			if removeLeft {
+				if bytes.Compare(cld.Key, key[pos:]) < 0 {
+					parent.(*fullNode).Children[key[pos-1]] = nil
+				}
+			} else {
+				if bytes.Compare(cld.Key, key[pos:]) > 0 {
+					parent.(*fullNode).Children[key[pos-1]] = nil
+				}
+			}
+			return nil
+		}
+		if _, ok := cld.Val.(valueNode); ok {
+			parent.(*fullNode).Children[key[pos-1]] = nil
+			return nil
+		}
+		cld.flags = nodeFlag{dirty: true}
+		return unset(cld, cld.Val, key, pos+len(cld.Key), removeLeft)
+	case nil:
+		// A missing child of the fork point full node, nothing to unset
+		return nil
+	default:
+		// Hash and value nodes can't be reached on a resolved edge path
+		return fmt.Errorf("%T: invalid node on edge path: %v", child, child)
+	}
+}
+
+// hasRightElement reports whether there are any leaves to the right of the
+// given path, which may point to an existent or non-existent key. The whole
+// path must already be resolved.
+func hasRightElement(node node, key []byte) bool {
+	pos, key := 0, compactHexDecode(key)
+	for node != nil {
+		switch rn := node.(type) {
+		case *fullNode:
+			for i := key[pos] + 1; i < 16; i++ {
+				if rn.Children[i] != nil {
+					return true
+				}
+			}
+			node, pos = rn.Children[key[pos]], pos+1
+		case *shortNode:
+			if len(key)-pos < len(rn.Key) || !bytes.Equal(rn.Key, key[pos:pos+len(rn.Key)]) {
+				return bytes.Compare(rn.Key, key[pos:]) > 0
+			}
+			node, pos = rn.Val, pos+len(rn.Key)
+		case valueNode:
+			return false
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", node, node))
+		}
+	}
+	return false
+}
+
+// get walks down the trie along key starting at tn. If skipResolved is set,
+// it steps over all resolved nodes and stops at the first hash node, value
+// node or missing child; otherwise it only takes a single step.
+func get(tn node, key []byte, skipResolved bool) ([]byte, node) {
+	for {
 		switch n := tn.(type) {
 		case *shortNode:
 			if len(key) < len(n.Key) || !bytes.Equal(n.Key, key[:len(n.Key)]) {
@@ -133,16 +543,23 @@ func get(tn node, key []byte) ([]byte, node) {
 			}
 			tn = n.Val
 			key = key[len(n.Key):]
+			if !skipResolved {
+				return key, tn
+			}
 		case *fullNode:
 			tn = n.Children[key[0]]
 			key = key[1:]
+			if !skipResolved {
+				return key, tn
+			}
 		case hashNode:
 			return key, n
 		case nil:
 			return key, nil
+		case valueNode:
+			return nil, n
 		default:
 			panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
 		}
 	}
-	return nil, tn.(valueNode)
 }
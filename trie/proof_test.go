@@ -20,6 +20,7 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	mrand "math/rand"
+	"sort"
 	"testing"
 	"time"
 
@@ -153,3 +154,432 @@ func randBytes(n int) []byte {
 	crand.Read(r)
 	return r
 }
+
+type entrySlice []*kv
+
+func (p entrySlice) Len() int           { return len(p) }
+func (p entrySlice) Less(i, j int) bool { return bytes.Compare(p[i].k, p[j].k) < 0 }
+func (p entrySlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// randomSortedTrie creates a random trie and returns its leaves sorted by key.
+func randomSortedTrie(n int) (*Trie, entrySlice) {
+	trie, vals := randomTrie(n)
+
+	var entries entrySlice
+	for _, kv := range vals {
+		entries = append(entries, kv)
+	}
+	sort.Sort(entries)
+	return trie, entries
+}
+
+// rangeData splits the given leaves into separate key and value slices.
+func rangeData(entries entrySlice) ([][]byte, [][]byte) {
+	keys := make([][]byte, 0, len(entries))
+	vals := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		keys = append(keys, entry.k)
+		vals = append(vals, entry.v)
+	}
+	return keys, vals
+}
+
+// increaseKey returns the key incremented by one, treated as a big endian number.
+func increaseKey(key []byte) []byte {
+	key = common.CopyBytes(key)
+	for i := len(key) - 1; i >= 0; i-- {
+		key[i]++
+		if key[i] != 0x0 {
+			break
+		}
+	}
+	return key
+}
+
+// decreaseKey returns the key decremented by one, treated as a big endian number.
+func decreaseKey(key []byte) []byte {
+	key = common.CopyBytes(key)
+	for i := len(key) - 1; i >= 0; i-- {
+		key[i]--
+		if key[i] != 0xff {
+			break
+		}
+	}
+	return key
+}
+
+// Tests that range proofs of random ranges with existent edge keys verify and
+// correctly report whether there are more leaves to the right.
+func TestRangeProof(t *testing.T) {
+	trie, entries := randomSortedTrie(4096)
+	root := trie.Hash()
+
+	for i := 0; i < 200; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+
+		proof := trie.ProveRange(entries[start].k, entries[end-1].k)
+		keys, vals := rangeData(entries[start:end])
+		more, err := VerifyRangeProof(root, keys[0], keys[len(keys)-1], keys, vals, proof)
+		if err != nil {
+			t.Fatalf("range [%d, %d): verification failed: %v", start, end, err)
+		}
+		if more != (end < len(entries)) {
+			t.Fatalf("range [%d, %d): more elements mismatch: have %v, want %v", start, end, more, end < len(entries))
+		}
+	}
+}
+
+// Tests that range proofs verify if the edge keys are not in the trie, as long
+// as the leaves in between are complete.
+func TestRangeProofWithNonExistentProof(t *testing.T) {
+	trie, entries := randomSortedTrie(4096)
+	root := trie.Hash()
+
+	for i := 0; i < 200; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+
+		first := decreaseKey(entries[start].k)
+		if start != 0 && bytes.Equal(first, entries[start-1].k) {
+			continue
+		}
+		last := increaseKey(entries[end-1].k)
+		if end != len(entries) && bytes.Equal(last, entries[end].k) {
+			continue
+		}
+		proof := trie.ProveRange(first, last)
+		keys, vals := rangeData(entries[start:end])
+		if _, err := VerifyRangeProof(root, first, last, keys, vals, proof); err != nil {
+			t.Fatalf("range [%d, %d): verification failed: %v", start, end, err)
+		}
+	}
+	// Special case, the edge keys are the smallest and largest possible keys
+	first := common.Hash{}.Bytes()
+	last := bytes.Repeat([]byte{0xff}, 32)
+	proof := trie.ProveRange(first, last)
+	keys, vals := rangeData(entries)
+	more, err := VerifyRangeProof(root, first, last, keys, vals, proof)
+	if err != nil {
+		t.Fatalf("full range verification failed: %v", err)
+	}
+	if more {
+		t.Fatal("more elements reported after the full range")
+	}
+}
+
+// Tests that range proofs with non-existent edge keys are rejected if a leaf
+// between an edge key and the first or last given leaf is omitted.
+func TestRangeProofWithInvalidNonExistentProof(t *testing.T) {
+	trie, entries := randomSortedTrie(4096)
+	root := trie.Hash()
+
+	// The leaf right after the left edge key is missing
+	start, end := 100, 200
+	first := decreaseKey(entries[start].k)
+	last := increaseKey(entries[end-1].k)
+
+	proof := trie.ProveRange(first, last)
+	keys, vals := rangeData(entries[start+1 : end])
+	if _, err := VerifyRangeProof(root, first, last, keys, vals, proof); err == nil {
+		t.Fatal("expected error for a missing left leaf")
+	}
+	// The leaf right before the right edge key is missing
+	keys, vals = rangeData(entries[start : end-1])
+	if _, err := VerifyRangeProof(root, first, last, keys, vals, proof); err == nil {
+		t.Fatal("expected error for a missing right leaf")
+	}
+}
+
+// Tests that range proofs of a single leaf verify, both with the same and with
+// distinct (non-existent) edge keys.
+func TestOneElementRangeProof(t *testing.T) {
+	trie, entries := randomSortedTrie(4096)
+	root := trie.Hash()
+
+	start := 1000
+	keys, vals := rangeData(entries[start : start+1])
+
+	// One element with the same existent edge keys
+	proof := trie.ProveRange(keys[0], keys[0])
+	if _, err := VerifyRangeProof(root, keys[0], keys[0], keys, vals, proof); err != nil {
+		t.Fatalf("same edge keys: %v", err)
+	}
+	// One element with a non-existent left edge key
+	first := decreaseKey(keys[0])
+	proof = trie.ProveRange(first, keys[0])
+	if _, err := VerifyRangeProof(root, first, keys[0], keys, vals, proof); err != nil {
+		t.Fatalf("non-existent left edge: %v", err)
+	}
+	// One element with a non-existent right edge key
+	last := increaseKey(keys[0])
+	proof = trie.ProveRange(keys[0], last)
+	if _, err := VerifyRangeProof(root, keys[0], last, keys, vals, proof); err != nil {
+		t.Fatalf("non-existent right edge: %v", err)
+	}
+	// One element with two non-existent edge keys
+	proof = trie.ProveRange(first, last)
+	if _, err := VerifyRangeProof(root, first, last, keys, vals, proof); err != nil {
+		t.Fatalf("non-existent edges: %v", err)
+	}
+	// A trie with a single leaf, proven with the full key range
+	tinyTrie := new(Trie)
+	entry := &kv{randBytes(32), randBytes(20), false}
+	tinyTrie.Update(entry.k, entry.v)
+
+	first = common.Hash{}.Bytes()
+	last = bytes.Repeat([]byte{0xff}, 32)
+	proof = tinyTrie.ProveRange(first, last)
+	more, err := VerifyRangeProof(tinyTrie.Hash(), first, last, [][]byte{entry.k}, [][]byte{entry.v}, proof)
+	if err != nil {
+		t.Fatalf("single leaf trie: %v", err)
+	}
+	if more {
+		t.Fatal("more elements reported in a single leaf trie")
+	}
+}
+
+// Tests that the entire leaf set of a trie verifies both with and without an
+// edge proof.
+func TestAllElementsProof(t *testing.T) {
+	trie, entries := randomSortedTrie(4096)
+	root := trie.Hash()
+	keys, vals := rangeData(entries)
+
+	if _, err := VerifyRangeProof(root, nil, nil, keys, vals, nil); err != nil {
+		t.Fatalf("without proof: %v", err)
+	}
+	proof := trie.ProveRange(keys[0], keys[len(keys)-1])
+	if _, err := VerifyRangeProof(root, keys[0], keys[len(keys)-1], keys, vals, proof); err != nil {
+		t.Fatalf("with existent edge proof: %v", err)
+	}
+	// Without a proof, a single missing leaf must be detected
+	if _, err := VerifyRangeProof(root, nil, nil, keys[1:], vals[1:], nil); err == nil {
+		t.Fatal("expected error for an incomplete leaf set without proof")
+	}
+}
+
+// Tests that ranges anchored at the smallest possible key, or ending at the
+// largest possible key, verify.
+func TestSingleSideRangeProof(t *testing.T) {
+	for i := 0; i < 16; i++ {
+		trie, entries := randomSortedTrie(mrand.Intn(1024) + 1)
+		root := trie.Hash()
+
+		for _, pos := range []int{0, 1, 5, 50, 100, 500, 1000, len(entries) - 1} {
+			if pos >= len(entries) {
+				continue
+			}
+			first := common.Hash{}.Bytes()
+			proof := trie.ProveRange(first, entries[pos].k)
+			keys, vals := rangeData(entries[:pos+1])
+			if _, err := VerifyRangeProof(root, first, keys[len(keys)-1], keys, vals, proof); err != nil {
+				t.Fatalf("left side range up to %d: %v", pos, err)
+			}
+			last := bytes.Repeat([]byte{0xff}, 32)
+			proof = trie.ProveRange(entries[pos].k, last)
+			keys, vals = rangeData(entries[pos:])
+			more, err := VerifyRangeProof(root, keys[0], last, keys, vals, proof)
+			if err != nil {
+				t.Fatalf("right side range from %d: %v", pos, err)
+			}
+			if more {
+				t.Fatalf("right side range from %d: more elements reported", pos)
+			}
+		}
+	}
+}
+
+// Tests that tampered range data is always rejected.
+func TestBadRangeProof(t *testing.T) {
+	trie, entries := randomSortedTrie(4096)
+	root := trie.Hash()
+
+	for i := 0; i < 200; i++ {
+		start := mrand.Intn(len(entries))
+		end := mrand.Intn(len(entries)-start) + start + 1
+		proof := trie.ProveRange(entries[start].k, entries[end-1].k)
+
+		keys, vals := rangeData(entries[start:end])
+		first, last := keys[0], keys[len(keys)-1]
+
+		var index int
+		switch mrand.Intn(6) {
+		case 0:
+			// Modified key
+			index = mrand.Intn(end - start)
+			keys[index] = randBytes(32)
+		case 1:
+			// Modified value
+			index = mrand.Intn(end - start)
+			vals[index] = randBytes(20)
+		case 2:
+			// Gapped entry slice
+			index = mrand.Intn(end - start)
+			keys = append(keys[:index], keys[index+1:]...)
+			vals = append(vals[:index], vals[index+1:]...)
+		case 3:
+			// Out of order
+			index1 := mrand.Intn(end - start)
+			index2 := mrand.Intn(end - start)
+			if index1 == index2 {
+				continue
+			}
+			keys[index1], keys[index2] = keys[index2], keys[index1]
+			vals[index1], vals[index2] = vals[index2], vals[index1]
+		case 4:
+			// Set random key to nil, do nothing
+			index = mrand.Intn(end - start)
+			keys[index] = nil
+		case 5:
+			// Set random value to nil, deletion
+			index = mrand.Intn(end - start)
+			vals[index] = nil
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		if _, err := VerifyRangeProof(root, first, last, keys, vals, proof); err == nil {
+			t.Fatalf("%d: expected error for tampered range [%d, %d)", i, start, end)
+		}
+	}
+}
+
+// Tests that tampered edge proofs are always rejected.
+func TestBadRangeProofNodes(t *testing.T) {
+	trie, entries := randomSortedTrie(800)
+	root := trie.Hash()
+
+	for i := 0; i < 200; i++ {
+		start := mrand.Intn(len(entries) - 1)
+		end := mrand.Intn(len(entries)-start-1) + start + 2
+
+		proof := trie.ProveRange(entries[start].k, entries[end-1].k)
+		mutateByte(proof[mrand.Intn(len(proof))])
+
+		keys, vals := rangeData(entries[start:end])
+		if _, err := VerifyRangeProof(root, keys[0], keys[len(keys)-1], keys, vals, proof); err == nil {
+			t.Fatalf("%d: expected error for tampered proof of range [%d, %d)", i, start, end)
+		}
+	}
+}
+
+// Tests that a range with a hole in it is rejected, even if both edges are valid.
+func TestGappedRangeProof(t *testing.T) {
+	trie := new(Trie)
+	var entries entrySlice
+	for i := 0; i < 10; i++ {
+		value := &kv{common.LeftPadBytes([]byte{byte(i)}, 32), []byte{byte(i)}, false}
+		trie.Update(value.k, value.v)
+		entries = append(entries, value)
+	}
+	first, last := 2, 8
+	proof := trie.ProveRange(entries[first].k, entries[last-1].k)
+
+	var keys, vals [][]byte
+	for i := first; i < last; i++ {
+		if i == (first+last)/2 {
+			continue
+		}
+		keys = append(keys, entries[i].k)
+		vals = append(vals, entries[i].v)
+	}
+	if _, err := VerifyRangeProof(trie.Hash(), keys[0], keys[len(keys)-1], keys, vals, proof); err == nil {
+		t.Fatal("expected error for gapped range")
+	}
+}
+
+// Tests that empty ranges verify only if there are no leaves at or after the
+// left edge key.
+func TestEmptyRangeProof(t *testing.T) {
+	trie, entries := randomSortedTrie(4096)
+	root := trie.Hash()
+
+	tests := []struct {
+		pos int
+		err bool
+	}{
+		{len(entries) - 1, false},
+		{500, true},
+	}
+	for i, test := range tests {
+		first := increaseKey(entries[test.pos].k)
+		proof := trie.ProveRange(first, first)
+		_, err := VerifyRangeProof(root, first, nil, nil, nil, proof)
+		if test.err && err == nil {
+			t.Fatalf("test %d: expected error", i)
+		}
+		if !test.err && err != nil {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+// Tests that the reported right side availability is correct for all edge cases.
+func TestHasRightElement(t *testing.T) {
+	trie, entries := randomSortedTrie(4096)
+	root := trie.Hash()
+
+	tests := []struct {
+		start   int
+		end     int
+		hasMore bool
+	}{
+		{-1, 1, true}, // single element with non-existent left edge
+		{0, 1, true},  // single element with existent left edge
+		{0, 10, true},
+		{50, 100, true},
+		{50, len(entries), false},               // range reaching the end with existent right edge
+		{len(entries) - 1, len(entries), false}, // single last element
+		{0, len(entries), false},                // entire leaf set
+		{-1, len(entries), false},               // entire leaf set with non-existent left edge
+		{-1, -1, false},                         // entire leaf set with both non-existent edges
+		{50, -1, false},                         // range reaching the end with non-existent right edge
+	}
+	for i, test := range tests {
+		var (
+			first, last []byte
+			start, end  = test.start, test.end
+		)
+		if start == -1 {
+			first, start = common.Hash{}.Bytes(), 0
+		} else {
+			first = entries[start].k
+		}
+		if end == -1 {
+			last, end = bytes.Repeat([]byte{0xff}, 32), len(entries)
+		} else {
+			last = entries[end-1].k
+		}
+		proof := trie.ProveRange(first, last)
+		keys, vals := rangeData(entries[start:end])
+		hasMore, err := VerifyRangeProof(root, first, last, keys, vals, proof)
+		if err != nil {
+			t.Fatalf("test %d: verification failed: %v", i, err)
+		}
+		if hasMore != test.hasMore {
+			t.Fatalf("test %d: more elements mismatch: have %v, want %v", i, hasMore, test.hasMore)
+		}
+	}
+}
+
+func BenchmarkVerifyRangeProof10(b *testing.B)   { benchmarkVerifyRangeProof(b, 10) }
+func BenchmarkVerifyRangeProof100(b *testing.B)  { benchmarkVerifyRangeProof(b, 100) }
+func BenchmarkVerifyRangeProof1000(b *testing.B) { benchmarkVerifyRangeProof(b, 1000) }
+
+func benchmarkVerifyRangeProof(b *testing.B, size int) {
+	trie, entries := randomSortedTrie(8192)
+	root := trie.Hash()
+
+	start := 2
+	end := start + size
+	proof := trie.ProveRange(entries[start].k, entries[end-1].k)
+	keys, vals := rangeData(entries[start:end])
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := VerifyRangeProof(root, keys[0], keys[len(keys)-1], keys, vals, proof); err != nil {
+			b.Fatalf("case %d(%d->%d): %v", i, start, end-1, err)
+		}
+	}
+}
@@ -20,6 +20,7 @@ package trie
 import (
 	"bytes"
 	"fmt"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto/sha3"
@@ -34,6 +35,10 @@ var (
 	emptyState common.Hash
 )
 
+// parallelHashThreshold is the number of key updates since the last hashing
+// above which the root's child subtrees are hashed concurrently.
+const parallelHashThreshold = 100
+
 var (
 	cacheMissCounter   = metrics.NewRegisteredCounter("trie/cachemiss", nil)
 	cacheUnloadCounter = metrics.NewRegisteredCounter("trie/cacheunload", nil)
@@ -76,6 +81,26 @@ type DatabaseWriter interface {
 	Put(key, value []byte) error
 }
 
+// LockedWriter is a database writer serializing concurrent Put calls into an
+// underlying writer, which isn't necessarily thread safe (e.g. batches).
+type LockedWriter struct {
+	db   DatabaseWriter
+	lock sync.Mutex
+}
+
+// NewLockedWriter wraps a database writer to be safe for concurrent use.
+func NewLockedWriter(db DatabaseWriter) *LockedWriter {
+	return &LockedWriter{db: db}
+}
+
+// Put implements DatabaseWriter, forwarding the write under the lock.
+func (w *LockedWriter) Put(key, value []byte) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.db.Put(key, value)
+}
+
 // Trie is a Merkle Patricia Trie.
 // The zero value is an empty trie with no database.
 // Use New to create a trie that sits on top of a database.
@@ -91,6 +116,10 @@ type Trie struct {
 	// new nodes are tagged with the current generation and unloaded
 	// when their generation is older than than cachegen-cachelimit.
 	cachegen, cachelimit uint16
+
+	// Number of key updates since the last hashing, used to decide whether
+	// the hashing is worth parallelizing.
+	unhashed int
 }
 
 // SetCacheLimit sets the number of 'cache generations' to keep.
@@ -211,6 +240,7 @@ func (t *Trie) Update(key, value []byte) {
 //
 // If a node was not found in the database, a MissingNodeError is returned.
 func (t *Trie) TryUpdate(key, value []byte) error {
+	t.unhashed++
 	k := compactHexDecode(key)
 	if len(value) != 0 {
 		_, n, err := t.insert(t.root, nil, k, valueNode(value))
@@ -307,6 +337,7 @@ func (t *Trie) Delete(key []byte) {
 // TryDelete removes any existing value for key from the trie.
 // If a node was not found in the database, a MissingNodeError is returned.
 func (t *Trie) TryDelete(key []byte) error {
+	t.unhashed++
 	k := compactHexDecode(key)
 	_, n, err := t.delete(t.root, nil, k)
 	if err != nil {
@@ -504,7 +535,10 @@ func (t *Trie) hashRoot(db DatabaseWriter) (node, node, error) {
 	if t.root == nil {
 		return hashNode(emptyRoot.Bytes()), nil, nil
 	}
-	h := newHasher(t.cachegen, t.cachelimit)
+	// Only hash concurrently if enough nodes are dirty to outweigh the overhead
+	h := newHasher(t.cachegen, t.cachelimit, t.unhashed >= parallelHashThreshold)
 	defer returnHasherToPool(h)
+
+	t.unhashed = 0
 	return h.hash(t.root, db, true)
 }
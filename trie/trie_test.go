@@ -21,6 +21,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"math/rand"
 	"os"
 	"reflect"
@@ -29,6 +30,7 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 )
 
@@ -512,6 +514,53 @@ func TestRandom(t *testing.T) {
 	}
 }
 
+// Tests that hashing and committing the root's subtrees concurrently produces
+// the same root and database contents as the sequential hasher.
+func TestParallelHashing(t *testing.T) {
+	for _, count := range []int{1, 16, 256, 4096} {
+		seqdb, _ := ethdb.NewMemDatabase()
+		pardb, _ := ethdb.NewMemDatabase()
+
+		seq, par := makeHashTrie(count), makeHashTrie(count)
+
+		seqh := newHasher(0, 0, false)
+		seqRoot, _, err := seqh.hash(seq.root, seqdb, true)
+		returnHasherToPool(seqh)
+		if err != nil {
+			t.Fatalf("%d keys: sequential commit failed: %v", count, err)
+		}
+		parh := newHasher(0, 0, true)
+		parRoot, _, err := parh.hash(par.root, pardb, true)
+		returnHasherToPool(parh)
+		if err != nil {
+			t.Fatalf("%d keys: parallel commit failed: %v", count, err)
+		}
+		if !bytes.Equal(seqRoot.(hashNode), parRoot.(hashNode)) {
+			t.Fatalf("%d keys: root mismatch: sequential %x, parallel %x", count, seqRoot, parRoot)
+		}
+		if len(seqdb.Keys()) != len(pardb.Keys()) {
+			t.Fatalf("%d keys: database size mismatch: sequential %d, parallel %d", count, len(seqdb.Keys()), len(pardb.Keys()))
+		}
+		for _, key := range seqdb.Keys() {
+			want, _ := seqdb.Get(key)
+			if have, _ := pardb.Get(key); !bytes.Equal(have, want) {
+				t.Fatalf("%d keys: node %x mismatch: have %x, want %x", count, key, have, want)
+			}
+		}
+	}
+}
+
+// makeHashTrie creates an in-memory trie with the given number of pseudo-random
+// keys spread across all the root's subtrees.
+func makeHashTrie(count int) *Trie {
+	trie := newEmpty()
+	for i := 0; i < count; i++ {
+		k := crypto.Keccak256(big.NewInt(int64(i)).Bytes())
+		trie.Update(k, k)
+	}
+	return trie
+}
+
 func BenchmarkGet(b *testing.B)      { benchGet(b, false) }
 func BenchmarkGetDB(b *testing.B)    { benchGet(b, true) }
 func BenchmarkUpdateBE(b *testing.B) { benchUpdate(b, binary.BigEndian) }
@@ -519,6 +568,11 @@ func BenchmarkUpdateLE(b *testing.B) { benchUpdate(b, binary.LittleEndian) }
 func BenchmarkHashBE(b *testing.B)   { benchHash(b, binary.BigEndian) }
 func BenchmarkHashLE(b *testing.B)   { benchHash(b, binary.LittleEndian) }
 
+func BenchmarkHashSequential(b *testing.B)   { benchHashDirty(b, false, false) }
+func BenchmarkHashParallel(b *testing.B)     { benchHashDirty(b, true, false) }
+func BenchmarkCommitSequential(b *testing.B) { benchHashDirty(b, false, true) }
+func BenchmarkCommitParallel(b *testing.B)   { benchHashDirty(b, true, true) }
+
 const benchElemCount = 20000
 
 func benchGet(b *testing.B, commit bool) {
@@ -574,6 +628,25 @@ func benchHash(b *testing.B, e binary.ByteOrder) {
 	}
 }
 
+// benchHashDirty measures hashing (or committing) a freshly modified trie with
+// either the sequential or the parallel hasher.
+func benchHashDirty(b *testing.B, parallel bool, commit bool) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		trie := makeHashTrie(benchElemCount)
+		var db DatabaseWriter
+		if commit {
+			db, _ = ethdb.NewMemDatabase()
+		}
+		b.StartTimer()
+
+		h := newHasher(0, 0, parallel)
+		h.hash(trie.root, db, true)
+		returnHasherToPool(h)
+	}
+}
+
 func tempDB() (string, Database) {
 	dir, err := ioutil.TempDir("", "trie-bench")
 	if err != nil {